@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"haystack-lite/internal/config"
+	"haystack-lite/internal/storage"
+)
+
+// runCommand 执行命令行子命令
+func runCommand(cfg *config.Config, args []string) error {
+	switch args[0] {
+	case "snapshot":
+		return snapshotCommand(cfg, args[1:])
+	case "backup":
+		return backupCommand(cfg, args[1:])
+	case "restore":
+		return restoreCommand(cfg, args[1:])
+	case "migrate":
+		return migrateCommand(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+// snapshotCommand 请求运行中的服务创建快照
+func snapshotCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	server := fs.String("server", serverURL(cfg), "服务地址")
+	archive := fs.Bool("archive", false, "打包为 tar.gz")
+	fs.Parse(args)
+
+	url := strings.TrimSuffix(*server, "/") + "/admin/snapshot"
+	if *archive {
+		url += "?archive=true"
+	}
+
+	resp, err := http.Post(url, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		storage.SnapshotManifest
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("snapshot failed: %s", result.Error)
+	}
+
+	fmt.Printf("Snapshot created: %s (%d volumes)\n", result.Path, len(result.Volumes))
+	return nil
+}
+
+// backupCommand 从运行中的服务导出增量备份
+func backupCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	server := fs.String("server", serverURL(cfg), "服务地址")
+	since := fs.Uint64("since", 0, "起始序列号（不含），0 表示全部")
+	out := fs.String("out", "", "输出文件，默认 changes-<since>-<until>.tar.gz")
+	fs.Parse(args)
+
+	resp, err := http.Get(fmt.Sprintf("%s/admin/changes?since=%d", strings.TrimSuffix(*server, "/"), *since))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var result struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return fmt.Errorf("backup failed: %s", result.Error)
+	}
+
+	until := resp.Header.Get("X-Changes-Until")
+	path := *out
+	if path == "" {
+		path = fmt.Sprintf("changes-%d-%s.tar.gz", *since, until)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	fmt.Printf("Backup written: %s (since %d, until %s)\n", path, *since, until)
+	return nil
+}
+
+// restoreCommand 从快照重建数据目录和数据库，并依次应用增量备份，需在服务停止时执行
+func restoreCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	from := fs.String("from", "", "快照目录或 tar.gz 路径")
+	dataDir := fs.String("data", cfg.Storage.DataDir, "恢复到的数据目录")
+	var backups stringList
+	fs.Var(&backups, "apply", "按顺序应用的增量备份，可重复指定")
+	fs.Parse(args)
+
+	if *from == "" && len(backups) == 0 {
+		return fmt.Errorf("-from or -apply is required")
+	}
+	cfg.Storage.DataDir = *dataDir
+
+	if *from != "" {
+		manifest, err := storage.RestoreSnapshot(cfg, *from)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Restored %s to %s (%d volumes, seq %d)\n", manifest.Name, cfg.Storage.DataDir, len(manifest.Volumes), manifest.Seq)
+	}
+
+	if len(backups) == 0 {
+		return nil
+	}
+
+	store, err := storage.NewStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	for _, path := range backups {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		result, err := store.ApplyChanges(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to apply %s: %w", path, err)
+		}
+		fmt.Printf("Applied %s: seq %d..%d, %d files\n", path, result.Since, result.Until, result.Applied)
+	}
+	return nil
+}
+
+// migrateCommand 管理数据库表结构迁移：up 执行未应用的迁移，down 回滚，status 查看状态
+func migrateCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down|status")
+	}
+	if cfg.Database.Type == config.DatabaseBolt {
+		return fmt.Errorf("bolt database has no schema migrations")
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	to := fs.Int("to", 0, "up：迁移到的版本，0 表示最新版本")
+	steps := fs.Int("steps", 1, "down：回滚的迁移个数")
+	fs.Parse(args[1:])
+
+	db, err := storage.ConnectDatabase(cfg.Database.Type, cfg.GetDatabaseDSN())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var states []storage.MigrationState
+	switch action {
+	case "up":
+		states, err = db.MigrateUp(*to)
+	case "down":
+		states, err = db.MigrateDown(*steps)
+	case "status":
+		states, err = db.MigrationStatus()
+	default:
+		return fmt.Errorf("unknown migrate action: %s", action)
+	}
+
+	for _, s := range states {
+		applied := ""
+		if s.AppliedAt > 0 {
+			applied = time.Unix(s.AppliedAt, 0).Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%04d  %-32s  %-8s  %s\n", s.Version, s.Name, s.Status, applied)
+	}
+	if err == nil && action != "status" && len(states) == 0 {
+		fmt.Println("Nothing to migrate")
+	}
+	return err
+}
+
+// stringList 可重复指定的字符串参数
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// serverURL 根据监听地址生成本机访问地址
+func serverURL(cfg *config.Config) string {
+	addr := cfg.Server.Port
+	if strings.HasPrefix(addr, ":") {
+		addr = "127.0.0.1" + addr
+	}
+	return "http://" + addr
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AntiEntropyDigest 返回本节点的 Merkle 摘要
+func (h *Handler) AntiEntropyDigest(c *gin.Context) {
+	buckets, _ := strconv.Atoi(c.Query("buckets"))
+	c.JSON(http.StatusOK, h.node.Digest(buckets))
+}
+
+// AntiEntropyBucket 列出单个桶内的 Needle
+func (h *Handler) AntiEntropyBucket(c *gin.Context) {
+	bucket, err := strconv.Atoi(c.Param("bucket"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket"})
+		return
+	}
+	buckets, _ := strconv.Atoi(c.Query("buckets"))
+	c.JSON(http.StatusOK, h.node.DigestBucket(buckets, bucket))
+}
+
+// AntiEntropyNeedles 导出指定 Needle 及其文件记录（tar.gz），供对端修复
+func (h *Handler) AntiEntropyNeedles(c *gin.Context) {
+	ids := make([]uint64, 0)
+	for _, part := range strings.Split(c.Query("ids"), ",") {
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ids"})
+			return
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids required"})
+		return
+	}
+
+	cs, err := h.node.RepairSet(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=needles-%d.tar.gz", len(cs.Needles)))
+	c.Status(http.StatusOK)
+
+	if err := h.node.WriteChanges(c.Writer, cs); err != nil {
+		// 响应头已发送，只能中断连接
+		log.Printf("Failed to write repair set: %v", err)
+		c.Abort()
+	}
+}
+
+// RunAntiEntropy 与对端比对并修复，dry_run=true 时只报告差异
+func (h *Handler) RunAntiEntropy(c *gin.Context) {
+	buckets, _ := strconv.Atoi(c.Query("buckets"))
+	dryRun := c.Query("dry_run") == "true"
+
+	report, err := h.node.RunAntiEntropy(c.Query("peer"), buckets, dryRun)
+	if err != nil {
+		if report == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, report)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// AntiEntropyReport 返回最近一次比对报告
+func (h *Handler) AntiEntropyReport(c *gin.Context) {
+	report := h.node.AntiEntropyReport()
+	if report == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no anti-entropy run yet"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -24,6 +24,19 @@ func (h *Handler) BatchUpload(c *gin.Context) {
 		return
 	}
 
+	expireTime, err := parseExpireTime(expiresAfter(c, true))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 元数据和标签应用到本批所有文件
+	userMeta, tags, err := uploadAttributes(c, true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	results := make([]map[string]interface{}, 0, len(files))
 	errors := make([]map[string]interface{}, 0)
 
@@ -52,7 +65,14 @@ func (h *Handler) BatchUpload(c *gin.Context) {
 			mimeType = "application/octet-stream"
 		}
 
-		id, err := h.store.WriteWithMetadata(data, file.Filename, mimeType)
+		id, err := h.store.WriteWithOptions(data, storage.WriteOptions{
+			FileName:   file.Filename,
+			MimeType:   mimeType,
+			ExpireTime: expireTime,
+			Tenant:     tenantOf(c),
+			UserMeta:   userMeta,
+			Tags:       tags,
+		})
 		if err != nil {
 			errors = append(errors, map[string]interface{}{
 				"filename": file.Filename,
@@ -188,8 +208,12 @@ func (h *Handler) GetFileInfo(c *gin.Context) {
 		"size":        metadata.Size,
 		"mime_type":   metadata.MimeType,
 		"md5":         metadata.MD5,
+		"sha256":      metadata.SHA256,
 		"deleted":     metadata.Deleted,
 		"create_time": metadata.CreateTime,
+		"expire_time": metadata.ExpireTime,
 		"update_time": metadata.UpdateTime,
+		"metadata":    attributesJSON(metadata.UserMeta),
+		"tags":        attributesJSON(metadata.Tags),
 	})
 }
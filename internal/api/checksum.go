@@ -0,0 +1,153 @@
+package api
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errInvalidDigest = errors.New("invalid digest header")
+	errBadDigest     = errors.New("content does not match supplied digest")
+)
+
+// 原始请求体上传时校验的摘要头，同名头可以出现多次
+var checksumHeaders = []string{"Content-MD5", "x-amz-checksum-sha256", "Digest"}
+
+// verifyChecksums 校验客户端提供的 Content-MD5、x-amz-checksum-sha256 和 Digest 头
+// 未提供任何摘要时直接通过
+func verifyChecksums(header http.Header, data []byte) error {
+	var md5Sum, sha256Sum []byte
+	md5Of := func() []byte {
+		if md5Sum == nil {
+			sum := md5.Sum(data)
+			md5Sum = sum[:]
+		}
+		return md5Sum
+	}
+	sha256Of := func() []byte {
+		if sha256Sum == nil {
+			sum := sha256.Sum256(data)
+			sha256Sum = sum[:]
+		}
+		return sha256Sum
+	}
+
+	for _, v := range header.Values("Content-MD5") {
+		if err := compareDigest(v, md5.Size, md5Of()); err != nil {
+			return fmt.Errorf("Content-MD5: %w", err)
+		}
+	}
+
+	for _, v := range header.Values("x-amz-checksum-sha256") {
+		if err := compareDigest(v, sha256.Size, sha256Of()); err != nil {
+			return fmt.Errorf("x-amz-checksum-sha256: %w", err)
+		}
+	}
+
+	// Digest: sha-256=<base64>, md5=<base64>（RFC 3230），不认识的算法忽略
+	for _, v := range header.Values("Digest") {
+		for _, part := range strings.Split(v, ",") {
+			alg, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if !ok {
+				return fmt.Errorf("Digest: %w", errInvalidDigest)
+			}
+
+			var err error
+			switch strings.ToLower(alg) {
+			case "md5":
+				err = compareDigest(value, md5.Size, md5Of())
+			case "sha-256":
+				err = compareDigest(value, sha256.Size, sha256Of())
+			}
+			if err != nil {
+				return fmt.Errorf("Digest %s: %w", alg, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// formChecksums 返回表单上传中文件部分的摘要，格式与 verifyChecksums 使用的请求头相同
+// 请求级的 Content-MD5、Digest 描述整个 multipart 请求体，不能用于校验文件；
+// 这里只读取文件部分自身的头，以及十六进制的表单字段 md5、sha256
+func formChecksums(c *gin.Context, file *multipart.FileHeader) (http.Header, error) {
+	header := make(http.Header)
+	for _, name := range checksumHeaders {
+		for _, v := range file.Header.Values(name) {
+			header.Add(name, v)
+		}
+	}
+
+	fields := []struct{ field, header string }{
+		{"md5", "Content-MD5"},
+		{"sha256", "x-amz-checksum-sha256"},
+	}
+	for _, f := range fields {
+		v := c.PostForm(f.field)
+		if v == "" {
+			continue
+		}
+		raw, err := hex.DecodeString(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.field, errInvalidDigest)
+		}
+		header.Add(f.header, base64.StdEncoding.EncodeToString(raw))
+	}
+	return header, nil
+}
+
+func compareDigest(encoded string, size int, actual []byte) error {
+	expected, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(expected) != size {
+		return errInvalidDigest
+	}
+	if string(expected) != string(actual) {
+		return errBadDigest
+	}
+	return nil
+}
+
+// hexToBase64 将十六进制摘要转换为 HTTP 头使用的 Base64 形式
+func hexToBase64(h string) string {
+	raw, err := hex.DecodeString(h)
+	if err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// GetFileDigest 获取文件存储的摘要，供下游系统做端到端校验
+func (h *Handler) GetFileDigest(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	metadata, err := h.store.GetMetadata(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":            metadata.ID,
+		"size":          metadata.Size,
+		"md5":           metadata.MD5,
+		"md5_base64":    hexToBase64(metadata.MD5),
+		"sha256":        metadata.SHA256,
+		"sha256_base64": hexToBase64(metadata.SHA256),
+	})
+}
@@ -12,12 +12,12 @@ import (
 
 // ChunkHandler 分片上传处理器
 type ChunkHandler struct {
-	store   *storage.Store
+	store   storage.ObjectStore
 	manager *storage.ChunkManager
 }
 
 // NewChunkHandler 创建分片上传处理器
-func NewChunkHandler(store *storage.Store, tempDir string) *ChunkHandler {
+func NewChunkHandler(store storage.ObjectStore, tempDir string) *ChunkHandler {
 	return &ChunkHandler{
 		store:   store,
 		manager: storage.NewChunkManager(tempDir),
@@ -119,6 +119,18 @@ func (h *ChunkHandler) CompleteChunkUpload(c *gin.Context) {
 		return
 	}
 
+	expireTime, err := parseExpireTime(expiresAfter(c, false))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userMeta, tags, err := uploadAttributes(c, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 合并分片
 	data, filename, err := h.manager.MergeChunks(uploadID)
 	if err != nil {
@@ -127,7 +139,18 @@ func (h *ChunkHandler) CompleteChunkUpload(c *gin.Context) {
 	}
 
 	// 保存文件
-	id, err := h.store.WriteWithMetadata(data, filename, "application/octet-stream")
+	id, err := h.store.WriteWithOptions(data, storage.WriteOptions{
+		FileName:   filename,
+		MimeType:   "application/octet-stream",
+		ExpireTime: expireTime,
+		Tenant:     tenantOf(c),
+		UserMeta:   userMeta,
+		Tags:       tags,
+	})
+	if err == storage.ErrQuotaExceeded {
+		quotaExceeded(c)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"haystack-lite/internal/cluster"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DirectoryHandler 目录服务接口
+type DirectoryHandler struct {
+	dir       *cluster.Directory
+	client    *http.Client
+	startTime time.Time
+}
+
+func NewDirectoryHandler(dir *cluster.Directory) *DirectoryHandler {
+	return &DirectoryHandler{
+		dir:       dir,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+		startTime: time.Now(),
+	}
+}
+
+// Heartbeat 接收存储节点的注册和心跳
+func (h *DirectoryHandler) Heartbeat(c *gin.Context) {
+	var hb cluster.Heartbeat
+	if err := c.ShouldBindJSON(&hb); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid heartbeat"})
+		return
+	}
+
+	node, err := h.dir.Heartbeat(&hb)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, node)
+}
+
+// Assign 分配文件 ID 和写入节点，count 为连续分配的 ID 数，size 为预计写入字节数
+func (h *DirectoryHandler) Assign(c *gin.Context) {
+	count, _ := strconv.Atoi(c.DefaultQuery("count", "1"))
+	size, _ := strconv.ParseInt(c.DefaultQuery("size", "0"), 10, 64)
+	if count <= 0 || count > 1000 || size < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid count or size"})
+		return
+	}
+
+	assignment, err := h.dir.Assign(count, size)
+	if err == cluster.ErrNoWritableNode {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, assignment)
+}
+
+// Lookup 查询逻辑 Volume 所在的存储节点，参数为 volume_id 或 fid
+func (h *DirectoryHandler) Lookup(c *gin.Context) {
+	var volumeID uint32
+	if fid := c.Query("fid"); fid != "" {
+		vid, _, err := cluster.ParseFID(fid)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		volumeID = vid
+	} else {
+		vid, err := strconv.ParseUint(c.Query("volume_id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid volume_id"})
+			return
+		}
+		volumeID = uint32(vid)
+	}
+
+	node, err := h.dir.Lookup(volumeID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"volume_id": volumeID,
+		"node_id":   node.ID,
+		"url":       node.URL,
+		"alive":     node.Alive,
+	})
+}
+
+// Nodes 列出存储节点
+func (h *DirectoryHandler) Nodes(c *gin.Context) {
+	nodes := h.dir.Nodes()
+	c.JSON(http.StatusOK, gin.H{
+		"nodes":   nodes,
+		"total":   len(nodes),
+		"next_id": h.dir.NextID(),
+	})
+}
+
+// Upload 分配 fid 后将上传的文件转发到存储节点
+func (h *DirectoryHandler) Upload(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no file uploaded"})
+		return
+	}
+
+	userMeta, tags, err := uploadAttributes(c, true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	checksums, err := formChecksums(c, file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer src.Close()
+
+	assignment, err := h.dir.Assign(1, file.Size)
+	if err == cluster.ErrNoWritableNode {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPut, needleURL(assignment.URL, assignment.FID), src)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	req.ContentLength = file.Size
+	// 存储节点根据内容识别未指定的 MIME 类型
+	if mimeType := file.Header.Get("Content-Type"); mimeType != "" {
+		req.Header.Set("Content-Type", mimeType)
+	}
+	req.Header.Set("X-File-Name", file.Filename)
+	for _, header := range []string{"X-Expires-After", "X-Tenant-ID"} {
+		if v := c.GetHeader(header); v != "" {
+			req.Header.Set(header, v)
+		}
+	}
+	// 存储节点接收的是文件本身，文件部分的摘要以请求头转发
+	for name, values := range checksums {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if v := c.PostForm("expires_after"); v != "" && req.Header.Get("X-Expires-After") == "" {
+		req.Header.Set("X-Expires-After", v)
+	}
+	// 元数据和标签统一以请求头转发
+	setAttributeHeaders(req.Header, userMeta, metaHeaderPrefix)
+	if len(tags) > 0 {
+		req.Header.Set(tagHeader, encodeTagging(tags))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("store node %s unavailable: %v", assignment.NodeID, err)})
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		// 存储节点的错误原样返回
+		c.DataFromReader(resp.StatusCode, resp.ContentLength, resp.Header.Get("Content-Type"), resp.Body, nil)
+		return
+	}
+
+	var result gin.H
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "invalid response from store node"})
+		return
+	}
+	result["url"] = needleURL(assignment.URL, assignment.FID)
+	result["node_id"] = assignment.NodeID
+	c.JSON(http.StatusOK, result)
+}
+
+// Download 将读取请求重定向到文件所在的存储节点
+func (h *DirectoryHandler) Download(c *gin.Context) {
+	node, ok := h.lookupFID(c)
+	if !ok {
+		return
+	}
+	c.Redirect(http.StatusFound, needleURL(node.URL, c.Param("fid")))
+}
+
+// Delete 将删除请求转发到文件所在的存储节点
+func (h *DirectoryHandler) Delete(c *gin.Context) {
+	node, ok := h.lookupFID(c)
+	if !ok {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, needleURL(node.URL, c.Param("fid")), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("store node %s unavailable: %v", node.ID, err)})
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
+}
+
+// Health 目录服务健康检查
+func (h *DirectoryHandler) Health(c *gin.Context) {
+	nodes := h.dir.Nodes()
+	alive := 0
+	for _, node := range nodes {
+		if node.Alive {
+			alive++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "healthy",
+		"role":        "directory",
+		"timestamp":   time.Now().Unix(),
+		"uptime":      time.Since(h.startTime).Seconds(),
+		"nodes":       len(nodes),
+		"alive_nodes": alive,
+	})
+}
+
+// lookupFID 查找 fid 所在的存储节点，失败时返回错误响应
+func (h *DirectoryHandler) lookupFID(c *gin.Context) (*cluster.Node, bool) {
+	volumeID, _, err := cluster.ParseFID(c.Param("fid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	node, err := h.dir.Lookup(volumeID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return nil, false
+	}
+	if !node.Alive {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("store node %s is down", node.ID)})
+		return nil, false
+	}
+	return node, true
+}
+
+func needleURL(base, fid string) string {
+	return strings.TrimRight(base, "/") + "/needle/" + fid
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"haystack-lite/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	eventBatchSize    = 100
+	eventHeartbeat    = 15 * time.Second
+	maxPollTimeoutSec = 60
+)
+
+// eventCursor 读取客户端提供的续读位置，未提供时从当前最新事件之后开始
+func (h *Handler) eventCursor(c *gin.Context) (uint64, error) {
+	v := c.Query("cursor")
+	if v == "" {
+		v = c.GetHeader("Last-Event-ID")
+	}
+	if v == "" {
+		return h.node.Events().Latest(), nil
+	}
+	return strconv.ParseUint(v, 10, 64)
+}
+
+// StreamEvents 以 Server-Sent Events 推送对象事件，事件 id 即续读 Cursor
+func (h *Handler) StreamEvents(c *gin.Context) {
+	cursor, err := h.eventCursor(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		return
+	}
+
+	bus := h.node.Events()
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		// 先取得等待通道再读取，避免漏掉两者之间发布的事件
+		wait := bus.Wait()
+		events, truncated := bus.Since(cursor, eventBatchSize)
+		if truncated {
+			// 部分事件已丢失，客户端需要重新全量同步
+			fmt.Fprintf(c.Writer, "event: truncated\ndata: {}\n\n")
+			if len(events) == 0 {
+				cursor = bus.Latest()
+			}
+		}
+		for _, e := range events {
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", e.Cursor, e.Type, data)
+			cursor = e.Cursor
+		}
+		c.Writer.Flush()
+
+		if len(events) == eventBatchSize {
+			continue
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-wait:
+		case <-heartbeat.C:
+			fmt.Fprintf(c.Writer, ": heartbeat\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+// PollEvents 长轮询获取对象事件，没有新事件时最多等待 timeout 秒
+func (h *Handler) PollEvents(c *gin.Context) {
+	cursor, err := h.eventCursor(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(eventBatchSize)))
+	if limit < 1 || limit > 1000 {
+		limit = eventBatchSize
+	}
+	timeout, _ := strconv.Atoi(c.DefaultQuery("timeout", "30"))
+	if timeout < 0 || timeout > maxPollTimeoutSec {
+		timeout = maxPollTimeoutSec
+	}
+
+	bus := h.node.Events()
+	deadline := time.NewTimer(time.Duration(timeout) * time.Second)
+	defer deadline.Stop()
+
+	var events []storage.Event
+	var truncated bool
+wait:
+	for {
+		ready := bus.Wait()
+		events, truncated = bus.Since(cursor, limit)
+		if len(events) > 0 || truncated {
+			break
+		}
+
+		select {
+		case <-ready:
+		case <-deadline.C:
+			break wait
+		case <-c.Request.Context().Done():
+			break wait
+		}
+	}
+
+	if len(events) > 0 {
+		cursor = events[len(events)-1].Cursor
+	} else if truncated {
+		cursor = bus.Latest()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":    events,
+		"cursor":    cursor,
+		"truncated": truncated,
+	})
+}
@@ -1,21 +1,31 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"haystack-lite/internal/storage"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Handler REST 接口处理器
+// 文件读写、批量操作和元数据修改只依赖 ObjectStore，可以使用任意实现；
+// 版本、回收站、事件、全文检索、配额、生命周期、Webhook、快照、复制和反熵等接口
+// 直接使用 node（*storage.Store），node 为 nil 时 SetupRoutes 不注册这些路由
 type Handler struct {
-	store *storage.Store
+	store storage.ObjectStore
+	node  *storage.Store
 }
 
-func NewHandler(store *storage.Store) *Handler {
-	return &Handler{store: store}
+func NewHandler(store storage.ObjectStore) *Handler {
+	node, _ := store.(*storage.Store)
+	return &Handler{store: store, node: node}
 }
 
 func (h *Handler) Upload(c *gin.Context) {
@@ -38,22 +48,62 @@ func (h *Handler) Upload(c *gin.Context) {
 		return
 	}
 
+	checksums, err := formChecksums(c, file)
+	if err == nil {
+		err = verifyChecksums(checksums, data)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	mimeType := file.Header.Get("Content-Type")
 	if mimeType == "" || mimeType == "application/octet-stream" {
 		mimeType = detectMimeType(file.Filename, data)
 	}
 
-	id, err := h.store.WriteWithMetadata(data, file.Filename, mimeType)
+	expireTime, err := parseExpireTime(expiresAfter(c, true))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userMeta, tags, err := uploadAttributes(c, true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := h.store.WriteWithOptions(data, storage.WriteOptions{
+		FileName:   file.Filename,
+		MimeType:   mimeType,
+		ExpireTime: expireTime,
+		Tenant:     tenantOf(c),
+		UserMeta:   userMeta,
+		Tags:       tags,
+	})
+	if err == storage.ErrQuotaExceeded {
+		quotaExceeded(c)
+		return
+	}
+	if err == storage.ErrReplicaTimeout {
+		// 本地已写入成功，只是副本未在超时前确认
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error(), "id": id})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":        id,
-		"size":      len(data),
-		"filename":  file.Filename,
-		"mime_type": mimeType,
+		"id":          id,
+		"size":        len(data),
+		"filename":    file.Filename,
+		"mime_type":   mimeType,
+		"expire_time": expireTime,
+		"metadata":    attributesJSON(userMeta),
+		"tags":        attributesJSON(tags),
 	})
 }
 
@@ -65,6 +115,11 @@ func (h *Handler) Download(c *gin.Context) {
 		return
 	}
 
+	h.serveFile(c, id)
+}
+
+// serveFile 返回文件内容
+func (h *Handler) serveFile(c *gin.Context, id uint64) {
 	data, metadata, err := h.store.ReadWithMetadata(id)
 	if err != nil {
 		if err == storage.ErrNeedleNotFound {
@@ -76,9 +131,16 @@ func (h *Handler) Download(c *gin.Context) {
 	}
 
 	// 设置响应头
+	if metadata.SHA256 != "" {
+		c.Header("Digest", "sha-256="+hexToBase64(metadata.SHA256))
+	}
 	if metadata.FileName != "" {
 		c.Header("Content-Disposition", "attachment; filename="+metadata.FileName)
 	}
+	setAttributeHeaders(c.Writer.Header(), metadata.UserMeta, metaHeaderPrefix)
+	if len(metadata.Tags) > 0 {
+		c.Header(tagHeader, encodeTagging(metadata.Tags))
+	}
 	if metadata.MimeType != "" {
 		c.Data(http.StatusOK, metadata.MimeType, data)
 	} else {
@@ -97,6 +159,8 @@ func (h *Handler) Delete(c *gin.Context) {
 	if err := h.store.Delete(id); err != nil {
 		if err == storage.ErrNeedleNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		} else if err == storage.ErrReplicaTimeout {
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
@@ -111,67 +175,159 @@ func (h *Handler) Status(c *gin.Context) {
 	c.JSON(http.StatusOK, status)
 }
 
+// ListFiles 按条件查询文件列表，过滤、排序和分页都在数据库中完成
+// 默认按游标分页，响应中的 next_cursor 传给下一次请求；指定 page 时按页码翻页并返回总数
 func (h *Handler) ListFiles(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-
-	if page < 1 {
-		page = 1
-	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 20
-	}
-
-	allFiles, err := h.store.ListAll()
+	q, err := parseFileQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	total := len(allFiles)
-
-	for i := 0; i < len(allFiles)/2; i++ {
-		allFiles[i], allFiles[len(allFiles)-1-i] = allFiles[len(allFiles)-1-i], allFiles[i]
+	page := 0
+	if v := c.Query("page"); v != "" {
+		page, err = strconv.Atoi(v)
+		if err != nil || page < 1 {
+			page = 1
+		}
+		q.Offset = (page - 1) * q.Limit
+		q.CountTotal = true
 	}
 
-	start := (page - 1) * pageSize
-	end := start + pageSize
-
-	if start >= total {
-		c.JSON(http.StatusOK, gin.H{
-			"files":      []gin.H{},
-			"total":      total,
-			"page":       page,
-			"page_size":  pageSize,
-			"total_page": (total + pageSize - 1) / pageSize,
-		})
+	result, err := h.store.QueryFiles(q)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidCursor) || errors.Is(err, storage.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	if end > total {
-		end = total
-	}
-
-	files := allFiles[start:end]
-	result := make([]gin.H, 0, len(files))
-	for _, f := range files {
-		result = append(result, gin.H{
+	files := make([]gin.H, 0, len(result.Files))
+	for _, f := range result.Files {
+		files = append(files, gin.H{
 			"id":         f.ID,
 			"filename":   f.FileName,
 			"mime_type":  f.MimeType,
 			"size":       f.Size,
 			"md5":        f.MD5,
 			"created_at": f.CreateTime,
+			"tags":       attributesJSON(f.Tags),
 		})
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"files":      result,
-		"total":      total,
-		"page":       page,
-		"page_size":  pageSize,
-		"total_page": (total + pageSize - 1) / pageSize,
-	})
+	resp := gin.H{
+		"files":       files,
+		"page_size":   q.Limit,
+		"next_cursor": result.NextCursor,
+	}
+	if page > 0 {
+		resp["page"] = page
+		resp["total"] = result.Total
+		resp["total_page"] = (result.Total + int64(q.Limit) - 1) / int64(q.Limit)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// parseFileQuery 解析文件列表的查询参数
+// name 为文件名子串或通配符，mime 为 MIME 前缀，时间支持 Unix 秒和 RFC3339，tag 为 键:值
+func parseFileQuery(c *gin.Context) (storage.FileQuery, error) {
+	q := storage.FileQuery{
+		Name:       c.Query("name"),
+		MimePrefix: c.Query("mime"),
+		MD5:        strings.ToLower(c.Query("md5")),
+		Sort:       c.DefaultQuery("sort", storage.SortByTime),
+		Cursor:     c.Query("cursor"),
+	}
+
+	switch q.Sort {
+	case storage.SortByName, storage.SortBySize, storage.SortByTime:
+	default:
+		return q, fmt.Errorf("invalid sort: %s", q.Sort)
+	}
+	// 时间默认从新到旧，文件名和大小默认升序
+	switch order := c.Query("order"); order {
+	case "":
+		q.Desc = q.Sort == storage.SortByTime
+	case "asc", "desc":
+		q.Desc = order == "desc"
+	default:
+		return q, fmt.Errorf("invalid order: %s", order)
+	}
+
+	limit := c.DefaultQuery("limit", c.Query("page_size"))
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxListLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+		q.Limit = n
+	} else {
+		q.Limit = storage.DefaultQueryLimit
+	}
+
+	var err error
+	if q.MinSize, err = queryInt(c, "min_size"); err != nil {
+		return q, err
+	}
+	if q.MaxSize, err = queryInt(c, "max_size"); err != nil {
+		return q, err
+	}
+	if q.CreatedAfter, err = queryTime(c, "created_after"); err != nil {
+		return q, err
+	}
+	if q.CreatedBefore, err = queryTime(c, "created_before"); err != nil {
+		return q, err
+	}
+
+	// tag=键:值，可以重复，需全部匹配
+	for _, v := range c.QueryArray("tag") {
+		k, value, ok := strings.Cut(v, ":")
+		if !ok || k == "" {
+			return q, fmt.Errorf("invalid tag: %s, expected key:value", v)
+		}
+		if q.Tags == nil {
+			q.Tags = make(map[string]string)
+		}
+		if prev, exists := q.Tags[k]; exists && prev != value {
+			return q, fmt.Errorf("conflicting values for tag %s", k)
+		}
+		q.Tags[k] = value
+	}
+	return q, nil
+}
+
+// maxListLimit 文件列表每页的最大条数
+const maxListLimit = 1000
+
+// queryInt 读取非负整数参数，缺省时返回 0
+func queryInt(c *gin.Context, key string) (int64, error) {
+	v := c.Query(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: %s", key, v)
+	}
+	return n, nil
+}
+
+// queryTime 读取时间参数，支持 Unix 秒和 RFC3339，缺省时返回 0
+func queryTime(c *gin.Context, key string) (int64, error) {
+	v := c.Query(key)
+	if v == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", key, v)
+	}
+	return t.Unix(), nil
 }
 
 func detectMimeType(filename string, data []byte) string {
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"haystack-lite/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter 注册单机模式的路由，存储使用 MemoryStore
+// 分片上传的临时目录是相对路径，因此切换到临时目录运行
+func newTestRouter(t *testing.T) (*gin.Engine, *storage.MemoryStore) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+
+	store := storage.NewMemoryStore()
+	r := gin.New()
+	SetupRoutes(r, store)
+	return r, store
+}
+
+// serve 发送请求并返回响应
+func serve(r http.Handler, method, target string, body io.Reader, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, body)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// multipartUpload 构造表单上传请求体，fields 为额外的表单字段
+func multipartUpload(t *testing.T, filename string, data []byte, fields map[string]string) (*bytes.Buffer, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf, mw.FormDataContentType()
+}
+
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var v map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", w.Body.String(), err)
+	}
+	return v
+}
+
+func TestRESTUploadDownloadDelete(t *testing.T) {
+	r, _ := newTestRouter(t)
+	data := []byte("hello haystack")
+	sum := md5.Sum(data)
+
+	body, contentType := multipartUpload(t, "hello.txt", data, map[string]string{
+		"meta[owner]": "alice",
+		"tagging":     "project=alpha",
+		"md5":         hex.EncodeToString(sum[:]),
+	})
+	w := serve(r, http.MethodPost, "/file", body, map[string]string{"Content-Type": contentType})
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", w.Code, w.Body.String())
+	}
+	id := strconv.FormatFloat(decodeJSON(t, w)["id"].(float64), 'f', 0, 64)
+
+	w = serve(r, http.MethodGet, "/file/"+id, nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != string(data) {
+		t.Fatalf("download: %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("X-Meta-Owner"); got != "alice" {
+		t.Errorf("X-Meta-Owner = %q, want alice", got)
+	}
+	if got := w.Header().Get("X-Tagging"); got != "project=alpha" {
+		t.Errorf("X-Tagging = %q, want project=alpha", got)
+	}
+
+	w = serve(r, http.MethodGet, "/files?tag=project:alpha", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: %d %s", w.Code, w.Body.String())
+	}
+	if files := decodeJSON(t, w)["files"].([]interface{}); len(files) != 1 {
+		t.Fatalf("list returned %d files, want 1", len(files))
+	}
+
+	w = serve(r, http.MethodDelete, "/file/"+id, nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+	}
+	if w = serve(r, http.MethodGet, "/file/"+id, nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("download after delete: %d", w.Code)
+	}
+}
+
+func TestRESTUploadChecksum(t *testing.T) {
+	r, _ := newTestRouter(t)
+	data := []byte("checked")
+
+	// 请求级的 Content-MD5 描述整个 multipart 请求体，不用于校验文件
+	body, contentType := multipartUpload(t, "a.txt", data, nil)
+	w := serve(r, http.MethodPost, "/file", body, map[string]string{
+		"Content-Type": contentType,
+		"Content-MD5":  "AAAAAAAAAAAAAAAAAAAAAA==",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload with request-level Content-MD5: %d %s", w.Code, w.Body.String())
+	}
+
+	body, contentType = multipartUpload(t, "a.txt", data, map[string]string{"md5": "00112233445566778899aabbccddeeff"})
+	w = serve(r, http.MethodPost, "/file", body, map[string]string{"Content-Type": contentType})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("upload with wrong md5 field: %d, want 400", w.Code)
+	}
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	r, store := newTestRouter(t)
+	id, err := store.WriteWithOptions([]byte("x"), storage.WriteOptions{
+		FileName: "a.txt",
+		UserMeta: map[string]string{"owner": "alice", "source": "crm"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(r, http.MethodPatch, "/file/"+strconv.FormatUint(id, 10)+"/metadata",
+		bytes.NewBufferString(`{"metadata": {"owner": "bob", "source": null}, "tags": {"env": "test"}}`),
+		map[string]string{"Content-Type": "application/json"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch: %d %s", w.Code, w.Body.String())
+	}
+
+	meta, err := store.GetMetadata(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.UserMeta) != 1 || meta.UserMeta["owner"] != "bob" || meta.Tags["env"] != "test" {
+		t.Fatalf("attributes = %v, %v", meta.UserMeta, meta.Tags)
+	}
+
+	w = serve(r, http.MethodPatch, "/file/"+strconv.FormatUint(id, 10)+"/metadata",
+		bytes.NewBufferString(`{"metadata": {"Bad Key": "x"}}`), map[string]string{"Content-Type": "application/json"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid metadata key: %d, want 400", w.Code)
+	}
+}
+
+// 管理接口只对 Store 注册
+func TestNodeRoutesNotRegisteredForMemoryStore(t *testing.T) {
+	r, _ := newTestRouter(t)
+	for _, target := range []string{"/versions?name=a.txt", "/trash", "/search?q=a", "/admin/quotas", "/webhooks"} {
+		if w := serve(r, http.MethodGet, target, nil, nil); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: %d, want 404", target, w.Code)
+		}
+	}
+	if w := serve(r, http.MethodGet, "/status", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("GET /status: %d", w.Code)
+	}
+}
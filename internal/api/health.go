@@ -10,11 +10,11 @@ import (
 )
 
 type HealthHandler struct {
-	store     *storage.Store
+	store     storage.ObjectStore
 	startTime time.Time
 }
 
-func NewHealthHandler(store *storage.Store) *HealthHandler {
+func NewHealthHandler(store storage.ObjectStore) *HealthHandler {
 	return &HealthHandler{
 		store:     store,
 		startTime: time.Now(),
@@ -53,5 +53,23 @@ func (h *HealthHandler) Health(c *gin.Context) {
 		},
 	}
 
+	node, ok := h.store.(storage.NodeStatus)
+	if !ok {
+		c.JSON(http.StatusOK, health)
+		return
+	}
+
+	if replication := node.ReplicationStatus(); replication.Role != "" {
+		health["replication"] = replication
+	}
+
+	// 镜像降级时数据只剩一份，需要尽快更换磁盘
+	if mirror := node.MirrorStatus(); mirror.Enabled {
+		health["mirror"] = mirror
+		if len(mirror.DegradedVolumes) > 0 || mirror.Unrecoverable > 0 {
+			health["status"] = "degraded"
+		}
+	}
+
 	c.JSON(http.StatusOK, health)
 }
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLeaseCount 单次最多租用的 ID 数
+const maxLeaseCount = 1 << 20
+
+// LeaseIDs 租用一段连续的文件 ID，租出的区间不会再被本节点或其它租用者使用
+func (h *Handler) LeaseIDs(c *gin.Context) {
+	count, err := strconv.ParseUint(c.DefaultQuery("count", "1000"), 10, 64)
+	if err != nil || count == 0 || count > maxLeaseCount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "count must be between 1 and 1048576"})
+		return
+	}
+
+	lease, err := h.node.LeaseIDs(count)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, lease)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"haystack-lite/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// expiresAfter 读取上传的过期时长，优先使用 X-Expires-After 头，其次是 expires_after 表单字段
+func expiresAfter(c *gin.Context, allowForm bool) string {
+	if v := c.GetHeader("X-Expires-After"); v != "" {
+		return v
+	}
+	if allowForm {
+		return c.PostForm("expires_after")
+	}
+	return ""
+}
+
+// parseExpireTime 将过期时长转换为过期时间点，支持秒数、"24h" 形式和 "7d" 形式，空值表示永不过期
+func parseExpireTime(v string) (int64, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, nil
+	}
+
+	var d time.Duration
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if days, found := strings.CutSuffix(v, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid expiration: %s", v)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid expiration: %s", v)
+		}
+	}
+
+	if d <= 0 {
+		return 0, errors.New("expiration must be positive")
+	}
+	return time.Now().Add(d).Unix(), nil
+}
+
+// ListLifecycleRules 列出生命周期规则
+func (h *Handler) ListLifecycleRules(c *gin.Context) {
+	rules, err := h.node.ListLifecycleRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, lifecycleRuleJSON(rule))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules": result,
+		"total": len(result),
+	})
+}
+
+// AddLifecycleRule 新增生命周期规则
+func (h *Handler) AddLifecycleRule(c *gin.Context) {
+	var req struct {
+		Prefix     string `json:"prefix" binding:"required"`
+		ExpireDays int    `json:"expire_days" binding:"required"`
+		Enabled    *bool  `json:"enabled"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.ExpireDays <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	rule := &storage.LifecycleRule{
+		Prefix:     req.Prefix,
+		ExpireDays: req.ExpireDays,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+	}
+	if err := h.node.AddLifecycleRule(rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, lifecycleRuleJSON(rule))
+}
+
+// DeleteLifecycleRule 删除生命周期规则
+func (h *Handler) DeleteLifecycleRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.node.DeleteLifecycleRule(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+func lifecycleRuleJSON(rule *storage.LifecycleRule) gin.H {
+	return gin.H{
+		"id":          rule.ID,
+		"bucket":      rule.Bucket,
+		"rule_id":     rule.RuleID,
+		"prefix":      rule.Prefix,
+		"expire_days": rule.ExpireDays,
+		"enabled":     rule.Enabled,
+	}
+}
+
+// ExpirationStats 获取过期清理统计
+func (h *Handler) ExpirationStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.node.GetExpirationStats())
+}
+
+// RunExpiration 手动触发过期清理
+func (h *Handler) RunExpiration(c *gin.Context) {
+	removed, err := h.node.RunExpiration()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "removed": removed})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"removed": removed})
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"haystack-lite/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 用户元数据和标签的请求头，S3 接口使用 x-amz-meta-* 和 x-amz-tagging
+const (
+	metaHeaderPrefix    = "X-Meta-"
+	tagHeader           = "X-Tagging"
+	s3MetaHeaderPrefix  = "X-Amz-Meta-"
+	s3TagHeader         = "X-Amz-Tagging"
+	s3TagCountHeader    = "X-Amz-Tagging-Count"
+	s3TagDirective      = "X-Amz-Tagging-Directive"
+	s3MetadataDirective = "X-Amz-Metadata-Directive"
+)
+
+// headerAttributes 从请求头读取用户元数据和标签
+// 元数据键为去掉前缀后的头名，统一转为小写；标签为 URL 查询串格式，如 project=a&owner=b
+func headerAttributes(header http.Header, metaPrefix, tagName string) (map[string]string, map[string]string, error) {
+	var userMeta map[string]string
+	for name, values := range header {
+		if len(name) <= len(metaPrefix) || !strings.EqualFold(name[:len(metaPrefix)], metaPrefix) {
+			continue
+		}
+		if userMeta == nil {
+			userMeta = make(map[string]string)
+		}
+		userMeta[strings.ToLower(name[len(metaPrefix):])] = strings.Join(values, ",")
+	}
+
+	tags, err := parseTagging(header.Get(tagName))
+	if err != nil {
+		return nil, nil, err
+	}
+	return userMeta, tags, nil
+}
+
+// uploadAttributes 读取上传请求的用户元数据和标签并校验
+// allowForm 时还接受表单字段 meta[键] 和 tagging，同名的键以请求头为准
+func uploadAttributes(c *gin.Context, allowForm bool) (map[string]string, map[string]string, error) {
+	userMeta, tags, err := headerAttributes(c.Request.Header, metaHeaderPrefix, tagHeader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if allowForm {
+		for k, v := range c.PostFormMap("meta") {
+			k = strings.ToLower(k)
+			if _, exists := userMeta[k]; exists {
+				continue
+			}
+			if userMeta == nil {
+				userMeta = make(map[string]string)
+			}
+			userMeta[k] = v
+		}
+		if tags == nil {
+			if tags, err = parseTagging(c.PostForm("tagging")); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if err := storage.ValidateUserMeta(userMeta); err != nil {
+		return nil, nil, err
+	}
+	if err := storage.ValidateTags(tags); err != nil {
+		return nil, nil, err
+	}
+	return userMeta, tags, nil
+}
+
+// parseTagging 解析 URL 查询串格式的标签，同一个键不能出现多次
+func parseTagging(v string) (map[string]string, error) {
+	if v == "" {
+		return nil, nil
+	}
+	values, err := url.ParseQuery(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid tagging: %v", storage.ErrInvalidMetadata, err)
+	}
+	tags := make(map[string]string, len(values))
+	for k, vs := range values {
+		if len(vs) > 1 {
+			return nil, fmt.Errorf("%w: duplicate tag %q", storage.ErrInvalidMetadata, k)
+		}
+		tags[k] = vs[0]
+	}
+	return tags, nil
+}
+
+// encodeTagging 把标签编码为 URL 查询串，按键排序
+func encodeTagging(tags map[string]string) string {
+	values := make(url.Values, len(tags))
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
+// setAttributeHeaders 以请求头的形式回传用户元数据，键按字母顺序输出
+func setAttributeHeaders(header http.Header, userMeta map[string]string, metaPrefix string) {
+	keys := make([]string, 0, len(userMeta))
+	for k := range userMeta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		header.Set(metaPrefix+k, userMeta[k])
+	}
+}
+
+// attributesJSON 返回 JSON 响应中的元数据和标签，没有时为空对象
+func attributesJSON(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+// UpdateMetadata 修改文件的用户元数据和标签
+// 请求体为 {"metadata": {...}, "tags": {...}, "replace": false}，值为 null 表示删除该键；
+// replace 为 true 时给出的部分整体替换，未给出的部分保持不变
+func (h *Handler) UpdateMetadata(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req struct {
+		Metadata map[string]*string `json:"metadata"`
+		Tags     map[string]*string `json:"tags"`
+		Replace  bool               `json:"replace"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	patch := storage.AttributePatch{Tags: req.Tags, Replace: req.Replace}
+	if req.Metadata != nil {
+		patch.UserMeta = make(map[string]*string, len(req.Metadata))
+		for k, v := range req.Metadata {
+			patch.UserMeta[strings.ToLower(k)] = v
+		}
+	}
+
+	meta, err := h.store.UpdateAttributes(id, patch)
+	switch {
+	case err == nil:
+	case err == storage.ErrNeedleNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	case errors.Is(err, storage.ErrInvalidMetadata):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err == storage.ErrReplicaTimeout:
+		// 本地已修改成功，只是副本未在超时前确认
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error(), "id": id})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":       meta.ID,
+		"metadata": attributesJSON(meta.UserMeta),
+		"tags":     attributesJSON(meta.Tags),
+	})
+}
@@ -5,17 +5,18 @@ import (
 	"runtime"
 	"time"
 
+	"haystack-lite/internal/config"
 	"haystack-lite/internal/storage"
 
 	"github.com/gin-gonic/gin"
 )
 
 type MetricsHandler struct {
-	store     *storage.Store
+	store     storage.ObjectStore
 	startTime time.Time
 }
 
-func NewMetricsHandler(store *storage.Store) *MetricsHandler {
+func NewMetricsHandler(store storage.ObjectStore) *MetricsHandler {
 	return &MetricsHandler{
 		store:     store,
 		startTime: time.Now(),
@@ -24,7 +25,6 @@ func NewMetricsHandler(store *storage.Store) *MetricsHandler {
 
 func (h *MetricsHandler) Metrics(c *gin.Context) {
 	status := h.store.Status()
-	compactionStats := h.store.GetCompactionStats()
 
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
@@ -60,14 +60,6 @@ func (h *MetricsHandler) Metrics(c *gin.Context) {
 		"# TYPE haystack_volumes_total gauge",
 		formatMetric("haystack_volumes_total", status["volume_count"]),
 		"",
-		"# HELP haystack_compaction_wasted_bytes Wasted space in bytes",
-		"# TYPE haystack_compaction_wasted_bytes gauge",
-		formatMetric("haystack_compaction_wasted_bytes", compactionStats["wasted_size"]),
-		"",
-		"# HELP haystack_compaction_wasted_ratio Wasted space ratio",
-		"# TYPE haystack_compaction_wasted_ratio gauge",
-		formatMetric("haystack_compaction_wasted_ratio", compactionStats["wasted_ratio"]),
-		"",
 		"# HELP haystack_memory_alloc_bytes Allocated memory in bytes",
 		"# TYPE haystack_memory_alloc_bytes gauge",
 		formatMetric("haystack_memory_alloc_bytes", m.Alloc),
@@ -82,9 +74,178 @@ func (h *MetricsHandler) Metrics(c *gin.Context) {
 		"",
 	}
 
+	// 压缩、复制、镜像和缓存指标只有存储节点提供
+	if node, ok := h.store.(storage.NodeStatus); ok {
+		metrics = append(metrics, compactionMetrics(node.GetCompactionStats())...)
+		metrics = append(metrics, replicationMetrics(node.ReplicationStatus())...)
+		metrics = append(metrics, mirrorMetrics(node.MirrorStatus())...)
+		metrics = append(metrics, cacheMetrics(node.CacheStats())...)
+	}
+
 	c.String(http.StatusOK, joinMetrics(metrics))
 }
 
+// compactionMetrics 导出可被压缩回收的空间
+func compactionMetrics(stats map[string]interface{}) []string {
+	return []string{
+		"# HELP haystack_compaction_wasted_bytes Wasted space in bytes",
+		"# TYPE haystack_compaction_wasted_bytes gauge",
+		formatMetric("haystack_compaction_wasted_bytes", stats["wasted_size"]),
+		"",
+		"# HELP haystack_compaction_wasted_ratio Wasted space ratio",
+		"# TYPE haystack_compaction_wasted_ratio gauge",
+		formatMetric("haystack_compaction_wasted_ratio", stats["wasted_ratio"]),
+		"",
+	}
+}
+
+// replicationMetrics 导出复制进度，单机运行时不输出
+func replicationMetrics(status storage.ReplicationStatus) []string {
+	if status.Role == "" {
+		return nil
+	}
+
+	metrics := []string{
+		"# HELP haystack_replication_seq Latest applied sequence number",
+		"# TYPE haystack_replication_seq gauge",
+		formatMetric("haystack_replication_seq", status.CurrentSeq),
+		"",
+	}
+
+	if status.Role == config.RoleReplica {
+		return append(metrics,
+			"# HELP haystack_replication_lag_seq Sequence numbers the replica is behind the primary",
+			"# TYPE haystack_replication_lag_seq gauge",
+			formatMetric("haystack_replication_lag_seq", status.LagSeq),
+			"",
+			"# HELP haystack_replication_lag_seconds Seconds since the replica was last in sync with the primary",
+			"# TYPE haystack_replication_lag_seconds gauge",
+			formatMetric("haystack_replication_lag_seconds", status.LagSeconds),
+			"",
+			"# HELP haystack_replication_last_sync_timestamp Time of the last successful pull",
+			"# TYPE haystack_replication_last_sync_timestamp gauge",
+			formatMetric("haystack_replication_last_sync_timestamp", status.LastSync),
+			"",
+			"# HELP haystack_replication_errors_total Failed pulls from the primary",
+			"# TYPE haystack_replication_errors_total counter",
+			formatMetric("haystack_replication_errors_total", status.SyncErrors),
+			"",
+		)
+	}
+
+	metrics = append(metrics,
+		"# HELP haystack_replication_replicas Connected replicas",
+		"# TYPE haystack_replication_replicas gauge",
+		formatMetric("haystack_replication_replicas", len(status.Replicas)),
+		"",
+		"# HELP haystack_replication_ack_timeouts_total Writes that timed out waiting for a replica",
+		"# TYPE haystack_replication_ack_timeouts_total counter",
+		formatMetric("haystack_replication_ack_timeouts_total", status.AckTimeouts),
+		"",
+		"# HELP haystack_replica_lag_seq Sequence numbers each replica is behind",
+		"# TYPE haystack_replica_lag_seq gauge",
+	)
+	for _, replica := range status.Replicas {
+		metrics = append(metrics, formatMetric(`haystack_replica_lag_seq{replica="`+replica.ID+`"}`, replica.LagSeq))
+	}
+	metrics = append(metrics,
+		"",
+		"# HELP haystack_replica_last_seen_timestamp Last time each replica pulled changes",
+		"# TYPE haystack_replica_last_seen_timestamp gauge",
+	)
+	for _, replica := range status.Replicas {
+		metrics = append(metrics, formatMetric(`haystack_replica_last_seen_timestamp{replica="`+replica.ID+`"}`, replica.LastSeen))
+	}
+	return append(metrics, "")
+}
+
+// mirrorMetrics 导出镜像健康状况，未配置镜像时不输出
+func mirrorMetrics(status storage.MirrorStatus) []string {
+	if !status.Enabled {
+		return nil
+	}
+
+	return []string{
+		"# HELP haystack_mirror_volumes Volumes with a mirror copy",
+		"# TYPE haystack_mirror_volumes gauge",
+		formatMetric("haystack_mirror_volumes", status.Volumes),
+		"",
+		"# HELP haystack_mirror_degraded_volumes Volumes whose mirror stopped accepting writes",
+		"# TYPE haystack_mirror_degraded_volumes gauge",
+		formatMetric("haystack_mirror_degraded_volumes", len(status.DegradedVolumes)),
+		"",
+		"# HELP haystack_mirror_divergent_reads_total Reads where one copy failed and the other succeeded",
+		"# TYPE haystack_mirror_divergent_reads_total counter",
+		formatMetric("haystack_mirror_divergent_reads_total", status.DivergentReads),
+		"",
+		"# HELP haystack_mirror_repairs_total Needles rewritten from the healthy copy",
+		"# TYPE haystack_mirror_repairs_total counter",
+		formatMetric(`haystack_mirror_repairs_total{copy="primary"}`, status.RepairsPrimary),
+		formatMetric(`haystack_mirror_repairs_total{copy="mirror"}`, status.RepairsMirror),
+		"",
+		"# HELP haystack_mirror_repair_failures_total Failed in-place repairs",
+		"# TYPE haystack_mirror_repair_failures_total counter",
+		formatMetric("haystack_mirror_repair_failures_total", status.RepairFailures),
+		"",
+		"# HELP haystack_mirror_unrecoverable_reads_total Reads that failed on both copies",
+		"# TYPE haystack_mirror_unrecoverable_reads_total counter",
+		formatMetric("haystack_mirror_unrecoverable_reads_total", status.Unrecoverable),
+		"",
+		"# HELP haystack_mirror_write_errors_total Failed writes to the mirror copy",
+		"# TYPE haystack_mirror_write_errors_total counter",
+		formatMetric("haystack_mirror_write_errors_total", status.WriteErrors),
+		"",
+		"# HELP haystack_mirror_resync_bytes_total Bytes copied to bring copies to the same length on open",
+		"# TYPE haystack_mirror_resync_bytes_total counter",
+		formatMetric("haystack_mirror_resync_bytes_total", status.ResyncBytes),
+		"",
+	}
+}
+
+// cacheMetrics 导出缓存命中率和淘汰情况，未启用缓存时不输出
+func cacheMetrics(stats storage.CacheStats) []string {
+	if !stats.Enabled {
+		return nil
+	}
+
+	tiers := []struct {
+		name  string
+		stats storage.CacheTierStats
+	}{
+		{"metadata", stats.Metadata},
+		{"body", stats.Body},
+	}
+
+	metrics := make([]string, 0)
+	families := []struct {
+		name, help, kind string
+		value            func(storage.CacheTierStats) interface{}
+	}{
+		{"haystack_cache_hits_total", "Cache hits", "counter", func(t storage.CacheTierStats) interface{} { return t.Hits }},
+		{"haystack_cache_misses_total", "Cache misses", "counter", func(t storage.CacheTierStats) interface{} { return t.Misses }},
+		{"haystack_cache_evictions_total", "Entries evicted to make room", "counter", func(t storage.CacheTierStats) interface{} { return t.Evictions }},
+		{"haystack_cache_rejections_total", "Entries refused by the TinyLFU admission policy", "counter", func(t storage.CacheTierStats) interface{} { return t.Rejections }},
+		{"haystack_cache_invalidations_total", "Entries removed after delete, overwrite or compaction", "counter", func(t storage.CacheTierStats) interface{} { return t.Invalidations }},
+		{"haystack_cache_entries", "Cached entries", "gauge", func(t storage.CacheTierStats) interface{} { return t.Entries }},
+	}
+	for _, family := range families {
+		metrics = append(metrics,
+			"# HELP "+family.name+" "+family.help,
+			"# TYPE "+family.name+" "+family.kind,
+		)
+		for _, tier := range tiers {
+			metrics = append(metrics, formatMetric(family.name+`{tier="`+tier.name+`"}`, family.value(tier.stats)))
+		}
+		metrics = append(metrics, "")
+	}
+	return append(metrics,
+		"# HELP haystack_cache_body_bytes Memory used by cached file bodies",
+		"# TYPE haystack_cache_body_bytes gauge",
+		formatMetric("haystack_cache_body_bytes", stats.Body.Bytes),
+		"",
+	)
+}
+
 func formatMetric(name string, value interface{}) string {
 	return name + " " + toString(value)
 }
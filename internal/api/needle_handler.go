@@ -0,0 +1,109 @@
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"haystack-lite/internal/cluster"
+	"haystack-lite/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WriteNeedle 存储节点按目录服务分配的 fid 写入文件，请求体为文件内容
+func (h *Handler) WriteNeedle(c *gin.Context) {
+	_, id, err := cluster.ParseFID(c.Param("fid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+
+	if err := verifyChecksums(c.Request.Header, data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := c.GetHeader("X-File-Name")
+	mimeType := c.GetHeader("Content-Type")
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = detectMimeType(filename, data)
+	}
+
+	expireTime, err := parseExpireTime(expiresAfter(c, false))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userMeta, tags, err := uploadAttributes(c, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = h.store.WriteWithOptions(data, storage.WriteOptions{
+		ID:         id,
+		FileName:   filename,
+		MimeType:   mimeType,
+		ExpireTime: expireTime,
+		Tenant:     tenantOf(c),
+		UserMeta:   userMeta,
+		Tags:       tags,
+	})
+	switch err {
+	case nil:
+	case storage.ErrFileExists:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case storage.ErrQuotaExceeded:
+		quotaExceeded(c)
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"fid":       c.Param("fid"),
+		"id":        id,
+		"size":      len(data),
+		"filename":  filename,
+		"mime_type": mimeType,
+	})
+}
+
+// ReadNeedle 存储节点按 fid 读取文件
+func (h *Handler) ReadNeedle(c *gin.Context) {
+	_, id, err := cluster.ParseFID(c.Param("fid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.serveFile(c, id)
+}
+
+// DeleteNeedle 存储节点按 fid 删除文件
+func (h *Handler) DeleteNeedle(c *gin.Context) {
+	_, id, err := cluster.ParseFID(c.Param("fid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.store.Delete(id); err != nil {
+		if err == storage.ErrNeedleNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"haystack-lite/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tenantOf 读取请求所属租户
+func tenantOf(c *gin.Context) string {
+	return c.GetHeader("X-Tenant-ID")
+}
+
+// quotaExceeded 返回配额超限错误
+func quotaExceeded(c *gin.Context) {
+	c.JSON(http.StatusInsufficientStorage, gin.H{
+		"error": storage.ErrQuotaExceeded.Error(),
+		"code":  "QuotaExceeded",
+	})
+}
+
+// ListQuotas 列出所有配额及用量
+func (h *Handler) ListQuotas(c *gin.Context) {
+	quotas, err := h.node.ListQuotas()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, 0, len(quotas))
+	for _, q := range quotas {
+		result = append(result, quotaJSON(q))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"quotas": result,
+		"total":  len(result),
+	})
+}
+
+// GetQuota 获取配额用量
+func (h *Handler) GetQuota(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	quota, err := h.node.GetQuota(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "quota not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, quotaJSON(quota))
+}
+
+// SetQuota 新增或修改配额，已有文件会重新统计用量
+func (h *Handler) SetQuota(c *gin.Context) {
+	var req struct {
+		Scope      string `json:"scope" binding:"required"`
+		Name       string `json:"name"`
+		MaxBytes   int64  `json:"max_bytes"`
+		MaxObjects int64  `json:"max_objects"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.MaxBytes < 0 || req.MaxObjects < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if req.Name == "" && req.Scope != storage.QuotaScopePrefix {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name required"})
+		return
+	}
+
+	quota := &storage.Quota{
+		Scope:      req.Scope,
+		Name:       req.Name,
+		MaxBytes:   req.MaxBytes,
+		MaxObjects: req.MaxObjects,
+	}
+	if err := h.node.SetQuota(quota); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, quotaJSON(quota))
+}
+
+// DeleteQuota 删除配额
+func (h *Handler) DeleteQuota(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.node.DeleteQuota(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "quota not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+func quotaJSON(q *storage.Quota) gin.H {
+	return gin.H{
+		"id":              q.ID,
+		"scope":           q.Scope,
+		"name":            q.Name,
+		"max_bytes":       q.MaxBytes,
+		"max_objects":     q.MaxObjects,
+		"used_bytes":      q.UsedBytes,
+		"used_objects":    q.UsedObjects,
+		"available_bytes": q.AvailableBytes(),
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RunReconcile 立即检查孤立的 Needle 和丢失数据的文件，repair=false 时只报告
+func (h *Handler) RunReconcile(c *gin.Context) {
+	grace, err := strconv.Atoi(c.DefaultQuery("grace", "600"))
+	if err != nil || grace < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid grace"})
+		return
+	}
+	repair := c.DefaultQuery("repair", "true") == "true"
+
+	report, err := h.node.Reconcile(grace, repair)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ReconcileReport 返回最近一次检查的结果
+func (h *Handler) ReconcileReport(c *gin.Context) {
+	report := h.node.ReconcileReport()
+	if report == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no reconcile run yet"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -1,12 +1,18 @@
 package api
 
 import (
+	"net/http"
+
+	"haystack-lite/internal/cluster"
 	"haystack-lite/internal/storage"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(r *gin.Engine, store *storage.Store) {
+// SetupRoutes 注册单机模式的全部接口
+// store 为 *storage.Store 时同时注册版本、回收站、事件、生命周期、配额、Webhook、全文检索等接口，
+// 其它 ObjectStore 实现只提供文件读写、分片上传、WebDAV、S3 和健康检查
+func SetupRoutes(r *gin.Engine, store storage.ObjectStore) {
 	r.Use(Logger())
 	r.Use(Recovery())
 
@@ -23,7 +29,81 @@ func SetupRoutes(r *gin.Engine, store *storage.Store) {
 	setupChunkUploadRoutes(r, chunkHandler)
 	setupWebDAVRoutes(r, webdavHandler)
 	setupS3Routes(r, s3Handler)
-	setupManagementRoutes(r, store, handler)
+	setupHealthRoutes(r, healthHandler, metricsHandler)
+	r.GET("/status", handler.Status)
+
+	if node, ok := store.(*storage.Store); ok {
+		setupEventRoutes(r, handler)
+		setupVersionRoutes(r, handler)
+		setupTrashRoutes(r, handler)
+		setupManagementRoutes(r, node, handler)
+		setupWebhookRoutes(r, handler)
+		setupSearchRoutes(r, handler)
+	}
+}
+
+// SetupDirectoryRoutes 目录服务：分配文件 ID、维护节点，并将文件请求转发到存储节点
+func SetupDirectoryRoutes(r *gin.Engine, dir *cluster.Directory) {
+	r.Use(Logger())
+	r.Use(Recovery())
+
+	handler := NewDirectoryHandler(dir)
+
+	directory := r.Group("/dir")
+	{
+		directory.POST("/heartbeat", handler.Heartbeat)
+		directory.POST("/assign", handler.Assign)
+		directory.GET("/assign", handler.Assign)
+		directory.GET("/lookup", handler.Lookup)
+		directory.GET("/nodes", handler.Nodes)
+	}
+
+	r.POST("/file", handler.Upload)
+	r.GET("/file/:fid", handler.Download)
+	r.DELETE("/file/:fid", handler.Delete)
+
+	r.GET("/health", handler.Health)
+	r.GET("/health/live", handler.Health)
+}
+
+// SetupStoreNodeRoutes 存储节点：按 fid 读写 Needle，文件 ID 由目录服务分配，不接受本地分配 ID 的写入
+func SetupStoreNodeRoutes(r *gin.Engine, store *storage.Store) {
+	r.Use(Logger())
+	r.Use(Recovery())
+
+	handler := NewHandler(store)
+	healthHandler := NewHealthHandler(store)
+	metricsHandler := NewMetricsHandler(store)
+
+	needles := r.Group("/needle")
+	{
+		needles.PUT("/:fid", handler.WriteNeedle)
+		needles.GET("/:fid", handler.ReadNeedle)
+		needles.DELETE("/:fid", handler.DeleteNeedle)
+	}
+
+	r.GET("/file/:id/info", handler.GetFileInfo)
+	r.PATCH("/file/:id/metadata", handler.UpdateMetadata)
+	r.GET("/files", handler.ListFiles)
+	r.GET("/search", handler.Search)
+	r.GET("/events", handler.StreamEvents)
+	r.GET("/events/poll", handler.PollEvents)
+	r.GET("/status", handler.Status)
+
+	admin := r.Group("/admin")
+	{
+		admin.POST("/snapshot", handler.Snapshot)
+		admin.GET("/changes", handler.Changes)
+		admin.GET("/replication", handler.Replication)
+		admin.GET("/antientropy/digest", handler.AntiEntropyDigest)
+		admin.GET("/antientropy/digest/:bucket", handler.AntiEntropyBucket)
+		admin.GET("/antientropy/needles", handler.AntiEntropyNeedles)
+		admin.POST("/antientropy/run", handler.RunAntiEntropy)
+		admin.GET("/antientropy/report", handler.AntiEntropyReport)
+		admin.POST("/reconcile/run", handler.RunReconcile)
+		admin.GET("/reconcile/report", handler.ReconcileReport)
+	}
+
 	setupHealthRoutes(r, healthHandler, metricsHandler)
 }
 
@@ -38,6 +118,8 @@ func setupFileRoutes(r *gin.Engine, handler *Handler) {
 		files.POST("", handler.Upload)
 		files.GET("/:id/preview", handler.Preview)
 		files.GET("/:id/info", handler.GetFileInfo)
+		files.GET("/:id/digest", handler.GetFileDigest)
+		files.PATCH("/:id/metadata", handler.UpdateMetadata)
 		files.GET("/:id", handler.Download)
 		files.DELETE("/:id", handler.Delete)
 	}
@@ -45,6 +127,22 @@ func setupFileRoutes(r *gin.Engine, handler *Handler) {
 	r.GET("/files", handler.ListFiles)
 }
 
+func setupEventRoutes(r *gin.Engine, handler *Handler) {
+	r.GET("/events", handler.StreamEvents)
+	r.GET("/events/poll", handler.PollEvents)
+}
+
+func setupVersionRoutes(r *gin.Engine, handler *Handler) {
+	r.POST("/file/:id/restore", handler.RestoreVersion)
+	r.GET("/versions", handler.ListVersions)
+
+	buckets := r.Group("/buckets")
+	{
+		buckets.GET("/:bucket/settings", handler.GetBucketSettings)
+		buckets.PUT("/:bucket/settings", handler.PutBucketSettings)
+	}
+}
+
 func setupBatchRoutes(r *gin.Engine, handler *Handler) {
 	batch := r.Group("/files/batch")
 	{
@@ -54,6 +152,11 @@ func setupBatchRoutes(r *gin.Engine, handler *Handler) {
 	}
 }
 
+func setupTrashRoutes(r *gin.Engine, handler *Handler) {
+	r.GET("/trash", handler.ListTrash)
+	r.POST("/trash/:id/restore", handler.RestoreTrash)
+}
+
 func setupChunkUploadRoutes(r *gin.Engine, handler *ChunkHandler) {
 	upload := r.Group("/upload")
 	{
@@ -82,9 +185,34 @@ func setupWebDAVRoutes(r *gin.Engine, handler *WebDAVHandler) {
 func setupS3Routes(r *gin.Engine, handler *S3Handler) {
 	s3 := r.Group("/s3")
 	{
+		s3.PUT("/:bucket", func(c *gin.Context) {
+			if _, ok := c.GetQuery("lifecycle"); ok {
+				handler.PutBucketLifecycle(c)
+			} else {
+				c.Status(http.StatusOK)
+			}
+		})
 		s3.PUT("/:bucket/*key", handler.PutObject)
+		s3.GET("/:bucket", func(c *gin.Context) {
+			if _, ok := c.GetQuery("lifecycle"); ok {
+				handler.GetBucketLifecycle(c)
+			} else if _, ok := c.GetQuery("versions"); ok {
+				handler.ListObjectVersions(c)
+			} else {
+				handler.ListObjects(c)
+			}
+		})
+		s3.DELETE("/:bucket", func(c *gin.Context) {
+			if _, ok := c.GetQuery("lifecycle"); ok {
+				handler.DeleteBucketLifecycle(c)
+			} else {
+				c.Status(http.StatusNoContent)
+			}
+		})
 		s3.GET("/:bucket/*key", func(c *gin.Context) {
-			if c.Query("prefix") != "" || c.Query("max-keys") != "" {
+			if _, ok := c.GetQuery("versions"); ok {
+				handler.ListObjectVersions(c)
+			} else if c.Query("prefix") != "" || c.Query("max-keys") != "" {
 				handler.ListObjects(c)
 			} else {
 				handler.GetObject(c)
@@ -96,7 +224,37 @@ func setupS3Routes(r *gin.Engine, handler *S3Handler) {
 }
 
 func setupManagementRoutes(r *gin.Engine, store *storage.Store, handler *Handler) {
-	r.GET("/status", handler.Status)
+	lifecycle := r.Group("/lifecycle")
+	{
+		lifecycle.GET("/rules", handler.ListLifecycleRules)
+		lifecycle.POST("/rules", handler.AddLifecycleRule)
+		lifecycle.DELETE("/rules/:id", handler.DeleteLifecycleRule)
+	}
+
+	expiration := r.Group("/expiration")
+	{
+		expiration.GET("/stats", handler.ExpirationStats)
+		expiration.POST("/run", handler.RunExpiration)
+	}
+
+	admin := r.Group("/admin")
+	{
+		admin.GET("/quotas", handler.ListQuotas)
+		admin.PUT("/quotas", handler.SetQuota)
+		admin.GET("/quotas/:id", handler.GetQuota)
+		admin.DELETE("/quotas/:id", handler.DeleteQuota)
+		admin.POST("/ids/lease", handler.LeaseIDs)
+		admin.POST("/snapshot", handler.Snapshot)
+		admin.GET("/changes", handler.Changes)
+		admin.GET("/replication", handler.Replication)
+		admin.GET("/antientropy/digest", handler.AntiEntropyDigest)
+		admin.GET("/antientropy/digest/:bucket", handler.AntiEntropyBucket)
+		admin.GET("/antientropy/needles", handler.AntiEntropyNeedles)
+		admin.POST("/antientropy/run", handler.RunAntiEntropy)
+		admin.GET("/antientropy/report", handler.AntiEntropyReport)
+		admin.POST("/reconcile/run", handler.RunReconcile)
+		admin.GET("/reconcile/report", handler.ReconcileReport)
+	}
 
 	compaction := r.Group("/compaction")
 	{
@@ -114,6 +272,23 @@ func setupManagementRoutes(r *gin.Engine, store *storage.Store, handler *Handler
 	}
 }
 
+func setupWebhookRoutes(r *gin.Engine, handler *Handler) {
+	webhooks := r.Group("/webhooks")
+	{
+		webhooks.GET("", handler.ListWebhooks)
+		webhooks.POST("", handler.CreateWebhook)
+		webhooks.GET("/:id", handler.GetWebhook)
+		webhooks.PUT("/:id", handler.UpdateWebhook)
+		webhooks.DELETE("/:id", handler.DeleteWebhook)
+		webhooks.GET("/:id/deliveries", handler.ListDeliveries)
+		webhooks.POST("/:id/deliveries/:delivery_id/redeliver", handler.Redeliver)
+	}
+}
+
+func setupSearchRoutes(r *gin.Engine, handler *Handler) {
+	r.GET("/search", handler.Search)
+}
+
 func setupHealthRoutes(r *gin.Engine, healthHandler *HealthHandler, metricsHandler *MetricsHandler) {
 	health := r.Group("/health")
 	{
@@ -3,9 +3,11 @@ package api
 import (
 	"crypto/md5"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -15,12 +17,18 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// s3DeleteMarkerHeader 响应涉及删除标记时返回 true
+const s3DeleteMarkerHeader = "X-Amz-Delete-Marker"
+
+// S3Handler S3 兼容接口处理器，Bucket 生命周期需要 Store 实现
 type S3Handler struct {
-	store *storage.Store
+	store storage.ObjectStore
+	node  *storage.Store
 }
 
-func NewS3Handler(store *storage.Store) *S3Handler {
-	return &S3Handler{store: store}
+func NewS3Handler(store storage.ObjectStore) *S3Handler {
+	node, _ := store.(*storage.Store)
+	return &S3Handler{store: store, node: node}
 }
 
 type ListBucketResult struct {
@@ -40,6 +48,43 @@ type S3Object struct {
 	StorageClass string `xml:"StorageClass"`
 }
 
+type ListVersionsResult struct {
+	XMLName             xml.Name          `xml:"ListVersionsResult"`
+	Name                string            `xml:"Name"`
+	Prefix              string            `xml:"Prefix"`
+	KeyMarker           string            `xml:"KeyMarker"`
+	VersionIdMarker     string            `xml:"VersionIdMarker"`
+	NextKeyMarker       string            `xml:"NextKeyMarker,omitempty"`
+	NextVersionIdMarker string            `xml:"NextVersionIdMarker,omitempty"`
+	MaxKeys             int               `xml:"MaxKeys"`
+	IsTruncated         bool              `xml:"IsTruncated"`
+	Versions            []S3ObjectVersion `xml:"Version"`
+	DeleteMarkers       []S3DeleteMarker  `xml:"DeleteMarker"`
+}
+
+type S3ObjectVersion struct {
+	Key          string `xml:"Key"`
+	VersionId    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         uint32 `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type S3DeleteMarker struct {
+	Key          string `xml:"Key"`
+	VersionId    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+}
+
+type CopyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+}
+
 type S3Error struct {
 	XMLName xml.Name `xml:"Error"`
 	Code    string   `xml:"Code"`
@@ -55,19 +100,60 @@ func (h *S3Handler) PutObject(c *gin.Context) {
 		return
 	}
 
+	if copySource := c.GetHeader("x-amz-copy-source"); copySource != "" {
+		h.copyObject(c, bucket, key, copySource)
+		return
+	}
+
 	data, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		h.sendS3Error(c, "InternalError", err.Error())
 		return
 	}
 
+	if err := verifyChecksums(c.Request.Header, data); err != nil {
+		if errors.Is(err, errBadDigest) {
+			h.sendS3Error(c, "BadDigest", err.Error())
+		} else {
+			h.sendS3Error(c, "InvalidDigest", err.Error())
+		}
+		return
+	}
+
 	contentType := c.GetHeader("Content-Type")
 	if contentType == "" {
 		contentType = "application/octet-stream"
 	}
 
+	expireTime, err := parseExpireTime(expiresAfter(c, false))
+	if err != nil {
+		h.sendS3Error(c, "InvalidArgument", err.Error())
+		return
+	}
+
+	userMeta, tags, err := s3Attributes(c)
+	if err != nil {
+		h.sendS3Error(c, "InvalidArgument", err.Error())
+		return
+	}
+
 	filename := fmt.Sprintf("%s/%s", bucket, key)
-	id, err := h.store.WriteWithMetadata(data, filename, contentType)
+	id, err := h.store.WriteVersion(data, storage.WriteOptions{
+		FileName:   filename,
+		MimeType:   contentType,
+		ExpireTime: expireTime,
+		Tenant:     tenantOf(c),
+		UserMeta:   userMeta,
+		Tags:       tags,
+	})
+	if err == storage.ErrQuotaExceeded {
+		h.sendS3Error(c, "QuotaExceeded", "The bucket or tenant storage quota has been exceeded")
+		return
+	}
+	if err == storage.ErrReplicaTimeout {
+		h.replicaTimeout(c, id, "The object was stored locally but no replica acknowledged it in time")
+		return
+	}
 	if err != nil {
 		h.sendS3Error(c, "InternalError", err.Error())
 		return
@@ -76,9 +162,101 @@ func (h *S3Handler) PutObject(c *gin.Context) {
 	etag := fmt.Sprintf("%x", md5.Sum(data))
 	c.Header("ETag", fmt.Sprintf("\"%s\"", etag))
 	c.Header("x-amz-request-id", fmt.Sprintf("%d", id))
+	c.Header("x-amz-version-id", strconv.FormatUint(id, 10))
 	c.Status(http.StatusOK)
 }
 
+// copyObject 处理带 x-amz-copy-source 的 PUT，复制指定版本时即为版本恢复
+func (h *S3Handler) copyObject(c *gin.Context, bucket, key, copySource string) {
+	if unescaped, err := url.PathUnescape(copySource); err == nil {
+		copySource = unescaped
+	}
+
+	source, versionID, _ := strings.Cut(strings.TrimPrefix(copySource, "/"), "?versionId=")
+	srcBucket, srcKey, found := strings.Cut(source, "/")
+	if !found || srcBucket == "" || srcKey == "" {
+		h.sendS3Error(c, "InvalidArgument", "Invalid copy source")
+		return
+	}
+
+	srcMeta, err := h.findObject(fmt.Sprintf("%s//%s", srcBucket, srcKey), versionID)
+	if err != nil || (srcMeta.DeleteMarker && versionID == "") {
+		h.sendS3Error(c, "NoSuchKey", "The specified copy source does not exist")
+		return
+	}
+	if srcMeta.DeleteMarker {
+		h.sendS3Error(c, "InvalidRequest", "The source of a copy request may not specifically refer to a delete marker by version id")
+		return
+	}
+
+	data, metadata, err := h.store.ReadWithMetadata(srcMeta.ID)
+	if err != nil {
+		h.sendS3Error(c, "InternalError", err.Error())
+		return
+	}
+
+	expireTime, err := parseExpireTime(expiresAfter(c, false))
+	if err != nil {
+		h.sendS3Error(c, "InvalidArgument", err.Error())
+		return
+	}
+
+	// 默认复制源对象的元数据和标签，指令为 REPLACE 时使用请求中给出的
+	userMeta, tags, err := s3Attributes(c)
+	if err != nil {
+		h.sendS3Error(c, "InvalidArgument", err.Error())
+		return
+	}
+	if !strings.EqualFold(c.GetHeader(s3MetadataDirective), "REPLACE") {
+		userMeta = metadata.UserMeta
+	}
+	if !strings.EqualFold(c.GetHeader(s3TagDirective), "REPLACE") {
+		tags = metadata.Tags
+	}
+
+	filename := fmt.Sprintf("%s/%s", bucket, key)
+	id, err := h.store.WriteVersion(data, storage.WriteOptions{
+		FileName:   filename,
+		MimeType:   metadata.MimeType,
+		ExpireTime: expireTime,
+		Tenant:     tenantOf(c),
+		UserMeta:   userMeta,
+		Tags:       tags,
+	})
+	if err == storage.ErrQuotaExceeded {
+		h.sendS3Error(c, "QuotaExceeded", "The bucket or tenant storage quota has been exceeded")
+		return
+	}
+	if err == storage.ErrReplicaTimeout {
+		h.replicaTimeout(c, id, "The object was stored locally but no replica acknowledged it in time")
+		return
+	}
+	if err != nil {
+		h.sendS3Error(c, "InternalError", err.Error())
+		return
+	}
+
+	c.Header("x-amz-version-id", strconv.FormatUint(id, 10))
+	c.Header("x-amz-copy-source-version-id", strconv.FormatUint(srcMeta.ID, 10))
+	c.XML(http.StatusOK, CopyObjectResult{
+		LastModified: time.Now().UTC().Format(time.RFC3339),
+		ETag:         fmt.Sprintf("\"%s\"", metadata.MD5),
+	})
+}
+
+// findObject 查找对象，versionID 为空时返回最新版本
+func (h *S3Handler) findObject(filename, versionID string) (*storage.FileMetadata, error) {
+	if versionID == "" {
+		return h.store.FindByFilename(filename)
+	}
+
+	id, err := strconv.ParseUint(versionID, 10, 64)
+	if err != nil {
+		return nil, storage.ErrNeedleNotFound
+	}
+	return h.store.GetVersion(filename, id)
+}
+
 func (h *S3Handler) GetObject(c *gin.Context) {
 	bucket := c.Param("bucket")
 	key := c.Param("key")
@@ -89,9 +267,23 @@ func (h *S3Handler) GetObject(c *gin.Context) {
 	}
 
 	filename := fmt.Sprintf("%s/%s", bucket, key)
-	meta, err := h.store.FindByFilename(filename)
+	versionID := c.Query("versionId")
+	meta, err := h.findObject(filename, versionID)
 	if err != nil {
-		h.sendS3Error(c, "NoSuchKey", "The specified key does not exist")
+		if versionID != "" {
+			h.sendS3Error(c, "NoSuchVersion", "The specified version does not exist")
+		} else {
+			h.sendS3Error(c, "NoSuchKey", "The specified key does not exist")
+		}
+		return
+	}
+	if meta.DeleteMarker {
+		setDeleteMarkerHeaders(c, meta)
+		if versionID != "" {
+			h.sendS3Error(c, "MethodNotAllowed", "The specified method is not allowed against a delete marker")
+		} else {
+			h.sendS3Error(c, "NoSuchKey", "The specified key does not exist")
+		}
 		return
 	}
 
@@ -104,7 +296,12 @@ func (h *S3Handler) GetObject(c *gin.Context) {
 	c.Header("Content-Type", metadata.MimeType)
 	c.Header("Content-Length", strconv.Itoa(len(data)))
 	c.Header("ETag", fmt.Sprintf("\"%s\"", metadata.MD5))
+	if metadata.SHA256 != "" {
+		c.Header("x-amz-checksum-sha256", hexToBase64(metadata.SHA256))
+	}
 	c.Header("Last-Modified", time.Unix(metadata.CreateTime, 0).Format(http.TimeFormat))
+	c.Header("x-amz-version-id", strconv.FormatUint(metadata.ID, 10))
+	setS3AttributeHeaders(c, metadata)
 	c.Data(http.StatusOK, metadata.MimeType, data)
 }
 
@@ -118,17 +315,49 @@ func (h *S3Handler) DeleteObject(c *gin.Context) {
 	}
 
 	filename := fmt.Sprintf("%s/%s", bucket, key)
-	meta, err := h.store.FindByFilename(filename)
+	versionID := c.Query("versionId")
+
+	// 未指定版本时写入删除标记，历史版本保留，删除该标记即可恢复对象
+	if versionID == "" {
+		id, err := h.store.WriteDeleteMarker(filename)
+		if err == storage.ErrNeedleNotFound {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		if err == storage.ErrReplicaTimeout {
+			c.Header(s3DeleteMarkerHeader, "true")
+			h.replicaTimeout(c, id, "The delete marker was stored locally but no replica acknowledged it in time")
+			return
+		}
+		if err != nil {
+			h.sendS3Error(c, "InternalError", err.Error())
+			return
+		}
+		c.Header(s3DeleteMarkerHeader, "true")
+		c.Header("x-amz-version-id", strconv.FormatUint(id, 10))
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	meta, err := h.findObject(filename, versionID)
 	if err != nil {
 		c.Status(http.StatusNoContent)
 		return
 	}
 
 	if err := h.store.Delete(meta.ID); err != nil {
+		if err == storage.ErrReplicaTimeout {
+			h.replicaTimeout(c, meta.ID, "The version was deleted locally but no replica acknowledged it in time")
+			return
+		}
 		h.sendS3Error(c, "InternalError", err.Error())
 		return
 	}
 
+	if meta.DeleteMarker {
+		c.Header(s3DeleteMarkerHeader, "true")
+	}
+	c.Header("x-amz-version-id", strconv.FormatUint(meta.ID, 10))
 	c.Status(http.StatusNoContent)
 }
 
@@ -163,6 +392,10 @@ func (h *S3Handler) ListObjects(c *gin.Context) {
 	}
 
 	for _, file := range files {
+		// 最新版本是删除标记的对象已被删除
+		if file.DeleteMarker {
+			continue
+		}
 		key := strings.TrimPrefix(file.FileName, bucket+"/")
 		result.Contents = append(result.Contents, S3Object{
 			Key:          key,
@@ -176,6 +409,94 @@ func (h *S3Handler) ListObjects(c *gin.Context) {
 	c.XML(http.StatusOK, result)
 }
 
+// ListObjectVersions 列出 Bucket 中对象的所有版本
+// 结果被截断时返回 NextKeyMarker 和 NextVersionIdMarker，作为下一页的 key-marker 和 version-id-marker
+func (h *S3Handler) ListObjectVersions(c *gin.Context) {
+	bucket := c.Param("bucket")
+	prefix := c.Query("prefix")
+	maxKeys := 1000
+
+	if maxKeysStr := c.Query("max-keys"); maxKeysStr != "" {
+		if mk, err := strconv.Atoi(maxKeysStr); err == nil && mk > 0 {
+			maxKeys = mk
+		}
+	}
+
+	searchPrefix := bucket + "/"
+	if prefix != "" {
+		searchPrefix = bucket + "/" + prefix
+	}
+
+	keyMarker := c.Query("key-marker")
+	versionIDMarker := c.Query("version-id-marker")
+	var after storage.VersionMarker
+	if keyMarker != "" {
+		after.FileName = bucket + "/" + keyMarker
+		if versionIDMarker != "" {
+			id, err := strconv.ParseUint(versionIDMarker, 10, 64)
+			if err != nil {
+				h.sendS3Error(c, "InvalidArgument", "Invalid version-id-marker")
+				return
+			}
+			after.ID = id
+		}
+	}
+
+	// 多取一条判断是否还有下一页
+	files, err := h.store.ListVersionsByPrefix(searchPrefix, after, maxKeys+1)
+	if err != nil {
+		h.sendS3Error(c, "InternalError", err.Error())
+		return
+	}
+
+	result := ListVersionsResult{
+		Name:            bucket,
+		Prefix:          prefix,
+		KeyMarker:       keyMarker,
+		VersionIdMarker: versionIDMarker,
+		MaxKeys:         maxKeys,
+		IsTruncated:     len(files) > maxKeys,
+		Versions:        make([]S3ObjectVersion, 0, len(files)),
+	}
+	if result.IsTruncated {
+		files = files[:maxKeys]
+		last := files[len(files)-1]
+		result.NextKeyMarker = strings.TrimPrefix(last.FileName, bucket+"/")
+		result.NextVersionIdMarker = strconv.FormatUint(last.ID, 10)
+	}
+
+	// 续传页的第一条可能不是该文件名的最新版本
+	lastName := ""
+	if after.ID > 0 {
+		lastName = after.FileName
+	}
+	for _, file := range files {
+		key := strings.TrimPrefix(file.FileName, bucket+"/")
+		latest := file.FileName != lastName
+		lastName = file.FileName
+		if file.DeleteMarker {
+			result.DeleteMarkers = append(result.DeleteMarkers, S3DeleteMarker{
+				Key:          key,
+				VersionId:    strconv.FormatUint(file.ID, 10),
+				IsLatest:     latest,
+				LastModified: time.Unix(file.CreateTime, 0).Format(time.RFC3339),
+			})
+			continue
+		}
+		result.Versions = append(result.Versions, S3ObjectVersion{
+			Key:          key,
+			VersionId:    strconv.FormatUint(file.ID, 10),
+			IsLatest:     latest,
+			LastModified: time.Unix(file.CreateTime, 0).Format(time.RFC3339),
+			ETag:         fmt.Sprintf("\"%s\"", file.MD5),
+			Size:         file.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+
+	c.XML(http.StatusOK, result)
+}
+
 func (h *S3Handler) HeadObject(c *gin.Context) {
 	bucket := c.Param("bucket")
 	key := c.Param("key")
@@ -186,32 +507,84 @@ func (h *S3Handler) HeadObject(c *gin.Context) {
 	}
 
 	filename := fmt.Sprintf("%s/%s", bucket, key)
-	meta, err := h.store.FindByFilename(filename)
+	versionID := c.Query("versionId")
+	metadata, err := h.findObject(filename, versionID)
 	if err != nil {
 		c.Status(http.StatusNotFound)
 		return
 	}
-
-	metadata, err := h.store.GetMetadata(meta.ID)
-	if err != nil {
-		c.Status(http.StatusNotFound)
+	if metadata.DeleteMarker {
+		setDeleteMarkerHeaders(c, metadata)
+		if versionID != "" {
+			c.Status(http.StatusMethodNotAllowed)
+		} else {
+			c.Status(http.StatusNotFound)
+		}
 		return
 	}
 
 	c.Header("Content-Type", metadata.MimeType)
 	c.Header("Content-Length", strconv.FormatUint(uint64(metadata.Size), 10))
 	c.Header("ETag", fmt.Sprintf("\"%s\"", metadata.MD5))
+	if metadata.SHA256 != "" {
+		c.Header("x-amz-checksum-sha256", hexToBase64(metadata.SHA256))
+	}
 	c.Header("Last-Modified", time.Unix(metadata.CreateTime, 0).Format(http.TimeFormat))
+	c.Header("x-amz-version-id", strconv.FormatUint(metadata.ID, 10))
+	setS3AttributeHeaders(c, metadata)
 	c.Status(http.StatusOK)
 }
 
+// s3Attributes 读取 x-amz-meta-* 和 x-amz-tagging 并校验
+func s3Attributes(c *gin.Context) (map[string]string, map[string]string, error) {
+	userMeta, tags, err := headerAttributes(c.Request.Header, s3MetaHeaderPrefix, s3TagHeader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := storage.ValidateUserMeta(userMeta); err != nil {
+		return nil, nil, err
+	}
+	if err := storage.ValidateTags(tags); err != nil {
+		return nil, nil, err
+	}
+	return userMeta, tags, nil
+}
+
+// setDeleteMarkerHeaders 读取到删除标记时返回标记的版本 ID
+func setDeleteMarkerHeaders(c *gin.Context, marker *storage.FileMetadata) {
+	c.Header(s3DeleteMarkerHeader, "true")
+	c.Header("x-amz-version-id", strconv.FormatUint(marker.ID, 10))
+}
+
+// setS3AttributeHeaders 返回用户元数据和标签数，与 S3 一样不在 GET/HEAD 中返回标签内容
+func setS3AttributeHeaders(c *gin.Context, meta *storage.FileMetadata) {
+	setAttributeHeaders(c.Writer.Header(), meta.UserMeta, s3MetaHeaderPrefix)
+	if len(meta.Tags) > 0 {
+		c.Header(s3TagCountHeader, strconv.Itoa(len(meta.Tags)))
+	}
+}
+
+// replicaTimeout 本地已写入或删除成功，只是副本未在超时前确认，返回 504 并给出版本 ID
+func (h *S3Handler) replicaTimeout(c *gin.Context, versionID uint64, message string) {
+	c.Header("x-amz-version-id", strconv.FormatUint(versionID, 10))
+	h.sendS3Error(c, "GatewayTimeout", message)
+}
+
 func (h *S3Handler) sendS3Error(c *gin.Context, code, message string) {
 	statusCode := http.StatusBadRequest
 	switch code {
-	case "NoSuchKey":
+	case "NoSuchKey", "NoSuchVersion", "NoSuchLifecycleConfiguration":
 		statusCode = http.StatusNotFound
+	case "MethodNotAllowed":
+		statusCode = http.StatusMethodNotAllowed
+	case "QuotaExceeded":
+		statusCode = http.StatusForbidden
 	case "InternalError":
 		statusCode = http.StatusInternalServerError
+	case "NotImplemented":
+		statusCode = http.StatusNotImplemented
+	case "GatewayTimeout":
+		statusCode = http.StatusGatewayTimeout
 	}
 
 	c.XML(statusCode, S3Error{
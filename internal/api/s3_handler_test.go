@@ -0,0 +1,231 @@
+package api
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"testing"
+
+	"haystack-lite/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func s3Put(t *testing.T, r http.Handler, target, body string, header map[string]string) {
+	t.Helper()
+	w := serve(r, http.MethodPut, target, bytes.NewBufferString(body), header)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT %s: %d %s", target, w.Code, w.Body.String())
+	}
+}
+
+func TestS3PutGetHead(t *testing.T) {
+	r, _ := newTestRouter(t)
+	s3Put(t, r, "/s3/photos/a.txt", "hello", map[string]string{
+		"Content-Type":      "text/plain",
+		"x-amz-meta-author": "alice",
+		"x-amz-tagging":     "env=prod&team=x",
+	})
+
+	w := serve(r, http.MethodGet, "/s3/photos/a.txt", nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Fatalf("GET: %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("x-amz-meta-author"); got != "alice" {
+		t.Errorf("x-amz-meta-author = %q, want alice", got)
+	}
+
+	w = serve(r, http.MethodHead, "/s3/photos/a.txt", nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Length") != "5" {
+		t.Fatalf("HEAD: %d, Content-Length %q", w.Code, w.Header().Get("Content-Length"))
+	}
+	if got := w.Header().Get("x-amz-tagging-count"); got != "2" {
+		t.Errorf("x-amz-tagging-count = %q, want 2", got)
+	}
+
+	if w = serve(r, http.MethodGet, "/s3/photos/missing.txt", nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("GET missing: %d, want 404", w.Code)
+	}
+
+	w = serve(r, http.MethodPut, "/s3/photos/b.txt", bytes.NewBufferString("x"), map[string]string{"Content-MD5": "AAAAAAAAAAAAAAAAAAAAAA=="})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("PUT with wrong Content-MD5: %d, want 400", w.Code)
+	}
+}
+
+func TestS3ListObjectVersionsPaging(t *testing.T) {
+	r, _ := newTestRouter(t)
+	for _, v := range []string{"v1", "v2", "v3"} {
+		s3Put(t, r, "/s3/bk/a.txt", v, nil)
+	}
+	s3Put(t, r, "/s3/bk/b.txt", "b", nil)
+
+	var all []S3ObjectVersion
+	target := "/s3/bk?versions&max-keys=2"
+	for page := 0; ; page++ {
+		if page > 3 {
+			t.Fatal("too many pages")
+		}
+		w := serve(r, http.MethodGet, target, nil, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list versions: %d %s", w.Code, w.Body.String())
+		}
+		var result ListVersionsResult
+		if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, result.Versions...)
+		if !result.IsTruncated {
+			break
+		}
+		if result.NextKeyMarker == "" || result.NextVersionIdMarker == "" {
+			t.Fatalf("truncated page without markers: %s", w.Body.String())
+		}
+		target = "/s3/bk?versions&max-keys=2&key-marker=" + result.NextKeyMarker + "&version-id-marker=" + result.NextVersionIdMarker
+	}
+
+	if len(all) != 4 {
+		t.Fatalf("got %d versions, want 4", len(all))
+	}
+	latest := 0
+	for _, v := range all {
+		if v.IsLatest {
+			latest++
+		}
+	}
+	if latest != 2 {
+		t.Fatalf("got %d latest versions, want 2", latest)
+	}
+}
+
+func TestS3DeleteWritesDeleteMarker(t *testing.T) {
+	r, _ := newTestRouter(t)
+	s3Put(t, r, "/s3/bk/a.txt", "v1", nil)
+	s3Put(t, r, "/s3/bk/a.txt", "v2", nil)
+
+	w := serve(r, http.MethodDelete, "/s3/bk/a.txt", nil, nil)
+	if w.Code != http.StatusNoContent || w.Header().Get("x-amz-delete-marker") != "true" {
+		t.Fatalf("DELETE: %d, x-amz-delete-marker %q", w.Code, w.Header().Get("x-amz-delete-marker"))
+	}
+	markerID := w.Header().Get("x-amz-version-id")
+
+	if w = serve(r, http.MethodGet, "/s3/bk/a.txt", nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("GET after DELETE: %d %q, want 404", w.Code, w.Body.String())
+	}
+	if w.Header().Get("x-amz-delete-marker") != "true" {
+		t.Errorf("GET after DELETE without x-amz-delete-marker")
+	}
+	if w = serve(r, http.MethodHead, "/s3/bk/a.txt", nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("HEAD after DELETE: %d, want 404", w.Code)
+	}
+	if w = serve(r, http.MethodGet, "/s3/bk/a.txt?versionId="+markerID, nil, nil); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET delete marker version: %d, want 405", w.Code)
+	}
+
+	var list ListBucketResult
+	w = serve(r, http.MethodGet, "/s3/bk", nil, nil)
+	if err := xml.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Contents) != 0 {
+		t.Fatalf("ListObjects after DELETE = %+v, want empty", list.Contents)
+	}
+
+	var versions ListVersionsResult
+	w = serve(r, http.MethodGet, "/s3/bk?versions", nil, nil)
+	if err := xml.Unmarshal(w.Body.Bytes(), &versions); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions.Versions) != 2 || len(versions.DeleteMarkers) != 1 {
+		t.Fatalf("ListObjectVersions: %d versions, %d delete markers, want 2 and 1", len(versions.Versions), len(versions.DeleteMarkers))
+	}
+	if m := versions.DeleteMarkers[0]; m.VersionId != markerID || !m.IsLatest {
+		t.Fatalf("delete marker = %+v, want latest %s", m, markerID)
+	}
+	for _, v := range versions.Versions {
+		if v.IsLatest {
+			t.Errorf("version %s is latest behind a delete marker", v.VersionId)
+		}
+	}
+
+	// 旧版本仍可按版本读取，删除标记被删除后对象恢复
+	oldest := versions.Versions[1].VersionId
+	if w = serve(r, http.MethodGet, "/s3/bk/a.txt?versionId="+oldest, nil, nil); w.Code != http.StatusOK || w.Body.String() != "v1" {
+		t.Fatalf("GET version %s: %d %q, want v1", oldest, w.Code, w.Body.String())
+	}
+	if w = serve(r, http.MethodDelete, "/s3/bk/a.txt?versionId="+markerID, nil, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE delete marker: %d", w.Code)
+	}
+	if w = serve(r, http.MethodGet, "/s3/bk/a.txt", nil, nil); w.Code != http.StatusOK || w.Body.String() != "v2" {
+		t.Fatalf("GET after removing delete marker: %d %q, want v2", w.Code, w.Body.String())
+	}
+}
+
+// replicaTimeoutStore 写入和删除在本地完成后报告副本确认超时
+type replicaTimeoutStore struct {
+	*storage.MemoryStore
+}
+
+func (s replicaTimeoutStore) WriteVersion(data []byte, opts storage.WriteOptions) (uint64, error) {
+	id, err := s.MemoryStore.WriteVersion(data, opts)
+	if err != nil {
+		return id, err
+	}
+	return id, storage.ErrReplicaTimeout
+}
+
+func (s replicaTimeoutStore) WriteDeleteMarker(filename string) (uint64, error) {
+	id, err := s.MemoryStore.WriteDeleteMarker(filename)
+	if err != nil {
+		return id, err
+	}
+	return id, storage.ErrReplicaTimeout
+}
+
+func (s replicaTimeoutStore) Delete(id uint64) error {
+	if err := s.MemoryStore.Delete(id); err != nil {
+		return err
+	}
+	return storage.ErrReplicaTimeout
+}
+
+// 副本确认超时时返回 504 和版本 ID，对象已在本地写入或删除
+func TestS3ReplicaTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	r := gin.New()
+	SetupRoutes(r, replicaTimeoutStore{storage.NewMemoryStore()})
+
+	steps := []struct {
+		name, method, target, body string
+		header                     map[string]string
+		get                        int // 之后 GET /s3/bk/a.txt 的状态码
+	}{
+		{"put", http.MethodPut, "/s3/bk/a.txt", "v1", nil, http.StatusOK},
+		{"copy", http.MethodPut, "/s3/bk/b.txt", "", map[string]string{"x-amz-copy-source": "/bk/a.txt"}, http.StatusOK},
+		{"delete", http.MethodDelete, "/s3/bk/a.txt", "", nil, http.StatusNotFound},
+	}
+	var markerID string
+	for _, step := range steps {
+		w := serve(r, step.method, step.target, bytes.NewBufferString(step.body), step.header)
+		var s3Err S3Error
+		if w.Code != http.StatusGatewayTimeout || xml.Unmarshal(w.Body.Bytes(), &s3Err) != nil || s3Err.Code != "GatewayTimeout" {
+			t.Fatalf("%s: %d %s, want 504 GatewayTimeout", step.name, w.Code, w.Body.String())
+		}
+		if markerID = w.Header().Get("x-amz-version-id"); markerID == "" {
+			t.Errorf("%s: 504 without x-amz-version-id", step.name)
+		}
+		if w = serve(r, http.MethodGet, "/s3/bk/a.txt", nil, nil); w.Code != step.get {
+			t.Errorf("GET after %s: %d, want %d", step.name, w.Code, step.get)
+		}
+	}
+
+	// 删除删除标记恢复最新版本
+	w := serve(r, http.MethodDelete, "/s3/bk/a.txt?versionId="+markerID, nil, nil)
+	if w.Code != http.StatusGatewayTimeout || w.Header().Get("x-amz-version-id") != markerID {
+		t.Fatalf("DELETE delete marker: %d, version %q, want 504 and %s", w.Code, w.Header().Get("x-amz-version-id"), markerID)
+	}
+	if w = serve(r, http.MethodGet, "/s3/bk/a.txt", nil, nil); w.Code != http.StatusOK || w.Body.String() != "v1" {
+		t.Errorf("GET after deleting the delete marker: %d %q, want v1", w.Code, w.Body.String())
+	}
+}
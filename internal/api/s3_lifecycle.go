@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"haystack-lite/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LifecycleConfiguration S3 生命周期配置，只支持按前缀过期删除
+type LifecycleConfiguration struct {
+	XMLName xml.Name          `xml:"LifecycleConfiguration"`
+	Rules   []S3LifecycleRule `xml:"Rule"`
+}
+
+type S3LifecycleRule struct {
+	ID         string             `xml:"ID,omitempty"`
+	Prefix     string             `xml:"Prefix,omitempty"`
+	Filter     *S3LifecycleFilter `xml:"Filter,omitempty"`
+	Status     string             `xml:"Status"`
+	Expiration S3Expiration       `xml:"Expiration"`
+}
+
+type S3LifecycleFilter struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type S3Expiration struct {
+	Days int `xml:"Days"`
+}
+
+// PutBucketLifecycle 设置 Bucket 生命周期规则（PutBucketLifecycleConfiguration 子集）
+func (h *S3Handler) PutBucketLifecycle(c *gin.Context) {
+	if !h.requireNode(c) {
+		return
+	}
+
+	bucket := c.Param("bucket")
+
+	var config LifecycleConfiguration
+	if err := xml.NewDecoder(c.Request.Body).Decode(&config); err != nil {
+		h.sendS3Error(c, "MalformedXML", "The XML you provided was not well-formed")
+		return
+	}
+
+	rules := make([]*storage.LifecycleRule, 0, len(config.Rules))
+	for _, r := range config.Rules {
+		if r.Expiration.Days <= 0 {
+			h.sendS3Error(c, "InvalidArgument", "Expiration days must be a positive integer")
+			return
+		}
+
+		prefix := r.Prefix
+		if r.Filter != nil {
+			prefix = r.Filter.Prefix
+		}
+
+		// 对象文件名由 bucket 和以 "/" 开头的 key 拼接而成
+		rules = append(rules, &storage.LifecycleRule{
+			RuleID:     r.ID,
+			Prefix:     fmt.Sprintf("%s/%s", bucket, "/"+prefix),
+			ExpireDays: r.Expiration.Days,
+			Enabled:    strings.EqualFold(r.Status, "Enabled"),
+		})
+	}
+
+	if err := h.node.PutBucketLifecycle(bucket, rules); err != nil {
+		h.sendS3Error(c, "InternalError", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// GetBucketLifecycle 获取 Bucket 生命周期规则
+func (h *S3Handler) GetBucketLifecycle(c *gin.Context) {
+	if !h.requireNode(c) {
+		return
+	}
+
+	bucket := c.Param("bucket")
+
+	rules, err := h.node.GetBucketLifecycle(bucket)
+	if err != nil {
+		h.sendS3Error(c, "InternalError", err.Error())
+		return
+	}
+	if len(rules) == 0 {
+		h.sendS3Error(c, "NoSuchLifecycleConfiguration", "The lifecycle configuration does not exist")
+		return
+	}
+
+	config := LifecycleConfiguration{Rules: make([]S3LifecycleRule, 0, len(rules))}
+	for _, rule := range rules {
+		status := "Disabled"
+		if rule.Enabled {
+			status = "Enabled"
+		}
+		config.Rules = append(config.Rules, S3LifecycleRule{
+			ID:         rule.RuleID,
+			Filter:     &S3LifecycleFilter{Prefix: strings.TrimPrefix(rule.Prefix, bucket+"//")},
+			Status:     status,
+			Expiration: S3Expiration{Days: rule.ExpireDays},
+		})
+	}
+
+	c.XML(http.StatusOK, config)
+}
+
+// DeleteBucketLifecycle 删除 Bucket 生命周期规则
+func (h *S3Handler) DeleteBucketLifecycle(c *gin.Context) {
+	if !h.requireNode(c) {
+		return
+	}
+
+	if err := h.node.PutBucketLifecycle(c.Param("bucket"), nil); err != nil {
+		h.sendS3Error(c, "InternalError", err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// requireNode Bucket 生命周期保存在 Store 中，其它 ObjectStore 实现返回 NotImplemented
+func (h *S3Handler) requireNode(c *gin.Context) bool {
+	if h.node == nil {
+		h.sendS3Error(c, "NotImplemented", "Bucket lifecycle is not supported by this storage backend")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"haystack-lite/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 全文检索每页的默认和最大条数
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// Search 全文检索文本文件，q 中的所有词都需出现，结果按相关度排序
+// 索引在后台增量更新，刚写入的文件可能要过几秒才能搜到
+func (h *Handler) Search(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing q"})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit)})
+			return
+		}
+		limit = n
+	}
+	offset := 0
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+			return
+		}
+		offset = n
+	}
+
+	result, err := h.node.Search(query, offset, limit)
+	switch {
+	case err == nil:
+	case err == storage.ErrSearchDisabled:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, storage.ErrInvalidQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query contains no searchable words"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]gin.H, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		results = append(results, gin.H{
+			"id":         hit.Meta.ID,
+			"filename":   hit.Meta.FileName,
+			"mime_type":  hit.Meta.MimeType,
+			"size":       hit.Meta.Size,
+			"created_at": hit.Meta.CreateTime,
+			"score":      hit.Score,
+			"snippet":    hit.Snippet,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   query,
+		"total":   result.Total,
+		"offset":  offset,
+		"limit":   limit,
+		"results": results,
+	})
+}
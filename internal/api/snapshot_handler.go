@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"haystack-lite/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Snapshot 创建整个存储的一致性快照，archive=true 时打包为 tar.gz
+func (h *Handler) Snapshot(c *gin.Context) {
+	archive := c.Query("archive") == "true"
+
+	manifest, err := h.node.Snapshot(h.node.SnapshotDir(), archive)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, manifest)
+}
+
+// Changes 导出序列号大于 since 的增量备份（tar.gz）
+// wait 大于 0 时没有新变更会等待最多 wait 秒；副本通过 X-Replica-ID 头拉取，since 即为其确认进度
+func (h *Handler) Changes(c *gin.Context) {
+	since, err := strconv.ParseUint(c.DefaultQuery("since", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+		return
+	}
+
+	if replicaID := c.GetHeader(storage.ReplicaIDHeader); replicaID != "" {
+		h.node.AckReplica(replicaID, since)
+	}
+
+	wait, _ := strconv.Atoi(c.DefaultQuery("wait", "0"))
+	if wait > 60 {
+		wait = 60
+	}
+	h.node.WaitForChanges(since, time.Duration(wait)*time.Second)
+
+	cs, err := h.node.Changes(since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=changes-%d-%d.tar.gz", cs.Since, cs.Until))
+	c.Header("X-Changes-Since", strconv.FormatUint(cs.Since, 10))
+	c.Header("X-Changes-Until", strconv.FormatUint(cs.Until, 10))
+	c.Status(http.StatusOK)
+
+	if err := h.node.WriteChanges(c.Writer, cs); err != nil {
+		// 响应头已发送，只能中断连接
+		log.Printf("Failed to write changes since %d: %v", since, err)
+		c.Abort()
+	}
+}
+
+// Replication 查看复制状态
+func (h *Handler) Replication(c *gin.Context) {
+	c.JSON(http.StatusOK, h.node.ReplicationStatus())
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"haystack-lite/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListTrash 列出回收站中可恢复的文件
+func (h *Handler) ListTrash(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	files, total, err := h.node.ListTrash((page-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	retention := int64(h.node.TrashRetention())
+	result := make([]gin.H, 0, len(files))
+	for _, f := range files {
+		result = append(result, gin.H{
+			"id":         f.ID,
+			"filename":   f.FileName,
+			"mime_type":  f.MimeType,
+			"size":       f.Size,
+			"md5":        f.MD5,
+			"created_at": f.CreateTime,
+			"deleted_at": f.DeleteTime,
+			"expires_at": f.DeleteTime + retention,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"files":      result,
+		"total":      total,
+		"page":       page,
+		"page_size":  pageSize,
+		"total_page": (int(total) + pageSize - 1) / pageSize,
+		"retention":  retention,
+	})
+}
+
+// RestoreTrash 从回收站恢复文件
+func (h *Handler) RestoreTrash(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.node.Restore(id); err != nil {
+		if err == storage.ErrNeedleNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found in trash"})
+		} else if err == storage.ErrQuotaExceeded {
+			quotaExceeded(c)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "message": "restored"})
+}
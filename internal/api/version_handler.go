@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"haystack-lite/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListVersions 列出文件名的所有版本
+func (h *Handler) ListVersions(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name required"})
+		return
+	}
+
+	versions, err := h.node.ListVersions(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, 0, len(versions))
+	for i, v := range versions {
+		result = append(result, gin.H{
+			"version_id": strconv.FormatUint(v.ID, 10),
+			"id":         v.ID,
+			"is_latest":  i == 0,
+			"size":       v.Size,
+			"md5":        v.MD5,
+			"mime_type":  v.MimeType,
+			"created_at": v.CreateTime,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":     name,
+		"versions": result,
+		"total":    len(result),
+	})
+}
+
+// RestoreVersion 将历史版本恢复为最新版本
+func (h *Handler) RestoreVersion(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	newID, err := h.node.RestoreVersion(id)
+	if err != nil {
+		if err == storage.ErrNeedleNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		} else if err == storage.ErrQuotaExceeded {
+			quotaExceeded(c)
+		} else if err == storage.ErrReplicaTimeout {
+			// 本地已恢复成功，只是副本未在超时前确认
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error(), "id": newID, "restored_from": id})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":            newID,
+		"restored_from": id,
+	})
+}
+
+// GetBucketSettings 获取 Bucket 配置
+func (h *Handler) GetBucketSettings(c *gin.Context) {
+	settings, err := h.node.GetBucketSettings(c.Param("bucket"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bucket":        settings.Name,
+		"keep_versions": settings.KeepVersions,
+	})
+}
+
+// PutBucketSettings 修改 Bucket 配置
+func (h *Handler) PutBucketSettings(c *gin.Context) {
+	var req struct {
+		KeepVersions *int `json:"keep_versions" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	// -1 表示不限，0 表示不保留历史版本
+	if *req.KeepVersions < -1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "keep_versions must be -1 or greater"})
+		return
+	}
+
+	settings := &storage.BucketSettings{
+		Name:         c.Param("bucket"),
+		KeepVersions: *req.KeepVersions,
+	}
+	if err := h.node.SetBucketSettings(settings); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bucket":        settings.Name,
+		"keep_versions": settings.KeepVersions,
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,16 +17,17 @@ import (
 )
 
 type WebDAVHandler struct {
-	store *storage.Store
+	store storage.ObjectStore
 }
 
-func NewWebDAVHandler(store *storage.Store) *WebDAVHandler {
+func NewWebDAVHandler(store storage.ObjectStore) *WebDAVHandler {
 	return &WebDAVHandler{store: store}
 }
 
 type Multistatus struct {
 	XMLName   xml.Name   `xml:"D:multistatus"`
 	Xmlns     string     `xml:"xmlns:D,attr"`
+	XmlnsH    string     `xml:"xmlns:H,attr,omitempty"`
 	Responses []Response `xml:"D:response"`
 }
 
@@ -46,6 +48,42 @@ type Prop struct {
 	GetContentLength string        `xml:"D:getcontentlength,omitempty"`
 	GetContentType   string        `xml:"D:getcontenttype,omitempty"`
 	ResourceType     *ResourceType `xml:"D:resourcetype,omitempty"`
+	// RFC 4331 配额属性
+	QuotaAvailableBytes string `xml:"D:quota-available-bytes,omitempty"`
+	QuotaUsedBytes      string `xml:"D:quota-used-bytes,omitempty"`
+	// 用户元数据和标签，命名空间为 haystackNamespace
+	Metadata *DAVAttributes `xml:"H:metadata,omitempty"`
+	Tags     *DAVAttributes `xml:"H:tags,omitempty"`
+}
+
+// haystackNamespace 自定义 WebDAV 属性的命名空间
+const haystackNamespace = "urn:haystack-lite:"
+
+// DAVAttributes 以 <H:entry name="键">值</H:entry> 列出元数据或标签
+type DAVAttributes struct {
+	Entries []DAVAttribute `xml:"H:entry"`
+}
+
+type DAVAttribute struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+// davAttributes 按键排序，没有时返回 nil 以省略属性
+func davAttributes(m map[string]string) *DAVAttributes {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := &DAVAttributes{Entries: make([]DAVAttribute, 0, len(keys))}
+	for _, k := range keys {
+		attrs.Entries = append(attrs.Entries, DAVAttribute{Name: k, Value: m[k]})
+	}
+	return attrs
 }
 
 type ResourceType struct {
@@ -71,23 +109,15 @@ func (h *WebDAVHandler) PropFind(c *gin.Context) {
 
 	multistatus := Multistatus{
 		Xmlns:     "DAV:",
+		XmlnsH:    haystackNamespace,
 		Responses: []Response{},
 	}
 
 	if urlPath == "/" {
-		multistatus.Responses = append(multistatus.Responses, Response{
-			Href: "/",
-			Propstat: Propstat{
-				Prop: Prop{
-					DisplayName:  "root",
-					ResourceType: &ResourceType{Collection: &struct{}{}},
-				},
-				Status: "HTTP/1.1 200 OK",
-			},
-		})
+		multistatus.Responses = append(multistatus.Responses, h.collectionResponse("/", "root", "", tenantOf(c)))
 
 		if depth != "0" {
-			files, err := h.store.ListAll()
+			files, err := h.listFiles("")
 			if err == nil {
 				for _, file := range files {
 					multistatus.Responses = append(multistatus.Responses, h.fileToResponse(file))
@@ -96,9 +126,26 @@ func (h *WebDAVHandler) PropFind(c *gin.Context) {
 		}
 	} else {
 		cleanPath := strings.TrimPrefix(urlPath, "/")
-		meta, err := h.store.FindByFilename(cleanPath)
+		meta, err := h.findFile(cleanPath)
 		if err != nil {
-			c.Status(http.StatusNotFound)
+			// 不是文件时按目录处理，目录下没有文件则不存在
+			prefix := strings.TrimSuffix(cleanPath, "/") + "/"
+			files, err := h.listFiles(prefix)
+			if err != nil || len(files) == 0 {
+				c.Status(http.StatusNotFound)
+				return
+			}
+
+			multistatus.Responses = append(multistatus.Responses,
+				h.collectionResponse("/"+prefix, path.Base(prefix), prefix, tenantOf(c)))
+			if depth != "0" {
+				for _, file := range files {
+					multistatus.Responses = append(multistatus.Responses, h.fileToResponse(file))
+				}
+			}
+
+			c.Header("Content-Type", "application/xml; charset=utf-8")
+			c.XML(http.StatusMultiStatus, multistatus)
 			return
 		}
 
@@ -122,7 +169,7 @@ func (h *WebDAVHandler) Get(c *gin.Context) {
 		return
 	}
 
-	meta, err := h.store.FindByFilename(urlPath)
+	meta, err := h.findFile(urlPath)
 	if err != nil {
 		c.Status(http.StatusNotFound)
 		return
@@ -137,6 +184,7 @@ func (h *WebDAVHandler) Get(c *gin.Context) {
 	c.Header("Content-Type", metadata.MimeType)
 	c.Header("Content-Length", strconv.Itoa(len(data)))
 	c.Header("Last-Modified", time.Unix(metadata.CreateTime, 0).Format(http.TimeFormat))
+	setAttributeHeaders(c.Writer.Header(), metadata.UserMeta, metaHeaderPrefix)
 	c.Data(http.StatusOK, metadata.MimeType, data)
 }
 
@@ -153,20 +201,48 @@ func (h *WebDAVHandler) Put(c *gin.Context) {
 		return
 	}
 
+	if err := verifyChecksums(c.Request.Header, data); err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
 	contentType := c.GetHeader("Content-Type")
 	if contentType == "" {
 		contentType = "application/octet-stream"
 	}
 
-	existingMeta, _ := h.store.FindByFilename(urlPath)
-	if existingMeta != nil {
-		if err := h.store.Delete(existingMeta.ID); err != nil {
-			c.Status(http.StatusInternalServerError)
-			return
-		}
+	expireTime, err := parseExpireTime(expiresAfter(c, false))
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	userMeta, tags, err := uploadAttributes(c, false)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
 	}
 
-	_, err = h.store.WriteWithMetadata(data, urlPath, contentType)
+	// 覆盖写入生成新版本，旧版本按 Bucket 配置保留
+	existingMeta, _ := h.findFile(urlPath)
+
+	_, err = h.store.WriteVersion(data, storage.WriteOptions{
+		FileName:   urlPath,
+		MimeType:   contentType,
+		ExpireTime: expireTime,
+		Tenant:     tenantOf(c),
+		UserMeta:   userMeta,
+		Tags:       tags,
+	})
+	if err == storage.ErrQuotaExceeded {
+		c.Status(http.StatusInsufficientStorage)
+		return
+	}
+	if err == storage.ErrReplicaTimeout {
+		// 本地已写入成功，只是副本未在超时前确认
+		c.Status(http.StatusGatewayTimeout)
+		return
+	}
 	if err != nil {
 		c.Status(http.StatusInternalServerError)
 		return
@@ -186,13 +262,17 @@ func (h *WebDAVHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	meta, err := h.store.FindByFilename(urlPath)
+	meta, err := h.findFile(urlPath)
 	if err != nil {
 		c.Status(http.StatusNotFound)
 		return
 	}
 
-	if err := h.store.Delete(meta.ID); err != nil {
+	if _, err := h.store.DeleteAllVersions(meta.FileName); err != nil {
+		if err == storage.ErrReplicaTimeout {
+			c.Status(http.StatusGatewayTimeout)
+			return
+		}
 		c.Status(http.StatusInternalServerError)
 		return
 	}
@@ -204,6 +284,57 @@ func (h *WebDAVHandler) MkCol(c *gin.Context) {
 	c.Status(http.StatusCreated)
 }
 
+// findFile 按文件名查找最新版本，最新版本是删除标记时视为不存在
+func (h *WebDAVHandler) findFile(name string) (*storage.FileMetadata, error) {
+	meta, err := h.store.FindByFilename(name)
+	if err != nil {
+		return nil, err
+	}
+	if meta.DeleteMarker {
+		return nil, storage.ErrNeedleNotFound
+	}
+	return meta, nil
+}
+
+// listFiles 按前缀列出文件的最新版本，跳过已被删除标记隐藏的文件
+func (h *WebDAVHandler) listFiles(prefix string) ([]*storage.FileMetadata, error) {
+	files, err := h.store.ListByPrefix(prefix, 0)
+	if err != nil {
+		return nil, err
+	}
+	visible := files[:0]
+	for _, file := range files {
+		if !file.DeleteMarker {
+			visible = append(visible, file)
+		}
+	}
+	return visible, nil
+}
+
+// collectionResponse 生成目录响应，目录受配额限制时附带配额属性
+func (h *WebDAVHandler) collectionResponse(href, displayName, prefix, tenant string) Response {
+	prop := Prop{
+		DisplayName:  displayName,
+		ResourceType: &ResourceType{Collection: &struct{}{}},
+	}
+
+	if quotas, ok := h.store.(storage.QuotaReporter); ok {
+		quota, err := quotas.QuotaFor(prefix, tenant)
+		if err == nil && quota != nil {
+			prop.QuotaAvailableBytes = strconv.FormatInt(quota.AvailableBytes(), 10)
+			prop.QuotaUsedBytes = strconv.FormatInt(quota.UsedBytes, 10)
+		}
+	}
+
+	return Response{
+		Href: href,
+		Propstat: Propstat{
+			Prop:   prop,
+			Status: "HTTP/1.1 200 OK",
+		},
+	}
+}
+
 func (h *WebDAVHandler) fileToResponse(file *storage.FileMetadata) Response {
 	return Response{
 		Href: "/" + file.FileName,
@@ -214,6 +345,8 @@ func (h *WebDAVHandler) fileToResponse(file *storage.FileMetadata) Response {
 				GetLastModified:  time.Unix(file.CreateTime, 0).Format(http.TimeFormat),
 				GetContentLength: strconv.FormatUint(uint64(file.Size), 10),
 				GetContentType:   file.MimeType,
+				Metadata:         davAttributes(file.UserMeta),
+				Tags:             davAttributes(file.Tags),
 			},
 			Status: "HTTP/1.1 200 OK",
 		},
@@ -230,6 +363,8 @@ func (h *WebDAVHandler) metadataToResponse(metadata *storage.FileMetadata) Respo
 				GetLastModified:  time.Unix(metadata.CreateTime, 0).Format(http.TimeFormat),
 				GetContentLength: fmt.Sprintf("%d", metadata.Size),
 				GetContentType:   metadata.MimeType,
+				Metadata:         davAttributes(metadata.UserMeta),
+				Tags:             davAttributes(metadata.Tags),
 			},
 			Status: "HTTP/1.1 200 OK",
 		},
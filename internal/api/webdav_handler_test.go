@@ -0,0 +1,47 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWebDAVPutGetPropFindDelete(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	w := serve(r, http.MethodPut, "/webdav/docs/a.txt", bytes.NewBufferString("first"), map[string]string{
+		"Content-Type": "text/plain",
+		"X-Meta-Owner": "alice",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("PUT new file: %d", w.Code)
+	}
+	if w = serve(r, http.MethodPut, "/webdav/docs/a.txt", bytes.NewBufferString("second"), nil); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT overwrite: %d", w.Code)
+	}
+
+	w = serve(r, http.MethodGet, "/webdav/docs/a.txt", nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "second" {
+		t.Fatalf("GET: %d %q", w.Code, w.Body.String())
+	}
+
+	w = serve(r, "PROPFIND", "/webdav/docs/", nil, map[string]string{"Depth": "1"})
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND: %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "/docs/a.txt") {
+		t.Fatalf("PROPFIND does not list the file: %s", body)
+	}
+
+	if w = serve(r, "PROPFIND", "/webdav/missing/", nil, map[string]string{"Depth": "1"}); w.Code != http.StatusNotFound {
+		t.Fatalf("PROPFIND missing collection: %d, want 404", w.Code)
+	}
+
+	if w = serve(r, http.MethodDelete, "/webdav/docs/a.txt", nil, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: %d", w.Code)
+	}
+	if w = serve(r, http.MethodGet, "/webdav/docs/a.txt", nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("GET after DELETE: %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"haystack-lite/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+type webhookRequest struct {
+	URL     string   `json:"url" binding:"required"`
+	Secret  string   `json:"secret"`
+	Bucket  string   `json:"bucket"`
+	Prefix  string   `json:"prefix"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// ListWebhooks 列出所有 Webhook
+func (h *Handler) ListWebhooks(c *gin.Context) {
+	hooks, err := h.node.ListWebhooks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, 0, len(hooks))
+	for _, hook := range hooks {
+		result = append(result, webhookJSON(hook))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": result,
+		"total":    len(result),
+	})
+}
+
+// CreateWebhook 注册 Webhook
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	hook := &storage.Webhook{Enabled: true}
+	applyWebhookRequest(hook, &req)
+	if err := h.node.SaveWebhook(hook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhookJSON(hook))
+}
+
+// GetWebhook 获取 Webhook
+func (h *Handler) GetWebhook(c *gin.Context) {
+	hook, ok := h.webhookParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, webhookJSON(hook))
+}
+
+// UpdateWebhook 修改 Webhook
+func (h *Handler) UpdateWebhook(c *gin.Context) {
+	hook, ok := h.webhookParam(c)
+	if !ok {
+		return
+	}
+
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	applyWebhookRequest(hook, &req)
+	if err := h.node.SaveWebhook(hook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookJSON(hook))
+}
+
+// DeleteWebhook 删除 Webhook 及其投递记录
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.node.DeleteWebhook(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// ListDeliveries 列出 Webhook 的投递记录，可按 status 过滤
+func (h *Handler) ListDeliveries(c *gin.Context) {
+	hook, ok := h.webhookParam(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	deliveries, err := h.node.ListDeliveries(hook.ID, c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, 0, len(deliveries))
+	for _, d := range deliveries {
+		result = append(result, deliveryJSON(d))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhook_id": hook.ID,
+		"deliveries": result,
+		"total":      len(result),
+	})
+}
+
+// Redeliver 立即重新投递一条记录
+func (h *Handler) Redeliver(c *gin.Context) {
+	id, err1 := strconv.ParseUint(c.Param("id"), 10, 64)
+	deliveryID, err2 := strconv.ParseUint(c.Param("delivery_id"), 10, 64)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	delivery, err := h.node.Redeliver(id, deliveryID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveryJSON(delivery))
+}
+
+// webhookParam 读取路径中的 Webhook，不存在时返回错误响应
+func (h *Handler) webhookParam(c *gin.Context) (*storage.Webhook, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil, false
+	}
+
+	hook, err := h.node.GetWebhook(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return nil, false
+	}
+	return hook, true
+}
+
+func applyWebhookRequest(hook *storage.Webhook, req *webhookRequest) {
+	hook.URL = req.URL
+	hook.Secret = req.Secret
+	hook.Bucket = req.Bucket
+	hook.Prefix = req.Prefix
+	hook.Events = strings.Join(req.Events, ",")
+	if req.Enabled != nil {
+		hook.Enabled = *req.Enabled
+	}
+}
+
+func webhookJSON(hook *storage.Webhook) gin.H {
+	events := hook.EventTypes()
+	if events == nil {
+		events = []string{}
+	}
+	return gin.H{
+		"id":          hook.ID,
+		"url":         hook.URL,
+		"bucket":      hook.Bucket,
+		"prefix":      hook.Prefix,
+		"events":      events,
+		"enabled":     hook.Enabled,
+		"signed":      hook.Secret != "",
+		"create_time": hook.CreateTime.Unix(),
+	}
+}
+
+func deliveryJSON(d *storage.WebhookDelivery) gin.H {
+	return gin.H{
+		"id":            d.ID,
+		"webhook_id":    d.WebhookID,
+		"event":         d.EventType,
+		"file_id":       d.FileID,
+		"payload":       json.RawMessage(d.Payload),
+		"status":        d.Status,
+		"attempts":      d.Attempts,
+		"next_attempt":  d.NextAttempt,
+		"response_code": d.ResponseCode,
+		"last_error":    d.LastError,
+		"create_time":   d.CreateTime.Unix(),
+		"update_time":   d.UpdateTime.Unix(),
+	}
+}
@@ -0,0 +1,315 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"haystack-lite/internal/config"
+)
+
+var (
+	ErrNoWritableNode = errors.New("no writable store node")
+	ErrVolumeNotFound = errors.New("volume not found")
+	ErrInvalidFID     = errors.New("invalid file id")
+)
+
+// Node 存储节点
+type Node struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	VolumeBase    uint32   `json:"volume_base"` // 节点可使用的 Volume ID 为 (VolumeBase, VolumeBase+VolumeRange]
+	Capacity      int64    `json:"capacity"`
+	Used          int64    `json:"used"`
+	Free          int64    `json:"free"`
+	Volumes       []Volume `json:"volumes"`
+	LastHeartbeat int64    `json:"last_heartbeat"`
+	Alive         bool     `json:"alive"`
+}
+
+// Volume 存储节点汇报的逻辑 Volume
+type Volume struct {
+	ID       uint32 `json:"id"`
+	Size     int64  `json:"size"`
+	MaxSize  int64  `json:"max_size"`
+	Writable bool   `json:"writable"`
+}
+
+// Heartbeat 存储节点定期发送的心跳
+type Heartbeat struct {
+	NodeID   string   `json:"node_id"`
+	URL      string   `json:"url"`
+	Capacity int64    `json:"capacity"`
+	Used     int64    `json:"used"`
+	Volumes  []Volume `json:"volumes"`
+}
+
+// Assignment 目录服务分配的写入位置
+type Assignment struct {
+	FID      string `json:"fid"`
+	ID       uint64 `json:"id"`
+	VolumeID uint32 `json:"volume_id"`
+	NodeID   string `json:"node_id"`
+	URL      string `json:"url"`
+	Count    int    `json:"count"`
+}
+
+// directoryState 目录服务持久化的状态
+type directoryState struct {
+	NextID    uint64            `json:"next_id"`
+	NextBase  uint32            `json:"next_base"`
+	NodeBases map[string]uint32 `json:"node_bases"`
+	NodeURLs  map[string]string `json:"node_urls"`
+}
+
+// Directory 目录服务：分配文件 ID，维护逻辑 Volume 到存储节点的映射
+type Directory struct {
+	cfg   config.ClusterConfig
+	mu    sync.Mutex
+	state directoryState
+	nodes map[string]*Node
+}
+
+// NewDirectory 创建目录服务并加载已保存的状态
+func NewDirectory(cfg config.ClusterConfig) (*Directory, error) {
+	if cfg.VolumeRange == 0 {
+		cfg.VolumeRange = 10000
+	}
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = 5
+	}
+
+	d := &Directory{
+		cfg: cfg,
+		state: directoryState{
+			NextID:    1,
+			NodeBases: make(map[string]uint32),
+			NodeURLs:  make(map[string]string),
+		},
+		nodes: make(map[string]*Node),
+	}
+
+	data, err := os.ReadFile(cfg.StateFile)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read directory state: %w", err)
+	default:
+		if err := json.Unmarshal(data, &d.state); err != nil {
+			return nil, fmt.Errorf("invalid directory state %s: %w", cfg.StateFile, err)
+		}
+	}
+
+	// 已注册过的节点在重启后等待心跳恢复
+	for id, base := range d.state.NodeBases {
+		d.nodes[id] = &Node{ID: id, URL: d.state.NodeURLs[id], VolumeBase: base}
+	}
+
+	log.Printf("Directory loaded: next id %d, %d known nodes", d.state.NextID, len(d.nodes))
+	return d, nil
+}
+
+// Heartbeat 处理存储节点的注册和心跳，返回节点的 Volume ID 起点
+func (d *Directory) Heartbeat(hb *Heartbeat) (*Node, error) {
+	if hb.NodeID == "" || hb.URL == "" {
+		return nil, fmt.Errorf("node_id and url required")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	node, exists := d.nodes[hb.NodeID]
+	if !exists {
+		node = &Node{ID: hb.NodeID}
+		d.nodes[hb.NodeID] = node
+	}
+
+	// 首次注册时分配 Volume ID 区间
+	base, registered := d.state.NodeBases[hb.NodeID]
+	if !registered || d.state.NodeURLs[hb.NodeID] != hb.URL {
+		if !registered {
+			d.state.NextBase += d.cfg.VolumeRange
+			base = d.state.NextBase
+			d.state.NodeBases[hb.NodeID] = base
+			log.Printf("Registered store node %s at %s, volume base %d", hb.NodeID, hb.URL, base)
+		}
+		d.state.NodeURLs[hb.NodeID] = hb.URL
+		if err := d.saveLocked(); err != nil {
+			return nil, err
+		}
+	}
+
+	node.URL = hb.URL
+	node.VolumeBase = base
+	node.Capacity = hb.Capacity
+	node.Used = hb.Used
+	node.Free = hb.Capacity - hb.Used
+	if node.Free < 0 {
+		node.Free = 0
+	}
+	node.Volumes = hb.Volumes
+	node.LastHeartbeat = time.Now().Unix()
+
+	result := *node
+	result.Alive = true
+	return &result, nil
+}
+
+// Assign 分配 count 个连续的文件 ID，选择剩余空间最多且能容纳 size 字节的存活节点
+func (d *Directory) Assign(count int, size int64) (*Assignment, error) {
+	if count <= 0 {
+		count = 1
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var target *Node
+	var volume *Volume
+	for _, node := range d.nodes {
+		if !d.aliveLocked(node) || node.Free < size {
+			continue
+		}
+		vol := writableVolume(node)
+		if vol == nil {
+			continue
+		}
+		if target == nil || node.Free > target.Free {
+			target = node
+			volume = vol
+		}
+	}
+	if target == nil {
+		return nil, ErrNoWritableNode
+	}
+
+	id := d.state.NextID
+	d.state.NextID += uint64(count)
+	if err := d.saveLocked(); err != nil {
+		d.state.NextID = id
+		return nil, err
+	}
+
+	// 预扣剩余空间，避免两次心跳之间集中写入同一节点
+	target.Free -= size * int64(count)
+
+	return &Assignment{
+		FID:      FormatFID(volume.ID, id),
+		ID:       id,
+		VolumeID: volume.ID,
+		NodeID:   target.ID,
+		URL:      target.URL,
+		Count:    count,
+	}, nil
+}
+
+// Lookup 返回逻辑 Volume 所在的节点
+func (d *Directory) Lookup(volumeID uint32) (*Node, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, node := range d.nodes {
+		for _, vol := range node.Volumes {
+			if vol.ID == volumeID {
+				result := *node
+				result.Alive = d.aliveLocked(node)
+				return &result, nil
+			}
+		}
+	}
+
+	// 节点尚未汇报该 Volume 时按 ID 区间查找
+	for _, node := range d.nodes {
+		if volumeID > node.VolumeBase && volumeID <= node.VolumeBase+d.cfg.VolumeRange {
+			result := *node
+			result.Alive = d.aliveLocked(node)
+			return &result, nil
+		}
+	}
+	return nil, ErrVolumeNotFound
+}
+
+// Nodes 列出所有存储节点，按 ID 排序
+func (d *Directory) Nodes() []Node {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	nodes := make([]Node, 0, len(d.nodes))
+	for _, node := range d.nodes {
+		n := *node
+		n.Alive = d.aliveLocked(node)
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// NextID 返回下一个待分配的文件 ID
+func (d *Directory) NextID() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state.NextID
+}
+
+// aliveLocked 连续错过三次心跳的节点视为下线
+func (d *Directory) aliveLocked(node *Node) bool {
+	timeout := int64(d.cfg.Heartbeat) * 3
+	return node.LastHeartbeat > 0 && time.Now().Unix()-node.LastHeartbeat <= timeout
+}
+
+// saveLocked 原子地写入状态文件
+func (d *Directory) saveLocked() error {
+	data, err := json.MarshalIndent(&d.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.cfg.StateFile), 0755); err != nil {
+		return err
+	}
+	tmp := d.cfg.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.cfg.StateFile)
+}
+
+// writableVolume 返回节点当前可写的 Volume
+func writableVolume(node *Node) *Volume {
+	for i := range node.Volumes {
+		if node.Volumes[i].Writable {
+			return &node.Volumes[i]
+		}
+	}
+	return nil
+}
+
+// FormatFID 生成文件标识 "<volume_id>,<file_id>"
+func FormatFID(volumeID uint32, id uint64) string {
+	return strconv.FormatUint(uint64(volumeID), 10) + "," + strconv.FormatUint(id, 10)
+}
+
+// ParseFID 解析文件标识
+func ParseFID(fid string) (uint32, uint64, error) {
+	vol, id, found := strings.Cut(fid, ",")
+	if !found {
+		return 0, 0, ErrInvalidFID
+	}
+	volumeID, err := strconv.ParseUint(vol, 10, 32)
+	if err != nil {
+		return 0, 0, ErrInvalidFID
+	}
+	fileID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || fileID == 0 {
+		return 0, 0, ErrInvalidFID
+	}
+	return uint32(volumeID), fileID, nil
+}
@@ -0,0 +1,117 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"haystack-lite/internal/config"
+	"haystack-lite/internal/storage"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// NodeID 返回存储节点标识，未配置时使用对外地址
+func NodeID(cfg config.ClusterConfig) string {
+	if cfg.NodeID != "" {
+		return cfg.NodeID
+	}
+	return cfg.Advertise
+}
+
+// Register 向目录服务注册存储节点，返回分配的 Volume ID 起点
+// 目录服务不可用时持续重试，存储节点必须在取得 Volume ID 区间后才能创建 Volume
+func Register(cfg config.ClusterConfig) (uint32, error) {
+	if cfg.Directory == "" || cfg.Advertise == "" {
+		return 0, fmt.Errorf("cluster.directory and cluster.advertise are required for store nodes")
+	}
+
+	hb := &Heartbeat{
+		NodeID:   NodeID(cfg),
+		URL:      cfg.Advertise,
+		Capacity: cfg.Capacity,
+	}
+
+	backoff := time.Second
+	for {
+		node, err := sendHeartbeat(cfg.Directory, hb)
+		if err == nil {
+			log.Printf("Registered with directory %s as %s, volume base %d", cfg.Directory, hb.NodeID, node.VolumeBase)
+			return node.VolumeBase, nil
+		}
+
+		log.Printf("Failed to register with directory %s: %v, retrying in %s", cfg.Directory, err, backoff)
+		time.Sleep(backoff)
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// StartHeartbeat 定期向目录服务汇报剩余空间和 Volume 列表
+func StartHeartbeat(store *storage.Store, cfg config.ClusterConfig) {
+	interval := time.Duration(cfg.Heartbeat) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := sendHeartbeat(cfg.Directory, NodeHeartbeat(store, cfg)); err != nil {
+				log.Printf("Heartbeat to directory failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// NodeHeartbeat 根据本地存储生成心跳内容
+func NodeHeartbeat(store *storage.Store, cfg config.ClusterConfig) *Heartbeat {
+	hb := &Heartbeat{
+		NodeID:   NodeID(cfg),
+		URL:      cfg.Advertise,
+		Capacity: cfg.Capacity,
+		Volumes:  make([]Volume, 0),
+	}
+
+	for _, vol := range store.ListVolumes() {
+		hb.Used += vol.Size
+		hb.Volumes = append(hb.Volumes, Volume{
+			ID:       vol.ID,
+			Size:     vol.Size,
+			MaxSize:  vol.MaxSize,
+			Writable: vol.Active && !store.IsReplica(),
+		})
+	}
+	return hb
+}
+
+func sendHeartbeat(directory string, hb *Heartbeat) (*Node, error) {
+	body, err := json.Marshal(hb)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Post(strings.TrimRight(directory, "/")+"/dir/heartbeat", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("directory returned %s", resp.Status)
+	}
+
+	var node Node
+	if err := json.NewDecoder(resp.Body).Decode(&node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
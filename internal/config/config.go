@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 
 	"gopkg.in/yaml.v3"
@@ -10,15 +11,28 @@ import (
 type DatabaseType string
 
 const (
-	DatabaseMySQL  DatabaseType = "mysql"
-	DatabaseSQLite DatabaseType = "sqlite"
+	DatabaseMySQL    DatabaseType = "mysql"
+	DatabaseSQLite   DatabaseType = "sqlite"
+	DatabaseBolt     DatabaseType = "bolt" // 进程内的有序键值存储，单机部署无需 SQL
+	DatabasePostgres DatabaseType = "postgres"
 )
 
 type Config struct {
-	Server     ServerConfig     `yaml:"server"`
-	Storage    StorageConfig    `yaml:"storage"`
-	Database   DatabaseConfig   `yaml:"database"`
-	Compaction CompactionConfig `yaml:"compaction"`
+	Server      ServerConfig      `yaml:"server"`
+	Storage     StorageConfig     `yaml:"storage"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Compaction  CompactionConfig  `yaml:"compaction"`
+	Trash       TrashConfig       `yaml:"trash"`
+	Expiration  ExpirationConfig  `yaml:"expiration"`
+	Snapshot    SnapshotConfig    `yaml:"snapshot"`
+	Events      EventsConfig      `yaml:"events"`
+	Webhook     WebhookConfig     `yaml:"webhook"`
+	Replication ReplicationConfig `yaml:"replication"`
+	Cluster     ClusterConfig     `yaml:"cluster"`
+	AntiEntropy AntiEntropyConfig `yaml:"anti_entropy"`
+	Cache       CacheConfig       `yaml:"cache"`
+	Reconcile   ReconcileConfig   `yaml:"reconcile"`
+	Search      SearchConfig      `yaml:"search"`
 }
 
 type ServerConfig struct {
@@ -31,6 +45,14 @@ type StorageConfig struct {
 	VolumeFileExt string `yaml:"volume_file_ext"`
 	SyncInterval  int    `yaml:"sync_interval"`
 	ReadOnly      bool   `yaml:"read_only"`
+	Dedup         bool   `yaml:"dedup"`
+	KeepVersions  int    `yaml:"keep_versions"`
+	// 按过期时间分区存放带 TTL 的文件，到期后整个 Volume 直接删除
+	PartitionByExpiry bool `yaml:"partition_by_expiry"`
+	PartitionSpan     int  `yaml:"partition_span"` // 分区时间跨度（秒）
+	// 镜像目录，通常位于另一块磁盘；设置后每个 Volume 同时写入两份，读取失败时从另一份修复
+	MirrorDir   string `yaml:"mirror_dir"`
+	IDBlockSize int    `yaml:"id_block_size"` // 每次向数据库租用的文件 ID 数，0 表示默认值 1000
 }
 
 type CompactionConfig struct {
@@ -40,16 +62,123 @@ type CompactionConfig struct {
 	MinVolumeSize    int64   `yaml:"min_volume_size"`
 }
 
+type TrashConfig struct {
+	Retention int `yaml:"retention"` // 删除文件在回收站的保留时间（秒）
+}
+
+type ExpirationConfig struct {
+	Enabled  bool `yaml:"enabled"`
+	Interval int  `yaml:"interval"`
+}
+
+type SnapshotConfig struct {
+	Dir string `yaml:"dir"` // 快照输出目录，与数据目录位于同一文件系统时可使用硬链接
+}
+
+type EventsConfig struct {
+	BufferSize int `yaml:"buffer_size"` // 事件总线保留的最近事件数
+}
+
+type WebhookConfig struct {
+	Enabled        bool `yaml:"enabled"`
+	MaxAttempts    int  `yaml:"max_attempts"`    // 最大尝试次数，超过后标记为失败
+	InitialBackoff int  `yaml:"initial_backoff"` // 首次重试间隔（秒），之后每次翻倍
+	MaxBackoff     int  `yaml:"max_backoff"`     // 最大重试间隔（秒）
+	Timeout        int  `yaml:"timeout"`         // 单次请求超时（秒）
+	Workers        int  `yaml:"workers"`         // 并发投递数
+}
+
+// 复制角色
+const (
+	RolePrimary = "primary"
+	RoleReplica = "replica"
+)
+
+type ReplicationConfig struct {
+	Role        string `yaml:"role"`         // primary、replica，为空表示单机运行
+	Primary     string `yaml:"primary"`      // 副本连接的主节点地址
+	ReplicaID   string `yaml:"replica_id"`   // 副本标识，主节点据此统计确认进度
+	PollTimeout int    `yaml:"poll_timeout"` // 副本长轮询等待时间（秒）
+	WaitForAck  bool   `yaml:"wait_for_ack"` // 主节点写入是否等待至少一个副本确认
+	AckTimeout  int    `yaml:"ack_timeout"`  // 等待副本确认的超时时间（秒）
+}
+
+// 集群角色
+const (
+	RoleDirectory = "directory"
+	RoleStore     = "store"
+)
+
+type ClusterConfig struct {
+	Role        string `yaml:"role"`         // directory、store，为空表示单进程运行
+	Directory   string `yaml:"directory"`    // 存储节点连接的目录服务地址
+	NodeID      string `yaml:"node_id"`      // 存储节点标识，为空时使用 advertise
+	Advertise   string `yaml:"advertise"`    // 存储节点对外地址，目录服务据此转发请求
+	Capacity    int64  `yaml:"capacity"`     // 存储节点容量（字节），用于计算剩余空间
+	Heartbeat   int    `yaml:"heartbeat"`    // 心跳间隔（秒）
+	VolumeRange uint32 `yaml:"volume_range"` // 目录服务为每个节点分配的 Volume ID 数
+	StateFile   string `yaml:"state_file"`   // 目录服务保存 ID 分配和节点信息的文件
+
+	// 目录服务分配给本节点的 Volume ID 起点，注册后设置
+	VolumeBase uint32 `yaml:"-"`
+}
+
+type AntiEntropyConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Interval int    `yaml:"interval"` // 比对间隔（秒）
+	Peer     string `yaml:"peer"`     // 对端节点地址，为空时副本使用 replication.primary
+	Buckets  int    `yaml:"buckets"`  // 摘要分桶数，两端必须一致
+	DryRun   bool   `yaml:"dry_run"`  // 只报告差异，不复制数据
+}
+
+type CacheConfig struct {
+	Enabled         bool  `yaml:"enabled"`
+	MetadataEntries int   `yaml:"metadata_entries"` // 元数据最多缓存条数
+	BodyBytes       int64 `yaml:"body_bytes"`       // 文件内容最多占用的内存（字节）
+	MaxObjectSize   int64 `yaml:"max_object_size"`  // 超过该大小的文件内容不缓存（字节）
+}
+
+type ReconcileConfig struct {
+	Enabled  bool `yaml:"enabled"`
+	Interval int  `yaml:"interval"` // 检查间隔（秒）
+	Grace    int  `yaml:"grace"`    // 只检查早于该秒数写入的数据
+	Repair   bool `yaml:"repair"`   // 孤立 Needle 打删除标记、能找到的数据重新加入索引；否则只报告
+}
+
+type SearchConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Path        string `yaml:"path"`          // 倒排索引文件
+	MaxFileSize int64  `yaml:"max_file_size"` // 超过该大小的文件不建索引（字节）
+	Interval    int    `yaml:"interval"`      // 没有写入时检查变更的间隔（秒）
+	BatchSize   int    `yaml:"batch_size"`    // 每次处理的序列号范围
+}
+
 type DatabaseConfig struct {
-	Type   DatabaseType `yaml:"type"`
-	SQLite SQLiteConfig `yaml:"sqlite"`
-	MySQL  MySQLConfig  `yaml:"mysql"`
+	Type     DatabaseType   `yaml:"type"`
+	SQLite   SQLiteConfig   `yaml:"sqlite"`
+	MySQL    MySQLConfig    `yaml:"mysql"`
+	Bolt     BoltConfig     `yaml:"bolt"`
+	Postgres PostgresConfig `yaml:"postgres"`
 }
 
 type SQLiteConfig struct {
 	Path string `yaml:"path"`
 }
 
+type BoltConfig struct {
+	Path string `yaml:"path"`
+}
+
+type PostgresConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Database string `yaml:"database"`
+	SSLMode  string `yaml:"sslmode"`  // disable、require、verify-ca、verify-full
+	TimeZone string `yaml:"timezone"` // 会话时区，为空时使用服务端设置
+}
+
 type MySQLConfig struct {
 	Host      string `yaml:"host"`
 	Port      int    `yaml:"port"`
@@ -81,6 +210,8 @@ func (c *Config) GetDatabaseDSN() string {
 	switch c.Database.Type {
 	case DatabaseSQLite:
 		return c.Database.SQLite.Path
+	case DatabaseBolt:
+		return c.Database.Bolt.Path
 	case DatabaseMySQL:
 		mysql := c.Database.MySQL
 		return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=%t&loc=%s",
@@ -93,6 +224,24 @@ func (c *Config) GetDatabaseDSN() string {
 			mysql.ParseTime,
 			mysql.Loc,
 		)
+	case DatabasePostgres:
+		pg := c.Database.Postgres
+		query := url.Values{}
+		if pg.SSLMode != "" {
+			query.Set("sslmode", pg.SSLMode)
+		}
+		if pg.TimeZone != "" {
+			query.Set("TimeZone", pg.TimeZone)
+		}
+		// URL 形式的 DSN，用户名和密码中的特殊字符会被转义
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(pg.User, pg.Password),
+			Host:     fmt.Sprintf("%s:%d", pg.Host, pg.Port),
+			Path:     "/" + pg.Database,
+			RawQuery: query.Encode(),
+		}
+		return dsn.String()
 	default:
 		return ""
 	}
@@ -110,6 +259,9 @@ func Default() *Config {
 			VolumeFileExt: ".dat",
 			SyncInterval:  60,
 			ReadOnly:      false,
+			Dedup:         true,
+			KeepVersions:  10,
+			PartitionSpan: 86400,
 		},
 		Compaction: CompactionConfig{
 			Enabled:          true,
@@ -117,6 +269,59 @@ func Default() *Config {
 			DeletedThreshold: 0.3,
 			MinVolumeSize:    10485760,
 		},
+		Trash: TrashConfig{
+			Retention: 7 * 24 * 3600,
+		},
+		Expiration: ExpirationConfig{
+			Enabled:  true,
+			Interval: 300,
+		},
+		Snapshot: SnapshotConfig{
+			Dir: "./snapshots",
+		},
+		Events: EventsConfig{
+			BufferSize: 10000,
+		},
+		Webhook: WebhookConfig{
+			Enabled:        true,
+			MaxAttempts:    8,
+			InitialBackoff: 10,
+			MaxBackoff:     3600,
+			Timeout:        10,
+			Workers:        4,
+		},
+		Replication: ReplicationConfig{
+			PollTimeout: 30,
+			AckTimeout:  5,
+		},
+		Cluster: ClusterConfig{
+			Capacity:    100 << 30,
+			Heartbeat:   5,
+			VolumeRange: 10000,
+			StateFile:   "./data/directory.json",
+		},
+		AntiEntropy: AntiEntropyConfig{
+			Interval: 3600,
+			Buckets:  256,
+		},
+		Reconcile: ReconcileConfig{
+			Enabled:  true,
+			Interval: 6 * 3600,
+			Grace:    600,
+			Repair:   true,
+		},
+		Cache: CacheConfig{
+			Enabled:         true,
+			MetadataEntries: 100000,
+			BodyBytes:       256 << 20,
+			MaxObjectSize:   1 << 20,
+		},
+		Search: SearchConfig{
+			Path:        "./data/search.bolt",
+			MaxFileSize: 1 << 20,
+			Interval:    5,
+			BatchSize:   500,
+		},
 		Database: DatabaseConfig{
 			Type: DatabaseSQLite,
 			SQLite: SQLiteConfig{
@@ -132,6 +337,17 @@ func Default() *Config {
 				ParseTime: true,
 				Loc:       "Local",
 			},
+			Bolt: BoltConfig{
+				Path: "./data/haystack.bolt",
+			},
+			Postgres: PostgresConfig{
+				Host:     "127.0.0.1",
+				Port:     5432,
+				User:     "postgres",
+				Password: "password",
+				Database: "haystack",
+				SSLMode:  "disable",
+			},
 		},
 	}
 }
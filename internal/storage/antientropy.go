@@ -0,0 +1,453 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDigestBuckets 摘要默认的叶子数
+const defaultDigestBuckets = 256
+
+// DigestEntry 摘要中的单个 Needle
+type DigestEntry struct {
+	ID       uint64 `json:"id"`
+	Size     uint32 `json:"size"`
+	CRC      uint32 `json:"crc"`
+	Corrupt  bool   `json:"corrupt,omitempty"` // 读取失败或校验和不匹配
+	VolumeID uint32 `json:"volume_id"`
+}
+
+// Digest 全部未删除 Needle 的两层 Merkle 摘要
+// 副本的 Volume 布局与主节点不同，因此按 Needle ID 取模分桶而不是按物理 Volume 计算
+type Digest struct {
+	Buckets    int      `json:"buckets"`
+	Root       string   `json:"root"`
+	Hashes     []string `json:"hashes"` // 每个桶的摘要
+	Needles    int      `json:"needles"`
+	Corrupt    int      `json:"corrupt"`
+	CreateTime int64    `json:"create_time"`
+}
+
+// AntiEntropyConfig 反熵修复配置
+type AntiEntropyConfig struct {
+	Enabled  bool   // 是否启用定时任务
+	Interval int    // 检查间隔（秒）
+	Peer     string // 对端节点地址，为空时副本使用主节点
+	Buckets  int    // 摘要分桶数
+	DryRun   bool   // 只报告差异，不复制数据
+}
+
+// AntiEntropyReport 一次比对与修复的结果
+type AntiEntropyReport struct {
+	Peer             string   `json:"peer"`
+	DryRun           bool     `json:"dry_run"`
+	StartTime        int64    `json:"start_time"`
+	EndTime          int64    `json:"end_time"`
+	Buckets          int      `json:"buckets"`
+	LocalRoot        string   `json:"local_root"`
+	PeerRoot         string   `json:"peer_root"`
+	InSync           bool     `json:"in_sync"`
+	DifferingBuckets int      `json:"differing_buckets"`
+	MissingLocal     []uint64 `json:"missing_local"` // 对端有、本地缺失
+	MissingPeer      []uint64 `json:"missing_peer"`  // 本地有、对端缺失
+	Mismatched       []uint64 `json:"mismatched"`    // 两端大小或 CRC 不同
+	CorruptLocal     []uint64 `json:"corrupt_local"`
+	CorruptPeer      []uint64 `json:"corrupt_peer"`
+	Repaired         []uint64 `json:"repaired"` // 已从对端复制的 Needle
+	Error            string   `json:"error,omitempty"`
+}
+
+type antiEntropy struct {
+	mu     sync.Mutex // 同一时刻只允许一次修复
+	report *AntiEntropyReport
+}
+
+// Digest 计算摘要，读取每个 Needle 校验 CRC
+func (s *Store) Digest(buckets int) *Digest {
+	buckets = digestBuckets(buckets)
+	entries := s.digestEntries(buckets, -1)
+
+	d := &Digest{
+		Buckets:    buckets,
+		Hashes:     make([]string, buckets),
+		CreateTime: time.Now().Unix(),
+	}
+	root := sha256.New()
+	for i := 0; i < buckets; i++ {
+		d.Hashes[i] = bucketHash(entries[i])
+		root.Write([]byte(d.Hashes[i]))
+
+		d.Needles += len(entries[i])
+		for _, e := range entries[i] {
+			if e.Corrupt {
+				d.Corrupt++
+			}
+		}
+	}
+	d.Root = hex.EncodeToString(root.Sum(nil))
+	return d
+}
+
+// DigestBucket 返回单个桶内的 Needle，按 ID 排序
+func (s *Store) DigestBucket(buckets, bucket int) []DigestEntry {
+	buckets = digestBuckets(buckets)
+	if bucket < 0 || bucket >= buckets {
+		return []DigestEntry{}
+	}
+	return s.digestEntries(buckets, bucket)[bucket]
+}
+
+// digestEntries 按桶收集未删除的 Needle，only 不为 -1 时只收集该桶
+func (s *Store) digestEntries(buckets, only int) map[int][]DigestEntry {
+	s.mu.RLock()
+	volumes := make([]*Volume, 0, len(s.volumes))
+	for _, vol := range s.volumes {
+		volumes = append(volumes, vol)
+	}
+	s.mu.RUnlock()
+
+	entries := make(map[int][]DigestEntry, buckets)
+	for _, vol := range volumes {
+		vol.mu.RLock()
+		ids := make([]uint64, 0, len(vol.NeedleIndex))
+		for id, info := range vol.NeedleIndex {
+			if info.Flags&0x01 == 0 && (only < 0 || int(id%uint64(buckets)) == only) {
+				ids = append(ids, id)
+			}
+		}
+		vol.mu.RUnlock()
+
+		for _, id := range ids {
+			entry := DigestEntry{ID: id, VolumeID: vol.ID}
+			needle, err := vol.readNeedleRaw(id)
+			if err != nil || needle.ID != id {
+				entry.Corrupt = true
+			} else {
+				entry.Size = needle.DataSize
+				entry.CRC = crc32.ChecksumIEEE(needle.Data)
+			}
+			bucket := int(id % uint64(buckets))
+			entries[bucket] = append(entries[bucket], entry)
+		}
+	}
+
+	for bucket := range entries {
+		list := entries[bucket]
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	}
+	return entries
+}
+
+// AntiEntropyReport 返回最近一次修复报告
+func (s *Store) AntiEntropyReport() *AntiEntropyReport {
+	s.antiEntropy.mu.Lock()
+	defer s.antiEntropy.mu.Unlock()
+	return s.antiEntropy.report
+}
+
+// RepairSet 导出指定 Needle 及引用它们的全部文件记录，用于对端修复
+// 本地损坏的 Needle 不附带数据
+func (s *Store) RepairSet(ids []uint64) (*ChangeSet, error) {
+	files, err := s.db.ListFilesByNeedles(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &ChangeSet{
+		Until:      s.CurrentSeq(),
+		CreateTime: time.Now().Unix(),
+		Files:      make([]FileMetadata, 0, len(files)),
+	}
+	for _, meta := range files {
+		cs.Files = append(cs.Files, *meta)
+	}
+
+	for _, id := range ids {
+		if _, err := s.readNeedleRaw(id); err == nil {
+			cs.Needles = append(cs.Needles, id)
+		}
+	}
+	if cs.NeedleRefs, err = s.db.GetNeedleRefs(ids); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// StartAntiEntropy 定时与对端比对摘要并修复
+func (s *Store) StartAntiEntropy(cfg AntiEntropyConfig) {
+	if !cfg.Enabled {
+		return
+	}
+	peer := s.antiEntropyPeer(cfg.Peer)
+	if peer == "" {
+		log.Println("Anti-entropy disabled: no peer configured")
+		return
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = 3600
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+		defer ticker.Stop()
+
+		log.Printf("Anti-entropy started against %s, interval: %d seconds, dry run: %t", peer, cfg.Interval, cfg.DryRun)
+
+		for range ticker.C {
+			report, err := s.RunAntiEntropy(peer, cfg.Buckets, cfg.DryRun)
+			if err != nil {
+				log.Printf("Anti-entropy error: %v", err)
+				continue
+			}
+			if !report.InSync {
+				log.Printf("Anti-entropy against %s: %d missing locally, %d missing on peer, %d mismatched, %d corrupt locally, %d repaired",
+					peer, len(report.MissingLocal), len(report.MissingPeer), len(report.Mismatched), len(report.CorruptLocal), len(report.Repaired))
+			}
+		}
+	}()
+}
+
+// antiEntropyPeer 返回对端地址，未配置时副本使用主节点
+func (s *Store) antiEntropyPeer(peer string) string {
+	if peer == "" && s.IsReplica() {
+		return s.config.Replication.Primary
+	}
+	return peer
+}
+
+// RunAntiEntropy 与对端比对摘要，列出差异并从对端复制本地缺失或损坏的 Needle
+// 对端为本节点的主节点时，大小或 CRC 不一致的 Needle 也以主节点为准
+func (s *Store) RunAntiEntropy(peer string, buckets int, dryRun bool) (*AntiEntropyReport, error) {
+	peer = strings.TrimRight(s.antiEntropyPeer(peer), "/")
+	if peer == "" {
+		return nil, fmt.Errorf("peer required")
+	}
+
+	s.antiEntropy.mu.Lock()
+	defer s.antiEntropy.mu.Unlock()
+
+	buckets = digestBuckets(buckets)
+	report := &AntiEntropyReport{
+		Peer:         peer,
+		DryRun:       dryRun,
+		StartTime:    time.Now().Unix(),
+		Buckets:      buckets,
+		MissingLocal: []uint64{},
+		MissingPeer:  []uint64{},
+		Mismatched:   []uint64{},
+		CorruptLocal: []uint64{},
+		CorruptPeer:  []uint64{},
+		Repaired:     []uint64{},
+	}
+	finish := func(err error) (*AntiEntropyReport, error) {
+		report.EndTime = time.Now().Unix()
+		if err != nil {
+			report.Error = err.Error()
+		}
+		s.antiEntropy.report = report
+		return report, err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Minute}
+	local := s.Digest(buckets)
+
+	var remote Digest
+	if err := getJSON(client, fmt.Sprintf("%s/admin/antientropy/digest?buckets=%d", peer, buckets), &remote); err != nil {
+		return finish(fmt.Errorf("failed to fetch peer digest: %w", err))
+	}
+	report.LocalRoot = local.Root
+	report.PeerRoot = remote.Root
+	if local.Root == remote.Root {
+		report.InSync = true
+		return finish(nil)
+	}
+	if len(remote.Hashes) != buckets {
+		return finish(fmt.Errorf("peer returned %d buckets, expected %d", len(remote.Hashes), buckets))
+	}
+
+	authoritative := s.IsReplica() && strings.TrimRight(s.config.Replication.Primary, "/") == peer
+	repair := make([]uint64, 0)
+	corrupt := make(map[uint64]bool)
+
+	for bucket := 0; bucket < buckets; bucket++ {
+		if local.Hashes[bucket] == remote.Hashes[bucket] {
+			continue
+		}
+		report.DifferingBuckets++
+
+		var peerEntries []DigestEntry
+		bucketURL := fmt.Sprintf("%s/admin/antientropy/digest/%d?buckets=%d", peer, bucket, buckets)
+		if err := getJSON(client, bucketURL, &peerEntries); err != nil {
+			return finish(fmt.Errorf("failed to fetch peer bucket %d: %w", bucket, err))
+		}
+
+		theirs := make(map[uint64]DigestEntry, len(peerEntries))
+		for _, e := range peerEntries {
+			theirs[e.ID] = e
+		}
+		ours := make(map[uint64]DigestEntry)
+		for _, e := range s.DigestBucket(buckets, bucket) {
+			ours[e.ID] = e
+		}
+
+		for id, mine := range ours {
+			other, exists := theirs[id]
+			switch {
+			case !exists:
+				report.MissingPeer = append(report.MissingPeer, id)
+				if mine.Corrupt {
+					report.CorruptLocal = append(report.CorruptLocal, id)
+				}
+			case mine.Corrupt && other.Corrupt:
+				report.CorruptLocal = append(report.CorruptLocal, id)
+				report.CorruptPeer = append(report.CorruptPeer, id)
+			case mine.Corrupt:
+				report.CorruptLocal = append(report.CorruptLocal, id)
+				repair = append(repair, id)
+				corrupt[id] = true
+			case other.Corrupt:
+				report.CorruptPeer = append(report.CorruptPeer, id)
+			case mine.Size != other.Size || mine.CRC != other.CRC:
+				report.Mismatched = append(report.Mismatched, id)
+				if authoritative {
+					repair = append(repair, id)
+					corrupt[id] = true
+				}
+			}
+		}
+		for id, other := range theirs {
+			if _, exists := ours[id]; exists {
+				continue
+			}
+			report.MissingLocal = append(report.MissingLocal, id)
+			if other.Corrupt {
+				report.CorruptPeer = append(report.CorruptPeer, id)
+				continue
+			}
+			repair = append(repair, id)
+		}
+	}
+
+	for _, list := range [][]uint64{report.MissingLocal, report.MissingPeer, report.Mismatched, report.CorruptLocal, report.CorruptPeer} {
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	}
+
+	if dryRun || len(repair) == 0 {
+		return finish(nil)
+	}
+
+	repaired, err := s.pullNeedles(client, peer, repair, corrupt)
+	report.Repaired = repaired
+	return finish(err)
+}
+
+// pullNeedles 从对端下载 Needle 及其文件记录并写入本地，replace 中的本地副本会被替换
+func (s *Store) pullNeedles(client *http.Client, peer string, ids []uint64, replace map[uint64]bool) ([]uint64, error) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.FormatUint(id, 10))
+	}
+	query := url.Values{}
+	query.Set("ids", strings.Join(parts, ","))
+
+	resp, err := client.Get(peer + "/admin/antientropy/needles?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer returned %s", resp.Status)
+	}
+
+	tmp, err := os.MkdirTemp("", "haystack-repair-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	cs, err := readChangeSet(resp.Body, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	// 只替换对端确实提供了数据的 Needle，避免丢弃本地唯一的副本
+	included := make(map[uint64]bool, len(cs.Needles))
+	for _, id := range cs.Needles {
+		included[id] = true
+	}
+	for id := range replace {
+		if !included[id] {
+			delete(replace, id)
+		}
+	}
+
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	if _, err := s.applyChangeSet(cs, tmp, replace, false); err != nil {
+		return nil, err
+	}
+
+	repaired := make([]uint64, 0, len(cs.Needles))
+	for _, id := range cs.Needles {
+		if _, _, found := s.locateNeedle(id); found {
+			repaired = append(repaired, id)
+		}
+	}
+	sort.Slice(repaired, func(i, j int) bool { return repaired[i] < repaired[j] })
+	log.Printf("Anti-entropy repaired %d needles from %s", len(repaired), peer)
+	return repaired, nil
+}
+
+// bucketHash 计算桶摘要，损坏的 Needle 以特殊标记参与计算
+func bucketHash(entries []DigestEntry) string {
+	h := sha256.New()
+	for _, e := range entries {
+		if e.Corrupt {
+			fmt.Fprintf(h, "%d corrupt\n", e.ID)
+		} else {
+			fmt.Fprintf(h, "%d %d %08x\n", e.ID, e.Size, e.CRC)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func digestBuckets(buckets int) int {
+	if buckets <= 0 {
+		return defaultDigestBuckets
+	}
+	if buckets > 65536 {
+		return 65536
+	}
+	return buckets
+}
+
+func getJSON(client *http.Client, target string, v interface{}) error {
+	resp, err := client.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
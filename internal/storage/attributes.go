@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// 用户元数据和标签的限制，与 S3 保持一致
+const (
+	MaxUserMetaSize   = 2048 // 元数据所有键和值的总字节数
+	MaxTags           = 10
+	MaxTagKeyLength   = 128 // 字符数
+	MaxTagValueLength = 256 // 字符数
+)
+
+// ValidateUserMeta 校验用户元数据
+// 键只能由小写字母、数字和 - _ . 组成（需要作为 HTTP 头名回传），值不能包含控制字符
+func ValidateUserMeta(meta map[string]string) error {
+	size := 0
+	for k, v := range meta {
+		if k == "" {
+			return fmt.Errorf("%w: empty metadata key", ErrInvalidMetadata)
+		}
+		for _, c := range k {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+				return fmt.Errorf("%w: invalid metadata key %q", ErrInvalidMetadata, k)
+			}
+		}
+		if !validAttributeValue(v) {
+			return fmt.Errorf("%w: invalid value of metadata %q", ErrInvalidMetadata, k)
+		}
+		size += len(k) + len(v)
+	}
+	if size > MaxUserMetaSize {
+		return fmt.Errorf("%w: metadata exceeds %d bytes", ErrInvalidMetadata, MaxUserMetaSize)
+	}
+	return nil
+}
+
+// ValidateTags 校验标签，键不能包含 :（按 tag=键:值 查询时作为分隔符）
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > MaxTags {
+		return fmt.Errorf("%w: at most %d tags", ErrInvalidMetadata, MaxTags)
+	}
+	for k, v := range tags {
+		n := utf8.RuneCountInString(k)
+		if n == 0 || n > MaxTagKeyLength || !validAttributeValue(k) {
+			return fmt.Errorf("%w: invalid tag key %q", ErrInvalidMetadata, k)
+		}
+		for _, c := range k {
+			if c == ':' {
+				return fmt.Errorf("%w: tag key %q contains ':'", ErrInvalidMetadata, k)
+			}
+		}
+		if utf8.RuneCountInString(v) > MaxTagValueLength || !validAttributeValue(v) {
+			return fmt.Errorf("%w: invalid value of tag %q", ErrInvalidMetadata, k)
+		}
+	}
+	return nil
+}
+
+// validAttributeValue 合法的 UTF-8 且不含控制字符
+func validAttributeValue(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, c := range s {
+		if c < 0x20 || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func validateWriteAttributes(opts *WriteOptions) error {
+	if err := ValidateUserMeta(opts.UserMeta); err != nil {
+		return err
+	}
+	return ValidateTags(opts.Tags)
+}
+
+// AttributePatch 对元数据和标签的修改，值为 nil 表示删除该键
+// Replace 为 true 时先清空原有的键，只保留本次给出的非 nil 值；字段为 nil 的部分保持不变
+type AttributePatch struct {
+	UserMeta map[string]*string
+	Tags     map[string]*string
+	Replace  bool
+}
+
+// apply 返回修改后的新 map，不修改文件原有的 map（可能与缓存共享）
+func (p *AttributePatch) apply(meta *FileMetadata) (userMeta, tags map[string]string) {
+	return mergeAttributes(meta.UserMeta, p.UserMeta, p.Replace), mergeAttributes(meta.Tags, p.Tags, p.Replace)
+}
+
+func mergeAttributes(current map[string]string, patch map[string]*string, replace bool) map[string]string {
+	if patch == nil {
+		return current
+	}
+	merged := make(map[string]string, len(current)+len(patch))
+	if !replace {
+		for k, v := range current {
+			merged[k] = v
+		}
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(merged, k)
+		} else {
+			merged[k] = *v
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// UpdateAttributes 修改文件的用户元数据和标签，返回修改后的元数据
+// 修改分配新的序列号，会随增量复制和备份同步；文件内容和 ID 不变
+func (s *Store) UpdateAttributes(id uint64, patch AttributePatch) (*FileMetadata, error) {
+	meta, err := s.updateAttributes(id, patch)
+	if err != nil {
+		return nil, err
+	}
+	return meta, s.waitForReplicas(meta.Seq)
+}
+
+func (s *Store) updateAttributes(id uint64, patch AttributePatch) (*FileMetadata, error) {
+	if s.readOnly() {
+		return nil, ErrReadOnly
+	}
+
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+
+	// 读-改-写需要串行，否则并发的修改会互相覆盖
+	s.attrMu.Lock()
+	defer s.attrMu.Unlock()
+
+	meta, err := s.db.GetFileMetadata(id)
+	if err != nil {
+		return nil, ErrNeedleNotFound
+	}
+
+	userMeta, tags := patch.apply(meta)
+	if err := ValidateUserMeta(userMeta); err != nil {
+		return nil, err
+	}
+	if err := ValidateTags(tags); err != nil {
+		return nil, err
+	}
+
+	seq := s.nextSeq()
+	defer s.doneSeq(seq)
+	if err := s.db.UpdateFileAttributes(id, userMeta, tags, seq); err != nil {
+		return nil, fmt.Errorf("failed to update attributes: %w", err)
+	}
+	meta.UserMeta, meta.Tags, meta.Seq = userMeta, tags, seq
+
+	s.invalidateCache(id, 0)
+	s.publishFile(EventMetadataUpdated, meta)
+	return meta, nil
+}
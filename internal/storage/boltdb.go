@@ -0,0 +1,2175 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gorm.io/gorm"
+)
+
+// Bolt 中的 Bucket，索引 Bucket 的值为空，键由索引字段和主键拼接而成（整数按大端序）
+var (
+	boltFiles          = []byte("files")              // 文件 ID -> 元数据
+	boltFilesByName    = []byte("files_by_name")      // 文件名 + 0x00 + 文件 ID，只含未删除的文件
+	boltFilesByNeedle  = []byte("files_by_needle")    // NeedleID + 文件 ID，只含 NeedleID 非 0 的文件
+	boltFilesByVolume  = []byte("files_by_volume")    // Volume ID + 文件 ID
+	boltFilesBySeq     = []byte("files_by_seq")       // 序列号 + 文件 ID
+	boltFilesByExpire  = []byte("files_by_expire")    // 过期时间 + 文件 ID，只含未删除且带 TTL 的文件
+	boltFilesByTime    = []byte("files_by_time")      // 创建时间 + 文件 ID，只含未删除的文件，用于按时间排序
+	boltFilesBySize    = []byte("files_by_size")      // 大小（4 字节）+ 文件 ID，只含未删除的文件，用于按大小排序
+	boltTrash          = []byte("trash")              // 删除时间 + 文件 ID，只含已删除的文件
+	boltNeedleRefs     = []byte("needle_refs")        // NeedleID -> 引用记录
+	boltRefsByMD5      = []byte("needle_refs_by_md5") // MD5 + 大小 + NeedleID
+	boltVolumes        = []byte("volume_info")        // Volume ID -> Volume 信息
+	boltBucketSettings = []byte("bucket_settings")    // Bucket 名 -> 配置
+	boltLifecycleRules = []byte("lifecycle_rules")    // 规则 ID -> 规则
+	boltQuotas         = []byte("quotas")             // 配额 ID -> 配额
+	boltWebhooks       = []byte("webhooks")           // Webhook ID -> Webhook
+	boltDeliveries     = []byte("webhook_deliveries") // 投递 ID -> 投递记录
+	boltDeliveriesDue  = []byte("deliveries_due")     // 下次尝试时间 + 投递 ID，只含待投递的记录
+	boltDeliveriesHook = []byte("deliveries_by_hook") // Webhook ID + 投递 ID
+	boltSequences      = []byte("id_sequences")       // 序列名 -> 下一次租用的起点
+	boltStats          = []byte("stats")              // 文件统计，随文件记录增量维护
+	boltMeta           = []byte("meta")               // 数据库自身的信息，如存储格式版本
+)
+
+var boltAllBuckets = [][]byte{
+	boltFiles, boltFilesByName, boltFilesByNeedle, boltFilesByVolume, boltFilesBySeq, boltFilesByExpire,
+	boltFilesByTime, boltFilesBySize, boltTrash,
+	boltNeedleRefs, boltRefsByMD5, boltVolumes, boltBucketSettings, boltLifecycleRules, boltQuotas,
+	boltWebhooks, boltDeliveries, boltDeliveriesDue, boltDeliveriesHook, boltSequences, boltStats, boltMeta,
+}
+
+var (
+	boltFileStatsKey     = []byte("files")
+	boltSchemaVersionKey = []byte("schema_version")
+)
+
+// boltSchemaVersion Bolt 存储格式版本，Bucket 或键的编码变化时递增
+// Bolt 没有 SQL 迁移，打开时补建旧版本缺少的索引，并拒绝打开由更新的版本写入的文件
+//
+//	2: 增加 files_by_time、files_by_size
+const boltSchemaVersion = 2
+
+// BoltDatabase 基于 bbolt 的元数据存储，单文件、进程内，不依赖 SQL
+// 文件名索引按字节序排列，前缀列举是一次有序范围扫描
+type BoltDatabase struct {
+	db *bolt.DB
+}
+
+// NewBoltDatabase 打开或创建 Bolt 数据库文件，同一文件只能被一个进程打开
+func NewBoltDatabase(path string) (*BoltDatabase, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range boltAllBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		meta := tx.Bucket(boltMeta)
+		var version uint64
+		if v := meta.Get(boltSchemaVersionKey); v != nil {
+			if version = binary.BigEndian.Uint64(v); version > boltSchemaVersion {
+				return fmt.Errorf("%w: bolt schema version %d, latest known is %d", ErrSchemaTooNew, version, boltSchemaVersion)
+			}
+		}
+		if version < 2 {
+			if err := backfillSortIndexes(tx); err != nil {
+				return err
+			}
+		}
+		return meta.Put(boltSchemaVersionKey, u64Key(boltSchemaVersion))
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize bolt database: %w", err)
+	}
+
+	log.Printf("Database (bolt) opened: %s", path)
+	return &BoltDatabase{db: db}, nil
+}
+
+// backfillSortIndexes 为版本 2 之前写入的文件补建排序索引
+func backfillSortIndexes(tx *bolt.Tx) error {
+	byTime, bySize := tx.Bucket(boltFilesByTime), tx.Bucket(boltFilesBySize)
+	count := 0
+	err := tx.Bucket(boltFiles).ForEach(func(_, v []byte) error {
+		var meta FileMetadata
+		if err := json.Unmarshal(v, &meta); err != nil {
+			return err
+		}
+		if meta.Deleted {
+			return nil
+		}
+		count++
+		if err := byTime.Put(timeKey(meta.CreateTime, meta.ID), nil); err != nil {
+			return err
+		}
+		return bySize.Put(sizeKey(meta.Size, meta.ID), nil)
+	})
+	if err == nil && count > 0 {
+		log.Printf("Bolt: built sort indexes for %d files", count)
+	}
+	return err
+}
+
+func (d *BoltDatabase) Close() error {
+	return d.db.Close()
+}
+
+// boltTx 封装事务内的读写，文件记录的索引和统计在 putFile、removeFile 中统一维护
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (d *BoltDatabase) view(fn func(t *boltTx) error) error {
+	return d.db.View(func(tx *bolt.Tx) error { return fn(&boltTx{tx: tx}) })
+}
+
+func (d *BoltDatabase) update(fn func(t *boltTx) error) error {
+	return d.db.Update(func(tx *bolt.Tx) error { return fn(&boltTx{tx: tx}) })
+}
+
+func (t *boltTx) bucket(name []byte) *bolt.Bucket {
+	return t.tx.Bucket(name)
+}
+
+// ---- 编码 ----
+
+func u64Key(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func u32Key(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+// joinKey 拼接索引键
+func joinKey(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// keyID 取索引键末尾 8 字节的主键
+func keyID(k []byte) uint64 {
+	return binary.BigEndian.Uint64(k[len(k)-8:])
+}
+
+func nameKey(name string, id uint64) []byte {
+	return joinKey([]byte(name), []byte{0}, u64Key(id))
+}
+
+// timeKey 创建时间索引键，创建时间为 Unix 秒，不会为负
+func timeKey(t int64, id uint64) []byte {
+	return joinKey(u64Key(uint64(t)), u64Key(id))
+}
+
+func sizeKey(size uint32, id uint64) []byte {
+	return joinKey(u32Key(size), u64Key(id))
+}
+
+// keyName 取文件名索引键中的文件名
+func keyName(k []byte) string {
+	return string(k[:len(k)-9])
+}
+
+func boltGet(b *bolt.Bucket, key []byte, v interface{}) (bool, error) {
+	data := b.Get(key)
+	if data == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+func boltPut(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// scanPrefix 按顺序遍历以 prefix 开头的键，fn 返回 false 时停止
+func scanPrefix(b *bolt.Bucket, prefix []byte, fn func(k, v []byte) (bool, error)) error {
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		more, err := fn(k, v)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanPrefixFrom 从不小于 start 的第一个键开始遍历以 prefix 开头的键，start 为空时从头开始
+func scanPrefixFrom(b *bolt.Bucket, prefix, start []byte, fn func(k, v []byte) (bool, error)) error {
+	seek := prefix
+	if bytes.Compare(start, prefix) > 0 {
+		seek = start
+	}
+	c := b.Cursor()
+	for k, v := c.Seek(seek); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		more, err := fn(k, v)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanRange 遍历 [lo, hi) 内的键，desc 时逆序，lo、hi 为 nil 表示不限
+func scanRange(b *bolt.Bucket, lo, hi []byte, desc bool, fn func(k, v []byte) (bool, error)) error {
+	c := b.Cursor()
+	var k, v []byte
+	if !desc {
+		if lo == nil {
+			k, v = c.First()
+		} else {
+			k, v = c.Seek(lo)
+		}
+		for ; k != nil && (hi == nil || bytes.Compare(k, hi) < 0); k, v = c.Next() {
+			more, err := fn(k, v)
+			if err != nil || !more {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if hi == nil {
+		k, v = c.Last()
+	} else if k, v = c.Seek(hi); k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+	for ; k != nil && (lo == nil || bytes.Compare(k, lo) >= 0); k, v = c.Prev() {
+		more, err := fn(k, v)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanPrefixReverse 按逆序遍历以 prefix 开头的键
+func scanPrefixReverse(b *bolt.Bucket, prefix []byte, fn func(k, v []byte) (bool, error)) error {
+	c := b.Cursor()
+	var k, v []byte
+	if end := prefixEnd(prefix); end == nil {
+		k, v = c.Last()
+	} else if k, v = c.Seek(end); k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+	for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Prev() {
+		more, err := fn(k, v)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// prefixEnd 返回大于所有以 prefix 开头的键的最小键，prefix 全为 0xff 时返回 nil
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// assignID 为自增主键分配 ID，已指定 ID 时推进序列避免之后重复
+func assignID(b *bolt.Bucket, id *uint64) error {
+	if *id == 0 {
+		next, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		*id = next
+		return nil
+	}
+	if *id > b.Sequence() {
+		return b.SetSequence(*id)
+	}
+	return nil
+}
+
+// ---- 文件记录 ----
+
+// boltFileStats 文件统计，与 Database.GetStats 的口径一致
+type boltFileStats struct {
+	Files      int64 `json:"files"`
+	Deleted    int64 `json:"deleted"`
+	Size       int64 `json:"size"`
+	DedupFiles int64 `json:"dedup_files"`
+	DedupSize  int64 `json:"dedup_size"`
+	Markers    int64 `json:"markers"` // 未删除的删除标记，不计入文件列表
+}
+
+func (s *boltFileStats) add(meta *FileMetadata, sign int64) {
+	s.Files += sign
+	s.Size += sign * int64(meta.Size)
+	if meta.Deleted {
+		s.Deleted += sign
+	} else if meta.DeleteMarker {
+		s.Markers += sign
+	} else if meta.NeedleID != 0 && meta.NeedleID != meta.ID {
+		s.DedupFiles += sign
+		s.DedupSize += sign * int64(meta.Size)
+	}
+}
+
+func (t *boltTx) file(id uint64) (*FileMetadata, error) {
+	var meta FileMetadata
+	found, err := boltGet(t.bucket(boltFiles), u64Key(id), &meta)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// boltMarkerValue 删除标记在文件名索引中的值，文件列表按键扫描时据此跳过
+var boltMarkerValue = []byte{1}
+
+// fileIndexes 返回文件记录的全部索引键
+// 删除标记只进入文件名索引，供按文件名查找版本，不进入时间和大小索引
+func fileIndexes(meta *FileMetadata) map[string][]byte {
+	keys := map[string][]byte{
+		string(boltFilesByVolume): joinKey(u32Key(meta.VolumeID), u64Key(meta.ID)),
+	}
+	if meta.Deleted {
+		keys[string(boltTrash)] = joinKey(u64Key(uint64(meta.DeleteTime)), u64Key(meta.ID))
+	} else if meta.DeleteMarker {
+		keys[string(boltFilesByName)] = nameKey(meta.FileName, meta.ID)
+	} else {
+		keys[string(boltFilesByName)] = nameKey(meta.FileName, meta.ID)
+		keys[string(boltFilesByTime)] = timeKey(meta.CreateTime, meta.ID)
+		keys[string(boltFilesBySize)] = sizeKey(meta.Size, meta.ID)
+		if meta.ExpireTime > 0 {
+			keys[string(boltFilesByExpire)] = joinKey(u64Key(uint64(meta.ExpireTime)), u64Key(meta.ID))
+		}
+	}
+	if meta.NeedleID != 0 {
+		keys[string(boltFilesByNeedle)] = joinKey(u64Key(meta.NeedleID), u64Key(meta.ID))
+	}
+	if meta.Seq != 0 {
+		keys[string(boltFilesBySeq)] = joinKey(u64Key(meta.Seq), u64Key(meta.ID))
+	}
+	return keys
+}
+
+// putFile 新增或覆盖文件记录，同时更新索引和统计
+func (t *boltTx) putFile(meta *FileMetadata) error {
+	if !validBoltFileName(meta.FileName) {
+		return fmt.Errorf("invalid file name: contains NUL byte")
+	}
+	old, err := t.file(meta.ID)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		if err := t.unindexFile(old); err != nil {
+			return err
+		}
+	}
+
+	meta.UpdateTime = time.Now()
+	if err := boltPut(t.bucket(boltFiles), u64Key(meta.ID), meta); err != nil {
+		return err
+	}
+	for name, key := range fileIndexes(meta) {
+		var value []byte
+		if meta.DeleteMarker && name == string(boltFilesByName) {
+			value = boltMarkerValue
+		}
+		if err := t.bucket([]byte(name)).Put(key, value); err != nil {
+			return err
+		}
+	}
+	return t.updateStats(old, meta)
+}
+
+// createFile 新增文件记录，ID 已存在时返回 ErrFileExists
+func (t *boltTx) createFile(meta *FileMetadata) error {
+	if t.bucket(boltFiles).Get(u64Key(meta.ID)) != nil {
+		return ErrFileExists
+	}
+	return t.putFile(meta)
+}
+
+// removeFile 删除文件记录及其索引
+func (t *boltTx) removeFile(meta *FileMetadata) error {
+	if err := t.unindexFile(meta); err != nil {
+		return err
+	}
+	if err := t.bucket(boltFiles).Delete(u64Key(meta.ID)); err != nil {
+		return err
+	}
+	return t.updateStats(meta, nil)
+}
+
+func (t *boltTx) unindexFile(meta *FileMetadata) error {
+	for name, key := range fileIndexes(meta) {
+		if err := t.bucket([]byte(name)).Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *boltTx) stats() (*boltFileStats, error) {
+	var stats boltFileStats
+	_, err := boltGet(t.bucket(boltStats), boltFileStatsKey, &stats)
+	return &stats, err
+}
+
+func (t *boltTx) updateStats(old, meta *FileMetadata) error {
+	stats, err := t.stats()
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		stats.add(old, -1)
+	}
+	if meta != nil {
+		stats.add(meta, 1)
+	}
+	return boltPut(t.bucket(boltStats), boltFileStatsKey, stats)
+}
+
+// filesByIDs 按 ID 加载文件记录，跳过不存在的
+func (t *boltTx) filesByIDs(ids []uint64) ([]*FileMetadata, error) {
+	metas := make([]*FileMetadata, 0, len(ids))
+	for _, id := range ids {
+		meta, err := t.file(id)
+		if err != nil {
+			return nil, err
+		}
+		if meta != nil {
+			metas = append(metas, meta)
+		}
+	}
+	return metas, nil
+}
+
+// filesOfNeedles 返回 ID 或 NeedleID 在 ids 中的文件记录，包括已删除的
+func (t *boltTx) filesOfNeedles(ids []uint64) ([]*FileMetadata, error) {
+	seen := make(map[uint64]bool)
+	fileIDs := make([]uint64, 0, len(ids))
+	add := func(id uint64) {
+		if !seen[id] {
+			seen[id] = true
+			fileIDs = append(fileIDs, id)
+		}
+	}
+
+	byNeedle := t.bucket(boltFilesByNeedle)
+	for _, id := range ids {
+		if t.bucket(boltFiles).Get(u64Key(id)) != nil {
+			add(id)
+		}
+		err := scanPrefix(byNeedle, u64Key(id), func(k, _ []byte) (bool, error) {
+			add(keyID(k))
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t.filesByIDs(fileIDs)
+}
+
+func (t *boltTx) updateFile(id uint64, fn func(meta *FileMetadata)) error {
+	meta, err := t.file(id)
+	if err != nil || meta == nil {
+		return err
+	}
+	fn(meta)
+	return t.putFile(meta)
+}
+
+func (d *BoltDatabase) SaveFileMetadata(meta *FileMetadata) error {
+	return d.update(func(t *boltTx) error {
+		return t.createFile(meta)
+	})
+}
+
+func (d *BoltDatabase) GetFileMetadata(id uint64) (*FileMetadata, error) {
+	return d.getFile(id, false)
+}
+
+func (d *BoltDatabase) GetDeletedFileMetadata(id uint64) (*FileMetadata, error) {
+	return d.getFile(id, true)
+}
+
+func (d *BoltDatabase) getFile(id uint64, deleted bool) (*FileMetadata, error) {
+	var meta *FileMetadata
+	err := d.view(func(t *boltTx) error {
+		var err error
+		meta, err = t.file(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil || meta.Deleted != deleted {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return meta, nil
+}
+
+func (d *BoltDatabase) FileExists(id uint64) (bool, error) {
+	exists := false
+	err := d.view(func(t *boltTx) error {
+		exists = t.bucket(boltFiles).Get(u64Key(id)) != nil
+		return nil
+	})
+	return exists, err
+}
+
+func (d *BoltDatabase) SaveFileMetadataWithRef(meta *FileMetadata, ref *NeedleRef, volumeSize int64) error {
+	return d.update(func(t *boltTx) error {
+		if err := t.createFile(meta); err != nil {
+			return err
+		}
+		if t.bucket(boltNeedleRefs).Get(u64Key(ref.NeedleID)) != nil {
+			return fmt.Errorf("needle ref %d already exists", ref.NeedleID)
+		}
+		if err := t.putRef(ref); err != nil {
+			return err
+		}
+
+		info, err := t.volume(meta.VolumeID)
+		if err != nil || info == nil || info.CurrentSize >= volumeSize {
+			return err
+		}
+		info.CurrentSize = volumeSize
+		return t.putVolume(info)
+	})
+}
+
+func (d *BoltDatabase) AddNeedleRef(meta *FileMetadata) error {
+	return d.update(func(t *boltTx) error {
+		ref, err := t.ref(meta.NeedleID)
+		if err != nil {
+			return err
+		}
+		if ref == nil || ref.RefCount <= 0 {
+			return ErrNeedleNotFound
+		}
+		ref.RefCount++
+		if err := t.putRef(ref); err != nil {
+			return err
+		}
+		return t.createFile(meta)
+	})
+}
+
+func (d *BoltDatabase) ReleaseFileMetadata(meta *FileMetadata, seq uint64) (int64, error) {
+	var remaining int64
+	err := d.update(func(t *boltTx) error {
+		needleID := meta.DataNeedleID()
+
+		// 去重功能上线前写入的文件没有引用记录
+		ref, err := t.ref(needleID)
+		if err != nil {
+			return err
+		}
+		remaining = 0
+		if ref != nil {
+			remaining = ref.RefCount - 1
+			if remaining < 0 {
+				remaining = 0
+			}
+			ref.RefCount = remaining
+			if err := t.putRef(ref); err != nil {
+				return err
+			}
+		}
+
+		err = t.updateFile(meta.ID, func(m *FileMetadata) {
+			m.Deleted = true
+			m.DeleteTime = time.Now().Unix()
+			m.Seq = seq
+			if remaining == 0 {
+				m.Flags = 1
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		// Needle 的拥有者记录可能早已删除，最后一个引用释放时一并标记
+		if remaining == 0 && needleID != meta.ID {
+			return t.updateFile(needleID, func(m *FileMetadata) {
+				m.Flags = 1
+				m.Seq = seq
+			})
+		}
+		return nil
+	})
+	return remaining, err
+}
+
+func (d *BoltDatabase) RestoreFileMetadata(meta *FileMetadata, seq uint64) error {
+	return d.update(func(t *boltTx) error {
+		needleID := meta.DataNeedleID()
+
+		current, err := t.file(meta.ID)
+		if err != nil {
+			return err
+		}
+		if current == nil || !current.Deleted {
+			return ErrNeedleNotFound
+		}
+
+		ref, err := t.ref(needleID)
+		if err != nil {
+			return err
+		}
+		if ref != nil {
+			ref.RefCount++
+			if err := t.putRef(ref); err != nil {
+				return err
+			}
+		}
+
+		err = t.updateFile(meta.ID, func(m *FileMetadata) {
+			m.Deleted = false
+			m.DeleteTime = 0
+			m.Flags = 0
+			m.Seq = seq
+		})
+		if err != nil {
+			return err
+		}
+
+		if needleID != meta.ID {
+			return t.updateFile(needleID, func(m *FileMetadata) {
+				m.Flags = 0
+				m.Seq = seq
+			})
+		}
+		return nil
+	})
+}
+
+// UpdateFileAttributes 替换文件的用户元数据和标签并更新序列号
+func (d *BoltDatabase) UpdateFileAttributes(id uint64, userMeta, tags map[string]string, seq uint64) error {
+	return d.update(func(t *boltTx) error {
+		meta, err := t.file(id)
+		if err != nil {
+			return err
+		}
+		if meta == nil {
+			return gorm.ErrRecordNotFound
+		}
+		meta.UserMeta, meta.Tags, meta.Seq = userMeta, tags, seq
+		return t.putFile(meta)
+	})
+}
+
+// ApplyFileMetadata 写入备份中的文件记录，已存在时只更新删除状态、元数据、标签和序列号
+func (d *BoltDatabase) ApplyFileMetadata(meta *FileMetadata) error {
+	return d.update(func(t *boltTx) error {
+		existing, err := t.file(meta.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			copied := *meta
+			return t.putFile(&copied)
+		}
+		existing.Deleted = meta.Deleted
+		existing.DeleteTime = meta.DeleteTime
+		existing.Flags = meta.Flags
+		existing.UserMeta = meta.UserMeta
+		existing.Tags = meta.Tags
+		existing.Seq = meta.Seq
+		return t.putFile(existing)
+	})
+}
+
+func (d *BoltDatabase) UpdateNeedleOffsets(offsets map[uint64]int64) error {
+	return d.update(func(t *boltTx) error {
+		for needleID, offset := range offsets {
+			files, err := t.filesOfNeedles([]uint64{needleID})
+			if err != nil {
+				return err
+			}
+			for _, meta := range files {
+				if meta.ID != needleID && meta.NeedleID != needleID {
+					continue
+				}
+				meta.Offset = offset
+				if err := t.putFile(meta); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// ---- 文件查询 ----
+
+func (d *BoltDatabase) LoadAllFileMetadata() ([]*FileMetadata, error) {
+	return d.loadFiles(func(meta *FileMetadata) bool { return !meta.Deleted })
+}
+
+func (d *BoltDatabase) LoadAllFileMetadataIncludingDeleted() ([]*FileMetadata, error) {
+	return d.loadFiles(func(*FileMetadata) bool { return true })
+}
+
+func (d *BoltDatabase) loadFiles(match func(meta *FileMetadata) bool) ([]*FileMetadata, error) {
+	metas := make([]*FileMetadata, 0)
+	err := d.view(func(t *boltTx) error {
+		return t.bucket(boltFiles).ForEach(func(_, v []byte) error {
+			var meta FileMetadata
+			if err := json.Unmarshal(v, &meta); err != nil {
+				return err
+			}
+			if match(&meta) {
+				metas = append(metas, &meta)
+			}
+			return nil
+		})
+	})
+	return metas, err
+}
+
+// versionGroups 按文件名顺序遍历前缀匹配的未删除文件，每个文件名回调一次，ID 升序
+// from 不为空时从该文件名开始（包含该文件名）
+func (t *boltTx) versionGroups(prefix, from string, fn func(name string, ids []uint64) bool) error {
+	var (
+		current string
+		ids     []uint64
+	)
+	stopped := false
+	var start []byte
+	if from != "" {
+		start = append([]byte(from), 0)
+	}
+	err := scanPrefixFrom(t.bucket(boltFilesByName), []byte(prefix), start, func(k, _ []byte) (bool, error) {
+		name := keyName(k)
+		if len(ids) > 0 && name != current {
+			if !fn(current, ids) {
+				stopped = true
+				return false, nil
+			}
+			ids = nil
+		}
+		current = name
+		ids = append(ids, keyID(k))
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !stopped && len(ids) > 0 {
+		fn(current, ids)
+	}
+	return nil
+}
+
+// fileVersionIDs 返回文件名的所有未删除版本，ID 升序
+func (t *boltTx) fileVersionIDs(filename string) []uint64 {
+	ids := make([]uint64, 0)
+	prefix := append([]byte(filename), 0)
+	scanPrefix(t.bucket(boltFilesByName), prefix, func(k, _ []byte) (bool, error) {
+		if len(k) == len(prefix)+8 {
+			ids = append(ids, keyID(k))
+		}
+		return true, nil
+	})
+	return ids
+}
+
+func (d *BoltDatabase) FindByFilename(filename string) (*FileMetadata, error) {
+	var meta *FileMetadata
+	err := d.view(func(t *boltTx) error {
+		ids := t.fileVersionIDs(filename)
+		if len(ids) == 0 {
+			return nil
+		}
+		var err error
+		meta, err = t.file(ids[len(ids)-1])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return meta, nil
+}
+
+// ListByPrefix 按前缀列出文件，每个文件名只返回最新版本
+func (d *BoltDatabase) ListByPrefix(prefix string, limit int) ([]*FileMetadata, error) {
+	var metas []*FileMetadata
+	err := d.view(func(t *boltTx) error {
+		latest := make([]uint64, 0)
+		err := t.versionGroups(prefix, "", func(_ string, ids []uint64) bool {
+			latest = append(latest, ids[len(ids)-1])
+			return limit <= 0 || len(latest) < limit
+		})
+		if err != nil {
+			return err
+		}
+		metas, err = t.filesByIDs(latest)
+		return err
+	})
+	return metas, err
+}
+
+func (d *BoltDatabase) ListVersions(filename string) ([]*FileMetadata, error) {
+	var metas []*FileMetadata
+	err := d.view(func(t *boltTx) error {
+		ids := t.fileVersionIDs(filename)
+		reverseIDs(ids)
+		var err error
+		metas, err = t.filesByIDs(ids)
+		return err
+	})
+	return metas, err
+}
+
+// ListVersionsByPrefix 按前缀列出 after 之后的所有版本，按文件名排序、同名最新的在前
+func (d *BoltDatabase) ListVersionsByPrefix(prefix string, after VersionMarker, limit int) ([]*FileMetadata, error) {
+	var metas []*FileMetadata
+	err := d.view(func(t *boltTx) error {
+		all := make([]uint64, 0)
+		err := t.versionGroups(prefix, after.FileName, func(name string, ids []uint64) bool {
+			reverseIDs(ids)
+			if name == after.FileName {
+				ids = after.versionsAfter(ids)
+			}
+			all = append(all, ids...)
+			return limit <= 0 || len(all) < limit
+		})
+		if err != nil {
+			return err
+		}
+		if limit > 0 && len(all) > limit {
+			all = all[:limit]
+		}
+		metas, err = t.filesByIDs(all)
+		return err
+	})
+	return metas, err
+}
+
+func reverseIDs(ids []uint64) {
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+}
+
+// ListTrash 列出删除时间晚于 since 的文件，最近删除的在前
+func (d *BoltDatabase) ListTrash(since int64, offset, limit int) ([]*FileMetadata, int64, error) {
+	var (
+		metas []*FileMetadata
+		total int64
+	)
+	err := d.view(func(t *boltTx) error {
+		ids := make([]uint64, 0)
+		err := scanPrefixReverse(t.bucket(boltTrash), nil, func(k, _ []byte) (bool, error) {
+			if int64(binary.BigEndian.Uint64(k[:8])) <= since {
+				return false, nil
+			}
+			if total >= int64(offset) && (limit <= 0 || len(ids) < limit) {
+				ids = append(ids, keyID(k))
+			}
+			total++
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		metas, err = t.filesByIDs(ids)
+		return err
+	})
+	return metas, total, err
+}
+
+// ListExpired 列出 TTL 已到期的文件，最早到期的在前
+func (d *BoltDatabase) ListExpired(now int64, limit int) ([]*FileMetadata, error) {
+	var metas []*FileMetadata
+	err := d.view(func(t *boltTx) error {
+		ids := make([]uint64, 0)
+		err := scanPrefix(t.bucket(boltFilesByExpire), nil, func(k, _ []byte) (bool, error) {
+			if int64(binary.BigEndian.Uint64(k[:8])) > now {
+				return false, nil
+			}
+			ids = append(ids, keyID(k))
+			return limit <= 0 || len(ids) < limit, nil
+		})
+		if err != nil {
+			return err
+		}
+		metas, err = t.filesByIDs(ids)
+		return err
+	})
+	return metas, err
+}
+
+// boltFileScan 文件查询在一个排序索引（文件名、时间或大小）上的扫描
+// 索引字段上的条件和游标直接按键判断，其余条件才需要读取文件记录
+type boltFileScan struct {
+	q      *FileQuery
+	field  string // 索引字段，SortByName、SortBySize 或 SortByTime
+	lo, hi []byte // 键范围 [lo, hi)，nil 表示不限
+	empty  bool   // 条件不可能满足
+}
+
+var boltSortIndexes = map[string][]byte{
+	SortByName: boltFilesByName,
+	SortBySize: boltFilesBySize,
+	SortByTime: boltFilesByTime,
+}
+
+func newBoltFileScan(q *FileQuery, field string) *boltFileScan {
+	s := &boltFileScan{q: q, field: field}
+	switch field {
+	case SortBySize:
+		if q.MinSize > math.MaxUint32 || (q.MaxSize > 0 && q.MaxSize < q.MinSize) {
+			s.empty = true
+		}
+		if q.MinSize > 0 && !s.empty {
+			s.lo = u32Key(uint32(q.MinSize))
+		}
+		if q.MaxSize > 0 && q.MaxSize < math.MaxUint32 {
+			s.hi = u32Key(uint32(q.MaxSize + 1))
+		}
+	case SortByTime:
+		if q.CreatedAfter > 0 {
+			s.lo = u64Key(uint64(q.CreatedAfter))
+		}
+		if q.CreatedBefore > 0 {
+			s.hi = u64Key(uint64(q.CreatedBefore))
+		}
+	}
+
+	// 游标在索引字段上时收窄扫描范围，游标所在的键本身由 keyMatch 排除
+	if c := q.after; c != nil && c.Sort == field {
+		var key []byte
+		switch field {
+		case SortByName:
+			key = nameKey(c.Name, c.ID)
+		case SortBySize:
+			key = sizeKey(uint32(c.Num), c.ID)
+		default:
+			key = timeKey(c.Num, c.ID)
+		}
+		if q.Desc && (s.hi == nil || bytes.Compare(key, s.hi) < 0) {
+			s.hi = key
+		} else if !q.Desc && bytes.Compare(key, s.lo) > 0 {
+			s.lo = key
+		}
+	}
+	return s
+}
+
+// needRecord 除索引字段外是否还有需要读取文件记录才能判断的条件
+func (s *boltFileScan) needRecord() bool {
+	q := s.q
+	switch {
+	case q.MimePrefix != "" || q.MD5 != "" || len(q.Tags) > 0:
+		return true
+	case q.Name != "" && s.field != SortByName:
+		return true
+	case (q.MinSize > 0 || q.MaxSize > 0) && s.field != SortBySize:
+		return true
+	case (q.CreatedAfter > 0 || q.CreatedBefore > 0) && s.field != SortByTime:
+		return true
+	case q.after != nil && q.after.Sort != s.field:
+		return true
+	}
+	return false
+}
+
+// keyMatch 按索引键和值判断索引字段上的条件和游标
+func (s *boltFileScan) keyMatch(k, v []byte) bool {
+	q, id := s.q, keyID(k)
+	switch s.field {
+	case SortByName:
+		if bytes.Equal(v, boltMarkerValue) {
+			return false
+		}
+		name := keyName(k)
+		if q.Name != "" && !q.matchName(name) {
+			return false
+		}
+		if q.after != nil && q.after.Sort == SortByName {
+			return q.compare(name, 0, id, q.after) > 0
+		}
+	case SortBySize:
+		if q.after != nil && q.after.Sort == SortBySize {
+			return q.compare("", int64(binary.BigEndian.Uint32(k)), id, q.after) > 0
+		}
+	default:
+		if q.after != nil && q.after.Sort == SortByTime {
+			return q.compare("", int64(binary.BigEndian.Uint64(k)), id, q.after) > 0
+		}
+	}
+	return true
+}
+
+// each 按查询的顺序遍历满足条件的文件，load 为 false 且不需要读取记录时 fn 收到 nil
+func (s *boltFileScan) each(t *boltTx, load bool, fn func(meta *FileMetadata) bool) error {
+	if s.empty {
+		return nil
+	}
+	needRecord := s.needRecord()
+	return scanRange(t.bucket(boltSortIndexes[s.field]), s.lo, s.hi, s.q.Desc, func(k, v []byte) (bool, error) {
+		if !s.keyMatch(k, v) {
+			return true, nil
+		}
+		var meta *FileMetadata
+		if load || needRecord {
+			var err error
+			if meta, err = t.file(keyID(k)); err != nil {
+				return false, err
+			}
+			if meta == nil || needRecord && !s.q.match(meta) {
+				return true, nil
+			}
+		}
+		return fn(meta), nil
+	})
+}
+
+// QueryFiles 沿排序字段的索引按顺序扫描，从游标处开始，取满 limit 条即停止
+func (d *BoltDatabase) QueryFiles(q FileQuery, limit int) ([]*FileMetadata, error) {
+	metas := make([]*FileMetadata, 0)
+	err := d.view(func(t *boltTx) error {
+		skip := q.Offset
+		return newBoltFileScan(&q, q.Sort).each(t, true, func(meta *FileMetadata) bool {
+			if skip > 0 {
+				skip--
+				return true
+			}
+			metas = append(metas, meta)
+			return limit <= 0 || len(metas) < limit
+		})
+	})
+	return metas, err
+}
+
+// CountFiles 只按索引键计数，条件涉及索引之外的字段时才读取文件记录；没有条件时直接使用统计
+func (d *BoltDatabase) CountFiles(q FileQuery) (int64, error) {
+	q.after = nil
+	field := SortByName
+	switch {
+	case q.MinSize > 0 || q.MaxSize > 0:
+		field = SortBySize
+	case q.CreatedAfter > 0 || q.CreatedBefore > 0:
+		field = SortByTime
+	}
+
+	var count int64
+	err := d.view(func(t *boltTx) error {
+		scan := newBoltFileScan(&q, field)
+		if q.Name == "" && !scan.needRecord() && scan.lo == nil && scan.hi == nil && !scan.empty {
+			stats, err := t.stats()
+			count = stats.Files - stats.Deleted - stats.Markers
+			return err
+		}
+		return scan.each(t, false, func(*FileMetadata) bool {
+			count++
+			return true
+		})
+	})
+	return count, err
+}
+
+// ListCreatedBefore 列出前缀匹配且创建时间早于 before 的文件
+func (d *BoltDatabase) ListCreatedBefore(prefix string, before int64, limit int) ([]*FileMetadata, error) {
+	metas := make([]*FileMetadata, 0)
+	err := d.view(func(t *boltTx) error {
+		return scanPrefix(t.bucket(boltFilesByName), []byte(prefix), func(k, _ []byte) (bool, error) {
+			meta, err := t.file(keyID(k))
+			if err != nil {
+				return false, err
+			}
+			if meta != nil && meta.CreateTime < before {
+				metas = append(metas, meta)
+			}
+			return limit <= 0 || len(metas) < limit, nil
+		})
+	})
+	return metas, err
+}
+
+func (d *BoltDatabase) ListFilesByNeedles(ids []uint64) ([]*FileMetadata, error) {
+	var metas []*FileMetadata
+	err := d.view(func(t *boltTx) error {
+		var err error
+		metas, err = t.filesOfNeedles(ids)
+		return err
+	})
+	return metas, err
+}
+
+// ListChanges 列出序列号在 (since, until] 内的文件记录，按序列号排序
+func (d *BoltDatabase) ListChanges(since, until uint64) ([]FileMetadata, error) {
+	metas := make([]FileMetadata, 0)
+	err := d.view(func(t *boltTx) error {
+		c := t.bucket(boltFilesBySeq).Cursor()
+		for k, _ := c.Seek(u64Key(since + 1)); k != nil; k, _ = c.Next() {
+			if binary.BigEndian.Uint64(k[:8]) > until {
+				break
+			}
+			meta, err := t.file(keyID(k))
+			if err != nil {
+				return err
+			}
+			if meta != nil {
+				metas = append(metas, *meta)
+			}
+		}
+		return nil
+	})
+	return metas, err
+}
+
+func (d *BoltDatabase) GetStats() (map[string]interface{}, error) {
+	var (
+		stats   *boltFileStats
+		volumes int64
+	)
+	err := d.view(func(t *boltTx) error {
+		var err error
+		if stats, err = t.stats(); err != nil {
+			return err
+		}
+		volumes = int64(t.bucket(boltVolumes).Stats().KeyN)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"total_files":       stats.Files,
+		"deleted_files":     stats.Deleted,
+		"active_files":      stats.Files - stats.Deleted,
+		"total_size":        stats.Size,
+		"volume_count":      volumes,
+		"dedup_files":       stats.DedupFiles,
+		"dedup_saved_bytes": stats.DedupSize,
+	}, nil
+}
+
+// ---- Needle 引用 ----
+
+func (t *boltTx) ref(needleID uint64) (*NeedleRef, error) {
+	var ref NeedleRef
+	found, err := boltGet(t.bucket(boltNeedleRefs), u64Key(needleID), &ref)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+func refMD5Key(ref *NeedleRef) []byte {
+	return joinKey([]byte(ref.MD5), u32Key(ref.Size), u64Key(ref.NeedleID))
+}
+
+// putRef 新增或覆盖引用记录，同时维护 MD5 索引
+func (t *boltTx) putRef(ref *NeedleRef) error {
+	old, err := t.ref(ref.NeedleID)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		if err := t.bucket(boltRefsByMD5).Delete(refMD5Key(old)); err != nil {
+			return err
+		}
+	}
+	if err := boltPut(t.bucket(boltNeedleRefs), u64Key(ref.NeedleID), ref); err != nil {
+		return err
+	}
+	return t.bucket(boltRefsByMD5).Put(refMD5Key(ref), nil)
+}
+
+func (t *boltTx) removeRef(ref *NeedleRef) error {
+	if err := t.bucket(boltRefsByMD5).Delete(refMD5Key(ref)); err != nil {
+		return err
+	}
+	return t.bucket(boltNeedleRefs).Delete(u64Key(ref.NeedleID))
+}
+
+// FindNeedleRefs 按 MD5 和大小查找仍被引用的 Needle
+func (d *BoltDatabase) FindNeedleRefs(md5 string, size uint32) ([]NeedleRef, error) {
+	refs := make([]NeedleRef, 0)
+	err := d.view(func(t *boltTx) error {
+		prefix := joinKey([]byte(md5), u32Key(size))
+		return scanPrefix(t.bucket(boltRefsByMD5), prefix, func(k, _ []byte) (bool, error) {
+			if len(k) != len(prefix)+8 {
+				return true, nil
+			}
+			ref, err := t.ref(keyID(k))
+			if err != nil {
+				return false, err
+			}
+			if ref != nil && ref.RefCount > 0 {
+				refs = append(refs, *ref)
+			}
+			return true, nil
+		})
+	})
+	return refs, err
+}
+
+func (d *BoltDatabase) GetNeedleRefs(ids []uint64) ([]NeedleRef, error) {
+	refs := make([]NeedleRef, 0, len(ids))
+	err := d.view(func(t *boltTx) error {
+		for _, id := range ids {
+			ref, err := t.ref(id)
+			if err != nil {
+				return err
+			}
+			if ref != nil {
+				refs = append(refs, *ref)
+			}
+		}
+		return nil
+	})
+	return refs, err
+}
+
+func (d *BoltDatabase) SaveNeedleRefs(refs []NeedleRef) error {
+	return d.update(func(t *boltTx) error {
+		for i := range refs {
+			if err := t.putRef(&refs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ReferencedNeedles 返回给定 Needle 中引用计数仍大于 0 的集合
+func (d *BoltDatabase) ReferencedNeedles(ids []uint64) (map[uint64]bool, error) {
+	result := make(map[uint64]bool)
+	refs, err := d.GetNeedleRefs(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if ref.RefCount > 0 {
+			result[ref.NeedleID] = true
+		}
+	}
+	return result, nil
+}
+
+// TrashedNeedles 返回给定 Needle 中仍被回收站文件（删除时间晚于 since）引用的集合
+func (d *BoltDatabase) TrashedNeedles(ids []uint64, since int64) (map[uint64]bool, error) {
+	result := make(map[uint64]bool)
+	files, err := d.ListFilesByNeedles(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, meta := range files {
+		if meta.Deleted && meta.DeleteTime > since {
+			result[meta.DataNeedleID()] = true
+		}
+	}
+	return result, nil
+}
+
+// ---- Volume ----
+
+func (t *boltTx) volume(id uint32) (*VolumeInfo, error) {
+	var info VolumeInfo
+	found, err := boltGet(t.bucket(boltVolumes), u32Key(id), &info)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (t *boltTx) putVolume(info *VolumeInfo) error {
+	now := time.Now()
+	if info.CreateTime.IsZero() {
+		info.CreateTime = now
+	}
+	info.UpdateTime = now
+	return boltPut(t.bucket(boltVolumes), u32Key(info.ID), info)
+}
+
+func (t *boltTx) updateVolume(id uint32, fn func(info *VolumeInfo)) error {
+	info, err := t.volume(id)
+	if err != nil || info == nil {
+		return err
+	}
+	fn(info)
+	return t.putVolume(info)
+}
+
+func (d *BoltDatabase) SaveVolumeInfo(info *VolumeInfo) error {
+	return d.update(func(t *boltTx) error {
+		if existing, err := t.volume(info.ID); err != nil {
+			return err
+		} else if existing != nil && info.CreateTime.IsZero() {
+			info.CreateTime = existing.CreateTime
+		}
+		return t.putVolume(info)
+	})
+}
+
+func (d *BoltDatabase) GetVolumeInfo(id uint32) (*VolumeInfo, error) {
+	var info *VolumeInfo
+	err := d.view(func(t *boltTx) error {
+		var err error
+		info, err = t.volume(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return info, nil
+}
+
+func (d *BoltDatabase) LoadAllVolumeInfo() ([]VolumeInfo, error) {
+	infos := make([]VolumeInfo, 0)
+	err := d.view(func(t *boltTx) error {
+		return t.bucket(boltVolumes).ForEach(func(_, v []byte) error {
+			var info VolumeInfo
+			if err := json.Unmarshal(v, &info); err != nil {
+				return err
+			}
+			infos = append(infos, info)
+			return nil
+		})
+	})
+	return infos, err
+}
+
+func (d *BoltDatabase) UpdateVolumeSize(id uint32, size int64) error {
+	return d.update(func(t *boltTx) error {
+		return t.updateVolume(id, func(info *VolumeInfo) { info.CurrentSize = size })
+	})
+}
+
+func (d *BoltDatabase) SetVolumeInactive(id uint32) error {
+	return d.update(func(t *boltTx) error {
+		return t.updateVolume(id, func(info *VolumeInfo) { info.Active = false })
+	})
+}
+
+// volumeFiles 返回 Volume 中的所有文件记录，包括已删除的
+func (t *boltTx) volumeFiles(id uint32) ([]*FileMetadata, error) {
+	ids := make([]uint64, 0)
+	err := scanPrefix(t.bucket(boltFilesByVolume), u32Key(id), func(k, _ []byte) (bool, error) {
+		ids = append(ids, keyID(k))
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.filesByIDs(ids)
+}
+
+func (d *BoltDatabase) ListVolumeFiles(id uint32) ([]*FileMetadata, error) {
+	live := make([]*FileMetadata, 0)
+	err := d.view(func(t *boltTx) error {
+		files, err := t.volumeFiles(id)
+		for _, meta := range files {
+			if !meta.Deleted {
+				live = append(live, meta)
+			}
+		}
+		return err
+	})
+	return live, err
+}
+
+// DropVolume 删除 Volume 及其中所有文件的元数据，不留删除记录
+func (d *BoltDatabase) DropVolume(id uint32) error {
+	return d.update(func(t *boltTx) error {
+		files, err := t.volumeFiles(id)
+		if err != nil {
+			return err
+		}
+		for _, meta := range files {
+			if err := t.removeFile(meta); err != nil {
+				return err
+			}
+		}
+
+		refs := make([]NeedleRef, 0)
+		err = t.bucket(boltNeedleRefs).ForEach(func(_, v []byte) error {
+			var ref NeedleRef
+			if err := json.Unmarshal(v, &ref); err != nil {
+				return err
+			}
+			if ref.VolumeID == id {
+				refs = append(refs, ref)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := range refs {
+			if err := t.removeRef(&refs[i]); err != nil {
+				return err
+			}
+		}
+		return t.bucket(boltVolumes).Delete(u32Key(id))
+	})
+}
+
+// ---- Bucket 配置与生命周期规则 ----
+
+func (d *BoltDatabase) GetBucketSettings(name string) (*BucketSettings, error) {
+	var settings BucketSettings
+	found := false
+	err := d.view(func(t *boltTx) error {
+		var err error
+		found, err = boltGet(t.bucket(boltBucketSettings), []byte(name), &settings)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &settings, nil
+}
+
+func (d *BoltDatabase) SaveBucketSettings(settings *BucketSettings) error {
+	return d.update(func(t *boltTx) error {
+		return t.putBucketSettings(settings)
+	})
+}
+
+func (t *boltTx) putBucketSettings(settings *BucketSettings) error {
+	settings.UpdateTime = time.Now()
+	return boltPut(t.bucket(boltBucketSettings), []byte(settings.Name), settings)
+}
+
+func (t *boltTx) lifecycleRules(match func(rule *LifecycleRule) bool) ([]*LifecycleRule, error) {
+	rules := make([]*LifecycleRule, 0)
+	err := t.bucket(boltLifecycleRules).ForEach(func(_, v []byte) error {
+		var rule LifecycleRule
+		if err := json.Unmarshal(v, &rule); err != nil {
+			return err
+		}
+		if match(&rule) {
+			rules = append(rules, &rule)
+		}
+		return nil
+	})
+	return rules, err
+}
+
+func (t *boltTx) putLifecycleRule(rule *LifecycleRule) error {
+	b := t.bucket(boltLifecycleRules)
+	if err := assignID(b, &rule.ID); err != nil {
+		return err
+	}
+	if rule.CreateTime.IsZero() {
+		rule.CreateTime = time.Now()
+	}
+	return boltPut(b, u64Key(rule.ID), rule)
+}
+
+func (d *BoltDatabase) ListLifecycleRules() ([]*LifecycleRule, error) {
+	var rules []*LifecycleRule
+	err := d.view(func(t *boltTx) error {
+		var err error
+		rules, err = t.lifecycleRules(func(*LifecycleRule) bool { return true })
+		return err
+	})
+	return rules, err
+}
+
+func (d *BoltDatabase) ListBucketLifecycleRules(bucket string) ([]*LifecycleRule, error) {
+	var rules []*LifecycleRule
+	err := d.view(func(t *boltTx) error {
+		var err error
+		rules, err = t.lifecycleRules(func(rule *LifecycleRule) bool { return rule.Bucket == bucket })
+		return err
+	})
+	return rules, err
+}
+
+func (d *BoltDatabase) SaveLifecycleRule(rule *LifecycleRule) error {
+	return d.update(func(t *boltTx) error {
+		return t.putLifecycleRule(rule)
+	})
+}
+
+func (d *BoltDatabase) DeleteLifecycleRule(id uint64) error {
+	return d.update(func(t *boltTx) error {
+		b := t.bucket(boltLifecycleRules)
+		if b.Get(u64Key(id)) == nil {
+			return gorm.ErrRecordNotFound
+		}
+		return b.Delete(u64Key(id))
+	})
+}
+
+func (d *BoltDatabase) ReplaceBucketLifecycleRules(bucket string, rules []*LifecycleRule) error {
+	return d.update(func(t *boltTx) error {
+		existing, err := t.lifecycleRules(func(rule *LifecycleRule) bool { return rule.Bucket == bucket })
+		if err != nil {
+			return err
+		}
+		for _, rule := range existing {
+			if err := t.bucket(boltLifecycleRules).Delete(u64Key(rule.ID)); err != nil {
+				return err
+			}
+		}
+		for _, rule := range rules {
+			if err := t.putLifecycleRule(rule); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ---- 配额 ----
+
+func (t *boltTx) quotas() ([]*Quota, error) {
+	quotas := make([]*Quota, 0)
+	err := t.bucket(boltQuotas).ForEach(func(_, v []byte) error {
+		var q Quota
+		if err := json.Unmarshal(v, &q); err != nil {
+			return err
+		}
+		quotas = append(quotas, &q)
+		return nil
+	})
+	return quotas, err
+}
+
+func (t *boltTx) quota(id uint64) (*Quota, error) {
+	var q Quota
+	found, err := boltGet(t.bucket(boltQuotas), u64Key(id), &q)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &q, nil
+}
+
+func (t *boltTx) putQuota(q *Quota) error {
+	b := t.bucket(boltQuotas)
+	if err := assignID(b, &q.ID); err != nil {
+		return err
+	}
+	now := time.Now()
+	if q.CreateTime.IsZero() {
+		q.CreateTime = now
+	}
+	q.UpdateTime = now
+	return boltPut(b, u64Key(q.ID), q)
+}
+
+// ListQuotas 列出所有配额，按 Scope 和 Name 排序
+func (d *BoltDatabase) ListQuotas() ([]*Quota, error) {
+	var quotas []*Quota
+	err := d.view(func(t *boltTx) error {
+		var err error
+		quotas, err = t.quotas()
+		return err
+	})
+	sort.Slice(quotas, func(i, j int) bool {
+		if quotas[i].Scope != quotas[j].Scope {
+			return quotas[i].Scope < quotas[j].Scope
+		}
+		return quotas[i].Name < quotas[j].Name
+	})
+	return quotas, err
+}
+
+func (d *BoltDatabase) GetQuota(id uint64) (*Quota, error) {
+	var q *Quota
+	err := d.view(func(t *boltTx) error {
+		var err error
+		q, err = t.quota(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if q == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return q, nil
+}
+
+// SaveQuota 按 Scope 和 Name 新增或更新配额
+func (d *BoltDatabase) SaveQuota(quota *Quota) error {
+	return d.update(func(t *boltTx) error {
+		quotas, err := t.quotas()
+		if err != nil {
+			return err
+		}
+		quota.ID = 0
+		for _, existing := range quotas {
+			if existing.Scope == quota.Scope && existing.Name == quota.Name {
+				quota.ID = existing.ID
+				quota.CreateTime = existing.CreateTime
+				break
+			}
+		}
+		return t.putQuota(quota)
+	})
+}
+
+func (d *BoltDatabase) DeleteQuota(id uint64) error {
+	return d.update(func(t *boltTx) error {
+		b := t.bucket(boltQuotas)
+		if b.Get(u64Key(id)) == nil {
+			return gorm.ErrRecordNotFound
+		}
+		return b.Delete(u64Key(id))
+	})
+}
+
+// QuotaUsage 统计配额范围内未删除文件的总字节数和文件数，删除标记不计入
+func (d *BoltDatabase) QuotaUsage(scope, name string) (int64, int64, error) {
+	var bytes, objects int64
+	count := func(meta *FileMetadata) {
+		if meta.DeleteMarker {
+			return
+		}
+		bytes += int64(meta.Size)
+		objects++
+	}
+
+	err := d.view(func(t *boltTx) error {
+		var prefix string
+		switch scope {
+		case QuotaScopeBucket:
+			prefix = name + "/"
+		case QuotaScopePrefix:
+			prefix = name
+		case QuotaScopeTenant:
+			return t.bucket(boltFiles).ForEach(func(_, v []byte) error {
+				var meta FileMetadata
+				if err := json.Unmarshal(v, &meta); err != nil {
+					return err
+				}
+				if !meta.Deleted && meta.Tenant == name {
+					count(&meta)
+				}
+				return nil
+			})
+		default:
+			return fmt.Errorf("unknown quota scope: %s", scope)
+		}
+
+		return scanPrefix(t.bucket(boltFilesByName), []byte(prefix), func(k, _ []byte) (bool, error) {
+			meta, err := t.file(keyID(k))
+			if err == nil && meta != nil {
+				count(meta)
+			}
+			return true, err
+		})
+	})
+	return bytes, objects, err
+}
+
+// ChargeQuotas 在事务中为多个配额增加用量，任一配额超限时全部回滚并返回 ErrQuotaExceeded
+func (d *BoltDatabase) ChargeQuotas(ids []uint64, bytes, objects int64) error {
+	return d.update(func(t *boltTx) error {
+		for _, id := range ids {
+			q, err := t.quota(id)
+			if err != nil {
+				return err
+			}
+			if q == nil ||
+				(q.MaxBytes != 0 && q.UsedBytes+bytes > q.MaxBytes) ||
+				(q.MaxObjects != 0 && q.UsedObjects+objects > q.MaxObjects) {
+				return ErrQuotaExceeded
+			}
+			q.UsedBytes += bytes
+			q.UsedObjects += objects
+			if err := t.putQuota(q); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *BoltDatabase) ReleaseQuotas(ids []uint64, bytes, objects int64) error {
+	return d.update(func(t *boltTx) error {
+		for _, id := range ids {
+			q, err := t.quota(id)
+			if err != nil {
+				return err
+			}
+			if q == nil {
+				continue
+			}
+			q.UsedBytes -= bytes
+			q.UsedObjects -= objects
+			if err := t.putQuota(q); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ---- 快照与备份 ----
+
+// dumpSettings 导出 Bucket 配置、生命周期规则和配额
+func (t *boltTx) dumpSettings(dump *MetadataDump) error {
+	dump.BucketSettings = make([]BucketSettings, 0)
+	err := t.bucket(boltBucketSettings).ForEach(func(_, v []byte) error {
+		var settings BucketSettings
+		if err := json.Unmarshal(v, &settings); err != nil {
+			return err
+		}
+		dump.BucketSettings = append(dump.BucketSettings, settings)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rules, err := t.lifecycleRules(func(*LifecycleRule) bool { return true })
+	if err != nil {
+		return err
+	}
+	dump.LifecycleRules = make([]LifecycleRule, 0, len(rules))
+	for _, rule := range rules {
+		dump.LifecycleRules = append(dump.LifecycleRules, *rule)
+	}
+
+	quotas, err := t.quotas()
+	if err != nil {
+		return err
+	}
+	dump.Quotas = make([]Quota, 0, len(quotas))
+	for _, q := range quotas {
+		dump.Quotas = append(dump.Quotas, *q)
+	}
+	return nil
+}
+
+// DumpMetadata 在同一只读事务中导出所有元数据
+func (d *BoltDatabase) DumpMetadata() (*MetadataDump, error) {
+	dump := &MetadataDump{
+		Files:       make([]FileMetadata, 0),
+		NeedleRefs:  make([]NeedleRef, 0),
+		Webhooks:    make([]Webhook, 0),
+		IDSequences: make([]IDSequence, 0),
+	}
+	err := d.view(func(t *boltTx) error {
+		err := t.bucket(boltFiles).ForEach(func(_, v []byte) error {
+			var meta FileMetadata
+			if err := json.Unmarshal(v, &meta); err != nil {
+				return err
+			}
+			dump.Files = append(dump.Files, meta)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = t.bucket(boltNeedleRefs).ForEach(func(_, v []byte) error {
+			var ref NeedleRef
+			if err := json.Unmarshal(v, &ref); err != nil {
+				return err
+			}
+			dump.NeedleRefs = append(dump.NeedleRefs, ref)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = t.bucket(boltWebhooks).ForEach(func(_, v []byte) error {
+			var hook Webhook
+			if err := json.Unmarshal(v, &hook); err != nil {
+				return err
+			}
+			dump.Webhooks = append(dump.Webhooks, hook)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = t.bucket(boltSequences).ForEach(func(k, v []byte) error {
+			dump.IDSequences = append(dump.IDSequences, IDSequence{Name: string(k), Next: binary.BigEndian.Uint64(v)})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return t.dumpSettings(dump)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dump.Volumes, err = d.LoadAllVolumeInfo()
+	return dump, err
+}
+
+func (d *BoltDatabase) DumpSettings() (*MetadataDump, error) {
+	dump := &MetadataDump{}
+	err := d.view(func(t *boltTx) error {
+		return t.dumpSettings(dump)
+	})
+	return dump, err
+}
+
+// LoadMetadata 将导出的元数据写入空数据库
+func (d *BoltDatabase) LoadMetadata(dump *MetadataDump) error {
+	return d.update(func(t *boltTx) error {
+		if k, _ := t.bucket(boltFiles).Cursor().First(); k != nil {
+			return errors.New("target database is not empty")
+		}
+
+		for i := range dump.Files {
+			if err := t.createFile(&dump.Files[i]); err != nil {
+				return err
+			}
+		}
+		for i := range dump.Volumes {
+			if err := t.putVolume(&dump.Volumes[i]); err != nil {
+				return err
+			}
+		}
+		for i := range dump.NeedleRefs {
+			if err := t.putRef(&dump.NeedleRefs[i]); err != nil {
+				return err
+			}
+		}
+		for i := range dump.Webhooks {
+			if err := t.putWebhook(&dump.Webhooks[i]); err != nil {
+				return err
+			}
+		}
+		for _, seq := range dump.IDSequences {
+			if err := t.bucket(boltSequences).Put([]byte(seq.Name), u64Key(seq.Next)); err != nil {
+				return err
+			}
+		}
+		return t.insertSettings(dump.BucketSettings, dump.LifecycleRules, dump.Quotas)
+	})
+}
+
+// ReplaceSettings 用备份中的 Bucket 配置、生命周期规则和配额替换现有记录
+func (d *BoltDatabase) ReplaceSettings(settings []BucketSettings, rules []LifecycleRule, quotas []Quota) error {
+	return d.update(func(t *boltTx) error {
+		for _, name := range [][]byte{boltBucketSettings, boltLifecycleRules, boltQuotas} {
+			if err := t.tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := t.tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return t.insertSettings(settings, rules, quotas)
+	})
+}
+
+func (t *boltTx) insertSettings(settings []BucketSettings, rules []LifecycleRule, quotas []Quota) error {
+	for i := range settings {
+		if err := t.putBucketSettings(&settings[i]); err != nil {
+			return err
+		}
+	}
+	for i := range rules {
+		if err := t.putLifecycleRule(&rules[i]); err != nil {
+			return err
+		}
+	}
+	for i := range quotas {
+		if err := t.putQuota(&quotas[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ---- Webhook ----
+
+func (t *boltTx) putWebhook(hook *Webhook) error {
+	b := t.bucket(boltWebhooks)
+	if err := assignID(b, &hook.ID); err != nil {
+		return err
+	}
+	now := time.Now()
+	if hook.CreateTime.IsZero() {
+		hook.CreateTime = now
+	}
+	hook.UpdateTime = now
+	return boltPut(b, u64Key(hook.ID), hook)
+}
+
+func (d *BoltDatabase) ListWebhooks() ([]*Webhook, error) {
+	hooks := make([]*Webhook, 0)
+	err := d.view(func(t *boltTx) error {
+		return t.bucket(boltWebhooks).ForEach(func(_, v []byte) error {
+			var hook Webhook
+			if err := json.Unmarshal(v, &hook); err != nil {
+				return err
+			}
+			hooks = append(hooks, &hook)
+			return nil
+		})
+	})
+	return hooks, err
+}
+
+func (d *BoltDatabase) GetWebhook(id uint64) (*Webhook, error) {
+	var hook Webhook
+	found := false
+	err := d.view(func(t *boltTx) error {
+		var err error
+		found, err = boltGet(t.bucket(boltWebhooks), u64Key(id), &hook)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &hook, nil
+}
+
+func (d *BoltDatabase) SaveWebhook(hook *Webhook) error {
+	return d.update(func(t *boltTx) error {
+		return t.putWebhook(hook)
+	})
+}
+
+// DeleteWebhook 删除 Webhook 及其投递记录
+func (d *BoltDatabase) DeleteWebhook(id uint64) error {
+	return d.update(func(t *boltTx) error {
+		b := t.bucket(boltWebhooks)
+		if b.Get(u64Key(id)) == nil {
+			return gorm.ErrRecordNotFound
+		}
+		if err := b.Delete(u64Key(id)); err != nil {
+			return err
+		}
+
+		ids := make([]uint64, 0)
+		err := scanPrefix(t.bucket(boltDeliveriesHook), u64Key(id), func(k, _ []byte) (bool, error) {
+			ids = append(ids, keyID(k))
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, deliveryID := range ids {
+			delivery, err := t.delivery(deliveryID)
+			if err != nil {
+				return err
+			}
+			if delivery != nil {
+				if err := t.removeDelivery(delivery); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (t *boltTx) delivery(id uint64) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	found, err := boltGet(t.bucket(boltDeliveries), u64Key(id), &delivery)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func deliveryDueKey(delivery *WebhookDelivery) []byte {
+	return joinKey(u64Key(uint64(delivery.NextAttempt)), u64Key(delivery.ID))
+}
+
+// putDelivery 新增或覆盖投递记录，同时维护待投递索引和 Webhook 索引
+func (t *boltTx) putDelivery(delivery *WebhookDelivery) error {
+	b := t.bucket(boltDeliveries)
+	if err := assignID(b, &delivery.ID); err != nil {
+		return err
+	}
+	old, err := t.delivery(delivery.ID)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		if err := t.bucket(boltDeliveriesDue).Delete(deliveryDueKey(old)); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if delivery.CreateTime.IsZero() {
+		delivery.CreateTime = now
+	}
+	delivery.UpdateTime = now
+	if err := boltPut(b, u64Key(delivery.ID), delivery); err != nil {
+		return err
+	}
+	if delivery.Status == DeliveryPending {
+		if err := t.bucket(boltDeliveriesDue).Put(deliveryDueKey(delivery), nil); err != nil {
+			return err
+		}
+	}
+	return t.bucket(boltDeliveriesHook).Put(joinKey(u64Key(delivery.WebhookID), u64Key(delivery.ID)), nil)
+}
+
+func (t *boltTx) removeDelivery(delivery *WebhookDelivery) error {
+	if err := t.bucket(boltDeliveriesDue).Delete(deliveryDueKey(delivery)); err != nil {
+		return err
+	}
+	if err := t.bucket(boltDeliveriesHook).Delete(joinKey(u64Key(delivery.WebhookID), u64Key(delivery.ID))); err != nil {
+		return err
+	}
+	return t.bucket(boltDeliveries).Delete(u64Key(delivery.ID))
+}
+
+func (d *BoltDatabase) CreateDeliveries(deliveries []*WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return d.update(func(t *boltTx) error {
+		for _, delivery := range deliveries {
+			if err := t.putDelivery(delivery); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DueDeliveries 列出到达重试时间的待投递记录
+func (d *BoltDatabase) DueDeliveries(now int64, limit int) ([]*WebhookDelivery, error) {
+	deliveries := make([]*WebhookDelivery, 0)
+	err := d.view(func(t *boltTx) error {
+		return scanPrefix(t.bucket(boltDeliveriesDue), nil, func(k, _ []byte) (bool, error) {
+			if int64(binary.BigEndian.Uint64(k[:8])) > now {
+				return false, nil
+			}
+			delivery, err := t.delivery(keyID(k))
+			if err != nil {
+				return false, err
+			}
+			if delivery != nil {
+				deliveries = append(deliveries, delivery)
+			}
+			return limit <= 0 || len(deliveries) < limit, nil
+		})
+	})
+	return deliveries, err
+}
+
+// ListDeliveries 按时间倒序列出 Webhook 的投递记录，status 为空时不过滤
+func (d *BoltDatabase) ListDeliveries(webhookID uint64, status string, limit int) ([]*WebhookDelivery, error) {
+	deliveries := make([]*WebhookDelivery, 0)
+	err := d.view(func(t *boltTx) error {
+		return scanPrefixReverse(t.bucket(boltDeliveriesHook), u64Key(webhookID), func(k, _ []byte) (bool, error) {
+			delivery, err := t.delivery(keyID(k))
+			if err != nil {
+				return false, err
+			}
+			if delivery != nil && (status == "" || delivery.Status == status) {
+				deliveries = append(deliveries, delivery)
+			}
+			return limit <= 0 || len(deliveries) < limit, nil
+		})
+	})
+	return deliveries, err
+}
+
+func (d *BoltDatabase) GetDelivery(id uint64) (*WebhookDelivery, error) {
+	var delivery *WebhookDelivery
+	err := d.view(func(t *boltTx) error {
+		var err error
+		delivery, err = t.delivery(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return delivery, nil
+}
+
+func (d *BoltDatabase) SaveDelivery(delivery *WebhookDelivery) error {
+	return d.update(func(t *boltTx) error {
+		return t.putDelivery(delivery)
+	})
+}
+
+// ---- ID 序列 ----
+
+// LeaseSequence 从序列中租用 count 个连续值，返回起点；起点不小于 min
+// Bolt 同一时刻只有一个写事务，租到的区间不会重叠
+func (d *BoltDatabase) LeaseSequence(name string, min, count uint64) (uint64, error) {
+	var start uint64
+	err := d.update(func(t *boltTx) error {
+		b := t.bucket(boltSequences)
+		start = min
+		if v := b.Get([]byte(name)); v != nil {
+			if next := binary.BigEndian.Uint64(v); next > start {
+				start = next
+			}
+		}
+		return b.Put([]byte(name), u64Key(start+count))
+	})
+	return start, err
+}
+
+// validBoltFileName 文件名中不能包含 0x00，否则与索引键的分隔符冲突
+func validBoltFileName(name string) bool {
+	return !strings.ContainsRune(name, 0)
+}
@@ -0,0 +1,378 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// Cache 热点对象缓存，位于数据库和 Volume 之前
+// 元数据按文件 ID 缓存，文件内容按 Needle ID 缓存（去重的文件共享同一份内容）
+// 实现需并发安全；返回的元数据由调用方持有，实现不能再修改它
+type Cache interface {
+	GetMetadata(id uint64) (*FileMetadata, bool)
+	SetMetadata(meta *FileMetadata)
+	GetBody(needleID uint64) ([]byte, bool)
+	SetBody(needleID uint64, data []byte)
+	// Invalidate 删除文件元数据，needleID 非 0 时同时删除内容
+	Invalidate(id, needleID uint64)
+	// PurgeMetadata 清空所有元数据，用于压缩等批量修改之后
+	PurgeMetadata()
+	Stats() CacheStats
+}
+
+// CacheConfig 内存缓存配置
+type CacheConfig struct {
+	MetadataEntries int   // 元数据最大条数
+	BodyBytes       int64 // 文件内容最多占用的字节数
+	MaxObjectSize   int64 // 超过该大小的文件内容不缓存
+}
+
+// CacheTierStats 单层缓存统计
+type CacheTierStats struct {
+	Entries       int   `json:"entries"`
+	Bytes         int64 `json:"bytes"`
+	Capacity      int64 `json:"capacity"`
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Evictions     int64 `json:"evictions"`
+	Rejections    int64 `json:"rejections"` // 准入策略拒绝的写入
+	Invalidations int64 `json:"invalidations"`
+}
+
+// CacheStats 缓存统计
+type CacheStats struct {
+	Enabled  bool           `json:"enabled"`
+	Metadata CacheTierStats `json:"metadata"`
+	Body     CacheTierStats `json:"body"`
+}
+
+// SetCache 设置缓存，nil 表示关闭缓存
+func (s *Store) SetCache(cache Cache) {
+	s.cache = cache
+}
+
+// CacheStats 返回缓存统计
+func (s *Store) CacheStats() CacheStats {
+	if s.cache == nil {
+		return CacheStats{}
+	}
+	return s.cache.Stats()
+}
+
+// cachedMetadata 读取未删除文件的元数据，优先使用缓存
+func (s *Store) cachedMetadata(id uint64) (*FileMetadata, error) {
+	if s.cache == nil {
+		return s.db.GetFileMetadata(id)
+	}
+	if meta, ok := s.cache.GetMetadata(id); ok {
+		return meta, nil
+	}
+
+	// 读取期间发生失效时不回填，避免缓存已被删除或修改的记录
+	gen := atomic.LoadUint64(&s.cacheGen)
+	meta, err := s.db.GetFileMetadata(id)
+	if err != nil {
+		return nil, err
+	}
+	if atomic.LoadUint64(&s.cacheGen) == gen {
+		s.cache.SetMetadata(meta)
+	}
+	return meta, nil
+}
+
+// cachedNeedle 读取 Needle 数据，优先使用缓存
+func (s *Store) cachedNeedle(needleID uint64) ([]byte, error) {
+	if s.cache == nil {
+		return s.readNeedle(needleID)
+	}
+	if data, ok := s.cache.GetBody(needleID); ok {
+		return data, nil
+	}
+
+	gen := atomic.LoadUint64(&s.cacheGen)
+	data, err := s.readNeedle(needleID)
+	if err != nil {
+		return nil, err
+	}
+	if atomic.LoadUint64(&s.cacheGen) == gen {
+		s.cache.SetBody(needleID, data)
+	}
+	return data, nil
+}
+
+// invalidateCache 文件元数据或数据变化后使缓存失效，needleID 为 0 时保留内容
+func (s *Store) invalidateCache(id, needleID uint64) {
+	if s.cache == nil {
+		return
+	}
+	atomic.AddUint64(&s.cacheGen, 1)
+	s.cache.Invalidate(id, needleID)
+}
+
+// purgeCachedMetadata 批量修改元数据后清空元数据缓存
+func (s *Store) purgeCachedMetadata() {
+	if s.cache == nil {
+		return
+	}
+	atomic.AddUint64(&s.cacheGen, 1)
+	s.cache.PurgeMetadata()
+}
+
+// MemoryCache 进程内缓存，LRU 淘汰，TinyLFU 准入
+type MemoryCache struct {
+	metadata      *cacheTier
+	body          *cacheTier
+	maxObjectSize int64
+}
+
+// NewMemoryCache 创建进程内缓存
+func NewMemoryCache(cfg CacheConfig) *MemoryCache {
+	return &MemoryCache{
+		metadata:      newCacheTier(int64(cfg.MetadataEntries), cfg.MetadataEntries),
+		body:          newCacheTier(cfg.BodyBytes, int(cfg.BodyBytes/(16<<10))),
+		maxObjectSize: cfg.MaxObjectSize,
+	}
+}
+
+func (c *MemoryCache) GetMetadata(id uint64) (*FileMetadata, bool) {
+	value, ok := c.metadata.get(id)
+	if !ok {
+		return nil, false
+	}
+	meta := *value.(*FileMetadata)
+	return &meta, true
+}
+
+// SetMetadata 保存元数据副本，每条记录按 1 计入容量
+func (c *MemoryCache) SetMetadata(meta *FileMetadata) {
+	copied := *meta
+	c.metadata.set(meta.ID, &copied, 1)
+}
+
+// GetBody 返回缓存中的文件内容，调用方不能修改
+func (c *MemoryCache) GetBody(needleID uint64) ([]byte, bool) {
+	value, ok := c.body.get(needleID)
+	if !ok {
+		return nil, false
+	}
+	return value.([]byte), true
+}
+
+func (c *MemoryCache) SetBody(needleID uint64, data []byte) {
+	if c.maxObjectSize > 0 && int64(len(data)) > c.maxObjectSize {
+		return
+	}
+	c.body.set(needleID, data, int64(len(data)))
+}
+
+func (c *MemoryCache) Invalidate(id, needleID uint64) {
+	c.metadata.remove(id)
+	if needleID != 0 {
+		c.body.remove(needleID)
+	}
+}
+
+func (c *MemoryCache) PurgeMetadata() {
+	c.metadata.purge()
+}
+
+func (c *MemoryCache) Stats() CacheStats {
+	return CacheStats{
+		Enabled:  true,
+		Metadata: c.metadata.stats(),
+		Body:     c.body.stats(),
+	}
+}
+
+type cacheEntry struct {
+	key   uint64
+	value interface{}
+	size  int64
+}
+
+// cacheTier 按容量淘汰最久未使用的条目
+// 缓存已满时，新条目的访问频率必须高于被淘汰条目才会写入，避免一次性访问冲掉热点
+type cacheTier struct {
+	mu       sync.Mutex
+	capacity int64
+	used     int64
+	items    map[uint64]*list.Element
+	lru      *list.List
+	sketch   *frequencySketch
+	counters CacheTierStats
+}
+
+func newCacheTier(capacity int64, expectedItems int) *cacheTier {
+	return &cacheTier{
+		capacity: capacity,
+		items:    make(map[uint64]*list.Element),
+		lru:      list.New(),
+		sketch:   newFrequencySketch(expectedItems),
+	}
+}
+
+func (t *cacheTier) get(key uint64) (interface{}, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sketch.increment(key)
+	elem, ok := t.items[key]
+	if !ok {
+		t.counters.Misses++
+		return nil, false
+	}
+	t.counters.Hits++
+	t.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).value, true
+}
+
+func (t *cacheTier) set(key uint64, value interface{}, size int64) {
+	if size > t.capacity {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if elem, ok := t.items[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		t.used += size - entry.size
+		entry.value = value
+		entry.size = size
+		t.lru.MoveToFront(elem)
+		t.evictLocked()
+		return
+	}
+
+	// TinyLFU 准入：逐个比较候选条目与 LRU 尾部条目的访问频率
+	freq := t.sketch.estimate(key)
+	for t.used+size > t.capacity {
+		victim := t.lru.Back().Value.(*cacheEntry)
+		if freq <= t.sketch.estimate(victim.key) {
+			t.counters.Rejections++
+			return
+		}
+		t.removeLocked(t.lru.Back())
+		t.counters.Evictions++
+	}
+
+	t.items[key] = t.lru.PushFront(&cacheEntry{key: key, value: value, size: size})
+	t.used += size
+}
+
+// evictLocked 条目变大后淘汰到容量以内
+func (t *cacheTier) evictLocked() {
+	for t.used > t.capacity && t.lru.Len() > 0 {
+		t.removeLocked(t.lru.Back())
+		t.counters.Evictions++
+	}
+}
+
+func (t *cacheTier) remove(key uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if elem, ok := t.items[key]; ok {
+		t.removeLocked(elem)
+		t.counters.Invalidations++
+	}
+}
+
+func (t *cacheTier) purge() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.counters.Invalidations += int64(len(t.items))
+	t.items = make(map[uint64]*list.Element)
+	t.lru.Init()
+	t.used = 0
+}
+
+func (t *cacheTier) removeLocked(elem *list.Element) {
+	entry := t.lru.Remove(elem).(*cacheEntry)
+	delete(t.items, entry.key)
+	t.used -= entry.size
+}
+
+func (t *cacheTier) stats() CacheTierStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := t.counters
+	stats.Entries = len(t.items)
+	stats.Bytes = t.used
+	stats.Capacity = t.capacity
+	return stats
+}
+
+// frequencySketch Count-Min Sketch，4 行 4 位计数器，记录最近的访问频率
+// 计数总数达到 10 倍宽度时全部减半，使过去的热点逐渐冷却
+type frequencySketch struct {
+	table     []uint64 // 每个 uint64 存放 16 个 4 位计数器
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+var sketchSeeds = [4]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+func newFrequencySketch(expectedItems int) *frequencySketch {
+	width := 64
+	for width < expectedItems {
+		width <<= 1
+	}
+	if width > 1<<24 {
+		width = 1 << 24
+	}
+	return &frequencySketch{
+		table:   make([]uint64, width),
+		mask:    uint64(width - 1),
+		resetAt: width * 10,
+	}
+}
+
+// counter 返回第 row 行计数器所在的位置
+func (f *frequencySketch) counter(key uint64, row int) (int, uint) {
+	h := (key + sketchSeeds[row]) * 0x9e3779b97f4a7c15
+	h ^= h >> 32
+	index := int(h & f.mask)
+	shift := uint((h>>20)&15) * 4
+	return index, shift
+}
+
+func (f *frequencySketch) increment(key uint64) {
+	added := false
+	for row := 0; row < 4; row++ {
+		index, shift := f.counter(key, row)
+		if (f.table[index]>>shift)&0xf < 15 {
+			f.table[index] += 1 << shift
+			added = true
+		}
+	}
+	if added {
+		f.additions++
+		if f.additions >= f.resetAt {
+			f.reset()
+		}
+	}
+}
+
+func (f *frequencySketch) estimate(key uint64) uint64 {
+	min := uint64(15)
+	for row := 0; row < 4; row++ {
+		index, shift := f.counter(key, row)
+		if count := (f.table[index] >> shift) & 0xf; count < min {
+			min = count
+		}
+	}
+	return min
+}
+
+// reset 所有计数器减半
+func (f *frequencySketch) reset() {
+	for i := range f.table {
+		f.table[i] = (f.table[i] >> 1) & 0x7777777777777777
+	}
+	f.additions /= 2
+}
@@ -0,0 +1,355 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	changeSetFile    = "changes.json"
+	changeNeedlesDir = "needles/"
+)
+
+// ChangeSet 增量备份，包含序列号区间内的文件写入和删除记录
+// 未删除的记录附带其 Needle 数据，删除记录只携带元数据
+type ChangeSet struct {
+	Since          uint64           `json:"since"`
+	Until          uint64           `json:"until"`
+	CreateTime     int64            `json:"create_time"`
+	Files          []FileMetadata   `json:"files"` // 按序列号排序
+	NeedleRefs     []NeedleRef      `json:"needle_refs"`
+	BucketSettings []BucketSettings `json:"bucket_settings"`
+	LifecycleRules []LifecycleRule  `json:"lifecycle_rules"`
+	Quotas         []Quota          `json:"quotas"`
+	Needles        []uint64         `json:"needles"` // 附带数据的 Needle ID
+}
+
+// ApplyResult 应用增量备份的结果
+type ApplyResult struct {
+	Since   uint64 `json:"since"`
+	Until   uint64 `json:"until"`
+	Applied int    `json:"applied"`
+	Skipped int    `json:"skipped"`
+	Needles int    `json:"needles"`
+}
+
+// Changes 收集序列号大于 since 的变更
+// 截止序列号取已结束写入的位置，不大于它的变更都已提交，不需要暂停写入
+func (s *Store) Changes(since uint64) (*ChangeSet, error) {
+	until := s.committedSeq()
+
+	cs := &ChangeSet{
+		Since:      since,
+		Until:      until,
+		CreateTime: time.Now().Unix(),
+	}
+
+	files, err := s.db.ListChanges(since, cs.Until)
+	if err != nil {
+		return nil, err
+	}
+	cs.Files = files
+
+	// 未删除的文件需要携带数据，同一 Needle 只导出一次；删除标记没有数据
+	seen := make(map[uint64]bool)
+	withData := make(map[uint64]bool)
+	ids := make([]uint64, 0)
+	for _, meta := range files {
+		if meta.DeleteMarker {
+			continue
+		}
+		needleID := meta.DataNeedleID()
+		if !seen[needleID] {
+			seen[needleID] = true
+			ids = append(ids, needleID)
+		}
+		if !meta.Deleted && !withData[needleID] {
+			withData[needleID] = true
+			cs.Needles = append(cs.Needles, needleID)
+		}
+	}
+
+	if cs.NeedleRefs, err = s.db.GetNeedleRefs(ids); err != nil {
+		return nil, err
+	}
+
+	dump, err := s.db.DumpSettings()
+	if err != nil {
+		return nil, err
+	}
+	cs.BucketSettings = dump.BucketSettings
+	cs.LifecycleRules = dump.LifecycleRules
+	cs.Quotas = dump.Quotas
+
+	return cs, nil
+}
+
+// WriteChanges 将增量备份写为 tar.gz：changes.json 和 needles/<id> 数据文件
+func (s *Store) WriteChanges(w io.Writer, cs *ChangeSet) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.Marshal(cs)
+	if err != nil {
+		return err
+	}
+	if err := writeTarEntry(tw, changeSetFile, manifest); err != nil {
+		return err
+	}
+
+	for _, needleID := range cs.Needles {
+		data, err := s.readNeedleRaw(needleID)
+		if err != nil {
+			return fmt.Errorf("failed to read needle %d: %w", needleID, err)
+		}
+		if err := writeTarEntry(tw, changeNeedlesDir+strconv.FormatUint(needleID, 10), data); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ApplyChanges 将增量备份应用到当前存储，需在服务停止时或由副本同步协程执行
+// 备份应在基础快照之上按序列号顺序依次应用
+func (s *Store) ApplyChanges(r io.Reader) (*ApplyResult, error) {
+	tmp, err := os.MkdirTemp("", "haystack-changes-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	cs, err := readChangeSet(r, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.applyChangeSet(cs, tmp, nil, true)
+}
+
+// applyDeleteMarker 应用删除标记的记录，删除标记没有 Needle
+func (s *Store) applyDeleteMarker(meta *FileMetadata) error {
+	if err := s.db.ApplyFileMetadata(meta); err != nil {
+		return fmt.Errorf("failed to apply file %d: %w", meta.ID, err)
+	}
+	if err := s.reserveID(meta.ID); err != nil {
+		return err
+	}
+	s.invalidateCache(meta.ID, 0)
+	if meta.Seq > s.CurrentSeq() {
+		atomic.StoreUint64(&s.seq, meta.Seq)
+	}
+	return nil
+}
+
+// applyChangeSet 应用已解压到 dir 的变更
+// replace 中的 Needle 即使本地存在也用 dir 中的数据重写；settings 为 false 时不替换 Bucket 设置
+func (s *Store) applyChangeSet(cs *ChangeSet, dir string, replace map[uint64]bool, settings bool) (*ApplyResult, error) {
+	result := &ApplyResult{Since: cs.Since, Until: cs.Until}
+	refs := make(map[uint64]*NeedleRef, len(cs.NeedleRefs))
+	for i := range cs.NeedleRefs {
+		refs[cs.NeedleRefs[i].NeedleID] = &cs.NeedleRefs[i]
+	}
+
+	for i := range cs.Files {
+		meta := &cs.Files[i]
+		if meta.DeleteMarker {
+			if err := s.applyDeleteMarker(meta); err != nil {
+				return result, err
+			}
+			result.Applied++
+			continue
+		}
+		needleID := meta.DataNeedleID()
+
+		vol, offset, found := s.locateNeedle(needleID)
+		if found && replace[needleID] {
+			// 本地副本损坏，丢弃旧索引后重新写入，旧数据在压缩时回收
+			vol.mu.Lock()
+			delete(vol.NeedleIndex, needleID)
+			vol.mu.Unlock()
+			delete(replace, needleID)
+			found = false
+		}
+		if !found {
+			data, err := os.ReadFile(filepath.Join(dir, strconv.FormatUint(needleID, 10)))
+			if err != nil {
+				// 删除记录且本地没有数据，无需恢复
+				result.Skipped++
+				continue
+			}
+			if meta.SHA256 != "" && fmt.Sprintf("%x", sha256.Sum256(data)) != meta.SHA256 {
+				return result, fmt.Errorf("checksum mismatch for needle %d", needleID)
+			}
+
+			vol, offset, err = s.appendNeedle(&Needle{
+				ID:         needleID,
+				Cookie:     meta.Cookie,
+				Data:       data,
+				DataSize:   uint32(len(data)),
+				CreateTime: meta.CreateTime,
+				FileName:   meta.FileName,
+				MimeType:   meta.MimeType,
+				MD5:        meta.MD5,
+			}, s.expiryBucket(meta.ExpireTime))
+			if err != nil {
+				return result, err
+			}
+			s.db.UpdateVolumeSize(vol.ID, vol.CurrentSize)
+			result.Needles++
+		}
+
+		meta.VolumeID = vol.ID
+		meta.Offset = offset
+		if err := s.db.ApplyFileMetadata(meta); err != nil {
+			return result, fmt.Errorf("failed to apply file %d: %w", meta.ID, err)
+		}
+		if err := s.reserveID(meta.ID); err != nil {
+			return result, err
+		}
+		s.invalidateCache(meta.ID, needleID)
+		if ref, exists := refs[needleID]; exists {
+			ref.VolumeID = vol.ID
+		}
+
+		// 同步内存中的删除标记
+		if needleID == meta.ID {
+			if meta.Flags&0x01 != 0 {
+				vol.DeleteNeedle(needleID)
+			} else {
+				vol.UndeleteNeedle(needleID)
+			}
+		}
+		if meta.Seq > s.CurrentSeq() {
+			atomic.StoreUint64(&s.seq, meta.Seq)
+		}
+		result.Applied++
+	}
+
+	applied := make([]NeedleRef, 0, len(refs))
+	for _, ref := range refs {
+		if _, _, found := s.locateNeedle(ref.NeedleID); found {
+			applied = append(applied, *ref)
+		}
+	}
+	if err := s.db.SaveNeedleRefs(applied); err != nil {
+		return result, err
+	}
+	if settings {
+		if err := s.db.ReplaceSettings(cs.BucketSettings, cs.LifecycleRules, cs.Quotas); err != nil {
+			return result, err
+		}
+	}
+
+	if len(cs.Files) > 0 {
+		log.Printf("Applied changes %d..%d: %d files, %d needles written, %d skipped",
+			cs.Since, cs.Until, result.Applied, result.Needles, result.Skipped)
+	}
+	return result, nil
+}
+
+// locateNeedle 查找 Needle 所在的 Volume 和偏移，包括已打删除标记的 Needle
+func (s *Store) locateNeedle(needleID uint64) (*Volume, int64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, vol := range s.volumes {
+		vol.mu.RLock()
+		info, exists := vol.NeedleIndex[needleID]
+		vol.mu.RUnlock()
+		if exists {
+			return vol, info.Offset, true
+		}
+	}
+	return nil, 0, false
+}
+
+// readNeedleRaw 读取 Needle 数据，忽略删除标记
+func (s *Store) readNeedleRaw(needleID uint64) ([]byte, error) {
+	vol, _, found := s.locateNeedle(needleID)
+	if !found {
+		return nil, ErrNeedleNotFound
+	}
+
+	needle, err := vol.readNeedleRaw(needleID)
+	if err != nil {
+		return nil, err
+	}
+	return needle.Data, nil
+}
+
+// readChangeSet 解析增量备份，Needle 数据解压到 dir 下
+func readChangeSet(r io.Reader, dir string) (*ChangeSet, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var cs *ChangeSet
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case header.Name == changeSetFile:
+			cs = &ChangeSet{}
+			if err := json.NewDecoder(tr).Decode(cs); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", changeSetFile, err)
+			}
+		case strings.HasPrefix(header.Name, changeNeedlesDir):
+			name := strings.TrimPrefix(header.Name, changeNeedlesDir)
+			if _, err := strconv.ParseUint(name, 10, 64); err != nil {
+				return nil, fmt.Errorf("unexpected entry in backup: %s", header.Name)
+			}
+			out, err := os.Create(filepath.Join(dir, name))
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.Copy(out, tr)
+			out.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cs == nil {
+		return nil, fmt.Errorf("backup is missing %s", changeSetFile)
+	}
+	return cs, nil
+}
+
+func writeTarEntry(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
@@ -41,7 +41,11 @@ func (s *Store) runCompaction(cfg CompactionConfig) error {
 	s.mu.RLock()
 	volumes := make([]*Volume, 0, len(s.volumes))
 	for _, vol := range s.volumes {
-		if vol.CurrentSize >= cfg.MinVolumeSize {
+		vol.mu.RLock()
+		size := vol.CurrentSize
+		vol.mu.RUnlock()
+		// 分区 Volume 到期后整体删除，无需压缩
+		if size >= cfg.MinVolumeSize && vol.ExpiryBucket == 0 {
 			volumes = append(volumes, vol)
 		}
 	}
@@ -67,12 +71,19 @@ func (s *Store) RunCompactionNow() error {
 
 // compactVolume 压缩单个 Volume
 func (s *Store) compactVolume(vol *Volume, cfg CompactionConfig) error {
+	// 压缩期间暂停写入和删除，复制之后追加的 Needle 和打上的删除标记会随旧文件一起丢失
+	// 与快照相同，先获取 writeMu 再获取 compactMu
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
 	vol.mu.RLock()
 	totalFiles := len(vol.NeedleIndex)
-	deletedFiles := 0
-	for _, info := range vol.NeedleIndex {
+	tombstoned := make([]uint64, 0)
+	for id, info := range vol.NeedleIndex {
 		if info.Flags&0x01 != 0 {
-			deletedFiles++
+			tombstoned = append(tombstoned, id)
 		}
 	}
 	vol.mu.RUnlock()
@@ -81,13 +92,36 @@ func (s *Store) compactVolume(vol *Volume, cfg CompactionConfig) error {
 		return nil
 	}
 
-	deletedRatio := float64(deletedFiles) / float64(totalFiles)
+	// 引用计数仍大于 0 的 Needle 不能回收
+	referenced, err := s.db.ReferencedNeedles(tombstoned)
+	if err != nil {
+		return fmt.Errorf("failed to check needle references: %w", err)
+	}
+
+	// 回收站保留期内的 Needle 暂不回收
+	trashed, err := s.db.TrashedNeedles(tombstoned, s.trashCutoff())
+	if err != nil {
+		return fmt.Errorf("failed to check trashed needles: %w", err)
+	}
+
+	reclaimable := make(map[uint64]bool, len(tombstoned))
+	for _, id := range tombstoned {
+		if referenced[id] {
+			log.Printf("Needle %d is tombstoned but still referenced, keeping it", id)
+			continue
+		}
+		if !trashed[id] {
+			reclaimable[id] = true
+		}
+	}
+
+	deletedRatio := float64(len(reclaimable)) / float64(totalFiles)
 	if deletedRatio < cfg.DeletedThreshold {
 		return nil
 	}
 
-	log.Printf("Compacting volume %d: %d/%d files deleted (%.2f%%)",
-		vol.ID, deletedFiles, totalFiles, deletedRatio*100)
+	log.Printf("Compacting volume %d: %d/%d files reclaimable (%.2f%%)",
+		vol.ID, len(reclaimable), totalFiles, deletedRatio*100)
 
 	// 创建临时 Volume
 	tempID := vol.ID + 10000
@@ -97,11 +131,11 @@ func (s *Store) compactVolume(vol *Volume, cfg CompactionConfig) error {
 	}
 	defer tempVol.Close()
 
-	// 复制未删除的文件
+	// 复制不可回收的文件
 	vol.mu.RLock()
-	needles := make([]uint64, 0, totalFiles-deletedFiles)
-	for id, info := range vol.NeedleIndex {
-		if info.Flags&0x01 == 0 {
+	needles := make([]uint64, 0, totalFiles-len(reclaimable))
+	for id := range vol.NeedleIndex {
+		if !reclaimable[id] {
 			needles = append(needles, id)
 		}
 	}
@@ -109,7 +143,7 @@ func (s *Store) compactVolume(vol *Volume, cfg CompactionConfig) error {
 
 	copiedCount := 0
 	for _, id := range needles {
-		needle, err := vol.ReadNeedle(id)
+		needle, err := vol.readNeedleRaw(id)
 		if err != nil {
 			log.Printf("Failed to read needle %d: %v", id, err)
 			continue
@@ -123,9 +157,15 @@ func (s *Store) compactVolume(vol *Volume, cfg CompactionConfig) error {
 		copiedCount++
 	}
 
-	// 关闭原 Volume
+	// 关闭原 Volume，镜像在重新打开时按新文件完整复制
 	vol.mu.Lock()
 	vol.File.Close()
+	if vol.Mirror != nil {
+		vol.Mirror.Close()
+		if err := os.Remove(vol.MirrorPath); err != nil {
+			log.Printf("Failed to remove old mirror: %v", err)
+		}
+	}
 	vol.mu.Unlock()
 
 	// 重命名文件
@@ -145,7 +185,7 @@ func (s *Store) compactVolume(vol *Volume, cfg CompactionConfig) error {
 	}
 
 	// 重新打开 Volume
-	newVol, err := NewVolume(vol.ID, s.config.Storage.DataDir, s.config.Storage.MaxVolumeSize)
+	newVol, err := s.openVolume(vol.ID)
 	if err != nil {
 		return fmt.Errorf("failed to reopen volume: %w", err)
 	}
@@ -156,20 +196,59 @@ func (s *Store) compactVolume(vol *Volume, cfg CompactionConfig) error {
 		return fmt.Errorf("failed to load index: %w", err)
 	}
 
+	// 回收站中的 Needle 保留删除标记
+	for id := range trashed {
+		if info, exists := newVol.NeedleIndex[id]; exists && !referenced[id] {
+			info.Flags |= 0x01
+		}
+	}
+
 	// 更新 Store
 	s.mu.Lock()
 	s.volumes[vol.ID] = newVol
 	s.mu.Unlock()
 
-	// 更新数据库
+	// 更新数据库，偏移变化需同步到所有引用该 Needle 的文件
+	offsets := make(map[uint64]int64, len(newVol.NeedleIndex))
+	for id, info := range newVol.NeedleIndex {
+		offsets[id] = info.Offset
+	}
+	if err := s.db.UpdateNeedleOffsets(offsets); err != nil {
+		log.Printf("Failed to update needle offsets for volume %d: %v", vol.ID, err)
+	}
 	s.db.UpdateVolumeSize(vol.ID, newVol.CurrentSize)
 
+	// 回收的数据不再可读，偏移变化的元数据全部重新加载
+	for id := range reclaimable {
+		s.invalidateCache(0, id)
+	}
+	s.purgeCachedMetadata()
+
 	log.Printf("Compaction completed for volume %d: %d files copied, saved %.2f MB",
 		vol.ID, copiedCount, float64(vol.CurrentSize-newVol.CurrentSize)/(1024*1024))
 
+	s.publishCompacted(reclaimable)
+
 	return nil
 }
 
+// publishCompacted 为数据已被回收的文件发布 compacted 事件
+func (s *Store) publishCompacted(reclaimed map[uint64]bool) {
+	ids := make([]uint64, 0, len(reclaimed))
+	for id := range reclaimed {
+		ids = append(ids, id)
+	}
+
+	metas, err := s.db.ListFilesByNeedles(ids)
+	if err != nil {
+		log.Printf("Warning: failed to load compacted files: %v", err)
+		return
+	}
+	for _, meta := range metas {
+		s.publishFile(EventCompacted, meta)
+	}
+}
+
 // GetCompactionStats 获取压缩统计信息
 func (s *Store) GetCompactionStats() map[string]interface{} {
 	s.mu.RLock()
@@ -1,12 +1,16 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"haystack-lite/internal/config"
 
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -16,13 +20,38 @@ type Database struct {
 	db *gorm.DB
 }
 
+// NewDatabase 连接数据库并执行未应用的迁移
+// 数据库中有本程序不认识的迁移或已执行迁移的校验和不一致时拒绝启动
 func NewDatabase(dbType config.DatabaseType, dsn string) (*Database, error) {
+	d, err := ConnectDatabase(dbType, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := d.MigrateUp(0)
+	if err != nil {
+		d.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	for _, m := range applied {
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
+
+	log.Printf("Database (%s) connected, schema version %d", dbType, latestMigration())
+	return d, nil
+}
+
+// ConnectDatabase 只连接数据库，不检查也不迁移表结构，用于 migrate 子命令
+func ConnectDatabase(dbType config.DatabaseType, dsn string) (*Database, error) {
 	var dialector gorm.Dialector
 
 	switch dbType {
 	case config.DatabaseMySQL:
 		dialector = mysql.Open(dsn)
 		log.Printf("Connecting to MySQL: %s", maskPassword(dsn))
+	case config.DatabasePostgres:
+		dialector = postgres.Open(dsn)
+		log.Printf("Connecting to PostgreSQL: %s", maskPassword(dsn))
 	case config.DatabaseSQLite:
 		dialector = sqlite.Open(dsn)
 		log.Printf("Connecting to SQLite: %s", dsn)
@@ -36,14 +65,6 @@ func NewDatabase(dbType config.DatabaseType, dsn string) (*Database, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect database: %w", err)
 	}
-
-	// 自动迁移表结构
-	if err := db.AutoMigrate(&FileMetadata{}, &VolumeInfo{}); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
-	}
-
-	log.Printf("Database (%s) connected and migrated successfully", dbType)
-
 	return &Database{db: db}, nil
 }
 
@@ -71,14 +92,225 @@ func (d *Database) GetFileMetadata(id uint64) (*FileMetadata, error) {
 	return &meta, nil
 }
 
-// DeleteFileMetadata 逻辑删除文件
-func (d *Database) DeleteFileMetadata(id uint64) error {
-	return d.db.Model(&FileMetadata{}).
-		Where("id = ?", id).
-		Updates(map[string]interface{}{
-			"deleted": true,
-			"flags":   1,
-		}).Error
+// FileExists 判断文件 ID 是否已被使用，包括已删除的文件
+func (d *Database) FileExists(id uint64) (bool, error) {
+	var count int64
+	err := d.db.Model(&FileMetadata{}).Where("id = ?", id).Count(&count).Error
+	return count > 0, err
+}
+
+// SaveFileMetadataWithRef 在同一事务中保存文件元数据、创建 Needle 引用记录并更新 Volume 大小
+// 并发写入的提交顺序不确定，Volume 大小只增不减
+func (d *Database) SaveFileMetadataWithRef(meta *FileMetadata, ref *NeedleRef, volumeSize int64) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(meta).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(ref).Error; err != nil {
+			return err
+		}
+		return tx.Model(&VolumeInfo{}).
+			Where("id = ? AND current_size < ?", meta.VolumeID, volumeSize).
+			Update("current_size", volumeSize).Error
+	})
+}
+
+// FindNeedleRefs 按 MD5 和大小查找仍被引用的 Needle
+func (d *Database) FindNeedleRefs(md5 string, size uint32) ([]NeedleRef, error) {
+	var refs []NeedleRef
+	err := d.db.Where("md5 = ? AND size = ? AND ref_count > ?", md5, size, 0).Find(&refs).Error
+	return refs, err
+}
+
+// AddNeedleRef 为已存在的 Needle 新增一条引用它的文件元数据
+func (d *Database) AddNeedleRef(meta *FileMetadata) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&NeedleRef{}).
+			Where("needle_id = ? AND ref_count > ?", meta.NeedleID, 0).
+			Update("ref_count", gorm.Expr("ref_count + ?", 1))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNeedleNotFound
+		}
+		return tx.Create(meta).Error
+	})
+}
+
+// ReleaseFileMetadata 逻辑删除文件并释放其 Needle 引用，返回 Needle 剩余引用数
+// 剩余引用数为 0 时 Needle 同时被标记为删除
+func (d *Database) ReleaseFileMetadata(meta *FileMetadata, seq uint64) (int64, error) {
+	var remaining int64
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		needleID := meta.DataNeedleID()
+
+		var ref NeedleRef
+		err := tx.First(&ref, needleID).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// 去重功能上线前写入的文件没有引用记录
+			remaining = 0
+		case err != nil:
+			return err
+		default:
+			remaining = ref.RefCount - 1
+			if remaining < 0 {
+				remaining = 0
+			}
+			if err := tx.Model(&NeedleRef{}).
+				Where("needle_id = ?", needleID).
+				Update("ref_count", remaining).Error; err != nil {
+				return err
+			}
+		}
+
+		updates := map[string]interface{}{
+			"deleted":     true,
+			"delete_time": time.Now().Unix(),
+			"seq":         seq,
+		}
+		if remaining == 0 {
+			updates["flags"] = 1
+		}
+		if err := tx.Model(&FileMetadata{}).Where("id = ?", meta.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		// Needle 的拥有者记录可能早已删除，最后一个引用释放时一并标记
+		if remaining == 0 && needleID != meta.ID {
+			return tx.Model(&FileMetadata{}).Where("id = ?", needleID).
+				Updates(map[string]interface{}{"flags": 1, "seq": seq}).Error
+		}
+		return nil
+	})
+	return remaining, err
+}
+
+// GetDeletedFileMetadata 获取已删除文件的元数据
+func (d *Database) GetDeletedFileMetadata(id uint64) (*FileMetadata, error) {
+	var meta FileMetadata
+	err := d.db.Where("id = ? AND deleted = ?", id, true).First(&meta).Error
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// RestoreFileMetadata 恢复已删除的文件并重新引用其 Needle
+// 文件已不处于删除状态时返回 ErrNeedleNotFound，不修改引用计数
+func (d *Database) RestoreFileMetadata(meta *FileMetadata, seq uint64) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		needleID := meta.DataNeedleID()
+
+		result := tx.Model(&FileMetadata{}).
+			Where("id = ? AND deleted = ?", meta.ID, true).
+			Updates(map[string]interface{}{
+				"deleted":     false,
+				"delete_time": 0,
+				"flags":       0,
+				"seq":         seq,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNeedleNotFound
+		}
+
+		if err := tx.Model(&NeedleRef{}).
+			Where("needle_id = ?", needleID).
+			Update("ref_count", gorm.Expr("ref_count + ?", 1)).Error; err != nil {
+			return err
+		}
+
+		if needleID != meta.ID {
+			return tx.Model(&FileMetadata{}).Where("id = ?", needleID).
+				Updates(map[string]interface{}{"flags": 0, "seq": seq}).Error
+		}
+		return nil
+	})
+}
+
+// ListTrash 列出删除时间晚于 since 的文件，最近删除的在前
+func (d *Database) ListTrash(since int64, offset, limit int) ([]*FileMetadata, int64, error) {
+	var total int64
+	if err := d.db.Model(&FileMetadata{}).
+		Where("deleted = ? AND delete_time > ?", true, since).
+		Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var metas []*FileMetadata
+	err := d.db.Where("deleted = ? AND delete_time > ?", true, since).
+		Order("delete_time DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&metas).Error
+	return metas, total, err
+}
+
+// TrashedNeedles 返回给定 Needle 中仍被回收站文件（删除时间晚于 since）引用的集合
+func (d *Database) TrashedNeedles(ids []uint64, since int64) (map[uint64]bool, error) {
+	result := make(map[uint64]bool)
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	var needleIDs []uint64
+	err := d.db.Model(&FileMetadata{}).
+		Select("CASE WHEN needle_id = 0 THEN id ELSE needle_id END").
+		Where("deleted = ? AND delete_time > ?", true, since).
+		Where("id IN ? OR needle_id IN ?", ids, ids).
+		Scan(&needleIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range needleIDs {
+		result[id] = true
+	}
+	return result, nil
+}
+
+// ReferencedNeedles 返回给定 Needle 中引用计数仍大于 0 的集合
+func (d *Database) ReferencedNeedles(ids []uint64) (map[uint64]bool, error) {
+	result := make(map[uint64]bool)
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	var refs []NeedleRef
+	if err := d.db.Where("needle_id IN ? AND ref_count > ?", ids, 0).Find(&refs).Error; err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		result[ref.NeedleID] = true
+	}
+	return result, nil
+}
+
+// ListFilesByNeedles 列出使用指定 Needle 的所有文件记录，包括已删除的
+func (d *Database) ListFilesByNeedles(ids []uint64) ([]*FileMetadata, error) {
+	var metas []*FileMetadata
+	if len(ids) == 0 {
+		return metas, nil
+	}
+	err := d.db.Where("id IN ? OR needle_id IN ?", ids, ids).Find(&metas).Error
+	return metas, err
+}
+
+// UpdateNeedleOffsets 压缩后更新 Needle 的新偏移，同时更新所有引用它的文件
+func (d *Database) UpdateNeedleOffsets(offsets map[uint64]int64) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		for needleID, offset := range offsets {
+			if err := tx.Model(&FileMetadata{}).
+				Where("id = ? OR needle_id = ?", needleID, needleID).
+				Update("offset", offset).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (d *Database) LoadAllFileMetadata() ([]*FileMetadata, error) {
@@ -129,6 +361,26 @@ func (d *Database) SetVolumeInactive(id uint32) error {
 		Update("active", false).Error
 }
 
+// ListVolumeFiles 列出 Volume 中未删除的文件
+func (d *Database) ListVolumeFiles(id uint32) ([]*FileMetadata, error) {
+	var metas []*FileMetadata
+	err := d.db.Where("volume_id = ? AND deleted = ?", id, false).Find(&metas).Error
+	return metas, err
+}
+
+// DropVolume 删除 Volume 及其中所有文件的元数据，不留删除记录
+func (d *Database) DropVolume(id uint32) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("volume_id = ?", id).Delete(&FileMetadata{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("volume_id = ?", id).Delete(&NeedleRef{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&VolumeInfo{}, id).Error
+	})
+}
+
 // GetStats 获取统计信息
 func (d *Database) GetStats() (map[string]interface{}, error) {
 	var totalFiles int64
@@ -142,27 +394,46 @@ func (d *Database) GetStats() (map[string]interface{}, error) {
 	var volumeCount int64
 	d.db.Model(&VolumeInfo{}).Count(&volumeCount)
 
+	var dedupFiles int64
+	var dedupSize int64
+	d.db.Model(&FileMetadata{}).
+		Where("needle_id <> ? AND needle_id <> id AND deleted = ?", 0, false).
+		Count(&dedupFiles)
+	d.db.Model(&FileMetadata{}).
+		Where("needle_id <> ? AND needle_id <> id AND deleted = ?", 0, false).
+		Select("COALESCE(SUM(size), 0)").Scan(&dedupSize)
+
 	return map[string]interface{}{
-		"total_files":   totalFiles,
-		"deleted_files": deletedFiles,
-		"active_files":  totalFiles - deletedFiles,
-		"total_size":    totalSize,
-		"volume_count":  volumeCount,
+		"total_files":       totalFiles,
+		"deleted_files":     deletedFiles,
+		"active_files":      totalFiles - deletedFiles,
+		"total_size":        totalSize,
+		"volume_count":      volumeCount,
+		"dedup_files":       dedupFiles,
+		"dedup_saved_bytes": dedupSize,
 	}, nil
 }
 
+// FindByFilename 查找文件名对应的最新版本
 func (d *Database) FindByFilename(filename string) (*FileMetadata, error) {
 	var meta FileMetadata
-	err := d.db.Where("file_name = ? AND deleted = ?", filename, false).First(&meta).Error
+	err := d.db.Where("file_name = ? AND deleted = ?", filename, false).
+		Order("id DESC").
+		First(&meta).Error
 	if err != nil {
 		return nil, err
 	}
 	return &meta, nil
 }
 
+// ListByPrefix 按前缀列出文件，每个文件名只返回最新版本
 func (d *Database) ListByPrefix(prefix string, limit int) ([]*FileMetadata, error) {
 	var metas []*FileMetadata
-	query := d.db.Where("file_name LIKE ? AND deleted = ?", prefix+"%", false)
+	latest := d.db.Model(&FileMetadata{}).
+		Select("MAX(id)").
+		Where("file_name LIKE ? ESCAPE '!' AND deleted = ?", escapeLike(prefix)+"%", false).
+		Group("file_name")
+	query := d.db.Where("id IN (?)", latest).Order("file_name")
 	if limit > 0 {
 		query = query.Limit(limit)
 	}
@@ -170,6 +441,593 @@ func (d *Database) ListByPrefix(prefix string, limit int) ([]*FileMetadata, erro
 	return metas, err
 }
 
+// ListVersions 列出文件名的所有版本，最新的在前
+func (d *Database) ListVersions(filename string) ([]*FileMetadata, error) {
+	var metas []*FileMetadata
+	err := d.db.Where("file_name = ? AND deleted = ?", filename, false).
+		Order("id DESC").
+		Find(&metas).Error
+	return metas, err
+}
+
+// ListVersionsByPrefix 按前缀列出 after 之后的所有版本，按文件名排序、同名最新的在前
+func (d *Database) ListVersionsByPrefix(prefix string, after VersionMarker, limit int) ([]*FileMetadata, error) {
+	var metas []*FileMetadata
+	query := d.db.Where("file_name LIKE ? ESCAPE '!' AND deleted = ?", escapeLike(prefix)+"%", false)
+	if after.FileName != "" {
+		query = query.Where("(file_name > ? OR (file_name = ? AND id < ?))", after.FileName, after.FileName, after.ID)
+	}
+	query = query.Order("file_name").Order("id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&metas).Error
+	return metas, err
+}
+
+// GetBucketSettings 获取 Bucket 配置
+func (d *Database) GetBucketSettings(name string) (*BucketSettings, error) {
+	var settings BucketSettings
+	err := d.db.Where("name = ?", name).First(&settings).Error
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// SaveBucketSettings 保存 Bucket 配置
+func (d *Database) SaveBucketSettings(settings *BucketSettings) error {
+	return d.db.Save(settings).Error
+}
+
+// ListExpired 列出 TTL 已到期的文件
+func (d *Database) ListExpired(now int64, limit int) ([]*FileMetadata, error) {
+	var metas []*FileMetadata
+	err := d.db.Where("deleted = ? AND expire_time > ? AND expire_time <= ?", false, 0, now).
+		Limit(limit).
+		Find(&metas).Error
+	return metas, err
+}
+
+// ListCreatedBefore 列出前缀匹配且创建时间早于 before 的文件
+func (d *Database) ListCreatedBefore(prefix string, before int64, limit int) ([]*FileMetadata, error) {
+	var metas []*FileMetadata
+	err := d.db.Where("file_name LIKE ? ESCAPE '!' AND deleted = ? AND create_time < ?", escapeLike(prefix)+"%", false, before).
+		Limit(limit).
+		Find(&metas).Error
+	return metas, err
+}
+
+// fileQueryColumns 排序字段对应的列
+var fileQueryColumns = map[string]string{
+	SortByName: "file_name",
+	SortBySize: "size",
+	SortByTime: "create_time",
+}
+
+// fileQueryScope 把查询条件转换为 SQL 过滤，游标转换为键集条件
+func (d *Database) fileQueryScope(q FileQuery) *gorm.DB {
+	db := d.db.Model(&FileMetadata{}).Where("deleted = ? AND delete_marker = ?", false, false)
+	if q.Name != "" {
+		pattern := "%" + escapeLike(strings.ToLower(q.Name)) + "%"
+		if q.isGlob() {
+			pattern = globToLike(strings.ToLower(q.Name))
+		}
+		db = db.Where("LOWER(file_name) LIKE ? ESCAPE '!'", pattern)
+	}
+	if q.MimePrefix != "" {
+		db = db.Where("mime_type LIKE ? ESCAPE '!'", escapeLike(q.MimePrefix)+"%")
+	}
+	if q.MinSize > 0 {
+		db = db.Where("size >= ?", q.MinSize)
+	}
+	if q.MaxSize > 0 {
+		db = db.Where("size <= ?", q.MaxSize)
+	}
+	if q.CreatedAfter > 0 {
+		db = db.Where("create_time >= ?", q.CreatedAfter)
+	}
+	if q.CreatedBefore > 0 {
+		db = db.Where("create_time < ?", q.CreatedBefore)
+	}
+	if q.MD5 != "" {
+		db = db.Where("md5 = ?", q.MD5)
+	}
+	contains := d.containsSQL("tags")
+	for k, v := range q.Tags {
+		first, rest := tagPatterns(k, v)
+		db = db.Where(fmt.Sprintf("(%s OR %s)", contains, contains), first, rest)
+	}
+	if q.after != nil {
+		column, op := fileQueryColumns[q.Sort], ">"
+		if q.Desc {
+			op = "<"
+		}
+		var value interface{} = q.after.Num
+		if q.Sort == SortByName {
+			value = q.after.Name
+		}
+		db = db.Where(fmt.Sprintf("((%s %s ?) OR (%s = ? AND id %s ?))", column, op, column, op), value, value, q.after.ID)
+	}
+	return db
+}
+
+// QueryFiles 按条件、排序和游标查询一页文件，排序字段相同时按 ID 排序
+func (d *Database) QueryFiles(q FileQuery, limit int) ([]*FileMetadata, error) {
+	dir := "ASC"
+	if q.Desc {
+		dir = "DESC"
+	}
+	var metas []*FileMetadata
+	err := d.fileQueryScope(q).
+		Order(fmt.Sprintf("%s %s, id %s", fileQueryColumns[q.Sort], dir, dir)).
+		Offset(q.Offset).
+		Limit(limit).
+		Find(&metas).Error
+	return metas, err
+}
+
+// CountFiles 统计满足条件的文件数
+func (d *Database) CountFiles(q FileQuery) (int64, error) {
+	var count int64
+	err := d.fileQueryScope(q).Count(&count).Error
+	return count, err
+}
+
+// containsSQL 返回区分大小写的子串判断，LIKE 在 SQLite 和 MySQL 默认排序规则下不区分大小写
+func (d *Database) containsSQL(column string) string {
+	switch d.db.Dialector.Name() {
+	case "postgres":
+		return fmt.Sprintf("strpos(%s, ?) > 0", column)
+	case "mysql":
+		return fmt.Sprintf("LOCATE(CAST(? AS BINARY), %s) > 0", column)
+	default:
+		return fmt.Sprintf("instr(%s, ?) > 0", column)
+	}
+}
+
+// escapeLike 转义 LIKE 中的特殊字符，转义符为 !（各数据库对反斜杠的处理不一致）
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// globToLike 把通配符转换为 LIKE 模式，* 对应 %，? 对应 _
+func globToLike(glob string) string {
+	return strings.NewReplacer("*", "%", "?", "_").Replace(escapeLike(glob))
+}
+
+// ListLifecycleRules 列出所有生命周期规则
+func (d *Database) ListLifecycleRules() ([]*LifecycleRule, error) {
+	var rules []*LifecycleRule
+	err := d.db.Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// ListBucketLifecycleRules 列出通过 S3 为 Bucket 配置的生命周期规则
+func (d *Database) ListBucketLifecycleRules(bucket string) ([]*LifecycleRule, error) {
+	var rules []*LifecycleRule
+	err := d.db.Where("bucket = ?", bucket).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// SaveLifecycleRule 保存生命周期规则
+func (d *Database) SaveLifecycleRule(rule *LifecycleRule) error {
+	return d.db.Save(rule).Error
+}
+
+// DeleteLifecycleRule 删除生命周期规则
+func (d *Database) DeleteLifecycleRule(id uint64) error {
+	result := d.db.Delete(&LifecycleRule{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ReplaceBucketLifecycleRules 替换 Bucket 的全部生命周期规则
+func (d *Database) ReplaceBucketLifecycleRules(bucket string, rules []*LifecycleRule) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("bucket = ?", bucket).Delete(&LifecycleRule{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Create(rules).Error
+	})
+}
+
+// ListQuotas 列出所有配额
+func (d *Database) ListQuotas() ([]*Quota, error) {
+	var quotas []*Quota
+	err := d.db.Order("scope, name").Find(&quotas).Error
+	return quotas, err
+}
+
+// GetQuota 获取配额
+func (d *Database) GetQuota(id uint64) (*Quota, error) {
+	var quota Quota
+	if err := d.db.First(&quota, id).Error; err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// SaveQuota 按 Scope 和 Name 新增或更新配额
+func (d *Database) SaveQuota(quota *Quota) error {
+	var existing Quota
+	err := d.db.Where("scope = ? AND name = ?", quota.Scope, quota.Name).First(&existing).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return d.db.Create(quota).Error
+	case err != nil:
+		return err
+	}
+
+	quota.ID = existing.ID
+	quota.CreateTime = existing.CreateTime
+	return d.db.Save(quota).Error
+}
+
+// DeleteQuota 删除配额
+func (d *Database) DeleteQuota(id uint64) error {
+	result := d.db.Delete(&Quota{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// QuotaUsage 统计配额范围内未删除文件的总字节数和文件数，删除标记不计入
+func (d *Database) QuotaUsage(scope, name string) (int64, int64, error) {
+	query := d.db.Model(&FileMetadata{}).Where("deleted = ? AND delete_marker = ?", false, false)
+	switch scope {
+	case QuotaScopeBucket:
+		query = query.Where("file_name LIKE ? ESCAPE '!'", escapeLike(name)+"/%")
+	case QuotaScopePrefix:
+		query = query.Where("file_name LIKE ? ESCAPE '!'", escapeLike(name)+"%")
+	case QuotaScopeTenant:
+		query = query.Where("tenant = ?", name)
+	default:
+		return 0, 0, fmt.Errorf("unknown quota scope: %s", scope)
+	}
+
+	var usage struct {
+		Bytes   int64
+		Objects int64
+	}
+	err := query.Select("COALESCE(SUM(size), 0) AS bytes, COUNT(*) AS objects").Scan(&usage).Error
+	return usage.Bytes, usage.Objects, err
+}
+
+// ChargeQuotas 在事务中为多个配额增加用量，任一配额超限时全部回滚并返回 ErrQuotaExceeded
+func (d *Database) ChargeQuotas(ids []uint64, bytes, objects int64) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		for _, id := range ids {
+			result := tx.Model(&Quota{}).
+				Where("id = ?", id).
+				Where("max_bytes = 0 OR used_bytes + ? <= max_bytes", bytes).
+				Where("max_objects = 0 OR used_objects + ? <= max_objects", objects).
+				Updates(map[string]interface{}{
+					"used_bytes":   gorm.Expr("used_bytes + ?", bytes),
+					"used_objects": gorm.Expr("used_objects + ?", objects),
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrQuotaExceeded
+			}
+		}
+		return nil
+	})
+}
+
+// ReleaseQuotas 减少多个配额的用量
+func (d *Database) ReleaseQuotas(ids []uint64, bytes, objects int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return d.db.Model(&Quota{}).
+		Where("id IN ?", ids).
+		Updates(map[string]interface{}{
+			"used_bytes":   gorm.Expr("used_bytes - ?", bytes),
+			"used_objects": gorm.Expr("used_objects - ?", objects),
+		}).Error
+}
+
+// DumpMetadata 在同一事务中导出所有元数据表
+func (d *Database) DumpMetadata() (*MetadataDump, error) {
+	dump := &MetadataDump{}
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		for _, dest := range []interface{}{
+			&dump.Files, &dump.Volumes, &dump.NeedleRefs,
+			&dump.BucketSettings, &dump.LifecycleRules, &dump.Quotas,
+			&dump.Webhooks, &dump.IDSequences,
+		} {
+			if err := tx.Find(dest).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return dump, err
+}
+
+// DumpSettings 导出 Bucket 配置、生命周期规则和配额
+func (d *Database) DumpSettings() (*MetadataDump, error) {
+	dump := &MetadataDump{}
+	for _, dest := range []interface{}{&dump.BucketSettings, &dump.LifecycleRules, &dump.Quotas} {
+		if err := d.db.Find(dest).Error; err != nil {
+			return nil, err
+		}
+	}
+	return dump, nil
+}
+
+// LoadMetadata 将导出的元数据写入空数据库
+func (d *Database) LoadMetadata(dump *MetadataDump) error {
+	var count int64
+	if err := d.db.Model(&FileMetadata{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("target database is not empty")
+	}
+
+	// 带默认值的 false 字段插入时会被替换为默认值并回写到 dump 中，需要先记下再单独更新
+	inactiveVolumes := make([]uint32, 0)
+	for _, v := range dump.Volumes {
+		if !v.Active {
+			inactiveVolumes = append(inactiveVolumes, v.ID)
+		}
+	}
+	disabledHooks := make([]uint64, 0)
+	for _, hook := range dump.Webhooks {
+		if !hook.Enabled {
+			disabledHooks = append(disabledHooks, hook.ID)
+		}
+	}
+
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		create := func(rows interface{}, n int) error {
+			if n == 0 {
+				return nil
+			}
+			return tx.CreateInBatches(rows, 500).Error
+		}
+
+		if err := create(dump.Files, len(dump.Files)); err != nil {
+			return err
+		}
+		if err := create(dump.Volumes, len(dump.Volumes)); err != nil {
+			return err
+		}
+		if err := create(dump.NeedleRefs, len(dump.NeedleRefs)); err != nil {
+			return err
+		}
+		if err := create(dump.Webhooks, len(dump.Webhooks)); err != nil {
+			return err
+		}
+		if err := create(dump.IDSequences, len(dump.IDSequences)); err != nil {
+			return err
+		}
+
+		if len(inactiveVolumes) > 0 {
+			if err := tx.Model(&VolumeInfo{}).Where("id IN ?", inactiveVolumes).Update("active", false).Error; err != nil {
+				return err
+			}
+		}
+		if len(disabledHooks) > 0 {
+			if err := tx.Model(&Webhook{}).Where("id IN ?", disabledHooks).Update("enabled", false).Error; err != nil {
+				return err
+			}
+		}
+		return insertSettings(tx, dump.BucketSettings, dump.LifecycleRules, dump.Quotas)
+	})
+}
+
+// ReplaceSettings 用备份中的 Bucket 配置、生命周期规则和配额替换现有记录
+func (d *Database) ReplaceSettings(settings []BucketSettings, rules []LifecycleRule, quotas []Quota) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&BucketSettings{}, &LifecycleRule{}, &Quota{}} {
+			if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return insertSettings(tx, settings, rules, quotas)
+	})
+}
+
+func insertSettings(tx *gorm.DB, settings []BucketSettings, rules []LifecycleRule, quotas []Quota) error {
+	// 带默认值的 false 字段插入时会被替换为默认值并回写到 rules 中，需要先记下再单独更新
+	disabled := make([]uint64, 0)
+	for _, r := range rules {
+		if !r.Enabled {
+			disabled = append(disabled, r.ID)
+		}
+	}
+
+	if len(settings) > 0 {
+		if err := tx.Create(settings).Error; err != nil {
+			return err
+		}
+	}
+	if len(rules) > 0 {
+		if err := tx.Create(rules).Error; err != nil {
+			return err
+		}
+	}
+	if len(quotas) > 0 {
+		if err := tx.Create(quotas).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(disabled) > 0 {
+		if err := tx.Model(&LifecycleRule{}).Where("id IN ?", disabled).Update("enabled", false).Error; err != nil {
+			return err
+		}
+	}
+	return syncSequences(tx, serialTables...)
+}
+
+// ListChanges 列出序列号在 (since, until] 内的文件记录，按序列号排序
+func (d *Database) ListChanges(since, until uint64) ([]FileMetadata, error) {
+	var metas []FileMetadata
+	err := d.db.Where("seq > ? AND seq <= ?", since, until).Order("seq").Find(&metas).Error
+	return metas, err
+}
+
+// GetNeedleRefs 按 Needle ID 获取引用记录
+func (d *Database) GetNeedleRefs(ids []uint64) ([]NeedleRef, error) {
+	var refs []NeedleRef
+	if len(ids) == 0 {
+		return refs, nil
+	}
+	err := d.db.Where("needle_id IN ?", ids).Find(&refs).Error
+	return refs, err
+}
+
+// SaveNeedleRefs 新增或覆盖 Needle 引用记录
+func (d *Database) SaveNeedleRefs(refs []NeedleRef) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		for i := range refs {
+			if err := tx.Save(&refs[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateFileAttributes 替换文件的用户元数据和标签并更新序列号
+func (d *Database) UpdateFileAttributes(id uint64, userMeta, tags map[string]string, seq uint64) error {
+	// 以结构体更新才会经过 JSON 序列化；Select 保证空 map 也写入
+	result := d.db.Model(&FileMetadata{}).Where("id = ?", id).
+		Select("user_meta", "tags", "seq").
+		Updates(&FileMetadata{UserMeta: userMeta, Tags: tags, Seq: seq})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ApplyFileMetadata 写入备份中的文件记录，已存在时只更新删除状态、元数据、标签和序列号
+func (d *Database) ApplyFileMetadata(meta *FileMetadata) error {
+	var count int64
+	if err := d.db.Model(&FileMetadata{}).Where("id = ?", meta.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		if err := d.db.Create(meta).Error; err != nil {
+			return err
+		}
+	}
+
+	// deleted、flags 为零值时 Create 会使用默认值，统一再更新一次
+	return d.db.Model(&FileMetadata{}).Where("id = ?", meta.ID).
+		Select("deleted", "delete_time", "flags", "user_meta", "tags", "seq").
+		Updates(meta).Error
+}
+
+// ListWebhooks 列出所有 Webhook
+func (d *Database) ListWebhooks() ([]*Webhook, error) {
+	var hooks []*Webhook
+	err := d.db.Order("id").Find(&hooks).Error
+	return hooks, err
+}
+
+// GetWebhook 获取 Webhook
+func (d *Database) GetWebhook(id uint64) (*Webhook, error) {
+	var hook Webhook
+	if err := d.db.First(&hook, id).Error; err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// SaveWebhook 新增或更新 Webhook
+func (d *Database) SaveWebhook(hook *Webhook) error {
+	if hook.ID != 0 {
+		return d.db.Save(hook).Error
+	}
+	if err := d.db.Create(hook).Error; err != nil {
+		return err
+	}
+	// 插入时 false 会被替换为列默认值，需要单独更新
+	if !hook.Enabled {
+		return d.db.Model(hook).Update("enabled", false).Error
+	}
+	return nil
+}
+
+// DeleteWebhook 删除 Webhook 及其投递记录
+func (d *Database) DeleteWebhook(id uint64) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&Webhook{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("webhook_id = ?", id).Delete(&WebhookDelivery{}).Error
+	})
+}
+
+// CreateDeliveries 批量新增投递记录
+func (d *Database) CreateDeliveries(deliveries []*WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return d.db.Create(&deliveries).Error
+}
+
+// DueDeliveries 列出到达重试时间的待投递记录
+func (d *Database) DueDeliveries(now int64, limit int) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	err := d.db.Where("status = ? AND next_attempt <= ?", DeliveryPending, now).
+		Order("next_attempt, id").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// ListDeliveries 按时间倒序列出 Webhook 的投递记录，status 为空时不过滤
+func (d *Database) ListDeliveries(webhookID uint64, status string, limit int) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	query := d.db.Where("webhook_id = ?", webhookID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// GetDelivery 获取投递记录
+func (d *Database) GetDelivery(id uint64) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	if err := d.db.First(&delivery, id).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// SaveDelivery 保存投递结果
+func (d *Database) SaveDelivery(delivery *WebhookDelivery) error {
+	return d.db.Save(delivery).Error
+}
+
 func (d *Database) Close() error {
 	sqlDB, err := d.db.DB()
 	if err != nil {
@@ -177,3 +1035,28 @@ func (d *Database) Close() error {
 	}
 	return sqlDB.Close()
 }
+
+// LeaseSequence 从序列中租用 count 个连续值，返回起点；起点不小于 min
+// 更新语句持有行锁直到事务提交，多个节点共享数据库时租到的区间不会重叠
+func (d *Database) LeaseSequence(name string, min, count uint64) (uint64, error) {
+	var start uint64
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(IDSequence{Name: name}).Attrs(IDSequence{Next: min}).FirstOrCreate(&IDSequence{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&IDSequence{}).Where("name = ?", name).
+			Update("next_value", gorm.Expr("CASE WHEN next_value > ? THEN next_value ELSE ? END + ?", min, min, count))
+		if result.Error != nil {
+			return result.Error
+		}
+
+		var seq IDSequence
+		if err := tx.Where("name = ?", name).First(&seq).Error; err != nil {
+			return err
+		}
+		start = seq.Next - count
+		return nil
+	})
+	return start, err
+}
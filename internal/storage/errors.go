@@ -3,10 +3,19 @@ package storage
 import "errors"
 
 var (
-	ErrNeedleNotFound = errors.New("needle not found")
-	ErrVolumeNotFound = errors.New("volume not found")
-	ErrVolumeFull     = errors.New("volume is full")
-	ErrCRCMismatch    = errors.New("crc checksum mismatch")
-	ErrReadOnly       = errors.New("storage is read-only")
-	ErrInvalidNeedle  = errors.New("invalid needle")
+	ErrNeedleNotFound  = errors.New("needle not found")
+	ErrVolumeNotFound  = errors.New("volume not found")
+	ErrVolumeFull      = errors.New("volume is full")
+	ErrCRCMismatch     = errors.New("crc checksum mismatch")
+	ErrReadOnly        = errors.New("storage is read-only")
+	ErrInvalidNeedle   = errors.New("invalid needle")
+	ErrQuotaExceeded   = errors.New("quota exceeded")
+	ErrReplicaTimeout  = errors.New("replica acknowledgement timed out")
+	ErrFileExists      = errors.New("file already exists")
+	ErrSchemaTooNew    = errors.New("database schema is newer than this binary")
+	ErrSchemaModified  = errors.New("applied migration checksum mismatch")
+	ErrInvalidQuery    = errors.New("invalid query")
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrInvalidMetadata = errors.New("invalid metadata or tags")
+	ErrSearchDisabled  = errors.New("full-text search is disabled")
 )
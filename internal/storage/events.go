@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType 对象事件类型
+type EventType string
+
+const (
+	EventCreated         EventType = "created"          // 新文件写入或从回收站恢复
+	EventOverwritten     EventType = "overwritten"      // 同名文件写入新版本
+	EventDeleted         EventType = "deleted"          // 文件删除（含版本清理）
+	EventExpired         EventType = "expired"          // TTL 或生命周期规则到期删除
+	EventCompacted       EventType = "compacted"        // 已删除文件的数据被压缩回收，无法再恢复
+	EventMetadataUpdated EventType = "metadata_updated" // 用户元数据或标签被修改
+)
+
+// defaultEventBufferSize 事件总线默认保留的事件数
+const defaultEventBufferSize = 10000
+
+// Event 对象事件，Cursor 单调递增，可用于断点续读
+type Event struct {
+	Cursor     uint64    `json:"cursor"`
+	Type       EventType `json:"type"`
+	FileID     uint64    `json:"file_id"`
+	FileName   string    `json:"filename"`
+	Size       uint32    `json:"size"`
+	MD5        string    `json:"md5"`
+	PreviousID uint64    `json:"previous_id,omitempty"` // 被覆盖的上一个版本
+	VolumeID   uint32    `json:"volume_id,omitempty"`
+	Time       int64     `json:"time"`
+}
+
+// EventBus 有界的进程内事件总线，只保留最近的事件
+// Cursor 以进程启动时间为起点，重启后旧 Cursor 会被识别为已截断
+type EventBus struct {
+	mu     sync.Mutex
+	events []Event // 环形缓冲区
+	start  int     // 最早事件的下标
+	count  int
+	base   uint64 // 第一个事件的 Cursor
+	next   uint64 // 下一个事件的 Cursor
+	notify chan struct{}
+}
+
+// NewEventBus 创建事件总线，size 为保留的事件数
+func NewEventBus(size int) *EventBus {
+	if size <= 0 {
+		size = defaultEventBufferSize
+	}
+	// 微秒时间戳作为起点，既保证重启后递增，又不超出 JSON 数字的精确范围
+	base := uint64(time.Now().UnixMicro())
+	return &EventBus{
+		events: make([]Event, size),
+		base:   base,
+		next:   base,
+		notify: make(chan struct{}),
+	}
+}
+
+// Publish 发布事件，缓冲区满时丢弃最早的事件
+func (b *EventBus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.Cursor = b.next
+	if e.Time == 0 {
+		e.Time = time.Now().Unix()
+	}
+	b.next++
+
+	if b.count < len(b.events) {
+		b.events[(b.start+b.count)%len(b.events)] = e
+		b.count++
+	} else {
+		b.events[b.start] = e
+		b.start = (b.start + 1) % len(b.events)
+	}
+
+	// 唤醒所有等待者
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// Since 返回 Cursor 大于 cursor 的事件，最多 limit 条
+// cursor 之后的事件已被丢弃（或来自上一次进程）时 truncated 为 true，调用方需要全量同步
+// cursor 为 0 时从缓冲区中最早的事件开始
+func (b *EventBus) Since(cursor uint64, limit int) (events []Event, truncated bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	oldest := b.next - uint64(b.count)
+	if cursor == 0 {
+		truncated = oldest > b.base
+		cursor = oldest - 1
+	} else if cursor+1 < oldest || cursor >= b.next {
+		// 早于缓冲区或来自上一次进程
+		truncated = true
+		cursor = oldest - 1
+	}
+
+	if cursor+1 >= b.next {
+		return []Event{}, truncated
+	}
+
+	n := int(b.next - cursor - 1)
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	skip := int(cursor + 1 - oldest)
+
+	events = make([]Event, 0, n)
+	for i := 0; i < n; i++ {
+		events = append(events, b.events[(b.start+skip+i)%len(b.events)])
+	}
+	return events, truncated
+}
+
+// Latest 返回最近一个事件的 Cursor，用于从当前位置开始订阅
+func (b *EventBus) Latest() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.next - 1
+}
+
+// Wait 返回在下一个事件发布时关闭的通道
+func (b *EventBus) Wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.notify
+}
+
+// Events 返回存储的事件总线
+func (s *Store) Events() *EventBus {
+	return s.events
+}
+
+// publishFile 发布与文件相关的事件
+func (s *Store) publishFile(t EventType, meta *FileMetadata) {
+	s.events.Publish(Event{
+		Type:     t,
+		FileID:   meta.ID,
+		FileName: meta.FileName,
+		Size:     meta.Size,
+		MD5:      meta.MD5,
+		VolumeID: meta.VolumeID,
+	})
+}
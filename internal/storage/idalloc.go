@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// fileIDSequence 文件 ID 的序列名
+	fileIDSequence = "file_id"
+	// defaultIDBlockSize 每次向数据库租用的 ID 数
+	defaultIDBlockSize = 1000
+)
+
+// IDRange 租用的 ID 区间 [Start, End)
+type IDRange struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// idAllocator 按块租用文件 ID
+// 每块在使用前先持久化到数据库，崩溃后未用完的部分直接丢弃，已分配的 ID 不会被再次使用
+type idAllocator struct {
+	db        MetadataStore
+	blockSize uint64
+	mu        sync.Mutex
+	next      uint64 // 当前块中下一个可用 ID
+	limit     uint64 // 当前块的结束位置（不含）
+}
+
+// newIDAllocator 创建 ID 分配器，minNext 为已知的最大 ID 加一
+// 旧版本没有租用记录，启动时以元数据中的最大 ID 为下限
+func newIDAllocator(db MetadataStore, blockSize int, minNext uint64) (*idAllocator, error) {
+	if blockSize <= 0 {
+		blockSize = defaultIDBlockSize
+	}
+	a := &idAllocator{db: db, blockSize: uint64(blockSize)}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.leaseLocked(minNext); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Next 分配一个新的文件 ID
+func (a *idAllocator) Next() (uint64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.next >= a.limit {
+		if err := a.leaseLocked(a.limit); err != nil {
+			return 0, err
+		}
+	}
+	id := a.next
+	a.next++
+	return id, nil
+}
+
+// Reserve 确保本地不会再分配小于等于 id 的 ID，用于外部分配的 ID 和副本应用的变更
+func (a *idAllocator) Reserve(id uint64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if id < a.next {
+		return nil
+	}
+	if id < a.limit {
+		a.next = id + 1
+		return nil
+	}
+	return a.leaseLocked(id + 1)
+}
+
+// Peek 返回下一个将要分配的 ID
+func (a *idAllocator) Peek() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.next
+}
+
+// leaseLocked 从数据库租用新块，新块的起点不小于 minNext
+func (a *idAllocator) leaseLocked(minNext uint64) error {
+	start, err := a.db.LeaseSequence(fileIDSequence, minNext, a.blockSize)
+	if err != nil {
+		return fmt.Errorf("failed to lease file ids: %w", err)
+	}
+	a.next = start
+	a.limit = start + a.blockSize
+	return nil
+}
+
+// LeaseIDs 租用一段不会被本节点或其它租用者使用的连续 ID，用于向其它节点分配 ID 区间
+func (s *Store) LeaseIDs(count uint64) (*IDRange, error) {
+	if count == 0 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+	start, err := s.db.LeaseSequence(fileIDSequence, 1, count)
+	if err != nil {
+		return nil, err
+	}
+	return &IDRange{Start: start, End: start + count}, nil
+}
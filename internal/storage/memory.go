@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryObject MemoryStore 中的一个文件
+type memoryObject struct {
+	meta FileMetadata
+	data []byte
+}
+
+// MemoryStore 纯内存的 ObjectStore 实现，进程退出后数据丢失
+// 用于测试 API 层和不需要持久化的场景；不支持配额、复制和内容去重
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[uint64]*memoryObject
+	nextID  uint64
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		objects: make(map[uint64]*memoryObject),
+		nextID:  1,
+	}
+}
+
+func (m *MemoryStore) WriteWithOptions(data []byte, opts WriteOptions) (uint64, error) {
+	if err := validateWriteAttributes(&opts); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := opts.ID
+	if id == 0 {
+		id = m.nextID
+	} else if _, exists := m.objects[id]; exists {
+		return 0, ErrFileExists
+	}
+	if id >= m.nextID {
+		m.nextID = id + 1
+	}
+
+	copied := make([]byte, len(data))
+	copy(copied, data)
+	m.objects[id] = &memoryObject{
+		meta: FileMetadata{
+			ID:         id,
+			Size:       uint32(len(data)),
+			FileName:   opts.FileName,
+			MimeType:   opts.MimeType,
+			Tenant:     opts.Tenant,
+			MD5:        fmt.Sprintf("%x", md5.Sum(data)),
+			SHA256:     fmt.Sprintf("%x", sha256.Sum256(data)),
+			CreateTime: time.Now().Unix(),
+			ExpireTime: opts.ExpireTime,
+			UserMeta:   opts.UserMeta,
+			Tags:       opts.Tags,
+		},
+		data: copied,
+	}
+	return id, nil
+}
+
+// WriteVersion 写入新版本，内存实现保留所有历史版本
+func (m *MemoryStore) WriteVersion(data []byte, opts WriteOptions) (uint64, error) {
+	return m.WriteWithOptions(data, opts)
+}
+
+// WriteDeleteMarker 写入删除标记作为最新版本
+func (m *MemoryStore) WriteDeleteMarker(filename string) (uint64, error) {
+	latest, err := m.FindByFilename(filename)
+	if err != nil || latest.DeleteMarker {
+		return 0, ErrNeedleNotFound
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextID
+	m.nextID++
+	m.objects[id] = &memoryObject{
+		meta: FileMetadata{
+			ID:           id,
+			FileName:     filename,
+			Tenant:       latest.Tenant,
+			CreateTime:   time.Now().Unix(),
+			DeleteMarker: true,
+		},
+	}
+	return id, nil
+}
+
+// ReadWithMetadata 返回数据和元数据的副本，删除标记没有数据
+func (m *MemoryStore) ReadWithMetadata(id uint64) ([]byte, *FileMetadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, ok := m.objects[id]
+	if !ok || obj.meta.Deleted || obj.meta.DeleteMarker {
+		return nil, nil, ErrNeedleNotFound
+	}
+	data := make([]byte, len(obj.data))
+	copy(data, obj.data)
+	meta := obj.meta
+	return data, &meta, nil
+}
+
+func (m *MemoryStore) GetMetadata(id uint64) (*FileMetadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, ok := m.objects[id]
+	if !ok || obj.meta.Deleted {
+		return nil, ErrNeedleNotFound
+	}
+	meta := obj.meta
+	return &meta, nil
+}
+
+// UpdateAttributes 修改用户元数据和标签，总是替换为新的 map，已返回的副本不受影响
+func (m *MemoryStore) UpdateAttributes(id uint64, patch AttributePatch) (*FileMetadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[id]
+	if !ok || obj.meta.Deleted {
+		return nil, ErrNeedleNotFound
+	}
+	userMeta, tags := patch.apply(&obj.meta)
+	if err := ValidateUserMeta(userMeta); err != nil {
+		return nil, err
+	}
+	if err := ValidateTags(tags); err != nil {
+		return nil, err
+	}
+	obj.meta.UserMeta, obj.meta.Tags = userMeta, tags
+	meta := obj.meta
+	return &meta, nil
+}
+
+func (m *MemoryStore) FindByFilename(filename string) (*FileMetadata, error) {
+	versions := m.versions(func(name string) bool { return name == filename })
+	if len(versions) == 0 {
+		return nil, ErrNeedleNotFound
+	}
+	return versions[0], nil
+}
+
+func (m *MemoryStore) GetVersion(filename string, versionID uint64) (*FileMetadata, error) {
+	meta, err := m.GetMetadata(versionID)
+	if err != nil || meta.FileName != filename {
+		return nil, ErrNeedleNotFound
+	}
+	return meta, nil
+}
+
+// ListAll 按 ID 升序列出所有未删除的文件
+func (m *MemoryStore) ListAll() ([]*FileMetadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	metas := make([]*FileMetadata, 0, len(m.objects))
+	for _, obj := range m.objects {
+		if !obj.meta.Deleted {
+			meta := obj.meta
+			metas = append(metas, &meta)
+		}
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].ID < metas[j].ID })
+	return metas, nil
+}
+
+func (m *MemoryStore) QueryFiles(q FileQuery) (*FileQueryResult, error) {
+	metas, _ := m.ListAll()
+	find := func(q FileQuery, limit int) ([]*FileMetadata, error) {
+		return filterFiles(q, metas, limit), nil
+	}
+	count := func(q FileQuery) (int64, error) {
+		return countFiles(q, metas), nil
+	}
+	return runFileQuery(q, find, count)
+}
+
+func (m *MemoryStore) ListByPrefix(prefix string, limit int) ([]*FileMetadata, error) {
+	versions := m.versions(func(name string) bool { return strings.HasPrefix(name, prefix) })
+
+	metas := make([]*FileMetadata, 0, len(versions))
+	for i, meta := range versions {
+		if i > 0 && versions[i-1].FileName == meta.FileName {
+			continue
+		}
+		metas = append(metas, meta)
+		if limit > 0 && len(metas) == limit {
+			break
+		}
+	}
+	return metas, nil
+}
+
+func (m *MemoryStore) ListVersionsByPrefix(prefix string, after VersionMarker, limit int) ([]*FileMetadata, error) {
+	versions := m.versions(func(name string) bool { return strings.HasPrefix(name, prefix) && name >= after.FileName })
+	if after.FileName != "" {
+		i := 0
+		for i < len(versions) && versions[i].FileName == after.FileName && versions[i].ID >= after.ID {
+			i++
+		}
+		versions = versions[i:]
+	}
+	if limit > 0 && len(versions) > limit {
+		versions = versions[:limit]
+	}
+	return versions, nil
+}
+
+func (m *MemoryStore) Delete(id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[id]
+	if !ok || obj.meta.Deleted {
+		return ErrNeedleNotFound
+	}
+	obj.meta.Deleted = true
+	obj.meta.DeleteTime = time.Now().Unix()
+	obj.data = nil
+	return nil
+}
+
+func (m *MemoryStore) DeleteAllVersions(filename string) (int, error) {
+	versions := m.versions(func(name string) bool { return name == filename })
+
+	deleted := 0
+	for _, v := range versions {
+		if err := m.Delete(v.ID); err != nil && err != ErrNeedleNotFound {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Status 返回与 Store.Status 相同字段的统计信息
+func (m *MemoryStore) Status() map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	totalFiles, deletedFiles := 0, 0
+	totalSize := int64(0)
+	for _, obj := range m.objects {
+		totalFiles++
+		totalSize += int64(obj.meta.Size)
+		if obj.meta.Deleted {
+			deletedFiles++
+		}
+	}
+
+	return map[string]interface{}{
+		"total_files":   totalFiles,
+		"deleted_files": deletedFiles,
+		"active_files":  totalFiles - deletedFiles,
+		"total_size":    totalSize,
+		"volume_count":  0,
+		"next_id":       m.nextID,
+	}
+}
+
+// versions 返回文件名满足条件的未删除文件，按文件名排序、同名最新的在前
+func (m *MemoryStore) versions(match func(name string) bool) []*FileMetadata {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	metas := make([]*FileMetadata, 0)
+	for _, obj := range m.objects {
+		if !obj.meta.Deleted && match(obj.meta.FileName) {
+			meta := obj.meta
+			metas = append(metas, &meta)
+		}
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].FileName != metas[j].FileName {
+			return metas[i].FileName < metas[j].FileName
+		}
+		return metas[i].ID > metas[j].ID
+	})
+	return metas
+}
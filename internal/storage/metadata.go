@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"fmt"
+
+	"haystack-lite/internal/config"
+)
+
+// MetadataStore 元数据存储接口，保存文件元数据、Volume 信息、Needle 引用和各类配置
+// Database 基于 GORM（SQLite、MySQL、PostgreSQL），BoltDatabase 是进程内的有序键值存储
+// 记录不存在时返回 gorm.ErrRecordNotFound；文件的 Flags、Deleted 等字段以存储中的值为准
+type MetadataStore interface {
+	// 文件元数据
+	SaveFileMetadata(meta *FileMetadata) error
+	GetFileMetadata(id uint64) (*FileMetadata, error)
+	GetDeletedFileMetadata(id uint64) (*FileMetadata, error)
+	FileExists(id uint64) (bool, error)
+	SaveFileMetadataWithRef(meta *FileMetadata, ref *NeedleRef, volumeSize int64) error
+	AddNeedleRef(meta *FileMetadata) error
+	ReleaseFileMetadata(meta *FileMetadata, seq uint64) (int64, error)
+	RestoreFileMetadata(meta *FileMetadata, seq uint64) error
+	ApplyFileMetadata(meta *FileMetadata) error
+	UpdateFileAttributes(id uint64, userMeta, tags map[string]string, seq uint64) error
+	UpdateNeedleOffsets(offsets map[uint64]int64) error
+
+	// 文件查询
+	LoadAllFileMetadata() ([]*FileMetadata, error)
+	LoadAllFileMetadataIncludingDeleted() ([]*FileMetadata, error)
+	FindByFilename(filename string) (*FileMetadata, error)
+	ListByPrefix(prefix string, limit int) ([]*FileMetadata, error)
+	ListVersions(filename string) ([]*FileMetadata, error)
+	ListVersionsByPrefix(prefix string, after VersionMarker, limit int) ([]*FileMetadata, error)
+	ListTrash(since int64, offset, limit int) ([]*FileMetadata, int64, error)
+	ListExpired(now int64, limit int) ([]*FileMetadata, error)
+	ListCreatedBefore(prefix string, before int64, limit int) ([]*FileMetadata, error)
+	ListFilesByNeedles(ids []uint64) ([]*FileMetadata, error)
+	ListChanges(since, until uint64) ([]FileMetadata, error)
+	// QueryFiles 按 FileQuery 过滤、排序并从游标之后取 limit 条，CountFiles 忽略游标
+	QueryFiles(q FileQuery, limit int) ([]*FileMetadata, error)
+	CountFiles(q FileQuery) (int64, error)
+	GetStats() (map[string]interface{}, error)
+
+	// Needle 引用
+	FindNeedleRefs(md5 string, size uint32) ([]NeedleRef, error)
+	GetNeedleRefs(ids []uint64) ([]NeedleRef, error)
+	SaveNeedleRefs(refs []NeedleRef) error
+	ReferencedNeedles(ids []uint64) (map[uint64]bool, error)
+	TrashedNeedles(ids []uint64, since int64) (map[uint64]bool, error)
+
+	// Volume
+	SaveVolumeInfo(info *VolumeInfo) error
+	GetVolumeInfo(id uint32) (*VolumeInfo, error)
+	LoadAllVolumeInfo() ([]VolumeInfo, error)
+	UpdateVolumeSize(id uint32, size int64) error
+	SetVolumeInactive(id uint32) error
+	ListVolumeFiles(id uint32) ([]*FileMetadata, error)
+	DropVolume(id uint32) error
+
+	// Bucket 配置与生命周期规则
+	GetBucketSettings(name string) (*BucketSettings, error)
+	SaveBucketSettings(settings *BucketSettings) error
+	ListLifecycleRules() ([]*LifecycleRule, error)
+	ListBucketLifecycleRules(bucket string) ([]*LifecycleRule, error)
+	SaveLifecycleRule(rule *LifecycleRule) error
+	DeleteLifecycleRule(id uint64) error
+	ReplaceBucketLifecycleRules(bucket string, rules []*LifecycleRule) error
+
+	// 配额
+	ListQuotas() ([]*Quota, error)
+	GetQuota(id uint64) (*Quota, error)
+	SaveQuota(quota *Quota) error
+	DeleteQuota(id uint64) error
+	QuotaUsage(scope, name string) (int64, int64, error)
+	ChargeQuotas(ids []uint64, bytes, objects int64) error
+	ReleaseQuotas(ids []uint64, bytes, objects int64) error
+
+	// 快照与备份
+	DumpMetadata() (*MetadataDump, error)
+	DumpSettings() (*MetadataDump, error)
+	LoadMetadata(dump *MetadataDump) error
+	ReplaceSettings(settings []BucketSettings, rules []LifecycleRule, quotas []Quota) error
+
+	// Webhook
+	ListWebhooks() ([]*Webhook, error)
+	GetWebhook(id uint64) (*Webhook, error)
+	SaveWebhook(hook *Webhook) error
+	DeleteWebhook(id uint64) error
+	CreateDeliveries(deliveries []*WebhookDelivery) error
+	DueDeliveries(now int64, limit int) ([]*WebhookDelivery, error)
+	ListDeliveries(webhookID uint64, status string, limit int) ([]*WebhookDelivery, error)
+	GetDelivery(id uint64) (*WebhookDelivery, error)
+	SaveDelivery(delivery *WebhookDelivery) error
+
+	LeaseSequence(name string, min, count uint64) (uint64, error)
+	Close() error
+}
+
+var (
+	_ MetadataStore = (*Database)(nil)
+	_ MetadataStore = (*BoltDatabase)(nil)
+)
+
+// OpenMetadataStore 按配置的数据库类型打开元数据存储
+func OpenMetadataStore(dbType config.DatabaseType, dsn string) (MetadataStore, error) {
+	switch dbType {
+	case config.DatabaseBolt:
+		return NewBoltDatabase(dsn)
+	case config.DatabaseMySQL, config.DatabaseSQLite, config.DatabasePostgres:
+		return NewDatabase(dbType, dsn)
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+}
@@ -0,0 +1,493 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"haystack-lite/internal/config"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// postgresDSNEnv 设置后一致性测试同时在该 PostgreSQL 数据库上运行，测试会清空其中的所有表
+const postgresDSNEnv = "HAYSTACK_TEST_POSTGRES_DSN"
+
+// forEachMetadataStore 在每个可用的元数据后端上运行 fn，每个后端使用一个空库
+func forEachMetadataStore(t *testing.T, fn func(t *testing.T, db MetadataStore)) {
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := NewDatabase(config.DatabaseSQLite, filepath.Join(t.TempDir(), "haystack.db"))
+		if err != nil {
+			t.Fatalf("NewDatabase: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		fn(t, db)
+	})
+	t.Run("bolt", func(t *testing.T) {
+		db, err := NewBoltDatabase(filepath.Join(t.TempDir(), "haystack.bolt"))
+		if err != nil {
+			t.Fatalf("NewBoltDatabase: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		fn(t, db)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		fn(t, openTestPostgres(t))
+	})
+}
+
+// openTestPostgres 回滚全部迁移后重新迁移，得到一个空库；未设置 DSN 时跳过
+func openTestPostgres(t *testing.T) *Database {
+	t.Helper()
+
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", postgresDSNEnv)
+	}
+	conn, err := ConnectDatabase(config.DatabasePostgres, dsn)
+	if err != nil {
+		t.Fatalf("ConnectDatabase: %v", err)
+	}
+	if _, err := conn.MigrateDown(len(migrations)); err != nil {
+		conn.Close()
+		t.Fatalf("MigrateDown: %v", err)
+	}
+	conn.Close()
+
+	db, err := NewDatabase(config.DatabasePostgres, dsn)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// saveTestFiles 以指定 ID 写入文件元数据，每个文件引用自己的 Needle
+func saveTestFiles(t *testing.T, db MetadataStore, metas ...*FileMetadata) {
+	t.Helper()
+	for _, meta := range metas {
+		if meta.MimeType == "" {
+			meta.MimeType = "text/plain"
+		}
+		ref := &NeedleRef{NeedleID: meta.ID, MD5: meta.MD5, Size: meta.Size, RefCount: 1}
+		if err := db.SaveFileMetadataWithRef(meta, ref, 0); err != nil {
+			t.Fatalf("SaveFileMetadataWithRef(%d): %v", meta.ID, err)
+		}
+	}
+}
+
+func fileIDs(metas []*FileMetadata) []uint64 {
+	ids := make([]uint64, 0, len(metas))
+	for _, meta := range metas {
+		ids = append(ids, meta.ID)
+	}
+	return ids
+}
+
+func TestMetadataFileNames(t *testing.T) {
+	forEachMetadataStore(t, func(t *testing.T, db MetadataStore) {
+		saveTestFiles(t, db,
+			&FileMetadata{ID: 1, FileName: "docs/a.txt", Size: 10, CreateTime: 100},
+			&FileMetadata{ID: 2, FileName: "docs/b.txt", Size: 20, CreateTime: 100},
+			&FileMetadata{ID: 3, FileName: "docs/a.txt", Size: 30, CreateTime: 200},
+			&FileMetadata{ID: 4, FileName: "doc_/c.txt", Size: 40, CreateTime: 100},
+			&FileMetadata{ID: 5, FileName: "a%b/d.txt", Size: 50, CreateTime: 100},
+			&FileMetadata{ID: 6, FileName: "axb/e.txt", Size: 60, CreateTime: 100},
+			&FileMetadata{ID: 7, FileName: "a!b/f.txt", Size: 70, CreateTime: 100},
+		)
+
+		latest, err := db.FindByFilename("docs/a.txt")
+		if err != nil || latest.ID != 3 {
+			t.Fatalf("FindByFilename = %v, %v, want ID 3", latest, err)
+		}
+		versions, err := db.ListVersions("docs/a.txt")
+		if err != nil {
+			t.Fatalf("ListVersions: %v", err)
+		}
+		if got := fileIDs(versions); !reflect.DeepEqual(got, []uint64{3, 1}) {
+			t.Errorf("ListVersions = %v, want [3 1]", got)
+		}
+
+		// 前缀中的 _、% 和转义符 ! 按字面匹配，同名文件只返回最新版本
+		prefixes := map[string][]uint64{
+			"doc_":  {4},
+			"docs/": {2, 3},
+			"a%":    {5},
+			"a!":    {7},
+			"a":     {5, 6, 7},
+		}
+		for prefix, want := range prefixes {
+			metas, err := db.ListByPrefix(prefix, 0)
+			if err != nil {
+				t.Fatalf("ListByPrefix(%q): %v", prefix, err)
+			}
+			got := fileIDs(metas)
+			sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ListByPrefix(%q) = %v, want %v", prefix, got, want)
+			}
+		}
+
+		usage := []struct {
+			scope, name    string
+			bytes, objects int64
+		}{
+			{QuotaScopeBucket, "a_b", 0, 0},
+			{QuotaScopeBucket, "a%b", 50, 1},
+			{QuotaScopeBucket, "a!b", 70, 1},
+			{QuotaScopePrefix, "doc_", 40, 1},
+			{QuotaScopePrefix, "docs", 60, 3},
+		}
+		for _, u := range usage {
+			bytes, objects, err := db.QuotaUsage(u.scope, u.name)
+			if err != nil {
+				t.Fatalf("QuotaUsage(%s, %q): %v", u.scope, u.name, err)
+			}
+			if bytes != u.bytes || objects != u.objects {
+				t.Errorf("QuotaUsage(%s, %q) = %d, %d, want %d, %d", u.scope, u.name, bytes, objects, u.bytes, u.objects)
+			}
+		}
+	})
+}
+
+func TestMetadataVersionsByPrefix(t *testing.T) {
+	forEachMetadataStore(t, func(t *testing.T, db MetadataStore) {
+		saveTestFiles(t, db,
+			&FileMetadata{ID: 1, FileName: "b/x", CreateTime: 100},
+			&FileMetadata{ID: 2, FileName: "b/y", CreateTime: 100},
+			&FileMetadata{ID: 3, FileName: "b/x", CreateTime: 100},
+			&FileMetadata{ID: 4, FileName: "b/x", CreateTime: 100},
+			&FileMetadata{ID: 5, FileName: "b_/z", CreateTime: 100},
+		)
+
+		// 按文件名升序、同名按 ID 降序，每页两条
+		var got []uint64
+		var after VersionMarker
+		for page := 0; page < 10; page++ {
+			metas, err := db.ListVersionsByPrefix("b/", after, 2)
+			if err != nil {
+				t.Fatalf("ListVersionsByPrefix: %v", err)
+			}
+			got = append(got, fileIDs(metas)...)
+			if len(metas) < 2 {
+				break
+			}
+			last := metas[len(metas)-1]
+			after = VersionMarker{FileName: last.FileName, ID: last.ID}
+		}
+		if want := []uint64{4, 3, 1, 2}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ListVersionsByPrefix pages = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestMetadataRestoreOnce(t *testing.T) {
+	forEachMetadataStore(t, func(t *testing.T, db MetadataStore) {
+		meta := &FileMetadata{ID: 1, FileName: "a.txt", Size: 10, CreateTime: 100}
+		saveTestFiles(t, db, meta)
+
+		remaining, err := db.ReleaseFileMetadata(meta, 2)
+		if err != nil || remaining != 0 {
+			t.Fatalf("ReleaseFileMetadata = %d, %v, want 0", remaining, err)
+		}
+		if err := db.RestoreFileMetadata(meta, 3); err != nil {
+			t.Fatalf("RestoreFileMetadata: %v", err)
+		}
+		if err := db.RestoreFileMetadata(meta, 4); !errors.Is(err, ErrNeedleNotFound) {
+			t.Fatalf("second RestoreFileMetadata = %v, want ErrNeedleNotFound", err)
+		}
+
+		refs, err := db.GetNeedleRefs([]uint64{1})
+		if err != nil || len(refs) != 1 {
+			t.Fatalf("GetNeedleRefs = %v, %v", refs, err)
+		}
+		if refs[0].RefCount != 1 {
+			t.Errorf("ref_count = %d, want 1", refs[0].RefCount)
+		}
+		restored, err := db.GetFileMetadata(1)
+		if err != nil || restored.Deleted || restored.Flags != 0 {
+			t.Errorf("GetFileMetadata = %+v, %v, want live file", restored, err)
+		}
+	})
+}
+
+// queryTestFiles 排序键有重复，用于检查同值时按 ID 续传；文件名只用字母和数字，
+// 避免不同排序规则下标点的顺序不一致
+func queryTestFiles() []*FileMetadata {
+	names := []string{"delta", "alpha", "charlie", "bravo", "alpha", "echo", "bravo", "foxtrot", "golf", "alpha"}
+	sizes := []uint32{30, 10, 30, 20, 10, 50, 20, 30, 10, 40}
+	times := []int64{300, 100, 100, 200, 300, 200, 100, 300, 200, 100}
+	metas := make([]*FileMetadata, len(names))
+	for i := range names {
+		metas[i] = &FileMetadata{
+			ID:         uint64(i + 1),
+			FileName:   "q/" + names[i],
+			Size:       sizes[i],
+			CreateTime: times[i],
+		}
+	}
+	return metas
+}
+
+// collectQuery 按 limit 条一页翻完所有结果
+func collectQuery(t *testing.T, db MetadataStore, q FileQuery) ([]uint64, int64) {
+	t.Helper()
+
+	ids := make([]uint64, 0)
+	var total int64
+	for page := 0; page < 100; page++ {
+		result, err := runFileQuery(q, db.QueryFiles, db.CountFiles)
+		if err != nil {
+			t.Fatalf("runFileQuery(%+v): %v", q, err)
+		}
+		if page == 0 {
+			total = result.Total
+		}
+		ids = append(ids, fileIDs(result.Files)...)
+		if result.NextCursor == "" {
+			return ids, total
+		}
+		q.Cursor = result.NextCursor
+	}
+	t.Fatalf("runFileQuery(%+v) did not terminate", q)
+	return nil, 0
+}
+
+func TestMetadataQueryKeyset(t *testing.T) {
+	forEachMetadataStore(t, func(t *testing.T, db MetadataStore) {
+		metas := queryTestFiles()
+		saveTestFiles(t, db, metas...)
+
+		for _, sortBy := range []string{SortByName, SortBySize, SortByTime} {
+			for _, desc := range []bool{false, true} {
+				for _, limit := range []int{1, 3, 20} {
+					q := FileQuery{Sort: sortBy, Desc: desc, Limit: limit, CountTotal: true}
+					want := fileIDs(filterFiles(q, metas, 0))
+					got, total := collectQuery(t, db, q)
+					if !reflect.DeepEqual(got, want) {
+						t.Errorf("sort=%s desc=%v limit=%d: got %v, want %v", sortBy, desc, limit, got, want)
+					}
+					if total != int64(len(metas)) {
+						t.Errorf("sort=%s desc=%v: total = %d, want %d", sortBy, desc, total, len(metas))
+					}
+				}
+			}
+		}
+	})
+}
+
+// 条件落在排序字段上时 Bolt 按索引范围扫描，其余条件读取记录判断；与内存中的参考实现比较
+func TestMetadataQueryRanges(t *testing.T) {
+	forEachMetadataStore(t, func(t *testing.T, db MetadataStore) {
+		metas := queryTestFiles()
+		saveTestFiles(t, db, metas...)
+
+		filters := []FileQuery{
+			{MinSize: 20, MaxSize: 30},
+			{MinSize: 31},
+			{MaxSize: 10},
+			{MinSize: 40, MaxSize: 20},
+			{CreatedAfter: 200},
+			{CreatedAfter: 100, CreatedBefore: 300},
+			{Name: "alpha"},
+			{Name: "q/*o"},
+			{Name: "ALPHA", MinSize: 20},
+		}
+		for _, f := range filters {
+			for _, sortBy := range []string{SortByName, SortBySize, SortByTime} {
+				for _, desc := range []bool{false, true} {
+					q := f
+					q.Sort, q.Desc, q.Limit, q.CountTotal = sortBy, desc, 2, true
+					want := fileIDs(filterFiles(q, metas, 0))
+					got, total := collectQuery(t, db, q)
+					if !reflect.DeepEqual(got, want) {
+						t.Errorf("%+v: got %v, want %v", q, got, want)
+					}
+					if wantTotal := countFiles(q, metas); total != wantTotal {
+						t.Errorf("%+v: total = %d, want %d", q, total, wantTotal)
+					}
+
+					// Offset 跳过满足条件的前几条
+					q.Offset, q.Limit = 2, 3
+					want = fileIDs(filterFiles(q, metas, 3))
+					result, err := runFileQuery(q, db.QueryFiles, db.CountFiles)
+					if err != nil {
+						t.Fatalf("%+v: %v", q, err)
+					}
+					if got := fileIDs(result.Files); !reflect.DeepEqual(got, want) {
+						t.Errorf("%+v: got %v, want %v", q, got, want)
+					}
+				}
+			}
+		}
+	})
+}
+
+func TestMetadataQueryFilters(t *testing.T) {
+	forEachMetadataStore(t, func(t *testing.T, db MetadataStore) {
+		metas := []*FileMetadata{
+			{ID: 1, FileName: "f/a_b.txt", Size: 10, CreateTime: 100, Tags: map[string]string{"env": "prod"}},
+			{ID: 2, FileName: "f/axb.txt", Size: 20, CreateTime: 200, Tags: map[string]string{"env": "Prod"}},
+			{ID: 3, FileName: "f/50%.TXT", Size: 30, CreateTime: 300, Tags: map[string]string{"env": "prod", "team": `a"b,c`}},
+			{ID: 4, FileName: "f/500.log", Size: 40, CreateTime: 400, Tags: map[string]string{"xenv": "prod"}},
+			{ID: 5, FileName: "f/a!b.txt", Size: 50, CreateTime: 500, Tags: map[string]string{"env": "prod!"}},
+		}
+		saveTestFiles(t, db, metas...)
+
+		cases := []struct {
+			name string
+			q    FileQuery
+			want []uint64
+		}{
+			{"literal underscore", FileQuery{Name: "a_b"}, []uint64{1}},
+			{"literal percent", FileQuery{Name: "0%"}, []uint64{3}},
+			{"literal escape", FileQuery{Name: "a!b"}, []uint64{5}},
+			{"case insensitive name", FileQuery{Name: ".txt"}, []uint64{1, 2, 3, 5}},
+			{"glob", FileQuery{Name: "f/a?b.*"}, []uint64{1, 2, 5}},
+			{"glob literal percent", FileQuery{Name: "*%*"}, []uint64{3}},
+			{"tag case sensitive", FileQuery{Tags: map[string]string{"env": "prod"}}, []uint64{1, 3}},
+			{"tag special characters", FileQuery{Tags: map[string]string{"team": `a"b,c`}}, []uint64{3}},
+			{"tags all", FileQuery{Tags: map[string]string{"env": "prod", "team": `a"b,c`}}, []uint64{3}},
+			{"size and time", FileQuery{MinSize: 20, MaxSize: 40, CreatedBefore: 400}, []uint64{2, 3}},
+		}
+		for _, tc := range cases {
+			q := tc.q
+			q.Limit = 2
+			q.CountTotal = true
+			if want := fileIDs(filterFiles(q, metas, 0)); !reflect.DeepEqual(want, tc.want) {
+				t.Fatalf("%s: reference filter = %v, test expects %v", tc.name, want, tc.want)
+			}
+			got, total := collectQuery(t, db, q)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+			}
+			if total != int64(len(tc.want)) {
+				t.Errorf("%s: total = %d, want %d", tc.name, total, len(tc.want))
+			}
+		}
+	})
+}
+
+// 以指定 ID 导入配置后新建的记录不能与导入的 ID 冲突（PostgreSQL 需要推进序列）
+func TestMetadataIDsAfterExplicitInsert(t *testing.T) {
+	forEachMetadataStore(t, func(t *testing.T, db MetadataStore) {
+		rules := []LifecycleRule{{ID: 7, Prefix: "logs/", ExpireDays: 1, Enabled: true}}
+		quotas := []Quota{{ID: 5, Scope: QuotaScopeBucket, Name: "imported"}}
+		if err := db.ReplaceSettings(nil, rules, quotas); err != nil {
+			t.Fatalf("ReplaceSettings: %v", err)
+		}
+
+		rule := &LifecycleRule{Prefix: "tmp/", ExpireDays: 1, Enabled: true}
+		if err := db.SaveLifecycleRule(rule); err != nil {
+			t.Fatalf("SaveLifecycleRule: %v", err)
+		}
+		if rule.ID <= 7 {
+			t.Errorf("new rule ID = %d, want > 7", rule.ID)
+		}
+		quota := &Quota{Scope: QuotaScopeBucket, Name: "created"}
+		if err := db.SaveQuota(quota); err != nil {
+			t.Fatalf("SaveQuota: %v", err)
+		}
+		if quota.ID <= 5 {
+			t.Errorf("new quota ID = %d, want > 5", quota.ID)
+		}
+
+		dump, err := db.DumpSettings()
+		if err != nil {
+			t.Fatalf("DumpSettings: %v", err)
+		}
+		// 再次导入包含新建记录的配置，之后新建的 ID 仍然在导入的最大 ID 之后
+		if err := db.ReplaceSettings(dump.BucketSettings, dump.LifecycleRules, dump.Quotas); err != nil {
+			t.Fatalf("ReplaceSettings from dump: %v", err)
+		}
+		another := &Quota{Scope: QuotaScopeTenant, Name: "after-import"}
+		if err := db.SaveQuota(another); err != nil {
+			t.Fatalf("SaveQuota after import: %v", err)
+		}
+		if another.ID <= quota.ID {
+			t.Errorf("quota ID after import = %d, want > %d", another.ID, quota.ID)
+		}
+	})
+}
+
+// 回滚全部迁移再升级到最新版本，检查每个迁移的 down 能撤销 up（包括索引和列）
+func TestMigrationsRoundTrip(t *testing.T) {
+	run := func(t *testing.T, db *Database) {
+		if _, err := db.MigrateDown(len(migrations)); err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		if _, err := db.MigrateUp(0); err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+		states, err := db.MigrationStatus()
+		if err != nil {
+			t.Fatalf("MigrationStatus: %v", err)
+		}
+		for _, s := range states {
+			if s.Status == MigrationPending || s.Status == MigrationModified {
+				t.Errorf("migration %04d_%s status = %s", s.Version, s.Name, s.Status)
+			}
+		}
+		saveTestFiles(t, db, &FileMetadata{ID: 1, FileName: "a.txt", CreateTime: 100, Tags: map[string]string{"k": "v"}})
+		got, err := db.GetFileMetadata(1)
+		if err != nil || got.Tags["k"] != "v" {
+			t.Errorf("GetFileMetadata after migrations = %+v, %v", got, err)
+		}
+	}
+
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := NewDatabase(config.DatabaseSQLite, filepath.Join(t.TempDir(), "haystack.db"))
+		if err != nil {
+			t.Fatalf("NewDatabase: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		run(t, db)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		run(t, openTestPostgres(t))
+	})
+}
+
+// 版本 1 的 Bolt 文件没有排序索引，打开时补建
+func TestBoltSortIndexBackfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "haystack.bolt")
+	db, err := NewBoltDatabase(path)
+	if err != nil {
+		t.Fatalf("NewBoltDatabase: %v", err)
+	}
+	metas := queryTestFiles()
+	saveTestFiles(t, db, metas...)
+
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltFilesByTime, boltFilesBySize} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(boltMeta).Put(boltSchemaVersionKey, u64Key(1))
+	})
+	if err != nil {
+		t.Fatalf("downgrade: %v", err)
+	}
+	db.Close()
+
+	db, err = NewBoltDatabase(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer db.Close()
+
+	for _, sortBy := range []string{SortBySize, SortByTime} {
+		q := FileQuery{Sort: sortBy, Limit: 20, CountTotal: true}
+		got, total := collectQuery(t, db, q)
+		if want := fileIDs(filterFiles(q, metas, 0)); !reflect.DeepEqual(got, want) {
+			t.Errorf("sort=%s after backfill: got %v, want %v", sortBy, got, want)
+		}
+		if total != int64(len(metas)) {
+			t.Errorf("sort=%s after backfill: total = %d, want %d", sortBy, total, len(metas))
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SchemaMigration 已执行的迁移记录
+type SchemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255;not null"`
+	Checksum  string `gorm:"size:64;not null"`
+	AppliedAt int64  `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migration 一次表结构变更，版本号从 1 开始连续递增
+// source 是迁移的定义（建表模型的结构或 SQL 语句），校验和由它计算；已发布的迁移不能修改
+type migration struct {
+	version int
+	name    string
+	source  string
+	up      func(tx *gorm.DB) error
+	down    func(tx *gorm.DB) error
+}
+
+func (m *migration) checksum() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\n%s\n%s", m.version, m.name, m.source)))
+	return hex.EncodeToString(sum[:])
+}
+
+// migrations 所有迁移，按版本号顺序排列，只能在末尾追加
+var migrations = []*migration{
+	// 第 1 版表结构；对已由 AutoMigrate 创建的旧数据库只补齐缺失的列和索引
+	createTables(1, "baseline",
+		&v1FileMetadata{}, &v1VolumeInfo{}, &v1NeedleRef{}, &v1BucketSettings{}, &v1LifecycleRule{},
+		&v1Quota{}, &v1Webhook{}, &v1WebhookDelivery{}, &v1IDSequence{}),
+
+	// file_name 的普通索引在非 C 排序规则下不能用于 LIKE 'prefix%'，
+	// text_pattern_ops 按字节比较，前缀列举、生命周期扫描和配额统计可以走索引范围扫描
+	dialectSQL(2, "postgres_file_name_pattern", "postgres",
+		`CREATE INDEX IF NOT EXISTS idx_file_metadata_file_name_pattern ON file_metadata (file_name text_pattern_ops) WHERE deleted = false`,
+		`DROP INDEX IF EXISTS idx_file_metadata_file_name_pattern`),
+
+	// 文件列表按时间、大小排序并按 (排序列, id) 做键集分页
+	createIndexes(3, "file_query_sort_indexes", "file_metadata",
+		tableIndex{"idx_file_metadata_sort_time", "create_time, id"},
+		tableIndex{"idx_file_metadata_sort_size", "size, id"}),
+
+	// 用户元数据和标签，JSON 对象
+	addColumns(4, "file_user_meta_and_tags", "file_metadata",
+		tableColumn{"user_meta", "TEXT"},
+		tableColumn{"tags", "TEXT"}),
+
+	// S3 删除标记，旧记录都不是删除标记
+	addColumns(5, "file_delete_marker", "file_metadata",
+		tableColumn{"delete_marker", "BOOLEAN NOT NULL DEFAULT FALSE"}),
+}
+
+// createTables 按模型建表，回滚时按相反顺序删除
+func createTables(version int, name string, models ...interface{}) *migration {
+	return &migration{
+		version: version,
+		name:    name,
+		source:  describeModels(models),
+		up: func(tx *gorm.DB) error {
+			return tx.Migrator().AutoMigrate(models...)
+		},
+		down: func(tx *gorm.DB) error {
+			for i := len(models) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(models[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// dialectSQL 只在指定方言上执行的 SQL，其它数据库上记录为已执行但不做任何变更
+func dialectSQL(version int, name, dialect, up, down string) *migration {
+	exec := func(stmt string) func(tx *gorm.DB) error {
+		return func(tx *gorm.DB) error {
+			if tx.Dialector.Name() != dialect {
+				return nil
+			}
+			return tx.Exec(stmt).Error
+		}
+	}
+	return &migration{
+		version: version,
+		name:    name,
+		source:  fmt.Sprintf("%s\nup: %s\ndown: %s", dialect, up, down),
+		up:      exec(up),
+		down:    exec(down),
+	}
+}
+
+// tableIndex 索引名和列
+type tableIndex struct {
+	name    string
+	columns string
+}
+
+// createIndexes 在已有的表上创建索引，语法在各数据库上通用
+func createIndexes(version int, name, table string, indexes ...tableIndex) *migration {
+	var source strings.Builder
+	for _, idx := range indexes {
+		fmt.Fprintf(&source, "%s ON %s (%s)\n", idx.name, table, idx.columns)
+	}
+	return &migration{
+		version: version,
+		name:    name,
+		source:  source.String(),
+		up: func(tx *gorm.DB) error {
+			for _, idx := range indexes {
+				if err := tx.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (%s)", idx.name, table, idx.columns)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		down: func(tx *gorm.DB) error {
+			for _, idx := range indexes {
+				if err := tx.Migrator().DropIndex(table, idx.name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// tableColumn 列名和类型
+type tableColumn struct {
+	name    string
+	sqlType string
+}
+
+// addColumns 在已有的表上增加可为空或带默认值的列，回滚时删除
+func addColumns(version int, name, table string, columns ...tableColumn) *migration {
+	var source strings.Builder
+	for _, col := range columns {
+		fmt.Fprintf(&source, "%s.%s %s\n", table, col.name, col.sqlType)
+	}
+	return &migration{
+		version: version,
+		name:    name,
+		source:  source.String(),
+		up: func(tx *gorm.DB) error {
+			for _, col := range columns {
+				if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col.name, col.sqlType)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		down: func(tx *gorm.DB) error {
+			for _, col := range columns {
+				if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, col.name)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// describeModels 以表名、字段名、类型和 gorm 标签描述模型，作为校验和的输入
+func describeModels(models []interface{}) string {
+	var b strings.Builder
+	for _, model := range models {
+		t := reflect.TypeOf(model).Elem()
+		if tabler, ok := model.(interface{ TableName() string }); ok {
+			fmt.Fprintf(&b, "table %s\n", tabler.TableName())
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fmt.Fprintf(&b, "  %s %s %s\n", f.Name, f.Type, f.Tag.Get("gorm"))
+		}
+	}
+	return b.String()
+}
+
+// latestMigration 返回本程序认识的最新迁移版本
+func latestMigration() int {
+	return migrations[len(migrations)-1].version
+}
+
+// 迁移状态
+const (
+	MigrationApplied  = "applied"  // 已执行
+	MigrationPending  = "pending"  // 未执行
+	MigrationModified = "modified" // 已执行，但定义与执行时不一致
+	MigrationUnknown  = "unknown"  // 数据库中有记录，本程序不认识（由更新的版本执行）
+)
+
+// MigrationState 单个迁移的状态
+type MigrationState struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	AppliedAt int64  `json:"applied_at,omitempty"`
+}
+
+// appliedMigrations 读取迁移记录，迁移表不存在时创建
+func (d *Database) appliedMigrations() (map[int]SchemaMigration, error) {
+	if err := d.db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var records []SchemaMigration
+	if err := d.db.Order("version").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]SchemaMigration, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// MigrationStatus 列出所有迁移的状态，包括数据库中有记录但本程序不认识的
+func (d *Database) MigrationStatus() ([]MigrationState, error) {
+	applied, err := d.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Version: m.version, Name: m.name, Status: MigrationPending}
+		if r, ok := applied[m.version]; ok {
+			state.AppliedAt = r.AppliedAt
+			state.Status = MigrationApplied
+			if r.Checksum != m.checksum() {
+				state.Status = MigrationModified
+			}
+			delete(applied, m.version)
+		}
+		states = append(states, state)
+	}
+	for _, r := range applied {
+		states = append(states, MigrationState{Version: r.Version, Name: r.Name, Status: MigrationUnknown, AppliedAt: r.AppliedAt})
+	}
+	return states, nil
+}
+
+// checkMigrations 拒绝在不认识的或被修改过的表结构上运行
+func checkMigrations(states []MigrationState) error {
+	for _, s := range states {
+		switch s.Status {
+		case MigrationUnknown:
+			return fmt.Errorf("%w: migration %04d_%s is not known, latest known is %d", ErrSchemaTooNew, s.Version, s.Name, latestMigration())
+		case MigrationModified:
+			return fmt.Errorf("%w: %04d_%s", ErrSchemaModified, s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// MigrateUp 依次执行未应用的迁移直到版本 to，to 为 0 表示最新版本
+// 每个迁移和它的记录在同一事务中提交（MySQL 的 DDL 会隐式提交，失败时需要手动检查）
+func (d *Database) MigrateUp(to int) ([]MigrationState, error) {
+	states, err := d.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMigrations(states); err != nil {
+		return nil, err
+	}
+
+	done := make([]MigrationState, 0)
+	for i, m := range migrations {
+		if to > 0 && m.version > to {
+			break
+		}
+		if states[i].Status != MigrationPending {
+			continue
+		}
+
+		record := SchemaMigration{Version: m.version, Name: m.name, Checksum: m.checksum(), AppliedAt: time.Now().Unix()}
+		err := d.db.Transaction(func(tx *gorm.DB) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&record).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+		}
+		done = append(done, MigrationState{Version: m.version, Name: m.name, Status: MigrationApplied, AppliedAt: record.AppliedAt})
+	}
+	return done, nil
+}
+
+// MigrateDown 按版本从新到旧回滚 steps 个已执行的迁移
+func (d *Database) MigrateDown(steps int) ([]MigrationState, error) {
+	states, err := d.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMigrations(states); err != nil {
+		return nil, err
+	}
+
+	done := make([]MigrationState, 0)
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if states[i].Status != MigrationApplied {
+			continue
+		}
+
+		err := d.db.Transaction(func(tx *gorm.DB) error {
+			if err := m.down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("rollback %04d_%s: %w", m.version, m.name, err)
+		}
+		done = append(done, MigrationState{Version: m.version, Name: m.name, Status: MigrationPending})
+	}
+	return done, nil
+}
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+)
+
+// mirrorCounters 镜像读写统计，Volume 压缩重建后继续累计
+type mirrorCounters struct {
+	reads          uint64 // 轮换读取计数，用于在两份副本间分摊读取
+	divergentReads int64  // 一份副本读取失败、另一份成功的次数
+	repairsPrimary int64  // 用镜像修复主副本的次数
+	repairsMirror  int64  // 用主副本修复镜像的次数
+	repairFailures int64  // 回写修复失败的次数
+	unrecoverable  int64  // 两份副本都无法读取的次数
+	writeErrors    int64  // 镜像写入失败的次数
+	resyncBytes    int64  // 打开时补齐镜像复制的字节数
+}
+
+// mirrorState 单个 Volume 的镜像状态
+type mirrorState struct {
+	counters  *mirrorCounters
+	degraded  bool // 镜像写入失败后停止使用，重启时重新补齐
+	lastError string
+}
+
+// MirrorStatus 镜像健康状况
+type MirrorStatus struct {
+	Enabled         bool     `json:"enabled"`
+	Dir             string   `json:"dir,omitempty"`
+	Volumes         int      `json:"volumes"`
+	DegradedVolumes []uint32 `json:"degraded_volumes"`
+	DivergentReads  int64    `json:"divergent_reads"`
+	RepairsPrimary  int64    `json:"repairs_primary"`
+	RepairsMirror   int64    `json:"repairs_mirror"`
+	RepairFailures  int64    `json:"repair_failures"`
+	Unrecoverable   int64    `json:"unrecoverable"`
+	WriteErrors     int64    `json:"write_errors"`
+	ResyncBytes     int64    `json:"resync_bytes"`
+	LastError       string   `json:"last_error,omitempty"`
+}
+
+// openVolume 打开 Volume，配置了镜像目录时同时打开镜像副本
+func (s *Store) openVolume(id uint32) (*Volume, error) {
+	vol, err := NewVolume(id, s.config.Storage.DataDir, s.config.Storage.MaxVolumeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir := s.config.Storage.MirrorDir; dir != "" {
+		if err := vol.OpenMirror(dir, &s.mirrorCounters); err != nil {
+			vol.Close()
+			return nil, fmt.Errorf("failed to open mirror of volume %d: %w", id, err)
+		}
+	}
+	return vol, nil
+}
+
+// removeVolumeFiles 删除 Volume 文件及其镜像
+func (s *Store) removeVolumeFiles(vol *Volume) {
+	for _, path := range []string{vol.FilePath, vol.MirrorPath} {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to remove volume file %s: %v", path, err)
+		}
+	}
+}
+
+// OpenMirror 打开镜像文件，与主副本长度不同时以较长的一份补齐
+// 追加写入先写主副本，崩溃后镜像最多缺少末尾的部分数据
+func (v *Volume) OpenMirror(dir string, counters *mirrorCounters) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, filepath.Base(v.FilePath))
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	primary, err := v.File.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	mirror, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	src, dst := v.File, file
+	from, to := mirror.Size(), primary.Size()
+	if from > to {
+		src, dst = file, v.File
+		from, to = to, from
+	}
+	if from < to {
+		n, err := io.Copy(io.NewOffsetWriter(dst, from), io.NewSectionReader(src, from, to-from))
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to resync mirror: %w", err)
+		}
+		atomic.AddInt64(&counters.resyncBytes, n)
+		if to > v.CurrentSize {
+			v.CurrentSize = to
+		}
+		log.Printf("Resynced volume %d: copied %d bytes to %s", v.ID, n, dst.Name())
+	}
+
+	v.Mirror = file
+	v.MirrorPath = path
+	v.mirror = &mirrorState{counters: counters}
+	return nil
+}
+
+// writeMirror 将刚写入主副本的 Needle 写入镜像，调用方持有写锁
+// 镜像写入失败时标记为降级，主副本继续提供服务
+func (v *Volume) writeMirror(n *Needle, offset int64) {
+	if v.Mirror == nil || v.mirror.degraded {
+		return
+	}
+
+	var buf bytes.Buffer
+	err := n.Write(&buf)
+	if err == nil {
+		_, err = v.Mirror.WriteAt(buf.Bytes(), offset)
+	}
+	if err != nil {
+		atomic.AddInt64(&v.mirror.counters.writeErrors, 1)
+		v.mirror.degraded = true
+		v.mirror.lastError = err.Error()
+		log.Printf("Mirror of volume %d failed, running degraded: %v", v.ID, err)
+	}
+}
+
+// readMirrored 轮流从两份副本读取，一份损坏或读取失败时改读另一份并回写修复
+func (v *Volume) readMirrored(id uint64, offset int64) (*Needle, error) {
+	v.mu.RLock()
+	copies := []*os.File{v.File, v.Mirror}
+	if v.mirror.degraded {
+		copies = copies[:1]
+	} else if atomic.AddUint64(&v.mirror.counters.reads, 1)%2 == 0 {
+		copies[0], copies[1] = copies[1], copies[0]
+	}
+	size := v.CurrentSize - offset
+
+	var firstErr error
+	for i, file := range copies {
+		n, err := readNeedleCopy(file, id, offset, size)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		v.mu.RUnlock()
+
+		if i > 0 {
+			atomic.AddInt64(&v.mirror.counters.divergentReads, 1)
+			log.Printf("Needle %d in volume %d unreadable from %s: %v, read from %s instead",
+				id, v.ID, copies[0].Name(), firstErr, file.Name())
+			v.repairCopy(copies[0], n, offset)
+		}
+		return n, nil
+	}
+	v.mu.RUnlock()
+
+	if len(copies) > 1 {
+		atomic.AddInt64(&v.mirror.counters.unrecoverable, 1)
+	}
+	return nil, firstErr
+}
+
+// repairCopy 用完好的 Needle 覆盖损坏副本中相同位置的数据
+func (v *Volume) repairCopy(file *os.File, n *Needle, offset int64) {
+	var buf bytes.Buffer
+	if err := n.Write(&buf); err != nil {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, err := file.WriteAt(buf.Bytes(), offset); err != nil {
+		atomic.AddInt64(&v.mirror.counters.repairFailures, 1)
+		v.mirror.lastError = err.Error()
+		log.Printf("Failed to repair needle %d in %s: %v", n.ID, file.Name(), err)
+		return
+	}
+
+	if file == v.File {
+		atomic.AddInt64(&v.mirror.counters.repairsPrimary, 1)
+	} else {
+		atomic.AddInt64(&v.mirror.counters.repairsMirror, 1)
+	}
+	log.Printf("Repaired needle %d in %s", n.ID, file.Name())
+}
+
+// readNeedleCopy 从一份副本读取 Needle 并核对 ID
+func readNeedleCopy(file *os.File, id uint64, offset, size int64) (*Needle, error) {
+	n, err := ReadNeedleFrom(io.NewSectionReader(file, offset, size))
+	if err != nil {
+		return nil, err
+	}
+	if n.ID != id {
+		return nil, ErrInvalidNeedle
+	}
+	return n, nil
+}
+
+// MirrorStatus 返回镜像健康状况
+func (s *Store) MirrorStatus() MirrorStatus {
+	status := MirrorStatus{
+		Enabled:         s.config.Storage.MirrorDir != "",
+		Dir:             s.config.Storage.MirrorDir,
+		DegradedVolumes: []uint32{},
+		DivergentReads:  atomic.LoadInt64(&s.mirrorCounters.divergentReads),
+		RepairsPrimary:  atomic.LoadInt64(&s.mirrorCounters.repairsPrimary),
+		RepairsMirror:   atomic.LoadInt64(&s.mirrorCounters.repairsMirror),
+		RepairFailures:  atomic.LoadInt64(&s.mirrorCounters.repairFailures),
+		Unrecoverable:   atomic.LoadInt64(&s.mirrorCounters.unrecoverable),
+		WriteErrors:     atomic.LoadInt64(&s.mirrorCounters.writeErrors),
+		ResyncBytes:     atomic.LoadInt64(&s.mirrorCounters.resyncBytes),
+	}
+	if !status.Enabled {
+		return status
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, vol := range s.volumes {
+		vol.mu.RLock()
+		if vol.Mirror != nil {
+			status.Volumes++
+			if vol.mirror.degraded {
+				status.DegradedVolumes = append(status.DegradedVolumes, vol.ID)
+			}
+			if vol.mirror.lastError != "" {
+				status.LastError = vol.mirror.lastError
+			}
+		}
+		vol.mu.RUnlock()
+	}
+	sort.Slice(status.DegradedVolumes, func(i, j int) bool { return status.DegradedVolumes[i] < status.DegradedVolumes[j] })
+	return status
+}
@@ -4,35 +4,160 @@ import "time"
 
 // FileMetadata 文件元数据表
 type FileMetadata struct {
-	ID         uint64    `gorm:"primaryKey;autoIncrement:false"`
-	VolumeID   uint32    `gorm:"index"`
-	Offset     int64     `gorm:"not null"`
-	Size       uint32    `gorm:"not null"`
-	Cookie     uint32    `gorm:"not null"`
-	Flags      uint8     `gorm:"default:0"`
-	Deleted    bool      `gorm:"default:false;index"`
-	FileName   string    `gorm:"size:255;index"`
-	MimeType   string    `gorm:"size:100"`
-	MD5        string    `gorm:"size:32;index"`
-	CreateTime int64     `gorm:"not null"`
-	UpdateTime time.Time `gorm:"autoUpdateTime"`
+	ID         uint64            `gorm:"primaryKey;autoIncrement:false"`
+	NeedleID   uint64            `gorm:"index"` // 数据所在 Needle，0 表示与 ID 相同
+	VolumeID   uint32            `gorm:"index"`
+	Offset     int64             `gorm:"not null"`
+	Size       uint32            `gorm:"not null"`
+	Cookie     uint32            `gorm:"not null"`
+	Flags      uint8             `gorm:"default:0"`
+	Deleted    bool              `gorm:"default:false;index"`
+	DeleteTime int64             `gorm:"default:0;index"`
+	FileName   string            `gorm:"size:255;index"`
+	MimeType   string            `gorm:"size:100"`
+	Tenant     string            `gorm:"size:64;index"` // 上传者所属租户，用于配额统计
+	MD5        string            `gorm:"size:32;index"`
+	SHA256     string            `gorm:"size:64;index"`
+	CreateTime int64             `gorm:"not null"`
+	ExpireTime int64             `gorm:"default:0;index"`
+	Seq        uint64            `gorm:"default:0;index"`           // 最后一次写入或删除的序列号，用于增量备份
+	UserMeta   map[string]string `gorm:"type:text;serializer:json"` // 用户自定义元数据
+	Tags       map[string]string `gorm:"type:text;serializer:json"` // 标签，可在文件列表中按标签过滤
+	// DeleteMarker 删除标记，没有数据的版本；作为最新版本时按文件名读取视为不存在
+	DeleteMarker bool      `gorm:"default:false"`
+	UpdateTime   time.Time `gorm:"autoUpdateTime"`
 }
 
 func (FileMetadata) TableName() string {
 	return "file_metadata"
 }
 
+// DataNeedleID 返回实际存放文件数据的 Needle ID
+func (m *FileMetadata) DataNeedleID() uint64 {
+	if m.NeedleID == 0 {
+		return m.ID
+	}
+	return m.NeedleID
+}
+
+// NeedleRef Needle 引用计数表，用于内容去重
+type NeedleRef struct {
+	NeedleID uint64 `gorm:"primaryKey;autoIncrement:false"`
+	VolumeID uint32 `gorm:"not null"`
+	Size     uint32 `gorm:"not null"`
+	MD5      string `gorm:"size:32;index"`
+	SHA256   string `gorm:"size:64"`
+	RefCount int64  `gorm:"default:0"`
+}
+
+func (NeedleRef) TableName() string {
+	return "needle_refs"
+}
+
 // VolumeInfo Volume 信息表
 type VolumeInfo struct {
-	ID          uint32    `gorm:"primaryKey;autoIncrement:false"`
-	FilePath    string    `gorm:"size:255;not null"`
-	MaxSize     int64     `gorm:"not null"`
-	CurrentSize int64     `gorm:"default:0"`
-	Active      bool      `gorm:"default:true;index"`
-	CreateTime  time.Time `gorm:"autoCreateTime"`
-	UpdateTime  time.Time `gorm:"autoUpdateTime"`
+	ID          uint32 `gorm:"primaryKey;autoIncrement:false"`
+	FilePath    string `gorm:"size:255;not null"`
+	MaxSize     int64  `gorm:"not null"`
+	CurrentSize int64  `gorm:"default:0"`
+	Active      bool   `gorm:"default:true;index"`
+	// 过期分区编号，0 表示普通 Volume；分区内所有文件在 MaxExpireTime 前过期
+	ExpiryBucket  int64     `gorm:"default:0;index"`
+	MaxExpireTime int64     `gorm:"default:0"`
+	CreateTime    time.Time `gorm:"autoCreateTime"`
+	UpdateTime    time.Time `gorm:"autoUpdateTime"`
 }
 
 func (VolumeInfo) TableName() string {
 	return "volume_info"
 }
+
+// BucketSettings Bucket（文件名第一级目录）级别的配置
+type BucketSettings struct {
+	Name         string    `gorm:"primaryKey;size:255"`
+	KeepVersions int       `gorm:"not null"` // 保留的历史版本数，-1 表示不限
+	UpdateTime   time.Time `gorm:"autoUpdateTime"`
+}
+
+func (BucketSettings) TableName() string {
+	return "bucket_settings"
+}
+
+// LifecycleRule 生命周期规则，文件名匹配前缀且创建超过指定天数后自动删除
+type LifecycleRule struct {
+	ID         uint64    `gorm:"primaryKey"`
+	Bucket     string    `gorm:"size:255;index"` // 通过 S3 配置时所属的 Bucket
+	RuleID     string    `gorm:"size:255"`
+	Prefix     string    `gorm:"size:255;not null"` // 完整文件名前缀
+	ExpireDays int       `gorm:"not null"`
+	Enabled    bool      `gorm:"default:true"`
+	CreateTime time.Time `gorm:"autoCreateTime"`
+}
+
+func (LifecycleRule) TableName() string {
+	return "lifecycle_rules"
+}
+
+// Quota 存储配额，按 Bucket、文件名前缀或租户统计已用字节数和文件数
+type Quota struct {
+	ID          uint64    `gorm:"primaryKey"`
+	Scope       string    `gorm:"size:16;not null;uniqueIndex:idx_quota_scope_name"` // bucket、prefix 或 tenant
+	Name        string    `gorm:"size:255;not null;uniqueIndex:idx_quota_scope_name"`
+	MaxBytes    int64     `gorm:"default:0"` // 0 表示不限制
+	MaxObjects  int64     `gorm:"default:0"` // 0 表示不限制
+	UsedBytes   int64     `gorm:"default:0"`
+	UsedObjects int64     `gorm:"default:0"`
+	CreateTime  time.Time `gorm:"autoCreateTime"`
+	UpdateTime  time.Time `gorm:"autoUpdateTime"`
+}
+
+func (Quota) TableName() string {
+	return "quotas"
+}
+
+// Webhook 对象事件回调，按 Bucket、文件名前缀和事件类型过滤
+type Webhook struct {
+	ID         uint64    `gorm:"primaryKey"`
+	URL        string    `gorm:"size:1024;not null"`
+	Secret     string    `gorm:"size:255"`     // HMAC-SHA256 签名密钥，为空时不签名
+	Bucket     string    `gorm:"size:255"`     // 为空表示所有 Bucket
+	Prefix     string    `gorm:"size:255"`     // 完整文件名前缀，为空表示不限
+	Events     string    `gorm:"size:255"`     // 逗号分隔的事件类型，为空表示所有事件
+	Enabled    bool      `gorm:"default:true"` // 停用后不再产生新的投递
+	CreateTime time.Time `gorm:"autoCreateTime"`
+	UpdateTime time.Time `gorm:"autoUpdateTime"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// WebhookDelivery Webhook 投递记录，失败后按指数退避重试
+type WebhookDelivery struct {
+	ID           uint64    `gorm:"primaryKey"`
+	WebhookID    uint64    `gorm:"index;not null"`
+	EventType    string    `gorm:"size:32;not null"`
+	FileID       uint64    `gorm:"index"`
+	Payload      string    `gorm:"type:text;not null"`
+	Status       string    `gorm:"size:16;not null;index:idx_delivery_due"` // pending、succeeded 或 failed
+	Attempts     int       `gorm:"default:0"`
+	NextAttempt  int64     `gorm:"default:0;index:idx_delivery_due"` // 下一次尝试的时间戳
+	ResponseCode int       `gorm:"default:0"`                        // 最近一次请求的 HTTP 状态码
+	LastError    string    `gorm:"size:1024"`
+	CreateTime   time.Time `gorm:"autoCreateTime"`
+	UpdateTime   time.Time `gorm:"autoUpdateTime"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// IDSequence 持久化的 ID 序列，记录已租出的最大位置
+type IDSequence struct {
+	Name string `gorm:"primaryKey;size:64"`
+	Next uint64 `gorm:"column:next_value;not null"` // 下一次租用的起点
+}
+
+func (IDSequence) TableName() string {
+	return "id_sequences"
+}
@@ -0,0 +1,54 @@
+package storage
+
+// ObjectStore API 层依赖的对象存储接口，覆盖写入、读取、查询、删除、列举和状态
+// Store 是基于 Volume 和数据库的实现，MemoryStore 是纯内存实现
+// 文件名相同的多次写入互为版本，按文件名查询时返回 ID 最大的未删除版本，可能是删除标记
+type ObjectStore interface {
+	WriteWithOptions(data []byte, opts WriteOptions) (uint64, error)
+	// WriteVersion 以文件名为键写入新版本，实现可以按保留策略清理旧版本
+	WriteVersion(data []byte, opts WriteOptions) (uint64, error)
+	// WriteDeleteMarker 写入删除标记作为最新版本，历史版本保留；没有可隐藏的版本时返回 ErrNeedleNotFound
+	WriteDeleteMarker(filename string) (uint64, error)
+
+	ReadWithMetadata(id uint64) ([]byte, *FileMetadata, error)
+	GetMetadata(id uint64) (*FileMetadata, error)
+	FindByFilename(filename string) (*FileMetadata, error)
+	// GetVersion 获取文件名的指定版本，版本 ID 即文件 ID
+	GetVersion(filename string, versionID uint64) (*FileMetadata, error)
+
+	ListAll() ([]*FileMetadata, error)
+	// QueryFiles 按条件过滤、排序并分页，NextCursor 用于获取下一页
+	QueryFiles(q FileQuery) (*FileQueryResult, error)
+	// ListByPrefix 按文件名排序，每个文件名只返回最新版本，limit 为 0 表示不限制
+	ListByPrefix(prefix string, limit int) ([]*FileMetadata, error)
+	// ListVersionsByPrefix 按文件名排序、同名最新的在前，从 after 之后开始
+	ListVersionsByPrefix(prefix string, after VersionMarker, limit int) ([]*FileMetadata, error)
+
+	// UpdateAttributes 修改用户元数据和标签，不改变文件内容和 ID
+	UpdateAttributes(id uint64, patch AttributePatch) (*FileMetadata, error)
+
+	Delete(id uint64) error
+	DeleteAllVersions(filename string) (int, error)
+
+	Status() map[string]interface{}
+}
+
+// QuotaReporter 可选接口，提供文件适用的配额，用于 WebDAV 配额属性
+type QuotaReporter interface {
+	QuotaFor(filename, tenant string) (*Quota, error)
+}
+
+// NodeStatus 可选接口，提供存储节点的运行状况，用于健康检查和监控指标
+type NodeStatus interface {
+	ReplicationStatus() ReplicationStatus
+	MirrorStatus() MirrorStatus
+	CacheStats() CacheStats
+	GetCompactionStats() map[string]interface{}
+}
+
+var (
+	_ ObjectStore   = (*Store)(nil)
+	_ QuotaReporter = (*Store)(nil)
+	_ NodeStatus    = (*Store)(nil)
+	_ ObjectStore   = (*MemoryStore)(nil)
+)
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// PartitionInfo 过期分区 Volume 信息
+type PartitionInfo struct {
+	VolumeID     uint32 `json:"volume_id"`
+	ExpiryBucket int64  `json:"expiry_bucket"`
+	ExpiresAt    int64  `json:"expires_at"`
+	Size         int64  `json:"size"`
+	Active       bool   `json:"active"`
+}
+
+// partitionSpan 返回过期分区的时间跨度（秒）
+func (s *Store) partitionSpan() int64 {
+	if s.config.Storage.PartitionSpan <= 0 {
+		return 86400
+	}
+	return int64(s.config.Storage.PartitionSpan)
+}
+
+// expiryBucket 计算过期时间所属的分区编号，未启用分区或永不过期时返回 0
+func (s *Store) expiryBucket(expireTime int64) int64 {
+	if !s.config.Storage.PartitionByExpiry || expireTime <= 0 {
+		return 0
+	}
+	span := s.partitionSpan()
+	// 向上取整，保证分区内所有文件都在分区到期前过期
+	return (expireTime + span - 1) / span
+}
+
+// isPartitionVolume 判断 Volume 是否为过期分区
+func (s *Store) isPartitionVolume(volID uint32) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	vol, exists := s.volumes[volID]
+	return exists && vol.ExpiryBucket != 0
+}
+
+// ListPartitions 列出所有过期分区 Volume，按到期时间排序
+func (s *Store) ListPartitions() []PartitionInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	partitions := make([]PartitionInfo, 0)
+	for _, vol := range s.volumes {
+		if vol.ExpiryBucket == 0 {
+			continue
+		}
+		partitions = append(partitions, PartitionInfo{
+			VolumeID:     vol.ID,
+			ExpiryBucket: vol.ExpiryBucket,
+			ExpiresAt:    vol.MaxExpireTime,
+			Size:         vol.CurrentSize,
+			Active:       s.partitions[vol.ExpiryBucket] == vol.ID,
+		})
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		if partitions[i].ExpiresAt != partitions[j].ExpiresAt {
+			return partitions[i].ExpiresAt < partitions[j].ExpiresAt
+		}
+		return partitions[i].VolumeID < partitions[j].VolumeID
+	})
+	return partitions
+}
+
+// dropExpiredPartitions 整体删除所有文件均已过期的分区 Volume，返回删除的 Volume 数和未删除的文件数
+// 删除不分配序列号，不会出现在增量变更中；副本按相同的分区配置在本地各自删除
+func (s *Store) dropExpiredPartitions(now int64) (int, int64) {
+	// 防止与压缩、恢复并发操作同一个 Volume
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.mu.Lock()
+	expired := make([]*Volume, 0)
+	for id, vol := range s.volumes {
+		if vol.ExpiryBucket == 0 || vol.MaxExpireTime >= now {
+			continue
+		}
+		expired = append(expired, vol)
+		delete(s.volumes, id)
+		if s.partitions[vol.ExpiryBucket] == id {
+			delete(s.partitions, vol.ExpiryBucket)
+		}
+	}
+	s.mu.Unlock()
+
+	droppedVolumes := 0
+	var droppedFiles int64
+	for _, vol := range expired {
+		live, err := s.db.ListVolumeFiles(vol.ID)
+		if err == nil {
+			err = s.db.DropVolume(vol.ID)
+		}
+		if err != nil {
+			// 元数据删除失败时保留 Volume，下一轮重试
+			log.Printf("Failed to drop partition volume %d: %v", vol.ID, err)
+			s.mu.Lock()
+			s.volumes[vol.ID] = vol
+			s.mu.Unlock()
+			continue
+		}
+
+		for _, meta := range live {
+			s.invalidateCache(meta.ID, meta.DataNeedleID())
+			s.releaseQuota(meta)
+			s.publishFile(EventExpired, meta)
+		}
+		files := int64(len(live))
+
+		vol.Close()
+		s.removeVolumeFiles(vol)
+
+		droppedVolumes++
+		droppedFiles += files
+		log.Printf("Dropped expired partition volume %d (%d files, expired at %s)",
+			vol.ID, files, time.Unix(vol.MaxExpireTime, 0).Format(time.RFC3339))
+	}
+
+	return droppedVolumes, droppedFiles
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// serialTables 使用自增主键、且会以指定 ID 批量写入的表
+var serialTables = []string{"lifecycle_rules", "quotas", "webhooks"}
+
+func isPostgres(db *gorm.DB) bool {
+	return db.Dialector.Name() == "postgres"
+}
+
+// syncSequences 以指定 ID 插入后把自增序列推进到最大 ID 之后
+// PostgreSQL 的 bigserial 不会因显式插入 ID 而前进，否则之后新建的记录会主键冲突
+func syncSequences(tx *gorm.DB, tables ...string) error {
+	if !isPostgres(tx) {
+		return nil
+	}
+	for _, table := range tables {
+		stmt := fmt.Sprintf(`SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE((SELECT MAX(id) FROM %s), 0) + 1, false)`, table, table)
+		if err := tx.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("failed to sync sequence of %s: %w", table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// 文件列表的排序字段
+const (
+	SortByName = "name"
+	SortBySize = "size"
+	SortByTime = "time"
+)
+
+// FileQuery 文件列表查询条件，零值字段表示不过滤
+type FileQuery struct {
+	Name          string // 文件名子串，包含 * 或 ? 时按通配符匹配整个文件名；不区分大小写
+	MimePrefix    string // MIME 类型前缀，如 image/
+	MinSize       int64  // 最小字节数（含）
+	MaxSize       int64  // 最大字节数（含）
+	CreatedAfter  int64  // 创建时间下限（含），Unix 秒
+	CreatedBefore int64  // 创建时间上限（不含），Unix 秒
+	MD5           string
+	Tags          map[string]string // 标签，需全部存在且值相等，区分大小写
+
+	Sort string // name、size 或 time，默认 time
+	Desc bool
+
+	Limit      int
+	Cursor     string // 上一页返回的 NextCursor
+	Offset     int    // 跳过的条数，用于按页码翻页，可以与游标同时使用
+	CountTotal bool   // 同时统计满足条件的总数
+
+	after *fileCursor // 由 Cursor 解码，只在存储层内部使用
+}
+
+// FileQueryResult 查询结果，NextCursor 为空表示没有下一页
+type FileQueryResult struct {
+	Files      []*FileMetadata
+	NextCursor string
+	Total      int64 // 仅在 CountTotal 时有效
+}
+
+// fileCursor 键集分页游标，记录上一页最后一条记录的排序键和 ID
+type fileCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d"`
+	Name string `json:"n,omitempty"`
+	Num  int64  `json:"v,omitempty"`
+	ID   uint64 `json:"id"`
+}
+
+func encodeCursor(c *fileCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor 解码游标，排序方式与查询不一致时返回 ErrInvalidCursor
+func decodeCursor(s string, q *FileQuery) (*fileCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c fileCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != q.Sort || c.Desc != q.Desc {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// DefaultQueryLimit 未指定 Limit 时每页的条数
+const DefaultQueryLimit = 20
+
+// normalize 补齐默认排序和每页条数
+func (q *FileQuery) normalize() error {
+	if q.Limit <= 0 {
+		q.Limit = DefaultQueryLimit
+	}
+	switch q.Sort {
+	case "":
+		q.Sort = SortByTime
+	case SortByName, SortBySize, SortByTime:
+	default:
+		return ErrInvalidQuery
+	}
+	return nil
+}
+
+// isGlob 文件名条件是否为通配符
+func (q *FileQuery) isGlob() bool {
+	return strings.ContainsAny(q.Name, "*?")
+}
+
+// sortKey 返回排序字段的值，文件名排序时为字符串，其它为整数
+func (q *FileQuery) sortKey(meta *FileMetadata) (string, int64) {
+	switch q.Sort {
+	case SortByName:
+		return meta.FileName, 0
+	case SortBySize:
+		return "", int64(meta.Size)
+	default:
+		return "", meta.CreateTime
+	}
+}
+
+func (q *FileQuery) cursorOf(meta *FileMetadata) *fileCursor {
+	name, num := q.sortKey(meta)
+	return &fileCursor{Sort: q.Sort, Desc: q.Desc, Name: name, Num: num, ID: meta.ID}
+}
+
+// compare 按排序字段和 ID 比较，结果已考虑降序
+func (q *FileQuery) compare(name string, num int64, id uint64, c *fileCursor) int {
+	result := 0
+	switch {
+	case q.Sort == SortByName && name != c.Name:
+		result = strings.Compare(name, c.Name)
+	case q.Sort != SortByName && num != c.Num:
+		if num < c.Num {
+			result = -1
+		} else {
+			result = 1
+		}
+	case id != c.ID:
+		if id < c.ID {
+			result = -1
+		} else {
+			result = 1
+		}
+	}
+	if q.Desc {
+		return -result
+	}
+	return result
+}
+
+// matchName 判断文件名是否满足文件名条件，不区分大小写
+func (q *FileQuery) matchName(filename string) bool {
+	name, pattern := strings.ToLower(filename), strings.ToLower(q.Name)
+	if q.isGlob() {
+		return wildcardMatch(pattern, name)
+	}
+	return strings.Contains(name, pattern)
+}
+
+// match 判断文件是否满足过滤条件，用于不支持 SQL 的存储
+func (q *FileQuery) match(meta *FileMetadata) bool {
+	if meta.Deleted || meta.DeleteMarker {
+		return false
+	}
+	if q.Name != "" && !q.matchName(meta.FileName) {
+		return false
+	}
+	if q.MimePrefix != "" && !strings.HasPrefix(meta.MimeType, q.MimePrefix) {
+		return false
+	}
+	if q.MinSize > 0 && int64(meta.Size) < q.MinSize {
+		return false
+	}
+	if q.MaxSize > 0 && int64(meta.Size) > q.MaxSize {
+		return false
+	}
+	if q.CreatedAfter > 0 && meta.CreateTime < q.CreatedAfter {
+		return false
+	}
+	if q.CreatedBefore > 0 && meta.CreateTime >= q.CreatedBefore {
+		return false
+	}
+	if q.MD5 != "" && meta.MD5 != q.MD5 {
+		return false
+	}
+	for k, v := range q.Tags {
+		if got, ok := meta.Tags[k]; !ok || got != v {
+			return false
+		}
+	}
+	if q.after != nil {
+		name, num := q.sortKey(meta)
+		if q.compare(name, num, meta.ID, q.after) <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// filterFiles 在内存中过滤、排序并截取一页，用于不支持 SQL 的存储
+func filterFiles(q FileQuery, metas []*FileMetadata, limit int) []*FileMetadata {
+	matched := make([]*FileMetadata, 0)
+	for _, meta := range metas {
+		if q.match(meta) {
+			matched = append(matched, meta)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		name, num := q.sortKey(matched[i])
+		return q.compare(name, num, matched[i].ID, q.cursorOf(matched[j])) < 0
+	})
+
+	if q.Offset >= len(matched) {
+		return []*FileMetadata{}
+	}
+	matched = matched[q.Offset:]
+	if limit > 0 && len(matched) > limit {
+		matched = matched[:limit]
+	}
+	return matched
+}
+
+// countFiles 在内存中统计满足过滤条件的文件数，不考虑游标
+func countFiles(q FileQuery, metas []*FileMetadata) int64 {
+	q.after = nil
+	var total int64
+	for _, meta := range metas {
+		if q.match(meta) {
+			total++
+		}
+	}
+	return total
+}
+
+// runFileQuery 解码游标、多取一条判断是否有下一页，并生成下一页游标
+func runFileQuery(q FileQuery, find func(q FileQuery, limit int) ([]*FileMetadata, error), count func(q FileQuery) (int64, error)) (*FileQueryResult, error) {
+	if err := q.normalize(); err != nil {
+		return nil, err
+	}
+	if q.Cursor != "" {
+		after, err := decodeCursor(q.Cursor, &q)
+		if err != nil {
+			return nil, err
+		}
+		q.after = after
+	}
+
+	files, err := find(q, q.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &FileQueryResult{Files: files}
+	if len(files) > q.Limit {
+		result.Files = files[:q.Limit]
+		result.NextCursor = encodeCursor(q.cursorOf(result.Files[q.Limit-1]))
+	}
+
+	if q.CountTotal {
+		q.after = nil
+		if result.Total, err = count(q); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// tagPatterns 返回标签在 JSON 列中的两种可能写法：第一个键或跟在逗号后
+// 字符串内的引号和逗号后的引号都会被转义，因此不会误匹配到键或值的内部
+func tagPatterns(k, v string) (string, string) {
+	key, _ := json.Marshal(k)
+	value, _ := json.Marshal(v)
+	pair := string(key) + ":" + string(value)
+	return "{" + pair, "," + pair
+}
+
+// wildcardMatch 通配符匹配，* 匹配任意个字符（包括 /），? 匹配一个字符
+func wildcardMatch(pattern, s string) bool {
+	p, str := []rune(pattern), []rune(s)
+	pi, si := 0, 0
+	star, mark := -1, 0
+	for si < len(str) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == str[si]):
+			pi++
+			si++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, si
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			si = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// 配额范围
+const (
+	QuotaScopeBucket = "bucket" // 文件名第一级目录
+	QuotaScopePrefix = "prefix" // 文件名前缀
+	QuotaScopeTenant = "tenant" // 上传者租户
+)
+
+// Matches 判断文件是否计入该配额
+func (q *Quota) Matches(filename, tenant string) bool {
+	switch q.Scope {
+	case QuotaScopeBucket:
+		return BucketOf(filename) == q.Name
+	case QuotaScopePrefix:
+		return strings.HasPrefix(filename, q.Name)
+	case QuotaScopeTenant:
+		return tenant != "" && tenant == q.Name
+	}
+	return false
+}
+
+// AvailableBytes 返回剩余可用字节数，不限制时返回 -1
+func (q *Quota) AvailableBytes() int64 {
+	if q.MaxBytes <= 0 {
+		return -1
+	}
+	if q.UsedBytes >= q.MaxBytes {
+		return 0
+	}
+	return q.MaxBytes - q.UsedBytes
+}
+
+// ListQuotas 列出所有配额
+func (s *Store) ListQuotas() ([]*Quota, error) {
+	return s.db.ListQuotas()
+}
+
+// GetQuota 获取配额
+func (s *Store) GetQuota(id uint64) (*Quota, error) {
+	return s.db.GetQuota(id)
+}
+
+// SetQuota 新增或修改配额，并按现有文件重新统计用量
+func (s *Store) SetQuota(quota *Quota) error {
+	switch quota.Scope {
+	case QuotaScopeBucket, QuotaScopePrefix, QuotaScopeTenant:
+	default:
+		return fmt.Errorf("unknown quota scope: %s", quota.Scope)
+	}
+
+	bytes, objects, err := s.db.QuotaUsage(quota.Scope, quota.Name)
+	if err != nil {
+		return err
+	}
+	quota.UsedBytes = bytes
+	quota.UsedObjects = objects
+
+	return s.db.SaveQuota(quota)
+}
+
+// DeleteQuota 删除配额
+func (s *Store) DeleteQuota(id uint64) error {
+	return s.db.DeleteQuota(id)
+}
+
+// QuotaFor 返回文件适用的配额中剩余空间最少的一个，没有限制字节数的配额时返回 nil
+func (s *Store) QuotaFor(filename, tenant string) (*Quota, error) {
+	quotas, err := s.matchingQuotas(filename, tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	var tightest *Quota
+	for _, q := range quotas {
+		if q.MaxBytes <= 0 {
+			continue
+		}
+		if tightest == nil || q.AvailableBytes() < tightest.AvailableBytes() {
+			tightest = q
+		}
+	}
+	return tightest, nil
+}
+
+func (s *Store) matchingQuotas(filename, tenant string) ([]*Quota, error) {
+	quotas, err := s.db.ListQuotas()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]*Quota, 0, len(quotas))
+	for _, q := range quotas {
+		if q.Matches(filename, tenant) {
+			matched = append(matched, q)
+		}
+	}
+	return matched, nil
+}
+
+func quotaIDs(quotas []*Quota) []uint64 {
+	ids := make([]uint64, len(quotas))
+	for i, q := range quotas {
+		ids[i] = q.ID
+	}
+	return ids
+}
+
+// chargeQuota 写入前预占配额，超限时返回 ErrQuotaExceeded，返回的 ID 用于写入失败时归还
+func (s *Store) chargeQuota(filename, tenant string, size int64) ([]uint64, error) {
+	quotas, err := s.matchingQuotas(filename, tenant)
+	if err != nil {
+		return nil, err
+	}
+	if len(quotas) == 0 {
+		return nil, nil
+	}
+
+	ids := quotaIDs(quotas)
+	if err := s.db.ChargeQuotas(ids, size, 1); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// refundQuota 归还预占的配额
+func (s *Store) refundQuota(ids []uint64, size int64) {
+	if err := s.db.ReleaseQuotas(ids, size, 1); err != nil {
+		log.Printf("Warning: failed to refund quota: %v", err)
+	}
+}
+
+// releaseQuota 文件删除后释放其占用的配额
+func (s *Store) releaseQuota(meta *FileMetadata) {
+	if meta.DeleteMarker {
+		return
+	}
+	quotas, err := s.matchingQuotas(meta.FileName, meta.Tenant)
+	if err != nil {
+		log.Printf("Warning: failed to release quota of file %d: %v", meta.ID, err)
+		return
+	}
+	if len(quotas) > 0 {
+		s.refundQuota(quotaIDs(quotas), int64(meta.Size))
+	}
+}
@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"encoding/binary"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReconcileConfig 孤立数据检查配置
+type ReconcileConfig struct {
+	Enabled  bool // 是否启用定时检查
+	Interval int  // 检查间隔（秒）
+	Grace    int  // 只检查早于该秒数写入的数据，避免误判正在提交的写入
+	Repair   bool // 是否自动修复
+}
+
+// OrphanNeedle Volume 中没有任何文件元数据引用的 Needle
+type OrphanNeedle struct {
+	ID       uint64 `json:"id"`
+	VolumeID uint32 `json:"volume_id"`
+	Offset   int64  `json:"offset"`
+	Size     int64  `json:"size"`
+	Indexed  bool   `json:"indexed"` // 仍在内存索引中且未打删除标记
+}
+
+// MissingNeedle 元数据存在但 Volume 中找不到数据的文件
+type MissingNeedle struct {
+	FileID   uint64 `json:"file_id"`
+	NeedleID uint64 `json:"needle_id"`
+	VolumeID uint32 `json:"volume_id"`
+	FileName string `json:"filename"`
+}
+
+// ReconcileReport 一次检查的结果
+type ReconcileReport struct {
+	StartTime      int64           `json:"start_time"`
+	EndTime        int64           `json:"end_time"`
+	Repair         bool            `json:"repair"`
+	Volumes        int             `json:"volumes"`
+	Needles        int             `json:"needles"` // 扫描到的 Needle 数
+	Files          int             `json:"files"`   // 检查的文件元数据数
+	OrphanNeedles  []OrphanNeedle  `json:"orphan_needles"`
+	OrphanBytes    int64           `json:"orphan_bytes"`
+	MissingNeedles []MissingNeedle `json:"missing_needles"`
+	Tombstoned     []uint64        `json:"tombstoned"` // 已打删除标记、等待压缩回收的孤立 Needle
+	Reindexed      []uint64        `json:"reindexed"`  // 在 Volume 中找到并重新加入索引的 Needle
+	Error          string          `json:"error,omitempty"`
+}
+
+type reconciler struct {
+	mu     sync.Mutex
+	report *ReconcileReport
+}
+
+// needleLocation 扫描 Volume 文件得到的 Needle 位置
+type needleLocation struct {
+	vol        *Volume
+	offset     int64
+	size       int64
+	createTime int64
+}
+
+// StartReconciler 定时检查孤立的 Needle 和丢失数据的文件
+func (s *Store) StartReconciler(cfg ReconcileConfig) {
+	if !cfg.Enabled {
+		return
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 3600
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+		defer ticker.Stop()
+
+		log.Printf("Reconciler started, interval: %d seconds, repair: %t", cfg.Interval, cfg.Repair)
+
+		for range ticker.C {
+			if _, err := s.Reconcile(cfg.Grace, cfg.Repair); err != nil {
+				log.Printf("Reconcile error: %v", err)
+			}
+		}
+	}()
+}
+
+// ReconcileReport 返回最近一次检查的结果
+func (s *Store) ReconcileReport() *ReconcileReport {
+	s.reconciler.mu.Lock()
+	defer s.reconciler.mu.Unlock()
+	return s.reconciler.report
+}
+
+// Reconcile 扫描所有 Volume 文件并与元数据比对
+// 没有元数据引用的 Needle 打删除标记等待压缩回收；元数据指向的 Needle 不在索引中时，
+// 若在原 Volume 中找到则重新加入索引，否则只报告
+func (s *Store) Reconcile(grace int, repair bool) (*ReconcileReport, error) {
+	s.reconciler.mu.Lock()
+	defer s.reconciler.mu.Unlock()
+
+	report := &ReconcileReport{
+		StartTime:      time.Now().Unix(),
+		Repair:         repair,
+		OrphanNeedles:  []OrphanNeedle{},
+		MissingNeedles: []MissingNeedle{},
+		Tombstoned:     []uint64{},
+		Reindexed:      []uint64{},
+	}
+	cutoff := report.StartTime - int64(grace)
+	finish := func(err error) (*ReconcileReport, error) {
+		report.EndTime = time.Now().Unix()
+		if err != nil {
+			report.Error = err.Error()
+		}
+		s.reconciler.report = report
+		return report, err
+	}
+
+	// 扫描期间不阻塞写入，修复前再暂停写入复核
+	s.mu.RLock()
+	volumes := make([]*Volume, 0, len(s.volumes))
+	for _, vol := range s.volumes {
+		volumes = append(volumes, vol)
+	}
+	s.mu.RUnlock()
+
+	scanned := make(map[uint64]needleLocation)
+	for _, vol := range volumes {
+		report.Volumes++
+		report.Needles += scanVolume(vol, scanned)
+	}
+
+	metas, err := s.db.LoadAllFileMetadataIncludingDeleted()
+	if err != nil {
+		return finish(err)
+	}
+	report.Files = len(metas)
+
+	referenced := make(map[uint64]bool, len(metas))
+	for _, meta := range metas {
+		referenced[meta.DataNeedleID()] = true
+	}
+
+	orphans := make([]uint64, 0)
+	for id, loc := range scanned {
+		if !referenced[id] && loc.createTime < cutoff {
+			orphans = append(orphans, id)
+		}
+	}
+
+	missing := make([]*FileMetadata, 0)
+	for _, meta := range metas {
+		if meta.Deleted || meta.DeleteMarker || meta.CreateTime >= cutoff {
+			continue
+		}
+		if _, _, found := s.locateNeedle(meta.DataNeedleID()); !found {
+			missing = append(missing, meta)
+		}
+	}
+
+	if len(orphans) == 0 && len(missing) == 0 {
+		return finish(nil)
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	// 复核：扫描之后提交的写入可能已经引用了这些 Needle
+	if len(orphans) > 0 {
+		files, err := s.db.ListFilesByNeedles(orphans)
+		if err != nil {
+			return finish(err)
+		}
+		for _, meta := range files {
+			referenced[meta.DataNeedleID()] = true
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i] < orphans[j] })
+	for _, id := range orphans {
+		if referenced[id] {
+			continue
+		}
+		loc := scanned[id]
+		orphan := OrphanNeedle{ID: id, VolumeID: loc.vol.ID, Offset: loc.offset, Size: loc.size}
+
+		loc.vol.mu.RLock()
+		info, indexed := loc.vol.NeedleIndex[id]
+		orphan.Indexed = indexed && info.Flags&0x01 == 0
+		loc.vol.mu.RUnlock()
+
+		report.OrphanNeedles = append(report.OrphanNeedles, orphan)
+		report.OrphanBytes += loc.size
+
+		// 不在索引中的 Needle 压缩时不会被复制，无需处理
+		if repair && orphan.Indexed && s.currentVolume(loc.vol) {
+			loc.vol.DeleteNeedle(id)
+			s.invalidateCache(0, id)
+			report.Tombstoned = append(report.Tombstoned, id)
+		}
+	}
+
+	for _, meta := range missing {
+		needleID := meta.DataNeedleID()
+		current, err := s.db.GetFileMetadata(meta.ID)
+		if err != nil {
+			continue
+		}
+		if _, _, found := s.locateNeedle(needleID); found {
+			continue
+		}
+
+		loc, onDisk := scanned[needleID]
+		if repair && onDisk && loc.vol.ID == current.VolumeID && s.currentVolume(loc.vol) {
+			loc.vol.mu.Lock()
+			loc.vol.NeedleIndex[needleID] = &NeedleInfo{
+				Offset:   loc.offset,
+				Size:     uint32(loc.size - NeedleHeaderSize - NeedleFooterSize),
+				VolumeID: loc.vol.ID,
+			}
+			loc.vol.mu.Unlock()
+
+			if loc.offset != current.Offset {
+				if err := s.db.UpdateNeedleOffsets(map[uint64]int64{needleID: loc.offset}); err != nil {
+					log.Printf("Failed to update offset of needle %d: %v", needleID, err)
+				}
+			}
+			s.invalidateCache(current.ID, needleID)
+			report.Reindexed = append(report.Reindexed, needleID)
+			continue
+		}
+
+		report.MissingNeedles = append(report.MissingNeedles, MissingNeedle{
+			FileID:   current.ID,
+			NeedleID: needleID,
+			VolumeID: current.VolumeID,
+			FileName: current.FileName,
+		})
+	}
+
+	log.Printf("Reconcile: %d orphan needles (%d bytes, %d tombstoned), %d files missing data, %d reindexed",
+		len(report.OrphanNeedles), report.OrphanBytes, len(report.Tombstoned), len(report.MissingNeedles), len(report.Reindexed))
+	return finish(nil)
+}
+
+// currentVolume 判断扫描时的 Volume 是否仍在使用，压缩或分区删除后会被替换
+func (s *Store) currentVolume(vol *Volume) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.volumes[vol.ID] == vol
+}
+
+// scanVolume 顺序读取 Volume 文件中的 Needle 头，同一 ID 以最后一次出现的位置为准
+// 只读取头部，不校验数据（由反熵检查负责）；遇到无法解析的头部时停止
+func scanVolume(vol *Volume, scanned map[uint64]needleLocation) int {
+	vol.mu.RLock()
+	size := vol.CurrentSize
+	file := vol.File
+	vol.mu.RUnlock()
+
+	header := make([]byte, NeedleHeaderSize)
+	count := 0
+	for offset := int64(0); offset+NeedleHeaderSize <= size; {
+		if _, err := file.ReadAt(header, offset); err != nil && err != io.EOF {
+			log.Printf("Reconcile: failed to read volume %d at %d: %v", vol.ID, offset, err)
+			break
+		}
+
+		id := binary.BigEndian.Uint64(header[0:8])
+		dataSize := int64(binary.BigEndian.Uint32(header[12:16]))
+		createTime := int64(binary.BigEndian.Uint64(header[16:24]))
+		needleSize := NeedleHeaderSize + dataSize + NeedleFooterSize
+		if offset+needleSize > size {
+			log.Printf("Reconcile: volume %d has a truncated needle at %d", vol.ID, offset)
+			break
+		}
+
+		scanned[id] = needleLocation{vol: vol, offset: offset, size: needleSize, createTime: createTime}
+		offset += needleSize
+		count++
+	}
+	return count
+}
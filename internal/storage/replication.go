@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"haystack-lite/internal/config"
+)
+
+// ReplicaIDHeader 副本拉取变更时携带的标识头
+const ReplicaIDHeader = "X-Replica-ID"
+
+// ReplicaStatus 主节点记录的副本确认进度
+type ReplicaStatus struct {
+	ID       string `json:"id"`
+	AckedSeq uint64 `json:"acked_seq"` // 副本已应用的序列号
+	LagSeq   uint64 `json:"lag_seq"`   // 落后主节点的序列号数
+	LastSeen int64  `json:"last_seen"`
+}
+
+// ReplicationStatus 副本同步状态
+type ReplicationStatus struct {
+	Role         string          `json:"role"`
+	Primary      string          `json:"primary,omitempty"`
+	CurrentSeq   uint64          `json:"current_seq"`
+	PrimarySeq   uint64          `json:"primary_seq,omitempty"`   // 最近一次拉取时主节点的序列号
+	LagSeq       uint64          `json:"lag_seq"`                 // 副本落后的序列号数
+	LagSeconds   int64           `json:"lag_seconds"`             // 距最近一次追平主节点的秒数
+	LastSync     int64           `json:"last_sync,omitempty"`     // 最近一次成功拉取的时间
+	SyncErrors   int64           `json:"sync_errors"`             // 累计拉取失败次数
+	LastError    string          `json:"last_error,omitempty"`    // 最近一次失败原因
+	Replicas     []ReplicaStatus `json:"replicas,omitempty"`      // 主节点上已连接的副本
+	WaitForAck   bool            `json:"wait_for_ack,omitempty"`  // 主节点写入是否等待副本确认
+	AckTimeouts  int64           `json:"ack_timeouts,omitempty"`  // 等待副本确认超时次数
+	AppliedFiles int64           `json:"applied_files,omitempty"` // 副本累计应用的文件记录数
+}
+
+type replicationState struct {
+	mu       sync.Mutex
+	replicas map[string]*ReplicaStatus
+	acked    chan struct{} // 副本确认进度前进时关闭
+
+	// 副本端状态
+	primarySeq   uint64
+	lastSync     int64
+	caughtUp     int64 // 已应用的数据在主节点上仍为最新的时刻
+	polling      bool  // 正在长轮询等待主节点的新变更
+	syncErrors   int64
+	lastError    string
+	appliedFiles int64
+	ackTimeouts  int64
+}
+
+// readOnly 判断是否拒绝客户端写入，副本只接受来自主节点的变更
+func (s *Store) readOnly() bool {
+	return s.config.Storage.ReadOnly || s.IsReplica()
+}
+
+// IsReplica 判断当前节点是否为副本
+func (s *Store) IsReplica() bool {
+	return s.config.Replication.Role == config.RoleReplica
+}
+
+// AckReplica 记录副本已应用到 seq 的变更
+func (s *Store) AckReplica(id string, seq uint64) {
+	r := &s.replication
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	replica, exists := r.replicas[id]
+	if !exists {
+		replica = &ReplicaStatus{ID: id}
+		r.replicas[id] = replica
+		log.Printf("Replica %s connected at seq %d", id, seq)
+	}
+	replica.LastSeen = time.Now().Unix()
+	if seq > replica.AckedSeq {
+		replica.AckedSeq = seq
+		close(r.acked)
+		r.acked = make(chan struct{})
+	}
+}
+
+// waitForReplicas 主节点开启 wait_for_ack 时，等待至少一个副本应用到 seq
+func (s *Store) waitForReplicas(seq uint64) error {
+	cfg := s.config.Replication
+	if cfg.Role != config.RolePrimary || !cfg.WaitForAck {
+		return nil
+	}
+
+	timeout := time.NewTimer(time.Duration(cfg.AckTimeout) * time.Second)
+	defer timeout.Stop()
+
+	r := &s.replication
+	for {
+		r.mu.Lock()
+		for _, replica := range r.replicas {
+			if replica.AckedSeq >= seq {
+				r.mu.Unlock()
+				return nil
+			}
+		}
+		acked := r.acked
+		r.mu.Unlock()
+
+		select {
+		case <-acked:
+		case <-timeout.C:
+			atomic.AddInt64(&r.ackTimeouts, 1)
+			return ErrReplicaTimeout
+		}
+	}
+}
+
+// WaitForChanges 等待序列号超过 since 或超时，供副本长轮询使用
+func (s *Store) WaitForChanges(since uint64, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for s.CurrentSeq() <= since {
+		select {
+		case <-s.events.Wait():
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+// ReplicationStatus 返回复制状态
+func (s *Store) ReplicationStatus() ReplicationStatus {
+	cfg := s.config.Replication
+	r := &s.replication
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := s.CurrentSeq()
+	status := ReplicationStatus{
+		Role:       cfg.Role,
+		CurrentSeq: current,
+		SyncErrors: r.syncErrors,
+		LastError:  r.lastError,
+	}
+
+	switch cfg.Role {
+	case config.RoleReplica:
+		status.Primary = cfg.Primary
+		status.PrimarySeq = r.primarySeq
+		status.LastSync = r.lastSync
+		status.AppliedFiles = r.appliedFiles
+		if r.primarySeq > current {
+			status.LagSeq = r.primarySeq - current
+		}
+		// 长轮询期间主节点有新变更会立即返回，此时视为没有延迟
+		if r.caughtUp > 0 && !r.polling {
+			status.LagSeconds = time.Now().Unix() - r.caughtUp
+		}
+	case config.RolePrimary:
+		status.WaitForAck = cfg.WaitForAck
+		status.AckTimeouts = atomic.LoadInt64(&r.ackTimeouts)
+		status.Replicas = make([]ReplicaStatus, 0, len(r.replicas))
+		for _, replica := range r.replicas {
+			rs := *replica
+			if current > rs.AckedSeq {
+				rs.LagSeq = current - rs.AckedSeq
+			}
+			status.Replicas = append(status.Replicas, rs)
+		}
+		sort.Slice(status.Replicas, func(i, j int) bool {
+			return status.Replicas[i].ID < status.Replicas[j].ID
+		})
+	}
+	return status
+}
+
+// StartReplication 副本在后台持续拉取主节点的增量变更并应用
+func (s *Store) StartReplication() {
+	cfg := s.config.Replication
+	switch cfg.Role {
+	case "":
+		return
+	case config.RolePrimary:
+		log.Printf("Replication primary, wait for ack: %t", cfg.WaitForAck)
+		return
+	case config.RoleReplica:
+	default:
+		log.Printf("Unknown replication role: %s", cfg.Role)
+		return
+	}
+
+	if cfg.Primary == "" {
+		log.Println("Replication disabled: primary address not configured")
+		return
+	}
+
+	pollTimeout := time.Duration(cfg.PollTimeout) * time.Second
+	client := &http.Client{Timeout: pollTimeout + 60*time.Second}
+
+	go func() {
+		log.Printf("Replicating from %s as %s, starting at seq %d", cfg.Primary, cfg.ReplicaID, s.CurrentSeq())
+
+		backoff := time.Second
+		for {
+			if err := s.pullChanges(client, cfg, pollTimeout); err != nil {
+				s.replication.mu.Lock()
+				s.replication.syncErrors++
+				s.replication.lastError = err.Error()
+				s.replication.mu.Unlock()
+
+				log.Printf("Replication error: %v", err)
+				time.Sleep(backoff)
+				if backoff < 30*time.Second {
+					backoff *= 2
+				}
+				continue
+			}
+			backoff = time.Second
+		}
+	}()
+}
+
+// pullChanges 从主节点拉取一次增量变更，请求中的 since 同时作为对主节点的确认
+func (s *Store) pullChanges(client *http.Client, cfg config.ReplicationConfig, pollTimeout time.Duration) error {
+	since := s.CurrentSeq()
+	query := url.Values{}
+	query.Set("since", strconv.FormatUint(since, 10))
+	query.Set("wait", strconv.Itoa(int(pollTimeout/time.Second)))
+	endpoint := strings.TrimRight(cfg.Primary, "/") + "/admin/changes?" + query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(ReplicaIDHeader, cfg.ReplicaID)
+
+	r := &s.replication
+	r.mu.Lock()
+	r.polling = r.caughtUp > 0
+	r.mu.Unlock()
+
+	resp, err := client.Do(req)
+	fetched := time.Now().Unix()
+
+	r.mu.Lock()
+	r.polling = false
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("primary returned %s", resp.Status)
+	}
+	until, err := strconv.ParseUint(resp.Header.Get("X-Changes-Until"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid X-Changes-Until header: %w", err)
+	}
+
+	// 与本地写入同样持有写锁的读锁，快照期间暂停应用
+	s.writeMu.RLock()
+	result, err := s.ApplyChanges(resp.Body)
+	if err == nil && until > s.CurrentSeq() {
+		atomic.StoreUint64(&s.seq, until)
+	}
+	s.writeMu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.primarySeq = until
+	r.lastSync = time.Now().Unix()
+	r.caughtUp = fetched
+	r.appliedFiles += int64(result.Applied)
+	r.lastError = ""
+	r.mu.Unlock()
+
+	// 主节点在下一次请求的 since 中得到确认
+	return nil
+}
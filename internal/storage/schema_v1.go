@@ -0,0 +1,126 @@
+package storage
+
+import "time"
+
+// 第 1 版表结构的冻结副本，只用于 baseline 迁移
+// models.go 中的模型之后可以继续演进，但这里不能修改，否则已执行的迁移校验和会失效
+
+type v1FileMetadata struct {
+	ID         uint64    `gorm:"primaryKey;autoIncrement:false"`
+	NeedleID   uint64    `gorm:"index"`
+	VolumeID   uint32    `gorm:"index"`
+	Offset     int64     `gorm:"not null"`
+	Size       uint32    `gorm:"not null"`
+	Cookie     uint32    `gorm:"not null"`
+	Flags      uint8     `gorm:"default:0"`
+	Deleted    bool      `gorm:"default:false;index"`
+	DeleteTime int64     `gorm:"default:0;index"`
+	FileName   string    `gorm:"size:255;index"`
+	MimeType   string    `gorm:"size:100"`
+	Tenant     string    `gorm:"size:64;index"`
+	MD5        string    `gorm:"size:32;index"`
+	SHA256     string    `gorm:"size:64;index"`
+	CreateTime int64     `gorm:"not null"`
+	ExpireTime int64     `gorm:"default:0;index"`
+	Seq        uint64    `gorm:"default:0;index"`
+	UpdateTime time.Time `gorm:"autoUpdateTime"`
+}
+
+func (v1FileMetadata) TableName() string { return "file_metadata" }
+
+type v1NeedleRef struct {
+	NeedleID uint64 `gorm:"primaryKey;autoIncrement:false"`
+	VolumeID uint32 `gorm:"not null"`
+	Size     uint32 `gorm:"not null"`
+	MD5      string `gorm:"size:32;index"`
+	SHA256   string `gorm:"size:64"`
+	RefCount int64  `gorm:"default:0"`
+}
+
+func (v1NeedleRef) TableName() string { return "needle_refs" }
+
+type v1VolumeInfo struct {
+	ID            uint32    `gorm:"primaryKey;autoIncrement:false"`
+	FilePath      string    `gorm:"size:255;not null"`
+	MaxSize       int64     `gorm:"not null"`
+	CurrentSize   int64     `gorm:"default:0"`
+	Active        bool      `gorm:"default:true;index"`
+	ExpiryBucket  int64     `gorm:"default:0;index"`
+	MaxExpireTime int64     `gorm:"default:0"`
+	CreateTime    time.Time `gorm:"autoCreateTime"`
+	UpdateTime    time.Time `gorm:"autoUpdateTime"`
+}
+
+func (v1VolumeInfo) TableName() string { return "volume_info" }
+
+type v1BucketSettings struct {
+	Name         string    `gorm:"primaryKey;size:255"`
+	KeepVersions int       `gorm:"not null"`
+	UpdateTime   time.Time `gorm:"autoUpdateTime"`
+}
+
+func (v1BucketSettings) TableName() string { return "bucket_settings" }
+
+type v1LifecycleRule struct {
+	ID         uint64    `gorm:"primaryKey"`
+	Bucket     string    `gorm:"size:255;index"`
+	RuleID     string    `gorm:"size:255"`
+	Prefix     string    `gorm:"size:255;not null"`
+	ExpireDays int       `gorm:"not null"`
+	Enabled    bool      `gorm:"default:true"`
+	CreateTime time.Time `gorm:"autoCreateTime"`
+}
+
+func (v1LifecycleRule) TableName() string { return "lifecycle_rules" }
+
+type v1Quota struct {
+	ID          uint64    `gorm:"primaryKey"`
+	Scope       string    `gorm:"size:16;not null;uniqueIndex:idx_quota_scope_name"`
+	Name        string    `gorm:"size:255;not null;uniqueIndex:idx_quota_scope_name"`
+	MaxBytes    int64     `gorm:"default:0"`
+	MaxObjects  int64     `gorm:"default:0"`
+	UsedBytes   int64     `gorm:"default:0"`
+	UsedObjects int64     `gorm:"default:0"`
+	CreateTime  time.Time `gorm:"autoCreateTime"`
+	UpdateTime  time.Time `gorm:"autoUpdateTime"`
+}
+
+func (v1Quota) TableName() string { return "quotas" }
+
+type v1Webhook struct {
+	ID         uint64    `gorm:"primaryKey"`
+	URL        string    `gorm:"size:1024;not null"`
+	Secret     string    `gorm:"size:255"`
+	Bucket     string    `gorm:"size:255"`
+	Prefix     string    `gorm:"size:255"`
+	Events     string    `gorm:"size:255"`
+	Enabled    bool      `gorm:"default:true"`
+	CreateTime time.Time `gorm:"autoCreateTime"`
+	UpdateTime time.Time `gorm:"autoUpdateTime"`
+}
+
+func (v1Webhook) TableName() string { return "webhooks" }
+
+type v1WebhookDelivery struct {
+	ID           uint64    `gorm:"primaryKey"`
+	WebhookID    uint64    `gorm:"index;not null"`
+	EventType    string    `gorm:"size:32;not null"`
+	FileID       uint64    `gorm:"index"`
+	Payload      string    `gorm:"type:text;not null"`
+	Status       string    `gorm:"size:16;not null;index:idx_delivery_due"`
+	Attempts     int       `gorm:"default:0"`
+	NextAttempt  int64     `gorm:"default:0;index:idx_delivery_due"`
+	ResponseCode int       `gorm:"default:0"`
+	LastError    string    `gorm:"size:1024"`
+	CreateTime   time.Time `gorm:"autoCreateTime"`
+	UpdateTime   time.Time `gorm:"autoUpdateTime"`
+}
+
+func (v1WebhookDelivery) TableName() string { return "webhook_deliveries" }
+
+type v1IDSequence struct {
+	Name string `gorm:"primaryKey;size:64"`
+	Next uint64 `gorm:"column:next_value;not null"`
+}
+
+func (v1IDSequence) TableName() string { return "id_sequences" }
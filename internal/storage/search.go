@@ -0,0 +1,328 @@
+package storage
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// SearchConfig 全文索引配置
+type SearchConfig struct {
+	Enabled     bool
+	Path        string // 索引文件路径
+	MaxFileSize int64  // 超过该大小的文件不建索引（字节）
+	Interval    int    // 没有写入通知时检查变更的间隔（秒）
+	BatchSize   int    // 每次从数据库读取的序列号范围
+}
+
+// SearchResult 全文检索结果
+type SearchResult struct {
+	Total int // 匹配且仍然存在的文件数
+	Hits  []*SearchMatch
+}
+
+// SearchMatch 一个匹配的文件
+type SearchMatch struct {
+	Meta    *FileMetadata
+	Score   float64
+	Snippet string
+}
+
+// SearchStats 索引状态
+type SearchStats struct {
+	Documents  uint64 `json:"documents"`
+	IndexedSeq uint64 `json:"indexed_seq"`
+	CurrentSeq uint64 `json:"current_seq"`
+}
+
+// snippetWidth 摘要的字符数
+const snippetWidth = 160
+
+type searchIndexer struct {
+	cfg   SearchConfig
+	index *searchIndex
+	mu    sync.Mutex // 串行化后台索引和检索时对失效条目的清理
+}
+
+// StartSearch 打开全文索引并在后台按序列号增量更新
+// 索引只依赖文件元数据的序列号，写入、删除、覆盖和复制过来的变更都会被处理，重启后从上次的位置继续
+func (s *Store) StartSearch(cfg SearchConfig) {
+	if !cfg.Enabled {
+		return
+	}
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = 1 << 20
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+
+	index, err := openSearchIndex(cfg.Path)
+	if err != nil {
+		log.Printf("Warning: full-text search disabled: %v", err)
+		return
+	}
+	s.search = &searchIndexer{cfg: cfg, index: index}
+
+	go s.searchLoop()
+
+	log.Printf("Full-text search started, index: %s, max file size: %d", cfg.Path, cfg.MaxFileSize)
+}
+
+// searchLoop 有新事件或定时器到期时处理新的变更
+func (s *Store) searchLoop() {
+	ticker := time.NewTicker(time.Duration(s.search.cfg.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		wait := s.events.Wait()
+		if err := s.indexChanges(); err != nil {
+			log.Printf("Search indexing error: %v", err)
+		}
+		select {
+		case <-wait:
+		case <-ticker.C:
+		}
+	}
+}
+
+// indexChanges 处理已索引序列号之后的所有变更
+func (s *Store) indexChanges() error {
+	index := s.search.index
+	since, err := index.indexedSeq()
+	if err != nil {
+		return err
+	}
+
+	// 截止到已结束写入的序列号，尚未提交的变更留到下一轮，不暂停写入
+	until := s.committedSeq()
+
+	// 元数据被恢复到更早的状态（如从快照恢复）时重建索引
+	if since > until {
+		log.Printf("Search index is ahead of metadata (seq %d > %d), rebuilding", since, until)
+		if err := index.reset(); err != nil {
+			return err
+		}
+		since = 0
+	}
+
+	for since < until {
+		end := since + uint64(s.search.cfg.BatchSize)
+		if end > until {
+			end = until
+		}
+		files, err := s.db.ListChanges(since, end)
+		if err != nil {
+			return err
+		}
+		for i := range files {
+			s.search.mu.Lock()
+			err := s.indexFile(&files[i])
+			s.search.mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		if err := index.setIndexedSeq(end); err != nil {
+			return err
+		}
+		since = end
+	}
+	return nil
+}
+
+// indexFile 按文件的当前状态更新索引
+func (s *Store) indexFile(meta *FileMetadata) error {
+	index := s.search.index
+	if !meta.Deleted && !s.searchable(meta) {
+		// 文本文件被覆盖为不建索引的内容时，旧版本不应再被搜到
+		return index.supersede(meta.FileName, meta.ID)
+	}
+	if meta.Deleted {
+		return s.unindexFile(meta.ID)
+	}
+
+	exists, err := index.has(meta.ID)
+	if err != nil || exists {
+		return err
+	}
+
+	data, err := s.readNeedle(meta.DataNeedleID())
+	if err != nil {
+		log.Printf("Warning: search indexer skipped file %d: %v", meta.ID, err)
+		return nil
+	}
+	tokens := tokenize(strings.ToValidUTF8(string(data), " "), false)
+	freqs := make(map[string]int)
+	for _, t := range tokens {
+		freqs[t]++
+	}
+	return index.add(meta.ID, meta.FileName, freqs, len(tokens))
+}
+
+// unindexFile 从索引中删除文件，删除的是最新版本时，仍然存在的上一个版本成为最新版本
+func (s *Store) unindexFile(id uint64) error {
+	name, err := s.search.index.remove(id)
+	if err != nil || name == "" {
+		return err
+	}
+	latest, err := s.db.FindByFilename(name)
+	if err != nil || latest.ID == id {
+		return nil
+	}
+	return s.indexFile(latest)
+}
+
+// searchable 是否为需要建索引的文本文件
+func (s *Store) searchable(meta *FileMetadata) bool {
+	if meta.Size == 0 || int64(meta.Size) > s.search.cfg.MaxFileSize {
+		return false
+	}
+	return IsTextMimeType(meta.MimeType)
+}
+
+// IsTextMimeType 判断 MIME 类型是否为文本：text/*、JSON、XML、JavaScript 及 +json、+xml 后缀
+func IsTextMimeType(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-yaml", "application/yaml":
+		return true
+	}
+	return false
+}
+
+// Search 在全文索引中查找包含 query 中所有词的文件，按相关度排序，跳过 offset 条后最多返回 limit 条
+func (s *Store) Search(query string, offset, limit int) (*SearchResult, error) {
+	if s.search == nil {
+		return nil, ErrSearchDisabled
+	}
+
+	terms := uniqueTerms(tokenize(query, true))
+	if len(terms) == 0 {
+		return nil, ErrInvalidQuery
+	}
+	hits, err := s.search.index.query(terms)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每个命中都检查元数据，Total 只统计仍然存在的文件
+	result := &SearchResult{Hits: make([]*SearchMatch, 0)}
+	for _, hit := range hits {
+		meta, err := s.GetMetadata(hit.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 索引在后台更新，可能仍包含刚删除的文件；按分区或 TTL 整体删除的记录不会出现在变更中，只能在这里清理
+			s.search.mu.Lock()
+			err = s.unindexFile(hit.ID)
+			s.search.mu.Unlock()
+			if err != nil {
+				log.Printf("Warning: failed to purge file %d from search index: %v", hit.ID, err)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result.Total++
+		if result.Total <= offset || len(result.Hits) >= limit {
+			continue
+		}
+
+		match := &SearchMatch{Meta: meta, Score: hit.Score}
+		if data, err := s.readNeedle(meta.DataNeedleID()); err == nil {
+			match.Snippet = snippet(strings.ToValidUTF8(string(data), " "), terms, snippetWidth)
+		}
+		result.Hits = append(result.Hits, match)
+	}
+	return result, nil
+}
+
+// SearchStats 返回索引状态，未启用全文检索时返回 nil
+func (s *Store) SearchStats() *SearchStats {
+	if s.search == nil {
+		return nil
+	}
+	docs, seq, err := s.search.index.stats()
+	if err != nil {
+		log.Printf("Warning: failed to read search index stats: %v", err)
+	}
+	return &SearchStats{Documents: docs, IndexedSeq: seq, CurrentSeq: s.CurrentSeq()}
+}
+
+func uniqueTerms(tokens []string) []string {
+	seen := make(map[string]bool, len(tokens))
+	terms := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// snippet 截取第一个匹配词附近的文本，连续的空白合并为一个空格
+func snippet(text string, terms []string, width int) string {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	pos := -1
+	for _, term := range terms {
+		if i := indexRunes(lower, []rune(term)); i >= 0 && (pos < 0 || i < pos) {
+			pos = i
+		}
+	}
+	start := 0
+	if pos > width/4 {
+		start = pos - width/4
+	}
+	end := start + width
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	s := strings.Join(strings.Fields(string(runes[start:end])), " ")
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(runes) {
+		s += "…"
+	}
+	return s
+}
+
+// indexRunes 返回 sub 在 s 中第一次出现的位置
+func indexRunes(s, sub []rune) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		j := 0
+		for j < len(sub) && s[i+j] == sub[j] {
+			j++
+		}
+		if j == len(sub) {
+			return i
+		}
+	}
+	return -1
+}
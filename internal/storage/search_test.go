@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"haystack-lite/internal/config"
+)
+
+// enableTestSearch 打开全文索引但不启动后台循环，测试中手动调用 indexChanges
+func enableTestSearch(t *testing.T, s *Store) {
+	t.Helper()
+	index, err := openSearchIndex(filepath.Join(t.TempDir(), "search.bolt"))
+	if err != nil {
+		t.Fatalf("openSearchIndex: %v", err)
+	}
+	s.search = &searchIndexer{cfg: SearchConfig{MaxFileSize: 1 << 20, BatchSize: 500}, index: index}
+}
+
+// 未结束的写入之后的变更不会被处理，已结束的序列号之前没有空洞
+func TestCommittedSeq(t *testing.T) {
+	s := newTestStore(t, config.DatabaseSQLite)
+	base := s.CurrentSeq()
+
+	first, second := s.nextSeq(), s.nextSeq()
+	s.doneSeq(second)
+	if got := s.committedSeq(); got != base {
+		t.Errorf("committedSeq with %d pending = %d, want %d", first, got, base)
+	}
+	s.doneSeq(first)
+	if got := s.committedSeq(); got != second {
+		t.Errorf("committedSeq = %d, want %d", got, second)
+	}
+}
+
+// 元数据被直接删除（分区、TTL）的文件不会出现在变更中，检索时清理且不计入 Total
+func TestSearchPurgesDroppedFiles(t *testing.T) {
+	s := newTestStore(t, config.DatabaseSQLite)
+	enableTestSearch(t, s)
+
+	ids := make([]uint64, 0)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		id, err := s.WriteWithMetadata([]byte("the quick brown fox in "+name), name, "text/plain")
+		if err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		ids = append(ids, id)
+	}
+	if err := s.indexChanges(); err != nil {
+		t.Fatalf("indexChanges: %v", err)
+	}
+	result, err := s.Search("quick fox", 0, 10)
+	if err != nil || result.Total != 3 {
+		t.Fatalf("Search = %+v, %v, want 3 hits", result, err)
+	}
+
+	if err := s.db.(*Database).db.Delete(&FileMetadata{}, ids[1]).Error; err != nil {
+		t.Fatalf("drop metadata: %v", err)
+	}
+	result, err = s.Search("quick fox", 1, 10)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if result.Total != 2 || len(result.Hits) != 1 {
+		t.Errorf("Search after drop: total = %d, hits = %d, want 2 and 1", result.Total, len(result.Hits))
+	}
+	if docs, _, _ := s.search.index.stats(); docs != 2 {
+		t.Errorf("indexed documents = %d, want 2", docs)
+	}
+}
@@ -0,0 +1,381 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"unicode"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// 全文索引文件中的 Bucket
+var (
+	searchPostings = []byte("postings") // 词 + 0x00 + 文件 ID -> 词频
+	searchDocs     = []byte("docs")     // 文件 ID -> 文件名和包含的词，删除时用于清理倒排表
+	searchLengths  = []byte("lengths")  // 文件 ID -> 词数，用于 BM25 的长度归一化
+	searchNames    = []byte("names")    // 文件名 -> 已索引的最新版本 ID
+	searchMeta     = []byte("meta")     // 已索引的序列号和统计
+)
+
+var searchAllBuckets = [][]byte{searchPostings, searchDocs, searchLengths, searchNames, searchMeta}
+
+var (
+	searchSeqKey    = []byte("seq")
+	searchDocsKey   = []byte("docs")
+	searchTokensKey = []byte("tokens")
+)
+
+// maxTermLength 超过该字节数的词不建索引（多为 Base64、哈希等无意义的长串）
+const maxTermLength = 64
+
+// BM25 参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// searchIndex 基于 bbolt 的倒排索引，每个文件名只索引最新版本
+// 文件内容按 ID 不可变，同一 ID 只需索引一次
+type searchIndex struct {
+	db *bolt.DB
+}
+
+// searchDoc 已索引文件的记录
+type searchDoc struct {
+	Name  string   `json:"n,omitempty"`
+	Terms []string `json:"t"`
+}
+
+func openSearchIndex(path string) (*searchIndex, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open search index: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range searchAllBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &searchIndex{db: db}, nil
+}
+
+func (x *searchIndex) Close() error {
+	return x.db.Close()
+}
+
+func getCounter(b *bolt.Bucket, key []byte) uint64 {
+	if v := b.Get(key); v != nil {
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+func addCounter(b *bolt.Bucket, key []byte, delta int64) error {
+	return b.Put(key, u64Key(uint64(int64(getCounter(b, key))+delta)))
+}
+
+// indexedSeq 返回已处理到的序列号
+func (x *searchIndex) indexedSeq() (uint64, error) {
+	var seq uint64
+	err := x.db.View(func(tx *bolt.Tx) error {
+		seq = getCounter(tx.Bucket(searchMeta), searchSeqKey)
+		return nil
+	})
+	return seq, err
+}
+
+func (x *searchIndex) setIndexedSeq(seq uint64) error {
+	return x.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(searchMeta).Put(searchSeqKey, u64Key(seq))
+	})
+}
+
+// reset 清空索引，之后从序列号 0 重建
+func (x *searchIndex) reset() error {
+	return x.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range searchAllBuckets {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// has 文件是否已索引
+func (x *searchIndex) has(id uint64) (bool, error) {
+	var exists bool
+	err := x.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(searchDocs).Get(u64Key(id)) != nil
+		return nil
+	})
+	return exists, err
+}
+
+// add 索引文件的词频，替换同名的旧版本；已有更新的同名版本时不索引
+func (x *searchIndex) add(id uint64, name string, freqs map[string]int, length int) error {
+	return x.db.Update(func(tx *bolt.Tx) error {
+		names := tx.Bucket(searchNames)
+		if name != "" {
+			if v := names.Get([]byte(name)); v != nil {
+				current := binary.BigEndian.Uint64(v)
+				if current > id {
+					return nil
+				}
+				if _, err := removeSearchDoc(tx, current); err != nil {
+					return err
+				}
+			}
+			if err := names.Put([]byte(name), u64Key(id)); err != nil {
+				return err
+			}
+		}
+
+		doc := searchDoc{Name: name, Terms: make([]string, 0, len(freqs))}
+		postings := tx.Bucket(searchPostings)
+		for term, tf := range freqs {
+			doc.Terms = append(doc.Terms, term)
+			if err := postings.Put(nameKey(term, id), binary.AppendUvarint(nil, uint64(tf))); err != nil {
+				return err
+			}
+		}
+		if err := boltPut(tx.Bucket(searchDocs), u64Key(id), &doc); err != nil {
+			return err
+		}
+		if err := tx.Bucket(searchLengths).Put(u64Key(id), binary.AppendUvarint(nil, uint64(length))); err != nil {
+			return err
+		}
+
+		meta := tx.Bucket(searchMeta)
+		if err := addCounter(meta, searchDocsKey, 1); err != nil {
+			return err
+		}
+		return addCounter(meta, searchTokensKey, int64(length))
+	})
+}
+
+// remove 从索引中删除文件，返回它作为最新版本时的文件名，以便重新索引仍然存在的旧版本
+func (x *searchIndex) remove(id uint64) (string, error) {
+	var name string
+	err := x.db.Update(func(tx *bolt.Tx) error {
+		doc, err := removeSearchDoc(tx, id)
+		if err != nil || doc == nil || doc.Name == "" {
+			return err
+		}
+		names := tx.Bucket(searchNames)
+		if v := names.Get([]byte(doc.Name)); v != nil && binary.BigEndian.Uint64(v) == id {
+			name = doc.Name
+			return names.Delete([]byte(doc.Name))
+		}
+		return nil
+	})
+	return name, err
+}
+
+// supersede 同名文件有了不建索引的新版本，删除已索引的旧版本
+func (x *searchIndex) supersede(name string, id uint64) error {
+	if name == "" {
+		return nil
+	}
+	return x.db.Update(func(tx *bolt.Tx) error {
+		names := tx.Bucket(searchNames)
+		v := names.Get([]byte(name))
+		if v == nil || binary.BigEndian.Uint64(v) >= id {
+			return nil
+		}
+		if _, err := removeSearchDoc(tx, binary.BigEndian.Uint64(v)); err != nil {
+			return err
+		}
+		return names.Delete([]byte(name))
+	})
+}
+
+// removeSearchDoc 删除文件的倒排记录，不修改文件名映射；文件未索引时返回 nil
+func removeSearchDoc(tx *bolt.Tx, id uint64) (*searchDoc, error) {
+	docs := tx.Bucket(searchDocs)
+	var doc searchDoc
+	found, err := boltGet(docs, u64Key(id), &doc)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	postings := tx.Bucket(searchPostings)
+	for _, term := range doc.Terms {
+		if err := postings.Delete(nameKey(term, id)); err != nil {
+			return nil, err
+		}
+	}
+
+	lengths := tx.Bucket(searchLengths)
+	length, _ := binary.Uvarint(lengths.Get(u64Key(id)))
+	if err := lengths.Delete(u64Key(id)); err != nil {
+		return nil, err
+	}
+	if err := docs.Delete(u64Key(id)); err != nil {
+		return nil, err
+	}
+
+	meta := tx.Bucket(searchMeta)
+	if err := addCounter(meta, searchDocsKey, -1); err != nil {
+		return nil, err
+	}
+	return &doc, addCounter(meta, searchTokensKey, -int64(length))
+}
+
+// searchHit 匹配的文件和相关度
+type searchHit struct {
+	ID    uint64
+	Score float64
+}
+
+// query 返回包含所有词的文件，按 BM25 相关度从高到低排序
+func (x *searchIndex) query(terms []string) ([]searchHit, error) {
+	var hits []searchHit
+	err := x.db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(searchMeta)
+		docs := float64(getCounter(meta, searchDocsKey))
+		if docs == 0 {
+			return nil
+		}
+		avgLength := float64(getCounter(meta, searchTokensKey)) / docs
+
+		// 每个词的倒排表：文件 ID -> 词频
+		postings := tx.Bucket(searchPostings)
+		lists := make([]map[uint64]int, 0, len(terms))
+		for _, term := range terms {
+			list := make(map[uint64]int)
+			prefix := joinKey([]byte(term), []byte{0})
+			err := scanPrefix(postings, prefix, func(k, v []byte) (bool, error) {
+				tf, _ := binary.Uvarint(v)
+				list[keyID(k)] = int(tf)
+				return true, nil
+			})
+			if err != nil {
+				return err
+			}
+			if len(list) == 0 {
+				return nil
+			}
+			lists = append(lists, list)
+		}
+
+		// 从最短的倒排表开始求交集
+		sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+		lengths := tx.Bucket(searchLengths)
+		for id := range lists[0] {
+			score := 0.0
+			length, _ := binary.Uvarint(lengths.Get(u64Key(id)))
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(length)/avgLength)
+			for _, list := range lists {
+				tf, ok := list[id]
+				if !ok {
+					score = -1
+					break
+				}
+				df := float64(len(list))
+				idf := math.Log(1 + (docs-df+0.5)/(df+0.5))
+				score += idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + norm)
+			}
+			if score >= 0 {
+				hits = append(hits, searchHit{ID: id, Score: score})
+			}
+		}
+		return nil
+	})
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID > hits[j].ID
+	})
+	return hits, err
+}
+
+// stats 返回已索引的文件数和序列号
+func (x *searchIndex) stats() (docs, seq uint64, err error) {
+	err = x.db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(searchMeta)
+		docs = getCounter(meta, searchDocsKey)
+		seq = getCounter(meta, searchSeqKey)
+		return nil
+	})
+	return docs, seq, err
+}
+
+// isCJK 中日韩文字没有空格分词，按字和相邻两字建索引
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// tokenize 把文本切分为小写的词
+// 字母、数字组成的连续串为一个词；中日韩文字建索引时输出单字和相邻两字，
+// 查询时只输出相邻两字（单个字时输出单字），多字查询因此近似为短语匹配
+func tokenize(text string, query bool) []string {
+	tokens := make([]string, 0)
+	word := make([]rune, 0, 16)
+	cjk := make([]rune, 0, 16)
+
+	flushWord := func() {
+		if len(word) > 0 {
+			if t := string(word); len(t) <= maxTermLength {
+				tokens = append(tokens, t)
+			}
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			tokens = append(tokens, string(cjk))
+		} else {
+			for i := range cjk {
+				if !query {
+					tokens = append(tokens, string(cjk[i]))
+				}
+				if i+1 < len(cjk) {
+					tokens = append(tokens, string(cjk[i:i+2]))
+				}
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range text {
+		r = unicode.ToLower(r)
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
@@ -0,0 +1,500 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"haystack-lite/internal/config"
+)
+
+const (
+	snapshotManifestFile = "manifest.json"
+	snapshotMetadataFile = "metadata.json"
+)
+
+// SnapshotVolume 快照中的 Volume 文件
+type SnapshotVolume struct {
+	ID     uint32 `json:"id"`
+	File   string `json:"file"`
+	Size   int64  `json:"size"`   // 快照时刻的有效长度
+	SHA256 string `json:"sha256"` // 前 Size 字节的摘要
+	Linked bool   `json:"linked"` // 已写满的 Volume 通过硬链接保存
+}
+
+// SnapshotManifest 快照清单
+type SnapshotManifest struct {
+	Name           string           `json:"name"`
+	CreateTime     int64            `json:"create_time"`
+	NextID         uint64           `json:"next_id"`
+	Seq            uint64           `json:"seq"` // 快照时刻的序列号，作为增量备份的起点
+	Volumes        []SnapshotVolume `json:"volumes"`
+	Metadata       string           `json:"metadata"`
+	MetadataSHA256 string           `json:"metadata_sha256"`
+	Path           string           `json:"path,omitempty"` // 快照目录或压缩包路径，不写入清单文件
+}
+
+// MetadataDump 元数据库的完整导出
+type MetadataDump struct {
+	Files          []FileMetadata   `json:"files"`
+	Volumes        []VolumeInfo     `json:"volumes"`
+	NeedleRefs     []NeedleRef      `json:"needle_refs"`
+	BucketSettings []BucketSettings `json:"bucket_settings"`
+	LifecycleRules []LifecycleRule  `json:"lifecycle_rules"`
+	Quotas         []Quota          `json:"quotas"`
+	Webhooks       []Webhook        `json:"webhooks"`
+	IDSequences    []IDSequence     `json:"id_sequences"` // ID 租用位置，恢复后不会重新分配已租出的 ID
+}
+
+// snapshotSource 快照时刻打开的 Volume 文件，解除写入暂停后再复制
+type snapshotSource struct {
+	vol  SnapshotVolume
+	file *os.File
+}
+
+// SnapshotDir 返回配置的快照输出目录
+func (s *Store) SnapshotDir() string {
+	if s.config.Snapshot.Dir == "" {
+		return "./snapshots"
+	}
+	return s.config.Snapshot.Dir
+}
+
+// Snapshot 在 dir 下创建一致性快照，archive 为 true 时打包为 tar.gz
+// 快照期间短暂暂停写入：记录各 Volume 长度、导出元数据并为已写满的 Volume 建立硬链接，
+// 未写满的 Volume 在恢复写入后按记录的长度复制
+func (s *Store) Snapshot(dir string, archive bool) (*SnapshotManifest, error) {
+	now := time.Now()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// 同一秒内多次快照时追加序号
+	name := "snapshot-" + now.Format("20060102-150405")
+	target := filepath.Join(dir, name)
+	for i := 1; ; i++ {
+		err := os.Mkdir(target, 0755)
+		if err == nil && !fileExists(target+".tar.gz") {
+			break
+		}
+		if err == nil {
+			os.Remove(target)
+		} else if !os.IsExist(err) {
+			return nil, err
+		}
+		name = fmt.Sprintf("snapshot-%s-%d", now.Format("20060102-150405"), i)
+		target = filepath.Join(dir, name)
+	}
+
+	manifest := &SnapshotManifest{
+		Name:       name,
+		CreateTime: now.Unix(),
+		Metadata:   snapshotMetadataFile,
+	}
+
+	sources, err := s.freezeSnapshot(target, manifest)
+	defer func() {
+		for _, src := range sources {
+			src.file.Close()
+		}
+	}()
+	if err != nil {
+		os.RemoveAll(target)
+		return nil, err
+	}
+
+	for _, src := range sources {
+		vol, err := copySnapshotVolume(src, target)
+		if err != nil {
+			os.RemoveAll(target)
+			return nil, fmt.Errorf("failed to snapshot volume %d: %w", src.vol.ID, err)
+		}
+		manifest.Volumes = append(manifest.Volumes, vol)
+	}
+
+	if err := writeJSONFile(filepath.Join(target, snapshotManifestFile), manifest); err != nil {
+		os.RemoveAll(target)
+		return nil, err
+	}
+	manifest.Path = target
+
+	if archive {
+		path, err := packSnapshot(target)
+		if err != nil {
+			return nil, err
+		}
+		os.RemoveAll(target)
+		manifest.Path = path
+	}
+
+	log.Printf("Snapshot created: %s (%d volumes)", manifest.Path, len(manifest.Volumes))
+	return manifest, nil
+}
+
+// freezeSnapshot 暂停写入和压缩，记录一致的 Volume 长度和元数据
+func (s *Store) freezeSnapshot(target string, manifest *SnapshotManifest) ([]*snapshotSource, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.mu.RLock()
+	volumes := make([]*Volume, 0, len(s.volumes))
+	for _, vol := range s.volumes {
+		volumes = append(volumes, vol)
+	}
+	manifest.NextID = s.ids.Peek()
+	manifest.Seq = s.CurrentSeq()
+	s.mu.RUnlock()
+
+	sources := make([]*snapshotSource, 0, len(volumes))
+	for _, vol := range volumes {
+		if err := vol.Sync(); err != nil {
+			return sources, err
+		}
+
+		vol.mu.RLock()
+		sv := SnapshotVolume{
+			ID:   vol.ID,
+			File: filepath.Base(vol.FilePath),
+			Size: vol.CurrentSize,
+		}
+		sealed := !vol.Active
+		vol.mu.RUnlock()
+
+		// 先打开文件，之后即使压缩替换了 Volume 文件仍能读到快照时刻的内容
+		file, err := os.Open(vol.FilePath)
+		if err != nil {
+			return sources, err
+		}
+		// 已写满的 Volume 不再追加，硬链接即可；跨文件系统时退回到复制
+		if sealed {
+			sv.Linked = os.Link(vol.FilePath, filepath.Join(target, sv.File)) == nil
+		}
+		sources = append(sources, &snapshotSource{vol: sv, file: file})
+	}
+
+	dump, err := s.db.DumpMetadata()
+	if err != nil {
+		return sources, fmt.Errorf("failed to dump metadata: %w", err)
+	}
+	metadataPath := filepath.Join(target, snapshotMetadataFile)
+	if err := writeJSONFile(metadataPath, dump); err != nil {
+		return sources, err
+	}
+	manifest.MetadataSHA256, err = fileSHA256(metadataPath)
+	return sources, err
+}
+
+// copySnapshotVolume 复制 Volume 的有效部分并计算摘要
+func copySnapshotVolume(src *snapshotSource, target string) (SnapshotVolume, error) {
+	vol := src.vol
+	reader := io.NewSectionReader(src.file, 0, vol.Size)
+	hash := sha256.New()
+
+	if vol.Linked {
+		if _, err := io.Copy(hash, reader); err != nil {
+			return vol, err
+		}
+	} else {
+		out, err := os.Create(filepath.Join(target, vol.File))
+		if err != nil {
+			return vol, err
+		}
+		_, err = io.Copy(io.MultiWriter(out, hash), reader)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return vol, err
+		}
+	}
+
+	vol.SHA256 = fmt.Sprintf("%x", hash.Sum(nil))
+	return vol, nil
+}
+
+// RestoreSnapshot 从快照目录或 tar.gz 重建数据目录和元数据库，校验所有文件摘要
+// 目标数据目录中不能已有 Volume 文件，目标数据库不能已有文件记录
+func RestoreSnapshot(cfg *config.Config, source string) (*SnapshotManifest, error) {
+	dir := source
+	if !isDir(source) {
+		tmp, err := os.MkdirTemp("", "haystack-restore-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+
+		if dir, err = unpackSnapshot(source, tmp); err != nil {
+			return nil, fmt.Errorf("failed to unpack snapshot: %w", err)
+		}
+	}
+
+	var manifest SnapshotManifest
+	if err := readJSONFile(filepath.Join(dir, snapshotManifestFile), &manifest); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+
+	dataDir := cfg.Storage.DataDir
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
+	if existing, _ := filepath.Glob(filepath.Join(dataDir, "volume_*.dat")); len(existing) > 0 {
+		return nil, fmt.Errorf("data dir %s is not empty", dataDir)
+	}
+	// 镜像在首次启动时从恢复的 Volume 完整复制，残留的旧镜像会被误认为有效数据
+	if mirrorDir := cfg.Storage.MirrorDir; mirrorDir != "" {
+		if existing, _ := filepath.Glob(filepath.Join(mirrorDir, "volume_*.dat")); len(existing) > 0 {
+			return nil, fmt.Errorf("mirror dir %s is not empty", mirrorDir)
+		}
+	}
+
+	// 先校验元数据，再逐个复制并校验 Volume
+	metadataPath := filepath.Join(dir, manifest.Metadata)
+	sum, err := fileSHA256(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	if sum != manifest.MetadataSHA256 {
+		return nil, fmt.Errorf("metadata checksum mismatch")
+	}
+
+	var dump MetadataDump
+	if err := readJSONFile(metadataPath, &dump); err != nil {
+		return nil, err
+	}
+
+	// 任一 Volume 校验失败时删除已复制的文件，数据目录保持为空
+	paths := make(map[uint32]string, len(manifest.Volumes))
+	restored := false
+	defer func() {
+		if !restored {
+			for _, path := range paths {
+				os.Remove(path)
+			}
+		}
+	}()
+
+	for _, vol := range manifest.Volumes {
+		dst := filepath.Join(dataDir, vol.File)
+		if err := restoreSnapshotVolume(filepath.Join(dir, vol.File), dst, vol); err != nil {
+			return nil, fmt.Errorf("failed to restore volume %d: %w", vol.ID, err)
+		}
+		paths[vol.ID] = dst
+	}
+
+	for i := range dump.Volumes {
+		info := &dump.Volumes[i]
+		path, exists := paths[info.ID]
+		if !exists {
+			return nil, fmt.Errorf("volume %d missing from snapshot", info.ID)
+		}
+		info.FilePath = path
+	}
+
+	db, err := OpenMetadataStore(cfg.Database.Type, cfg.GetDatabaseDSN())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if err := db.LoadMetadata(&dump); err != nil {
+		return nil, fmt.Errorf("failed to load metadata: %w", err)
+	}
+	restored = true
+
+	log.Printf("Snapshot %s restored to %s (%d volumes, %d files)", manifest.Name, dataDir, len(manifest.Volumes), len(dump.Files))
+	manifest.Path = source
+	return &manifest, nil
+}
+
+// restoreSnapshotVolume 复制 Volume 文件并校验长度和摘要
+func restoreSnapshotVolume(src, dst string, vol SnapshotVolume) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, hash), io.NewSectionReader(in, 0, vol.Size))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n != vol.Size {
+		err = fmt.Errorf("size mismatch: expected %d, got %d", vol.Size, n)
+	}
+	if err == nil && fmt.Sprintf("%x", hash.Sum(nil)) != vol.SHA256 {
+		err = fmt.Errorf("checksum mismatch")
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+// packSnapshot 将快照目录打包为同名 tar.gz
+func packSnapshot(dir string) (string, error) {
+	path := dir + ".tar.gz"
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if err := addTarFile(tw, filepath.Join(dir, entry.Name()), filepath.Join(filepath.Base(dir), entry.Name())); err != nil {
+			os.Remove(path)
+			return "", err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func addTarFile(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(stat, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// unpackSnapshot 解压 tar.gz 快照，返回快照目录
+func unpackSnapshot(path, dest string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	defer gz.Close()
+
+	root := ""
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// 只接受 快照目录/文件名 形式的条目
+		name := filepath.Clean(header.Name)
+		dir, file := filepath.Split(name)
+		dir = strings.TrimSuffix(dir, string(filepath.Separator))
+		if dir == "" || strings.Contains(dir, string(filepath.Separator)) || dir == ".." || file == "" {
+			return "", fmt.Errorf("unexpected entry in snapshot: %s", header.Name)
+		}
+		root = dir
+
+		if err := os.MkdirAll(filepath.Join(dest, dir), 0755); err != nil {
+			return "", err
+		}
+		out, err := os.Create(filepath.Join(dest, name))
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if root == "" {
+		return "", fmt.Errorf("empty snapshot archive")
+	}
+	return filepath.Join(dest, root), nil
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func isDir(path string) bool {
+	stat, err := os.Stat(path)
+	return err == nil && stat.IsDir()
+}
@@ -2,9 +2,11 @@ package storage
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,9 +18,28 @@ type Store struct {
 	config      *config.Config
 	volumes     map[uint32]*Volume
 	activeVolID uint32
-	nextID      uint64
-	db          *Database
+	maxVolID    uint32
+	partitions  map[int64]uint32 // 过期分区 -> 当前写入的 Volume
+	ids         *idAllocator
+	events      *EventBus
+	seq         uint64      // 最近分配的写入/删除序列号
+	pending     pendingSeqs // 已分配、元数据尚未提交的序列号
+	db          MetadataStore
 	mu          sync.RWMutex
+	compactMu   sync.Mutex   // 压缩与回收站恢复互斥
+	writeMu     sync.RWMutex // 写入持有读锁，快照和压缩持有写锁以暂停写入；需先于 compactMu 获取
+	attrMu      sync.Mutex   // 串行化元数据和标签的修改
+	expirer     expirer
+	webhooks    *webhookDispatcher
+	replication replicationState
+	antiEntropy antiEntropy
+	reconciler  reconciler
+	search      *searchIndexer // 全文索引，nil 表示未启用
+
+	mirrorCounters mirrorCounters
+
+	cache    Cache  // 热点对象缓存，nil 表示不缓存
+	cacheGen uint64 // 每次缓存失效加一，读取期间发生失效时不回填
 }
 
 func NewStore(cfg *config.Config) (*Store, error) {
@@ -28,24 +49,32 @@ func NewStore(cfg *config.Config) (*Store, error) {
 
 	// 连接数据库
 	dsn := cfg.GetDatabaseDSN()
-	db, err := NewDatabase(cfg.Database.Type, dsn)
+	db, err := OpenMetadataStore(cfg.Database.Type, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect database: %w", err)
 	}
 
 	s := &Store{
-		config:  cfg,
-		volumes: make(map[uint32]*Volume),
-		nextID:  1,
-		db:      db,
+		config:     cfg,
+		volumes:    make(map[uint32]*Volume),
+		partitions: make(map[int64]uint32),
+		events:     NewEventBus(cfg.Events.BufferSize),
+		db:         db,
 	}
+	s.replication.replicas = make(map[string]*ReplicaStatus)
+	s.replication.acked = make(chan struct{})
 
 	if err := s.loadFromDatabase(); err != nil {
 		return nil, err
 	}
 
-	if len(s.volumes) == 0 {
-		if _, err := s.createNewVolume(); err != nil {
+	// 集群模式下 Volume ID 从目录服务分配的起点开始，保证全局唯一
+	if base := cfg.Cluster.VolumeBase; base > s.maxVolID {
+		s.maxVolID = base
+	}
+
+	if s.activeVolID == 0 {
+		if _, err := s.createNewVolume(0); err != nil {
 			return nil, err
 		}
 	}
@@ -64,7 +93,7 @@ func (s *Store) loadFromDatabase() error {
 
 	maxID := uint32(0)
 	for _, info := range volumeInfos {
-		vol, err := NewVolume(info.ID, s.config.Storage.DataDir, s.config.Storage.MaxVolumeSize)
+		vol, err := s.openVolume(info.ID)
 		if err != nil {
 			log.Printf("Warning: failed to open volume %d: %v", info.ID, err)
 			continue
@@ -72,8 +101,21 @@ func (s *Store) loadFromDatabase() error {
 
 		vol.CurrentSize = info.CurrentSize
 		vol.Active = info.Active
+		vol.ExpiryBucket = info.ExpiryBucket
+		vol.MaxExpireTime = info.MaxExpireTime
 
 		s.volumes[info.ID] = vol
+		if info.ID > s.maxVolID {
+			s.maxVolID = info.ID
+		}
+
+		if info.ExpiryBucket != 0 {
+			if info.Active {
+				s.partitions[info.ExpiryBucket] = info.ID
+			}
+			continue
+		}
+
 		if info.Active && info.ID > maxID {
 			maxID = info.ID
 			s.activeVolID = info.ID
@@ -86,8 +128,11 @@ func (s *Store) loadFromDatabase() error {
 	}
 
 	activeMetas := 0
+	maxFileID := uint64(0)
 	for _, meta := range allMetas {
-		if vol, exists := s.volumes[meta.VolumeID]; exists {
+		// 去重产生的引用记录不拥有 Needle，只索引数据的拥有者
+		isOwner := meta.DataNeedleID() == meta.ID
+		if vol, exists := s.volumes[meta.VolumeID]; exists && isOwner {
 			vol.NeedleIndex[meta.ID] = &NeedleInfo{
 				Offset:   meta.Offset,
 				Size:     meta.Size,
@@ -100,33 +145,49 @@ func (s *Store) loadFromDatabase() error {
 			}
 		}
 
-		if meta.ID >= s.nextID {
-			s.nextID = meta.ID + 1
+		if meta.ID > maxFileID {
+			maxFileID = meta.ID
+		}
+		if meta.Seq > s.seq {
+			s.seq = meta.Seq
 		}
 	}
 
-	log.Printf("Loaded %d volumes and %d files (%d active, %d deleted) from database",
-		len(s.volumes), len(allMetas), activeMetas, len(allMetas)-activeMetas)
+	// 新的 ID 块从已租出的位置和已有文件的最大 ID 之后开始
+	if s.ids, err = newIDAllocator(s.db, s.config.Storage.IDBlockSize, maxFileID+1); err != nil {
+		return err
+	}
+
+	log.Printf("Loaded %d volumes and %d files (%d active, %d deleted) from database, next file id %d",
+		len(s.volumes), len(allMetas), activeMetas, len(allMetas)-activeMetas, s.ids.Peek())
 	return nil
 }
 
-func (s *Store) createNewVolume() (*Volume, error) {
+// createNewVolume 创建新的可写 Volume，expiryBucket 非 0 时创建对应过期分区的 Volume
+func (s *Store) createNewVolume(expiryBucket int64) (*Volume, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	newID := s.activeVolID + 1
-	vol, err := NewVolume(newID, s.config.Storage.DataDir, s.config.Storage.MaxVolumeSize)
+	newID := s.maxVolID + 1
+	vol, err := s.openVolume(newID)
 	if err != nil {
 		return nil, err
 	}
 
+	if expiryBucket != 0 {
+		vol.ExpiryBucket = expiryBucket
+		vol.MaxExpireTime = expiryBucket * s.partitionSpan()
+	}
+
 	// 保存到数据库
 	volumeInfo := &VolumeInfo{
-		ID:          newID,
-		FilePath:    vol.FilePath,
-		MaxSize:     vol.MaxSize,
-		CurrentSize: 0,
-		Active:      true,
+		ID:            newID,
+		FilePath:      vol.FilePath,
+		MaxSize:       vol.MaxSize,
+		CurrentSize:   0,
+		Active:        true,
+		ExpiryBucket:  vol.ExpiryBucket,
+		MaxExpireTime: vol.MaxExpireTime,
 	}
 	if err := s.db.SaveVolumeInfo(volumeInfo); err != nil {
 		vol.Close()
@@ -134,25 +195,150 @@ func (s *Store) createNewVolume() (*Volume, error) {
 	}
 
 	s.volumes[newID] = vol
-	s.activeVolID = newID
+	s.maxVolID = newID
+	if expiryBucket != 0 {
+		s.partitions[expiryBucket] = newID
+		log.Printf("Created new volume: %d (expiry partition %d)", newID, expiryBucket)
+	} else {
+		s.activeVolID = newID
+		log.Printf("Created new volume: %d", newID)
+	}
 
-	log.Printf("Created new volume: %d", newID)
 	return vol, nil
 }
 
+// writableVolume 返回写入目标 Volume，分区模式下带过期时间的文件写入对应分区
+func (s *Store) writableVolume(expiryBucket int64) (*Volume, error) {
+	s.mu.RLock()
+	volID := s.activeVolID
+	if expiryBucket != 0 {
+		volID = s.partitions[expiryBucket]
+	}
+	vol := s.volumes[volID]
+	s.mu.RUnlock()
+
+	if vol != nil {
+		return vol, nil
+	}
+	return s.createNewVolume(expiryBucket)
+}
+
 func (s *Store) Write(data []byte) (uint64, error) {
 	return s.WriteWithMetadata(data, "", "")
 }
 
+// WriteOptions 写入选项
+type WriteOptions struct {
+	FileName   string
+	MimeType   string
+	ExpireTime int64             // 过期时间（Unix 秒），0 表示永不过期
+	Tenant     string            // 上传者租户，用于配额统计
+	ID         uint64            // 由目录服务分配的文件 ID，0 表示本地分配
+	UserMeta   map[string]string // 用户自定义元数据
+	Tags       map[string]string
+}
+
 func (s *Store) WriteWithMetadata(data []byte, filename, mimeType string) (uint64, error) {
-	if s.config.Storage.ReadOnly {
-		return 0, ErrReadOnly
+	return s.WriteWithOptions(data, WriteOptions{FileName: filename, MimeType: mimeType})
+}
+
+func (s *Store) WriteWithOptions(data []byte, opts WriteOptions) (uint64, error) {
+	meta, err := s.writeWithOptions(data, opts, false)
+	if err != nil {
+		return 0, err
+	}
+	// 需在释放写锁后等待，快照要获取写锁
+	return meta.ID, s.waitForReplicas(meta.Seq)
+}
+
+// writeWithOptions 写入文件，versioned 时为按文件名寻址的新版本，同名文件存在时发布 overwritten 事件
+// 按 ID 寻址的上传（REST、批量、分片）只是恰好同名，不是覆盖
+func (s *Store) writeWithOptions(data []byte, opts WriteOptions, versioned bool) (*FileMetadata, error) {
+	if s.readOnly() {
+		return nil, ErrReadOnly
+	}
+	if err := validateWriteAttributes(&opts); err != nil {
+		return nil, err
+	}
+
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+
+	// 外部分配的 ID 不能重复写入
+	if opts.ID != 0 {
+		exists, err := s.db.FileExists(opts.ID)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, ErrFileExists
+		}
+	}
+
+	// 写入前预占配额
+	quotaIDs, err := s.chargeQuota(opts.FileName, opts.Tenant, int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	// 同名文件已存在时为覆盖写入
+	var previous *FileMetadata
+	if versioned && opts.FileName != "" {
+		// 最新版本是删除标记时对象已不存在，新版本算作创建
+		if previous, _ = s.db.FindByFilename(opts.FileName); previous != nil && previous.DeleteMarker {
+			previous = nil
+		}
+	}
+
+	meta, err := s.writeFile(data, opts)
+	if err != nil {
+		if len(quotaIDs) > 0 {
+			s.refundQuota(quotaIDs, int64(len(data)))
+		}
+		return nil, err
+	}
+
+	if previous != nil {
+		s.events.Publish(Event{
+			Type:       EventOverwritten,
+			FileID:     meta.ID,
+			FileName:   meta.FileName,
+			Size:       meta.Size,
+			MD5:        meta.MD5,
+			PreviousID: previous.ID,
+			VolumeID:   meta.VolumeID,
+		})
+	} else {
+		s.publishFile(EventCreated, meta)
 	}
+	return meta, nil
+}
 
-	id := atomic.AddUint64(&s.nextID, 1) - 1
+func (s *Store) writeFile(data []byte, opts WriteOptions) (*FileMetadata, error) {
+	id := opts.ID
+	if id == 0 {
+		var err error
+		if id, err = s.ids.Next(); err != nil {
+			return nil, err
+		}
+	} else if err := s.reserveID(id); err != nil {
+		return nil, err
+	}
 
-	// 计算 MD5
+	// 计算 MD5 和 SHA-256
 	md5Hash := fmt.Sprintf("%x", md5.Sum(data))
+	sha256Hash := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	// 内容去重：相同内容直接引用已有的 Needle
+	if s.config.Storage.Dedup {
+		if ref := s.findDuplicate(uint32(len(data)), md5Hash, sha256Hash); ref != nil {
+			meta, err := s.linkNeedle(id, ref, opts, md5Hash, sha256Hash)
+			if err == nil {
+				return meta, nil
+			}
+			log.Printf("Warning: failed to reuse needle %d, writing new copy: %v", ref.NeedleID, err)
+		}
+	}
 
 	needle := &Needle{
 		ID:         id,
@@ -161,65 +347,215 @@ func (s *Store) WriteWithMetadata(data []byte, filename, mimeType string) (uint6
 		DataSize:   uint32(len(data)),
 		Flags:      0,
 		CreateTime: time.Now().Unix(),
-		FileName:   filename,
-		MimeType:   mimeType,
+		FileName:   opts.FileName,
+		MimeType:   opts.MimeType,
 		MD5:        md5Hash,
 	}
 
-	s.mu.RLock()
-	vol := s.volumes[s.activeVolID]
-	volID := s.activeVolID
-	s.mu.RUnlock()
+	vol, offset, err := s.appendNeedle(needle, s.expiryBucket(opts.ExpireTime))
+	if err != nil {
+		return nil, err
+	}
+	volID := vol.ID
+
+	seq := s.nextSeq()
+	defer s.doneSeq(seq)
+	meta := &FileMetadata{
+		ID:         id,
+		NeedleID:   id,
+		VolumeID:   volID,
+		Offset:     offset,
+		Size:       needle.DataSize,
+		Cookie:     needle.Cookie,
+		Flags:      needle.Flags,
+		Deleted:    false,
+		FileName:   opts.FileName,
+		MimeType:   opts.MimeType,
+		Tenant:     opts.Tenant,
+		MD5:        md5Hash,
+		SHA256:     sha256Hash,
+		CreateTime: needle.CreateTime,
+		ExpireTime: opts.ExpireTime,
+		Seq:        seq,
+		UserMeta:   opts.UserMeta,
+		Tags:       opts.Tags,
+	}
+	ref := &NeedleRef{
+		NeedleID: id,
+		VolumeID: volID,
+		Size:     needle.DataSize,
+		MD5:      md5Hash,
+		SHA256:   sha256Hash,
+		RefCount: 1,
+	}
+	if err := s.db.SaveFileMetadataWithRef(meta, ref, offset+needle.Size()); err != nil {
+		// 回滚：数据已写入但没有元数据，打删除标记由压缩回收；ID 已租出，不会被再次分配
+		vol.DeleteNeedle(id)
+		return nil, fmt.Errorf("failed to save metadata: %w", err)
+	}
 
-	err := vol.WriteNeedle(needle)
+	return meta, nil
+}
+
+// appendNeedle 将 Needle 追加到可写 Volume，写满时切换到新 Volume，返回所在 Volume 和偏移
+func (s *Store) appendNeedle(needle *Needle, expiryBucket int64) (*Volume, int64, error) {
+	vol, err := s.writableVolume(expiryBucket)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = vol.WriteNeedle(needle)
 	if err == ErrVolumeFull {
 		// 设置当前 volume 为非活跃
-		s.db.SetVolumeInactive(volID)
+		s.db.SetVolumeInactive(vol.ID)
 
-		vol, err = s.createNewVolume()
+		vol, err = s.createNewVolume(expiryBucket)
 		if err != nil {
-			return 0, err
+			return nil, 0, err
 		}
-		volID = vol.ID
 		err = vol.WriteNeedle(needle)
 	}
 
 	if err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 
+	vol.mu.RLock()
+	offset := vol.NeedleIndex[needle.ID].Offset
+	vol.mu.RUnlock()
+	return vol, offset, nil
+}
+
+// reserveID 保证本地分配的 ID 大于外部分配的 id
+func (s *Store) reserveID(id uint64) error {
+	return s.ids.Reserve(id)
+}
+
+// pendingSeqs 已分配但元数据写入尚未结束的序列号
+type pendingSeqs struct {
+	mu   sync.Mutex
+	seqs map[uint64]struct{}
+}
+
+// nextSeq 分配新的写入/删除序列号，元数据写入结束（提交或失败）后需调用 doneSeq
+func (s *Store) nextSeq() uint64 {
+	s.pending.mu.Lock()
+	defer s.pending.mu.Unlock()
+
+	seq := atomic.AddUint64(&s.seq, 1)
+	if s.pending.seqs == nil {
+		s.pending.seqs = make(map[uint64]struct{})
+	}
+	s.pending.seqs[seq] = struct{}{}
+	return seq
+}
+
+// doneSeq 标记序列号对应的元数据写入已结束
+func (s *Store) doneSeq(seq uint64) {
+	s.pending.mu.Lock()
+	delete(s.pending.seqs, seq)
+	s.pending.mu.Unlock()
+}
+
+// committedSeq 返回最大的 n，使不大于 n 的序列号对应的写入都已结束，不需要暂停写入
+func (s *Store) committedSeq() uint64 {
+	s.pending.mu.Lock()
+	defer s.pending.mu.Unlock()
+
+	until := s.CurrentSeq()
+	for seq := range s.pending.seqs {
+		if seq <= until {
+			until = seq - 1
+		}
+	}
+	return until
+}
+
+// CurrentSeq 返回最近分配的序列号
+func (s *Store) CurrentSeq() uint64 {
+	return atomic.LoadUint64(&s.seq)
+}
+
+// findDuplicate 查找内容完全相同且仍被引用的 Needle
+func (s *Store) findDuplicate(size uint32, md5Hash, sha256Hash string) *NeedleRef {
+	refs, err := s.db.FindNeedleRefs(md5Hash, size)
+	if err != nil {
+		log.Printf("Warning: failed to look up duplicate needles: %v", err)
+		return nil
+	}
+
+	for i := range refs {
+		// 分区 Volume 会被整体删除，其中的 Needle 不能被其它文件引用
+		if s.isPartitionVolume(refs[i].VolumeID) {
+			continue
+		}
+		// MD5 存在碰撞可能，必须以 SHA-256 再次确认
+		if refs[i].SHA256 == sha256Hash {
+			return &refs[i]
+		}
+	}
+	return nil
+}
+
+// linkNeedle 创建一条指向已有 Needle 的文件元数据
+func (s *Store) linkNeedle(id uint64, ref *NeedleRef, opts WriteOptions, md5Hash, sha256Hash string) (*FileMetadata, error) {
+	s.mu.RLock()
+	vol, exists := s.volumes[ref.VolumeID]
+	s.mu.RUnlock()
+
+	if !exists {
+		return nil, ErrVolumeNotFound
+	}
+
+	vol.mu.RLock()
+	info, exists := vol.NeedleIndex[ref.NeedleID]
+	var offset int64
+	if exists {
+		offset = info.Offset
+		exists = info.Flags&0x01 == 0
+	}
+	vol.mu.RUnlock()
+
+	if !exists {
+		return nil, ErrNeedleNotFound
+	}
+
+	seq := s.nextSeq()
+	defer s.doneSeq(seq)
 	meta := &FileMetadata{
 		ID:         id,
-		VolumeID:   volID,
-		Offset:     vol.NeedleIndex[id].Offset,
-		Size:       needle.DataSize,
-		Cookie:     needle.Cookie,
-		Flags:      needle.Flags,
+		NeedleID:   ref.NeedleID,
+		VolumeID:   ref.VolumeID,
+		Offset:     offset,
+		Size:       ref.Size,
+		Cookie:     uint32(time.Now().Unix()),
 		Deleted:    false,
-		FileName:   filename,
-		MimeType:   mimeType,
+		FileName:   opts.FileName,
+		MimeType:   opts.MimeType,
+		Tenant:     opts.Tenant,
 		MD5:        md5Hash,
-		CreateTime: needle.CreateTime,
+		SHA256:     sha256Hash,
+		CreateTime: time.Now().Unix(),
+		ExpireTime: opts.ExpireTime,
+		Seq:        seq,
+		UserMeta:   opts.UserMeta,
+		Tags:       opts.Tags,
 	}
-	if err := s.db.SaveFileMetadata(meta); err != nil {
-		log.Printf("Warning: failed to save metadata to database: %v", err)
+	if err := s.db.AddNeedleRef(meta); err != nil {
+		return nil, err
 	}
-
-	// 更新 Volume 大小
-	s.db.UpdateVolumeSize(volID, vol.CurrentSize)
-
-	return id, nil
+	return meta, nil
 }
 
 func (s *Store) ReadWithMetadata(id uint64) ([]byte, *FileMetadata, error) {
-	// 从数据库获取元数据
-	meta, err := s.db.GetFileMetadata(id)
-	if err != nil {
+	// 获取元数据，缓存未命中时查询数据库
+	meta, err := s.cachedMetadata(id)
+	if err != nil || meta.DeleteMarker {
 		return nil, nil, ErrNeedleNotFound
 	}
 
 	// 读取文件数据
-	data, err := s.Read(id)
+	data, err := s.cachedNeedle(meta.DataNeedleID())
 	if err != nil {
 		return nil, nil, err
 	}
@@ -228,15 +564,20 @@ func (s *Store) ReadWithMetadata(id uint64) ([]byte, *FileMetadata, error) {
 }
 
 func (s *Store) GetMetadata(id uint64) (*FileMetadata, error) {
-	return s.db.GetFileMetadata(id)
+	return s.cachedMetadata(id)
 }
 
 func (s *Store) Read(id uint64) ([]byte, error) {
+	data, _, err := s.ReadWithMetadata(id)
+	return data, err
+}
+
+func (s *Store) readNeedle(needleID uint64) ([]byte, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	for _, vol := range s.volumes {
-		needle, err := vol.ReadNeedle(id)
+		needle, err := vol.ReadNeedle(needleID)
 		if err == nil {
 			return needle.Data, nil
 		}
@@ -246,24 +587,53 @@ func (s *Store) Read(id uint64) ([]byte, error) {
 }
 
 func (s *Store) Delete(id uint64) error {
-	if s.config.Storage.ReadOnly {
-		return ErrReadOnly
+	seq, err := s.deleteFile(id, EventDeleted)
+	if err != nil {
+		return err
+	}
+	return s.waitForReplicas(seq)
+}
+
+// deleteFile 删除文件并发布指定类型的事件，返回删除的序列号
+func (s *Store) deleteFile(id uint64, event EventType) (uint64, error) {
+	if s.readOnly() {
+		return 0, ErrReadOnly
 	}
 
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+
+	meta, err := s.db.GetFileMetadata(id)
+	if err != nil {
+		return 0, ErrNeedleNotFound
+	}
+
+	seq := s.nextSeq()
+	remaining, err := s.db.ReleaseFileMetadata(meta, seq)
+	s.doneSeq(seq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete metadata: %w", err)
+	}
+	s.releaseQuota(meta)
+	s.publishFile(event, meta)
+
+	// 仍有其它文件引用同一 Needle，不能打删除标记
+	if remaining > 0 {
+		s.invalidateCache(meta.ID, 0)
+		return seq, nil
+	}
+	s.invalidateCache(meta.ID, meta.DataNeedleID())
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	for _, vol := range s.volumes {
-		if err := vol.DeleteNeedle(id); err == nil {
-			// 更新数据库
-			if err := s.db.DeleteFileMetadata(id); err != nil {
-				log.Printf("Warning: failed to delete metadata from database: %v", err)
-			}
-			return nil
+	if vol, exists := s.volumes[meta.VolumeID]; exists {
+		if err := vol.DeleteNeedle(meta.DataNeedleID()); err != nil {
+			log.Printf("Warning: needle %d missing from volume %d: %v", meta.DataNeedleID(), meta.VolumeID, err)
 		}
 	}
 
-	return ErrNeedleNotFound
+	return seq, nil
 }
 
 func (s *Store) Status() map[string]interface{} {
@@ -276,7 +646,16 @@ func (s *Store) Status() map[string]interface{} {
 	}
 
 	stats["active_volume"] = s.activeVolID
-	stats["next_id"] = s.nextID
+	stats["next_id"] = s.ids.Peek()
+	if s.config.Storage.PartitionByExpiry {
+		partitions := s.ListPartitions()
+		stats["partition_span"] = s.partitionSpan()
+		stats["partition_count"] = len(partitions)
+		stats["partitions"] = partitions
+	}
+	if search := s.SearchStats(); search != nil {
+		stats["search"] = search
+	}
 	return stats
 }
 
@@ -307,7 +686,7 @@ func (s *Store) getMemoryStats() map[string]interface{} {
 		"total_size":    totalSize,
 		"volume_count":  len(s.volumes),
 		"active_volume": s.activeVolID,
-		"next_id":       s.nextID,
+		"next_id":       s.ids.Peek(),
 	}
 }
 
@@ -328,6 +707,11 @@ func (s *Store) ListAll() ([]*FileMetadata, error) {
 	return s.db.LoadAllFileMetadata()
 }
 
+// QueryFiles 按条件分页查询文件，过滤、排序和分页都在数据库中完成
+func (s *Store) QueryFiles(q FileQuery) (*FileQueryResult, error) {
+	return runFileQuery(q, s.db.QueryFiles, s.db.CountFiles)
+}
+
 func (s *Store) FindByFilename(filename string) (*FileMetadata, error) {
 	return s.db.FindByFilename(filename)
 }
@@ -346,9 +730,41 @@ func (s *Store) Close() error {
 		}
 	}
 
+	if s.search != nil {
+		if err := s.search.index.Close(); err != nil {
+			return err
+		}
+	}
+
 	if s.db != nil {
 		return s.db.Close()
 	}
 
 	return nil
 }
+
+// VolumeStat Volume 用量，用于向目录服务汇报
+type VolumeStat struct {
+	ID      uint32 `json:"id"`
+	Size    int64  `json:"size"`
+	MaxSize int64  `json:"max_size"`
+	Active  bool   `json:"active"`
+}
+
+// ListVolumes 列出所有 Volume 的用量，按 ID 排序
+func (s *Store) ListVolumes() []VolumeStat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := make([]VolumeStat, 0, len(s.volumes))
+	for _, vol := range s.volumes {
+		stats = append(stats, VolumeStat{
+			ID:      vol.ID,
+			Size:    vol.CurrentSize,
+			MaxSize: vol.MaxSize,
+			Active:  vol.ID == s.activeVolID,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+	return stats
+}
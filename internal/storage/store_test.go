@@ -0,0 +1,764 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"haystack-lite/internal/config"
+)
+
+// newTestConfig 返回数据目录和元数据库都在临时目录中的配置
+func newTestConfig(t *testing.T, dbType config.DatabaseType) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.Storage.DataDir = dir
+	cfg.Database.Type = dbType
+	cfg.Database.SQLite.Path = filepath.Join(dir, "haystack.db")
+	cfg.Database.Bolt.Path = filepath.Join(dir, "haystack.bolt")
+	return cfg
+}
+
+// newTestStore 在临时目录中创建使用指定元数据后端的 Store，测试结束时关闭
+func newTestStore(t *testing.T, dbType config.DatabaseType) *Store {
+	t.Helper()
+	return openTestStore(t, newTestConfig(t, dbType))
+}
+
+// openTestStore 按配置打开 Store，测试结束时关闭
+func openTestStore(t *testing.T, cfg *config.Config) *Store {
+	t.Helper()
+
+	s, err := NewStore(cfg)
+	if err != nil {
+		t.Fatalf("NewStore(%s): %v", cfg.Database.Type, err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// writeTestFile 写入文件，失败时终止测试
+func writeTestFile(t *testing.T, s *Store, name, data string) uint64 {
+	t.Helper()
+	id, err := s.WriteWithMetadata([]byte(data), name, "text/plain")
+	if err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return id
+}
+
+// checkFile 确认文件可读且内容一致
+func checkFile(t *testing.T, s *Store, id uint64, want string) {
+	t.Helper()
+	data, err := s.Read(id)
+	if err != nil || string(data) != want {
+		t.Errorf("Read(%d) = %q, %v, want %q", id, data, err, want)
+	}
+}
+
+// testDatabaseTypes 行为测试覆盖的元数据后端
+var testDatabaseTypes = []config.DatabaseType{config.DatabaseSQLite, config.DatabaseBolt}
+
+// eventTypes 返回 cursor 之后发布的事件类型
+func eventTypes(s *Store, cursor uint64) []EventType {
+	events, _ := s.events.Since(cursor, 100)
+	types := make([]EventType, 0, len(events))
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+// 只有按文件名寻址的写入才是覆盖，按 ID 寻址的同名上传互不影响
+func TestOverwriteOnlyForVersionedWrites(t *testing.T) {
+	for _, dbType := range testDatabaseTypes {
+		t.Run(string(dbType), func(t *testing.T) {
+			s := newTestStore(t, dbType)
+			s.config.Storage.KeepVersions = 0
+
+			cursor := s.events.Latest()
+			for _, data := range []string{"one", "two"} {
+				if _, err := s.WriteWithOptions([]byte(data), WriteOptions{FileName: "up/a.txt"}); err != nil {
+					t.Fatalf("WriteWithOptions: %v", err)
+				}
+			}
+			if got := eventTypes(s, cursor); !reflect.DeepEqual(got, []EventType{EventCreated, EventCreated}) {
+				t.Errorf("events of ID-addressed uploads = %v, want two created", got)
+			}
+			versions, _ := s.ListVersions("up/a.txt")
+			if len(versions) != 2 {
+				t.Errorf("ID-addressed uploads: %d files left, want 2", len(versions))
+			}
+
+			cursor = s.events.Latest()
+			for _, data := range []string{"one", "two"} {
+				if _, err := s.WriteVersion([]byte(data), WriteOptions{FileName: "s3/b.txt"}); err != nil {
+					t.Fatalf("WriteVersion: %v", err)
+				}
+			}
+			// 超出保留数的旧版本被清理
+			want := []EventType{EventCreated, EventOverwritten, EventDeleted}
+			if got := eventTypes(s, cursor); !reflect.DeepEqual(got, want) {
+				t.Errorf("events of versioned writes = %v, want %v", got, want)
+			}
+			versions, _ = s.ListVersions("s3/b.txt")
+			if len(versions) != 1 {
+				t.Errorf("versioned writes with keep_versions 0: %d versions left, want 1", len(versions))
+			}
+		})
+	}
+}
+
+// PUT、PUT、DELETE 之后按文件名读取不到对象，历史版本保留，删除标记被删除后恢复最新版本
+func TestDeleteMarker(t *testing.T) {
+	for _, dbType := range testDatabaseTypes {
+		t.Run(string(dbType), func(t *testing.T) {
+			s := newTestStore(t, dbType)
+			name := "bk//a.txt"
+			if _, err := s.WriteVersion([]byte("v1"), WriteOptions{FileName: name}); err != nil {
+				t.Fatal(err)
+			}
+			v2, err := s.WriteVersion([]byte("v2"), WriteOptions{FileName: name})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			marker, err := s.WriteDeleteMarker(name)
+			if err != nil {
+				t.Fatalf("WriteDeleteMarker: %v", err)
+			}
+			if _, err := s.WriteDeleteMarker(name); err != ErrNeedleNotFound {
+				t.Errorf("second WriteDeleteMarker = %v, want ErrNeedleNotFound", err)
+			}
+			latest, err := s.FindByFilename(name)
+			if err != nil || latest.ID != marker || !latest.DeleteMarker {
+				t.Fatalf("FindByFilename = %+v, %v, want delete marker %d", latest, err, marker)
+			}
+			if _, _, err := s.ReadWithMetadata(marker); err != ErrNeedleNotFound {
+				t.Errorf("ReadWithMetadata(marker) = %v, want ErrNeedleNotFound", err)
+			}
+			if versions, _ := s.ListVersions(name); len(versions) != 3 {
+				t.Errorf("ListVersions: %d, want 3", len(versions))
+			}
+
+			for _, sort := range []string{SortByName, SortByTime, SortBySize} {
+				result, err := s.QueryFiles(FileQuery{Sort: sort, CountTotal: true})
+				if err != nil {
+					t.Fatalf("QueryFiles(%s): %v", sort, err)
+				}
+				for _, meta := range result.Files {
+					if meta.DeleteMarker {
+						t.Errorf("QueryFiles(%s) returned delete marker %d", sort, meta.ID)
+					}
+				}
+				if result.Total != 2 {
+					t.Errorf("QueryFiles(%s).Total = %d, want 2", sort, result.Total)
+				}
+			}
+
+			if err := s.Delete(marker); err != nil {
+				t.Fatalf("Delete(marker): %v", err)
+			}
+			data, meta, err := s.ReadWithMetadata(v2)
+			if err != nil || string(data) != "v2" {
+				t.Fatalf("ReadWithMetadata(v2) = %q, %v", data, err)
+			}
+			if latest, _ := s.FindByFilename(name); latest.ID != meta.ID {
+				t.Errorf("latest after removing the delete marker = %d, want %d", latest.ID, v2)
+			}
+		})
+	}
+}
+
+// 压缩与写入、删除并发时，新写入的文件和删除都不会丢失
+func TestCompactionWithConcurrentWrites(t *testing.T) {
+	for _, dbType := range testDatabaseTypes {
+		t.Run(string(dbType), func(t *testing.T) {
+			s := newTestStore(t, dbType)
+			s.config.Trash.Retention = 0
+
+			// 写入方持续写入文件并删除临时文件，每轮压缩都有可回收的 Needle
+			// SQLite 不支持并发写事务，写入和删除在同一个 goroutine 中进行
+			written := make(map[uint64]string)
+			removed := make([]uint64, 0)
+			var rounds atomic.Int64
+			stop, done := make(chan struct{}), make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					data := fmt.Sprintf("file %d", i)
+					id, err := s.WriteWithMetadata([]byte(data), fmt.Sprintf("keep/%d", i), "text/plain")
+					if err != nil {
+						t.Errorf("write during compaction: %v", err)
+						return
+					}
+					written[id] = data
+					tmp, err := s.WriteWithMetadata([]byte("tmp "+data), fmt.Sprintf("tmp/%d", i), "text/plain")
+					if err != nil {
+						t.Errorf("write during compaction: %v", err)
+						return
+					}
+					if err := s.Delete(tmp); err != nil {
+						t.Errorf("delete during compaction: %v", err)
+						return
+					}
+					removed = append(removed, tmp)
+					rounds.Add(1)
+				}
+			}()
+
+			cfg := CompactionConfig{DeletedThreshold: 0.01}
+			for i := 0; i < 20 || rounds.Load() < 200; i++ {
+				if err := s.runCompaction(cfg); err != nil {
+					t.Fatalf("runCompaction: %v", err)
+				}
+				if t.Failed() {
+					break
+				}
+			}
+			close(stop)
+			<-done
+
+			// 再压缩一次，确认并发期间的写入和删除都已落在新文件中
+			if err := s.runCompaction(cfg); err != nil {
+				t.Fatalf("runCompaction: %v", err)
+			}
+			for id, want := range written {
+				if data, err := s.Read(id); err != nil || string(data) != want {
+					t.Fatalf("Read(%d) after compaction = %q, %v, want %q", id, data, err, want)
+				}
+			}
+			for _, id := range removed {
+				if _, err := s.readNeedle(id); err == nil {
+					t.Fatalf("needle %d deleted during compaction is still readable", id)
+				}
+			}
+		})
+	}
+}
+
+// 相同内容共享一个 Needle，删除其中一个文件不影响另一个，最后一个引用删除后数据才被标记删除
+func TestDedupRefCounts(t *testing.T) {
+	for _, dbType := range testDatabaseTypes {
+		t.Run(string(dbType), func(t *testing.T) {
+			s := newTestStore(t, dbType)
+			s.config.Storage.Dedup = true
+
+			first := writeTestFile(t, s, "a.txt", "same content")
+			second := writeTestFile(t, s, "b.txt", "same content")
+			other := writeTestFile(t, s, "c.txt", "other content")
+
+			meta, err := s.GetMetadata(second)
+			if err != nil || meta.DataNeedleID() != first {
+				t.Fatalf("second file needle = %+v, %v, want needle %d", meta, err, first)
+			}
+
+			steps := []struct {
+				delete   uint64
+				refCount int64 // 删除后共享 Needle 的引用数
+				readable []uint64
+			}{
+				{first, 1, []uint64{second, other}},
+				{second, 0, []uint64{other}},
+			}
+			for _, step := range steps {
+				if err := s.Delete(step.delete); err != nil {
+					t.Fatalf("Delete(%d): %v", step.delete, err)
+				}
+				refs, err := s.db.GetNeedleRefs([]uint64{first})
+				if err != nil || len(refs) != 1 || refs[0].RefCount != step.refCount {
+					t.Fatalf("after deleting %d: refs = %+v, %v, want ref count %d", step.delete, refs, err, step.refCount)
+				}
+				for _, id := range step.readable {
+					if _, err := s.Read(id); err != nil {
+						t.Errorf("after deleting %d: Read(%d) = %v", step.delete, id, err)
+					}
+				}
+			}
+
+			// 最后一个引用删除后 Needle 打删除标记，等待压缩回收
+			if _, err := s.readNeedle(first); err != ErrNeedleNotFound {
+				t.Errorf("shared needle after deleting all files: %v, want ErrNeedleNotFound", err)
+			}
+			checkFile(t, s, other, "other content")
+		})
+	}
+}
+
+// 保留期内删除的文件可以恢复，超过保留期不能恢复，压缩后数据被回收
+func TestTrashRestoreAndPurge(t *testing.T) {
+	for _, dbType := range testDatabaseTypes {
+		t.Run(string(dbType), func(t *testing.T) {
+			s := newTestStore(t, dbType)
+			id := writeTestFile(t, s, "a.txt", "trash me")
+			writeTestFile(t, s, "b.txt", "keep me")
+
+			if err := s.Delete(id); err != nil {
+				t.Fatal(err)
+			}
+			trash, total, err := s.ListTrash(0, 10)
+			if err != nil || total != 1 || len(trash) != 1 || trash[0].ID != id {
+				t.Fatalf("ListTrash = %v, %d, %v, want file %d", fileIDs(trash), total, err, id)
+			}
+			if err := s.Restore(id); err != nil {
+				t.Fatalf("Restore: %v", err)
+			}
+			checkFile(t, s, id, "trash me")
+			if err := s.Restore(id); err != ErrNeedleNotFound {
+				t.Errorf("second Restore = %v, want ErrNeedleNotFound", err)
+			}
+
+			// 保留期为 0 时删除立即超过保留期
+			s.config.Trash.Retention = 0
+			if err := s.Delete(id); err != nil {
+				t.Fatal(err)
+			}
+			if _, total, _ := s.ListTrash(0, 10); total != 0 {
+				t.Errorf("ListTrash after retention = %d files, want 0", total)
+			}
+			if err := s.Restore(id); err != ErrNeedleNotFound {
+				t.Errorf("Restore after retention = %v, want ErrNeedleNotFound", err)
+			}
+
+			if err := s.runCompaction(CompactionConfig{}); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, found := s.locateNeedle(id); found {
+				t.Errorf("needle %d still in volume after compaction", id)
+			}
+		})
+	}
+}
+
+// 超限的写入被拒绝；同时匹配多个配额时任一超限都不会计入其它配额
+func TestQuotaRejection(t *testing.T) {
+	for _, dbType := range testDatabaseTypes {
+		t.Run(string(dbType), func(t *testing.T) {
+			s := newTestStore(t, dbType)
+			bucket := &Quota{Scope: QuotaScopeBucket, Name: "photos", MaxBytes: 10, MaxObjects: 3}
+			tenant := &Quota{Scope: QuotaScopeTenant, Name: "t1", MaxObjects: 1}
+			for _, q := range []*Quota{bucket, tenant} {
+				if err := s.SetQuota(q); err != nil {
+					t.Fatalf("SetQuota: %v", err)
+				}
+			}
+
+			steps := []struct {
+				name, tenant string
+				size         int
+				err          error
+				bytes, objs  int64 // 写入后 bucket 配额的用量
+			}{
+				{"photos/a", "", 6, nil, 6, 1},
+				{"photos/b", "", 6, ErrQuotaExceeded, 6, 1},
+				{"photos/c", "t1", 4, nil, 10, 2},
+				{"other/d", "t1", 1, ErrQuotaExceeded, 10, 2},
+				// bucket 配额有余量，租户配额超限，整个预占回滚
+				{"photos/e", "t1", 0, ErrQuotaExceeded, 10, 2},
+			}
+			for _, step := range steps {
+				_, err := s.WriteWithOptions(make([]byte, step.size), WriteOptions{FileName: step.name, Tenant: step.tenant})
+				if err != step.err {
+					t.Fatalf("write %s: %v, want %v", step.name, err, step.err)
+				}
+				q, err := s.GetQuota(bucket.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if q.UsedBytes != step.bytes || q.UsedObjects != step.objs {
+					t.Fatalf("after %s: bucket usage %d bytes, %d objects, want %d, %d", step.name, q.UsedBytes, q.UsedObjects, step.bytes, step.objs)
+				}
+			}
+
+			// 删除后释放配额
+			found, err := s.FindByFilename("photos/a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Delete(found.ID); err != nil {
+				t.Fatal(err)
+			}
+			if q, _ := s.GetQuota(bucket.ID); q.UsedBytes != 4 || q.UsedObjects != 1 {
+				t.Errorf("after delete: bucket usage %d bytes, %d objects, want 4, 1", q.UsedBytes, q.UsedObjects)
+			}
+		})
+	}
+}
+
+// 快照恢复到新的数据目录后，文件、回收站、序列号、Webhook 和 ID 租用位置都与快照时一致
+func TestSnapshotRestore(t *testing.T) {
+	for _, dbType := range testDatabaseTypes {
+		t.Run(string(dbType), func(t *testing.T) {
+			s := newTestStore(t, dbType)
+			files := []struct {
+				name, data string
+				deleted    bool
+			}{
+				{"a.txt", "alpha", false},
+				{"b.txt", "beta", true},
+				{"c/d.txt", "delta", false},
+			}
+			ids := make([]uint64, len(files))
+			for i, f := range files {
+				ids[i] = writeTestFile(t, s, f.name, f.data)
+				if f.deleted {
+					if err := s.Delete(ids[i]); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			hook := &Webhook{URL: "http://127.0.0.1:1/hook", Enabled: true}
+			if err := s.SaveWebhook(hook); err != nil {
+				t.Fatal(err)
+			}
+			hook.Enabled = false
+			if err := s.SaveWebhook(hook); err != nil {
+				t.Fatal(err)
+			}
+			leased, err := s.LeaseIDs(100)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			manifest, err := s.Snapshot(t.TempDir(), true)
+			if err != nil {
+				t.Fatalf("Snapshot: %v", err)
+			}
+			// 快照之后的写入不在快照中
+			writeTestFile(t, s, "later.txt", "later")
+
+			cfg := newTestConfig(t, dbType)
+			if _, err := RestoreSnapshot(cfg, manifest.Path); err != nil {
+				t.Fatalf("RestoreSnapshot: %v", err)
+			}
+			restored := openTestStore(t, cfg)
+
+			for i, f := range files {
+				_, err := restored.Read(ids[i])
+				if f.deleted {
+					if err != ErrNeedleNotFound {
+						t.Errorf("Read(%s) = %v, want ErrNeedleNotFound", f.name, err)
+					}
+					continue
+				}
+				checkFile(t, restored, ids[i], f.data)
+			}
+			if _, err := restored.FindByFilename("later.txt"); err == nil {
+				t.Error("file written after the snapshot was restored")
+			}
+			if _, total, _ := restored.ListTrash(0, 10); total != 1 {
+				t.Errorf("restored trash has %d files, want 1", total)
+			}
+			if got := restored.CurrentSeq(); got != manifest.Seq {
+				t.Errorf("restored seq = %d, want %d", got, manifest.Seq)
+			}
+
+			hooks, err := restored.ListWebhooks()
+			if err != nil || len(hooks) != 1 || hooks[0].ID != hook.ID || hooks[0].Enabled {
+				t.Errorf("restored webhooks = %+v, %v, want disabled webhook %d", hooks, err, hook.ID)
+			}
+			if id := writeTestFile(t, restored, "new.txt", "new"); id >= leased.Start && id < leased.End {
+				t.Errorf("restored store allocated id %d from leased range [%d, %d)", id, leased.Start, leased.End)
+			}
+		})
+	}
+}
+
+// replicateTestChanges 将主节点 since 之后的变更经 tar.gz 应用到副本，返回本次截止的序列号
+func replicateTestChanges(t *testing.T, primary, replica *Store, since uint64) uint64 {
+	t.Helper()
+	cs, err := primary.Changes(since)
+	if err != nil {
+		t.Fatalf("Changes(%d): %v", since, err)
+	}
+	var buf bytes.Buffer
+	if err := primary.WriteChanges(&buf, cs); err != nil {
+		t.Fatalf("WriteChanges: %v", err)
+	}
+	if _, err := replica.ApplyChanges(&buf); err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	return cs.Until
+}
+
+// 每一轮增量同步后，副本按 ID 和文件名读取的结果与主节点一致，包括删除、去重和删除标记
+func TestReplication(t *testing.T) {
+	for _, dbType := range testDatabaseTypes {
+		t.Run(string(dbType), func(t *testing.T) {
+			primary := newTestStore(t, dbType)
+			replica := newTestStore(t, dbType)
+
+			ids := make(map[string]uint64)
+			write := func(name, data string) func(t *testing.T) {
+				return func(t *testing.T) { ids[name] = writeTestFile(t, primary, name, data) }
+			}
+			remove := func(name string) func(t *testing.T) {
+				return func(t *testing.T) {
+					if err := primary.Delete(ids[name]); err != nil {
+						t.Fatalf("Delete(%s): %v", name, err)
+					}
+				}
+			}
+			steps := []struct {
+				name string
+				do   func(t *testing.T)
+			}{
+				{"write", write("a.txt", "alpha")},
+				{"write another", write("b.txt", "beta")},
+				{"write duplicate", write("c.txt", "alpha")},
+				{"delete", remove("b.txt")},
+				{"delete one duplicate", remove("a.txt")},
+				{"restore from trash", func(t *testing.T) {
+					if err := primary.Restore(ids["b.txt"]); err != nil {
+						t.Fatalf("Restore: %v", err)
+					}
+				}},
+				{"write version", func(t *testing.T) {
+					id, err := primary.WriteVersion([]byte("v1"), WriteOptions{FileName: "s3/k"})
+					if err != nil {
+						t.Fatalf("WriteVersion: %v", err)
+					}
+					ids["s3/k"] = id
+				}},
+				{"delete marker", func(t *testing.T) {
+					if _, err := primary.WriteDeleteMarker("s3/k"); err != nil {
+						t.Fatalf("WriteDeleteMarker: %v", err)
+					}
+				}},
+			}
+
+			var since uint64
+			for _, step := range steps {
+				step.do(t)
+				since = replicateTestChanges(t, primary, replica, since)
+
+				if got := replica.CurrentSeq(); got != since {
+					t.Errorf("after %s: replica seq = %d, want %d", step.name, got, since)
+				}
+				for name, id := range ids {
+					want, wantErr := primary.Read(id)
+					got, err := replica.Read(id)
+					if (err == nil) != (wantErr == nil) || string(got) != string(want) {
+						t.Errorf("after %s: replica Read(%s) = %q, %v, primary = %q, %v",
+							step.name, name, got, err, want, wantErr)
+					}
+
+					wantMeta, wantErr := primary.FindByFilename(name)
+					meta, err := replica.FindByFilename(name)
+					if (err == nil) != (wantErr == nil) ||
+						(err == nil && (meta.ID != wantMeta.ID || meta.DeleteMarker != wantMeta.DeleteMarker)) {
+						t.Errorf("after %s: replica FindByFilename(%s) = %+v, %v, primary = %+v, %v",
+							step.name, name, meta, err, wantMeta, wantErr)
+					}
+				}
+			}
+
+			// 没有新变更时再同步一轮不改变副本
+			if until := replicateTestChanges(t, primary, replica, since); until != since {
+				t.Errorf("idle round until = %d, want %d", until, since)
+			}
+		})
+	}
+}
+
+// 主节点整体删除到期分区不产生变更，副本按相同的分区配置在本地删除
+func TestPartitionDropOnReplica(t *testing.T) {
+	for _, dbType := range testDatabaseTypes {
+		t.Run(string(dbType), func(t *testing.T) {
+			stores := make([]*Store, 2)
+			for i := range stores {
+				cfg := newTestConfig(t, dbType)
+				cfg.Storage.PartitionByExpiry = true
+				cfg.Storage.PartitionSpan = 3600
+				stores[i] = openTestStore(t, cfg)
+			}
+			primary, replica := stores[0], stores[1]
+
+			expiring, err := primary.WriteWithOptions([]byte("expiring"), WriteOptions{
+				FileName:   "tmp.txt",
+				ExpireTime: time.Now().Unix() + 60,
+			})
+			if err != nil {
+				t.Fatalf("write expiring file: %v", err)
+			}
+			kept := writeTestFile(t, primary, "kept.txt", "kept")
+			since := replicateTestChanges(t, primary, replica, 0)
+			checkFile(t, replica, expiring, "expiring")
+
+			later := time.Now().Unix() + 2*3600
+			if volumes, files := primary.dropExpiredPartitions(later); volumes != 1 || files != 1 {
+				t.Fatalf("primary dropped %d volumes, %d files, want 1 and 1", volumes, files)
+			}
+			cs, err := primary.Changes(since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cs.Files) != 0 {
+				t.Errorf("partition drop produced %d changes, want none", len(cs.Files))
+			}
+			replicateTestChanges(t, primary, replica, since)
+			checkFile(t, replica, expiring, "expiring")
+
+			if volumes, files := replica.dropExpiredPartitions(later); volumes != 1 || files != 1 {
+				t.Fatalf("replica dropped %d volumes, %d files, want 1 and 1", volumes, files)
+			}
+			for _, s := range stores {
+				if _, err := s.Read(expiring); err == nil {
+					t.Error("expired partition file still readable")
+				}
+				checkFile(t, s, kept, "kept")
+			}
+		})
+	}
+}
+
+// 重启后不会重新分配上次租用块中未用完的 ID、租给其它节点的区间和外部指定的 ID
+func TestIDAllocatorAfterRestart(t *testing.T) {
+	for _, dbType := range testDatabaseTypes {
+		t.Run(string(dbType), func(t *testing.T) {
+			cfg := newTestConfig(t, dbType)
+			cfg.Storage.IDBlockSize = 5
+
+			rounds := []struct {
+				name     string
+				writes   int
+				lease    uint64
+				explicit uint64 // 外部指定 ID 相对已用最大 ID 的偏移，0 表示不写入
+			}{
+				{"first start", 3, 4, 0},
+				{"restart", 7, 0, 20},
+				{"restart after explicit id", 2, 10, 0},
+				{"restart again", 1, 0, 0},
+			}
+
+			var used uint64 // 已分配或租出的最大 ID
+			for _, round := range rounds {
+				func() {
+					s, err := NewStore(cfg)
+					if err != nil {
+						t.Fatalf("%s: NewStore: %v", round.name, err)
+					}
+					defer s.Close()
+
+					for i := 0; i < round.writes; i++ {
+						id := writeTestFile(t, s, fmt.Sprintf("%s-%d.txt", round.name, i), round.name)
+						if id <= used {
+							t.Errorf("%s: allocated id %d, want above %d", round.name, id, used)
+						}
+						used = id
+					}
+					if round.lease > 0 {
+						leased, err := s.LeaseIDs(round.lease)
+						if err != nil {
+							t.Fatalf("%s: LeaseIDs: %v", round.name, err)
+						}
+						if leased.Start <= used || leased.End-leased.Start != round.lease {
+							t.Errorf("%s: leased [%d, %d), want %d ids above %d",
+								round.name, leased.Start, leased.End, round.lease, used)
+						}
+						used = leased.End - 1
+					}
+					if round.explicit > 0 {
+						id := used + round.explicit
+						if _, err := s.WriteWithOptions([]byte("x"), WriteOptions{ID: id}); err != nil {
+							t.Fatalf("%s: write explicit id %d: %v", round.name, id, err)
+						}
+						used = id
+					}
+				}()
+			}
+		})
+	}
+}
+
+// failingMetadataStore 在 fail 为 true 时保存文件元数据失败
+type failingMetadataStore struct {
+	MetadataStore
+	fail bool
+}
+
+var errTestMetadata = errors.New("metadata unavailable")
+
+func (d *failingMetadataStore) SaveFileMetadataWithRef(meta *FileMetadata, ref *NeedleRef, volumeSize int64) error {
+	if d.fail {
+		return errTestMetadata
+	}
+	return d.MetadataStore.SaveFileMetadataWithRef(meta, ref, volumeSize)
+}
+
+// 元数据保存失败时已追加的 Needle 打上删除标记、序列号结束，ID 不会被再次分配，数据由压缩回收
+func TestWriteRollbackOnMetadataFailure(t *testing.T) {
+	for _, dbType := range testDatabaseTypes {
+		t.Run(string(dbType), func(t *testing.T) {
+			s := newTestStore(t, dbType)
+			s.config.Trash.Retention = 0
+			db := &failingMetadataStore{MetadataStore: s.db}
+			s.db = db
+
+			steps := []struct {
+				name string
+				fail bool
+			}{
+				{"a.txt", false},
+				{"b.txt", true},
+				{"c.txt", false},
+			}
+			written := make(map[string]uint64)
+			var failed uint64
+			for _, step := range steps {
+				db.fail = step.fail
+				next := s.ids.Peek()
+				id, err := s.WriteWithMetadata([]byte(step.name), step.name, "text/plain")
+				if !step.fail {
+					if err != nil {
+						t.Fatalf("write %s: %v", step.name, err)
+					}
+					if id <= failed {
+						t.Errorf("write %s got id %d, want above failed id %d", step.name, id, failed)
+					}
+					written[step.name] = id
+					continue
+				}
+
+				if !errors.Is(err, errTestMetadata) {
+					t.Fatalf("write %s = %d, %v, want %v", step.name, id, err, errTestMetadata)
+				}
+				failed = next
+				if _, _, found := s.locateNeedle(failed); !found {
+					t.Fatalf("needle %d of the failed write was not appended", failed)
+				}
+				if _, err := s.readNeedle(failed); err == nil {
+					t.Errorf("needle %d of the failed write is readable", failed)
+				}
+				if committed, current := s.committedSeq(), s.CurrentSeq(); committed != current {
+					t.Errorf("committedSeq = %d, want %d after the failed write", committed, current)
+				}
+			}
+
+			if _, err := s.FindByFilename("b.txt"); err == nil {
+				t.Error("failed write left metadata behind")
+			}
+			if err := s.runCompaction(CompactionConfig{DeletedThreshold: 0.01}); err != nil {
+				t.Fatalf("runCompaction: %v", err)
+			}
+			if _, _, found := s.locateNeedle(failed); found {
+				t.Errorf("needle %d of the failed write survived compaction", failed)
+			}
+			for name, id := range written {
+				checkFile(t, s, id, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"time"
+)
+
+// trashCutoff 返回回收站保留期的起点，删除时间早于该时刻的文件可被压缩回收
+func (s *Store) trashCutoff() int64 {
+	return time.Now().Unix() - int64(s.config.Trash.Retention)
+}
+
+// ListTrash 分页列出回收站中仍可恢复的文件
+func (s *Store) ListTrash(offset, limit int) ([]*FileMetadata, int64, error) {
+	return s.db.ListTrash(s.trashCutoff(), offset, limit)
+}
+
+// TrashRetention 返回回收站保留时间（秒）
+func (s *Store) TrashRetention() int {
+	return s.config.Trash.Retention
+}
+
+// Restore 从回收站恢复文件
+// 文件不在回收站、已超过保留期或 Needle 已被压缩回收时返回 ErrNeedleNotFound
+func (s *Store) Restore(id uint64) error {
+	seq, err := s.restore(id)
+	if err != nil {
+		return err
+	}
+	return s.waitForReplicas(seq)
+}
+
+func (s *Store) restore(id uint64) (uint64, error) {
+	if s.readOnly() {
+		return 0, ErrReadOnly
+	}
+
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+
+	// 防止恢复过程中 Needle 被压缩回收，同时使并发的恢复串行执行
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	// 持锁后再读取，先完成的恢复已清除删除标记，后到的请求不会重复计入引用和配额
+	meta, err := s.db.GetDeletedFileMetadata(id)
+	if err != nil {
+		return 0, ErrNeedleNotFound
+	}
+	// 超过保留期的文件随时可能被压缩回收，不再允许恢复
+	if meta.DeleteTime <= s.trashCutoff() {
+		return 0, ErrNeedleNotFound
+	}
+
+	// 删除标记没有数据，只恢复记录
+	if meta.DeleteMarker {
+		seq := s.nextSeq()
+		err := s.db.RestoreFileMetadata(meta, seq)
+		s.doneSeq(seq)
+		return seq, err
+	}
+
+	s.mu.RLock()
+	vol, exists := s.volumes[meta.VolumeID]
+	s.mu.RUnlock()
+
+	if !exists {
+		return 0, ErrNeedleNotFound
+	}
+
+	needleID := meta.DataNeedleID()
+	vol.mu.RLock()
+	_, exists = vol.NeedleIndex[needleID]
+	vol.mu.RUnlock()
+
+	if !exists {
+		return 0, ErrNeedleNotFound
+	}
+
+	// 恢复的文件重新计入配额
+	quotaIDs, err := s.chargeQuota(meta.FileName, meta.Tenant, int64(meta.Size))
+	if err != nil {
+		return 0, err
+	}
+
+	seq := s.nextSeq()
+	err = s.db.RestoreFileMetadata(meta, seq)
+	s.doneSeq(seq)
+	if err != nil {
+		if len(quotaIDs) > 0 {
+			s.refundQuota(quotaIDs, int64(meta.Size))
+		}
+		return 0, err
+	}
+
+	if err := vol.UndeleteNeedle(needleID); err != nil {
+		return 0, err
+	}
+	s.invalidateCache(meta.ID, 0)
+
+	s.publishFile(EventCreated, meta)
+	return seq, nil
+}
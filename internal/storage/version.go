@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WriteVersion 以文件名为键写入新版本，并按 Bucket 配置清理多余的历史版本
+func (s *Store) WriteVersion(data []byte, opts WriteOptions) (uint64, error) {
+	meta, err := s.writeWithOptions(data, opts, true)
+	if err != nil {
+		return 0, err
+	}
+
+	s.pruneVersions(opts.FileName)
+	return meta.ID, s.waitForReplicas(meta.Seq)
+}
+
+// WriteDeleteMarker 为文件名写入删除标记作为最新版本，返回标记的版本 ID
+// 按文件名读取和列举时视为不存在，历史版本保留，删除标记本身即可恢复
+// 文件名没有版本或最新版本已是删除标记时不写入，返回 ErrNeedleNotFound
+func (s *Store) WriteDeleteMarker(filename string) (uint64, error) {
+	meta, err := s.writeDeleteMarker(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	s.pruneVersions(filename)
+	return meta.ID, s.waitForReplicas(meta.Seq)
+}
+
+func (s *Store) writeDeleteMarker(filename string) (*FileMetadata, error) {
+	if s.readOnly() {
+		return nil, ErrReadOnly
+	}
+
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+
+	latest, err := s.db.FindByFilename(filename)
+	if err != nil || latest.DeleteMarker {
+		return nil, ErrNeedleNotFound
+	}
+
+	id, err := s.ids.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	// 删除标记没有数据，不写 Needle，也不计入配额
+	seq := s.nextSeq()
+	meta := &FileMetadata{
+		ID:           id,
+		FileName:     filename,
+		Tenant:       latest.Tenant,
+		CreateTime:   time.Now().Unix(),
+		Seq:          seq,
+		DeleteMarker: true,
+	}
+	err = s.db.SaveFileMetadata(meta)
+	s.doneSeq(seq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save delete marker: %w", err)
+	}
+
+	s.publishFile(EventDeleted, latest)
+	return meta, nil
+}
+
+// ListVersions 列出文件名的所有版本，最新的在前
+func (s *Store) ListVersions(filename string) ([]*FileMetadata, error) {
+	return s.db.ListVersions(filename)
+}
+
+// VersionMarker 按前缀列举版本时的续传位置，即上一页最后一条的文件名和版本 ID
+// ID 为 0 时从下一个文件名开始；FileName 为空表示从头开始
+type VersionMarker struct {
+	FileName string
+	ID       uint64
+}
+
+// versionsAfter 返回同名版本（ID 降序）中排在续传位置之后的部分
+func (m VersionMarker) versionsAfter(ids []uint64) []uint64 {
+	for i, id := range ids {
+		if id < m.ID {
+			return ids[i:]
+		}
+	}
+	return nil
+}
+
+// ListVersionsByPrefix 按前缀列出 after 之后的所有版本
+func (s *Store) ListVersionsByPrefix(prefix string, after VersionMarker, limit int) ([]*FileMetadata, error) {
+	return s.db.ListVersionsByPrefix(prefix, after, limit)
+}
+
+// GetVersion 获取文件名的指定版本，版本 ID 即文件 ID
+func (s *Store) GetVersion(filename string, versionID uint64) (*FileMetadata, error) {
+	meta, err := s.db.GetFileMetadata(versionID)
+	if err != nil || meta.FileName != filename {
+		return nil, ErrNeedleNotFound
+	}
+	return meta, nil
+}
+
+// RestoreVersion 将历史版本恢复为最新版本，返回新版本 ID
+// 内容去重开启时不会复制数据
+func (s *Store) RestoreVersion(versionID uint64) (uint64, error) {
+	data, meta, err := s.ReadWithMetadata(versionID)
+	if err != nil {
+		return 0, err
+	}
+	return s.WriteVersion(data, WriteOptions{
+		FileName:   meta.FileName,
+		MimeType:   meta.MimeType,
+		ExpireTime: meta.ExpireTime,
+		Tenant:     meta.Tenant,
+		UserMeta:   meta.UserMeta,
+		Tags:       meta.Tags,
+	})
+}
+
+// DeleteAllVersions 删除文件名的所有版本
+// 全部删除后只等待一次副本确认，超时不会中断剩余版本的删除
+func (s *Store) DeleteAllVersions(filename string) (int, error) {
+	versions, err := s.db.ListVersions(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	var last uint64
+	for _, v := range versions {
+		seq, err := s.deleteFile(v.ID, EventDeleted)
+		if err != nil && err != ErrNeedleNotFound {
+			return deleted, err
+		}
+		if seq > last {
+			last = seq
+		}
+		deleted++
+	}
+	if last == 0 {
+		return deleted, nil
+	}
+	return deleted, s.waitForReplicas(last)
+}
+
+// GetBucketSettings 获取 Bucket 配置，未单独配置时返回全局默认值
+func (s *Store) GetBucketSettings(bucket string) (*BucketSettings, error) {
+	settings, err := s.db.GetBucketSettings(bucket)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &BucketSettings{
+			Name:         bucket,
+			KeepVersions: s.config.Storage.KeepVersions,
+		}, nil
+	}
+	return settings, err
+}
+
+// SetBucketSettings 保存 Bucket 配置
+func (s *Store) SetBucketSettings(settings *BucketSettings) error {
+	return s.db.SaveBucketSettings(settings)
+}
+
+// pruneVersions 删除超出保留数量的历史版本
+func (s *Store) pruneVersions(filename string) {
+	settings, err := s.GetBucketSettings(BucketOf(filename))
+	if err != nil {
+		log.Printf("Warning: failed to load bucket settings for %s: %v", filename, err)
+		return
+	}
+	if settings.KeepVersions < 0 {
+		return
+	}
+
+	versions, err := s.db.ListVersions(filename)
+	if err != nil {
+		log.Printf("Warning: failed to list versions of %s: %v", filename, err)
+		return
+	}
+
+	// 第一个是当前版本，不计入历史版本
+	keep := settings.KeepVersions + 1
+	if len(versions) <= keep {
+		return
+	}
+
+	for _, v := range versions[keep:] {
+		if err := s.Delete(v.ID); err != nil && err != ErrNeedleNotFound {
+			log.Printf("Warning: failed to prune version %d of %s: %v", v.ID, filename, err)
+		}
+	}
+}
+
+// BucketOf 返回文件名的第一级目录作为 Bucket 名，顶层文件返回空字符串
+func BucketOf(filename string) string {
+	bucket, _, found := strings.Cut(strings.TrimPrefix(filename, "/"), "/")
+	if !found {
+		return ""
+	}
+	return bucket
+}
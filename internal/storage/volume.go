@@ -2,6 +2,8 @@ package storage
 
 import (
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
@@ -15,7 +17,14 @@ type Volume struct {
 	CurrentSize int64
 	Active      bool
 	NeedleIndex map[uint64]*NeedleInfo
-	mu          sync.RWMutex
+	// 过期分区信息，见 VolumeInfo
+	ExpiryBucket  int64
+	MaxExpireTime int64
+	// 镜像副本，见 mirror.go
+	Mirror     *os.File
+	MirrorPath string
+	mirror     *mirrorState
+	mu         sync.RWMutex
 }
 
 func NewVolume(id uint32, dataDir string, maxSize int64) (*Volume, error) {
@@ -63,6 +72,7 @@ func (v *Volume) WriteNeedle(n *Needle) error {
 	if err := n.Write(v.File); err != nil {
 		return err
 	}
+	v.writeMirror(n, offset)
 
 	v.NeedleIndex[n.ID] = &NeedleInfo{
 		Offset:   offset,
@@ -88,14 +98,32 @@ func (v *Volume) ReadNeedle(id uint64) (*Needle, error) {
 		return nil, ErrNeedleNotFound
 	}
 
+	return v.readNeedleAt(id, info.Offset)
+}
+
+// readNeedleRaw 读取 Needle，忽略删除标记
+func (v *Volume) readNeedleRaw(id uint64) (*Needle, error) {
 	v.mu.RLock()
-	defer v.mu.RUnlock()
+	info, exists := v.NeedleIndex[id]
+	v.mu.RUnlock()
 
-	if _, err := v.File.Seek(info.Offset, 0); err != nil {
-		return nil, err
+	if !exists {
+		return nil, ErrNeedleNotFound
 	}
 
-	return ReadNeedleFrom(v.File)
+	return v.readNeedleAt(id, info.Offset)
+}
+
+func (v *Volume) readNeedleAt(id uint64, offset int64) (*Needle, error) {
+	if v.Mirror != nil {
+		return v.readMirrored(id, offset)
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	// 使用 ReadAt，避免并发读共享文件偏移
+	return ReadNeedleFrom(io.NewSectionReader(v.File, offset, v.CurrentSize-offset))
 }
 
 func (v *Volume) DeleteNeedle(id uint64) error {
@@ -111,6 +139,20 @@ func (v *Volume) DeleteNeedle(id uint64) error {
 	return nil
 }
 
+// UndeleteNeedle 清除 Needle 的删除标记
+func (v *Volume) UndeleteNeedle(id uint64) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	info, exists := v.NeedleIndex[id]
+	if !exists {
+		return ErrNeedleNotFound
+	}
+
+	info.Flags &^= 0x01
+	return nil
+}
+
 func (v *Volume) LoadIndex() error {
 	v.mu.Lock()
 	defer v.mu.Unlock()
@@ -143,11 +185,19 @@ func (v *Volume) LoadIndex() error {
 func (v *Volume) Sync() error {
 	v.mu.RLock()
 	defer v.mu.RUnlock()
+	if v.Mirror != nil && !v.mirror.degraded {
+		if err := v.Mirror.Sync(); err != nil {
+			log.Printf("Mirror of volume %d failed to sync: %v", v.ID, err)
+		}
+	}
 	return v.File.Sync()
 }
 
 func (v *Volume) Close() error {
 	v.mu.Lock()
 	defer v.mu.Unlock()
+	if v.Mirror != nil {
+		v.Mirror.Close()
+	}
 	return v.File.Close()
 }
@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 投递状态
+const (
+	DeliveryPending   = "pending"   // 等待投递或重试
+	DeliverySucceeded = "succeeded" // 接收方返回 2xx
+	DeliveryFailed    = "failed"    // 超过最大重试次数
+)
+
+// webhookBatchSize 每轮处理的事件数和投递数
+const webhookBatchSize = 100
+
+// WebhookConfig Webhook 投递配置
+type WebhookConfig struct {
+	Enabled        bool // 是否启用
+	MaxAttempts    int  // 最大尝试次数
+	InitialBackoff int  // 首次重试间隔（秒），之后每次翻倍
+	MaxBackoff     int  // 最大重试间隔（秒）
+	Timeout        int  // 单次请求超时（秒）
+	Workers        int  // 并发投递数
+}
+
+type webhookDispatcher struct {
+	cfg    WebhookConfig
+	client *http.Client
+	wake   chan struct{}
+}
+
+// ValidateWebhook 校验 Webhook 配置
+func ValidateWebhook(hook *Webhook) error {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url: %s", hook.URL)
+	}
+	for _, t := range hook.EventTypes() {
+		switch EventType(t) {
+		case EventCreated, EventOverwritten, EventDeleted, EventExpired, EventCompacted, EventMetadataUpdated:
+		default:
+			return fmt.Errorf("unknown event type: %s", t)
+		}
+	}
+	return nil
+}
+
+// EventTypes 返回订阅的事件类型，为空表示所有事件
+func (w *Webhook) EventTypes() []string {
+	if w.Events == "" {
+		return nil
+	}
+	types := make([]string, 0)
+	for _, t := range strings.Split(w.Events, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// Matches 判断事件是否需要投递到该 Webhook
+func (w *Webhook) Matches(e *Event) bool {
+	if !w.Enabled {
+		return false
+	}
+	if w.Bucket != "" && BucketOf(e.FileName) != w.Bucket {
+		return false
+	}
+	if w.Prefix != "" && !strings.HasPrefix(e.FileName, w.Prefix) {
+		return false
+	}
+
+	types := w.EventTypes()
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if EventType(t) == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// SignWebhook 计算投递签名：HMAC-SHA256(secret, timestamp + "." + body) 的十六进制
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ListWebhooks 列出所有 Webhook
+func (s *Store) ListWebhooks() ([]*Webhook, error) {
+	return s.db.ListWebhooks()
+}
+
+// GetWebhook 获取 Webhook
+func (s *Store) GetWebhook(id uint64) (*Webhook, error) {
+	return s.db.GetWebhook(id)
+}
+
+// SaveWebhook 新增或修改 Webhook
+func (s *Store) SaveWebhook(hook *Webhook) error {
+	if err := ValidateWebhook(hook); err != nil {
+		return err
+	}
+	return s.db.SaveWebhook(hook)
+}
+
+// DeleteWebhook 删除 Webhook 及其投递记录
+func (s *Store) DeleteWebhook(id uint64) error {
+	return s.db.DeleteWebhook(id)
+}
+
+// ListDeliveries 列出 Webhook 的投递记录
+func (s *Store) ListDeliveries(webhookID uint64, status string, limit int) ([]*WebhookDelivery, error) {
+	return s.db.ListDeliveries(webhookID, status, limit)
+}
+
+// Redeliver 以原投递记录的内容生成一条新的投递记录并立即投递，原记录保持不变
+func (s *Store) Redeliver(webhookID, deliveryID uint64) (*WebhookDelivery, error) {
+	original, err := s.db.GetDelivery(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if original.WebhookID != webhookID {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	delivery := &WebhookDelivery{
+		WebhookID:   original.WebhookID,
+		EventType:   original.EventType,
+		FileID:      original.FileID,
+		Payload:     original.Payload,
+		Status:      DeliveryPending,
+		NextAttempt: time.Now().Unix(),
+	}
+	if err := s.db.CreateDeliveries([]*WebhookDelivery{delivery}); err != nil {
+		return nil, err
+	}
+	s.wakeWebhooks()
+	return delivery, nil
+}
+
+// StartWebhooks 订阅事件总线并在后台投递 Webhook
+// 投递记录保存在数据库中，重启后未完成的投递会继续重试
+func (s *Store) StartWebhooks(cfg WebhookConfig) {
+	if !cfg.Enabled {
+		log.Println("Webhooks disabled")
+		return
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+
+	s.webhooks = &webhookDispatcher{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		wake:   make(chan struct{}, 1),
+	}
+
+	// 在返回前取得订阅位置，之后发布的事件都会被处理
+	go s.enqueueWebhooks(s.events.Latest())
+	go s.deliverWebhooks()
+
+	log.Printf("Webhooks started, max attempts: %d, workers: %d", cfg.MaxAttempts, cfg.Workers)
+}
+
+// wakeWebhooks 通知投递协程有新的待投递记录
+func (s *Store) wakeWebhooks() {
+	if s.webhooks == nil {
+		return
+	}
+	select {
+	case s.webhooks.wake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueueWebhooks 从事件总线的 cursor 之后读取事件，为匹配的 Webhook 生成投递记录
+func (s *Store) enqueueWebhooks(cursor uint64) {
+	for {
+		wait := s.events.Wait()
+		events, truncated := s.events.Since(cursor, webhookBatchSize)
+		if truncated {
+			log.Printf("Warning: webhook dispatcher fell behind, some events were dropped")
+		}
+		if len(events) == 0 {
+			if truncated {
+				cursor = s.events.Latest()
+			}
+			<-wait
+			continue
+		}
+
+		hooks, err := s.db.ListWebhooks()
+		if err != nil {
+			// 数据库暂时不可用时稍后重试同一批事件
+			log.Printf("Failed to load webhooks: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		now := time.Now().Unix()
+		deliveries := make([]*WebhookDelivery, 0)
+		for i := range events {
+			e := &events[i]
+			for _, hook := range hooks {
+				if !hook.Matches(e) {
+					continue
+				}
+				payload, _ := json.Marshal(e)
+				deliveries = append(deliveries, &WebhookDelivery{
+					WebhookID:   hook.ID,
+					EventType:   string(e.Type),
+					FileID:      e.FileID,
+					Payload:     string(payload),
+					Status:      DeliveryPending,
+					NextAttempt: now,
+				})
+			}
+		}
+
+		if err := s.db.CreateDeliveries(deliveries); err != nil {
+			log.Printf("Failed to save webhook deliveries: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		cursor = events[len(events)-1].Cursor
+		if len(deliveries) > 0 {
+			s.wakeWebhooks()
+		}
+	}
+}
+
+// deliverWebhooks 投递到期的记录，没有待投递记录时等待唤醒或定时检查重试
+func (s *Store) deliverWebhooks() {
+	d := s.webhooks
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		due, err := s.db.DueDeliveries(time.Now().Unix(), webhookBatchSize)
+		if err != nil {
+			log.Printf("Failed to load webhook deliveries: %v", err)
+		}
+
+		if len(due) > 0 {
+			s.deliverBatch(due)
+			if len(due) == webhookBatchSize {
+				continue
+			}
+		}
+
+		select {
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverBatch 并发投递一批记录
+func (s *Store) deliverBatch(deliveries []*WebhookDelivery) {
+	d := s.webhooks
+	hooks := make(map[uint64]*Webhook)
+
+	sem := make(chan struct{}, d.cfg.Workers)
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		hook, ok := hooks[delivery.WebhookID]
+		if !ok {
+			var err error
+			if hook, err = s.db.GetWebhook(delivery.WebhookID); err != nil {
+				hook = nil
+			}
+			hooks[delivery.WebhookID] = hook
+		}
+
+		if hook == nil {
+			// Webhook 已被删除
+			delivery.Status = DeliveryFailed
+			delivery.LastError = "webhook not found"
+			s.db.SaveDelivery(delivery)
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(hook *Webhook, delivery *WebhookDelivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			s.attemptDelivery(hook, delivery)
+		}(hook, delivery)
+	}
+	wg.Wait()
+}
+
+// attemptDelivery 发送一次投递并记录结果，失败时按指数退避安排下一次尝试
+func (s *Store) attemptDelivery(hook *Webhook, delivery *WebhookDelivery) {
+	cfg := s.webhooks.cfg
+	delivery.Attempts++
+
+	code, err := s.sendWebhook(hook, delivery)
+	delivery.ResponseCode = code
+	switch {
+	case err == nil:
+		delivery.Status = DeliverySucceeded
+		delivery.LastError = ""
+	case delivery.Attempts >= cfg.MaxAttempts:
+		delivery.Status = DeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttempt = time.Now().Unix() + webhookBackoff(cfg, delivery.Attempts)
+	}
+
+	if err := s.db.SaveDelivery(delivery); err != nil {
+		log.Printf("Failed to save webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// webhookBackoff 第 attempts 次失败后的等待秒数
+func webhookBackoff(cfg WebhookConfig, attempts int) int64 {
+	backoff := int64(cfg.InitialBackoff)
+	if backoff <= 0 {
+		backoff = 1
+	}
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if cfg.MaxBackoff > 0 && backoff >= int64(cfg.MaxBackoff) {
+			return int64(cfg.MaxBackoff)
+		}
+	}
+	return backoff
+}
+
+// sendWebhook 以 POST 发送投递内容，返回 HTTP 状态码
+func (s *Store) sendWebhook(hook *Webhook, delivery *WebhookDelivery) (int, error) {
+	body := []byte(fmt.Sprintf(`{"delivery_id":%d,"webhook_id":%d,"event":%s}`,
+		delivery.ID, hook.ID, delivery.Payload))
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "haystack-lite-webhook")
+	req.Header.Set("X-Haystack-Event", delivery.EventType)
+	req.Header.Set("X-Haystack-Delivery", strconv.FormatUint(delivery.ID, 10))
+	req.Header.Set("X-Haystack-Timestamp", strconv.FormatInt(timestamp, 10))
+	if hook.Secret != "" {
+		req.Header.Set("X-Haystack-Signature", "sha256="+SignWebhook(hook.Secret, timestamp, body))
+	}
+
+	resp, err := s.webhooks.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"haystack-lite/internal/config"
+)
+
+// webhookRequest 接收方收到的一次请求
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver 本地接收方，前 failures 次请求返回 500，之后返回 200
+func webhookReceiver(t *testing.T, failures int) (*httptest.Server, <-chan webhookRequest) {
+	t.Helper()
+
+	requests := make(chan webhookRequest, 16)
+	var count atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- webhookRequest{header: r.Header.Clone(), body: body}
+		if int(count.Add(1)) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func nextWebhookRequest(t *testing.T, requests <-chan webhookRequest) webhookRequest {
+	t.Helper()
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for webhook delivery")
+		return webhookRequest{}
+	}
+}
+
+// waitForDelivery 等待投递记录满足条件
+func waitForDelivery(t *testing.T, s *Store, hookID, deliveryID uint64, done func(*WebhookDelivery) bool) *WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		deliveries, err := s.ListDeliveries(hookID, "", 100)
+		if err != nil {
+			t.Fatalf("ListDeliveries: %v", err)
+		}
+		for _, d := range deliveries {
+			if d.ID == deliveryID && done(d) {
+				return d
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("delivery %d did not reach the expected state", deliveryID)
+	return nil
+}
+
+// checkSignature 按文档独立计算签名：HMAC-SHA256(secret, timestamp + "." + body)
+func checkSignature(t *testing.T, secret string, req webhookRequest) {
+	t.Helper()
+	timestamp := req.header.Get("X-Haystack-Timestamp")
+	if timestamp == "" {
+		t.Fatal("missing X-Haystack-Timestamp")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(req.body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := req.header.Get("X-Haystack-Signature"); got != want {
+		t.Fatalf("X-Haystack-Signature = %q, want %q", got, want)
+	}
+}
+
+func TestWebhookDeliveryRetryAndRedeliver(t *testing.T) {
+	const secret = "s3cret"
+
+	s := newTestStore(t, config.DatabaseSQLite)
+	srv, requests := webhookReceiver(t, 1)
+	s.StartWebhooks(WebhookConfig{
+		Enabled:        true,
+		MaxAttempts:    3,
+		InitialBackoff: 1,
+		MaxBackoff:     1,
+		Timeout:        5,
+		Workers:        1,
+	})
+
+	hook := &Webhook{URL: srv.URL, Secret: secret, Events: string(EventCreated), Enabled: true}
+	if err := s.SaveWebhook(hook); err != nil {
+		t.Fatalf("SaveWebhook: %v", err)
+	}
+
+	fileID, err := s.WriteWithOptions([]byte("hello"), WriteOptions{FileName: "docs/a.txt", MimeType: "text/plain"})
+	if err != nil {
+		t.Fatalf("WriteWithOptions: %v", err)
+	}
+
+	// 第一次投递返回 500
+	first := nextWebhookRequest(t, requests)
+	checkSignature(t, secret, first)
+	if got := first.header.Get("X-Haystack-Event"); got != string(EventCreated) {
+		t.Fatalf("X-Haystack-Event = %q, want %q", got, EventCreated)
+	}
+
+	var payload struct {
+		DeliveryID uint64 `json:"delivery_id"`
+		WebhookID  uint64 `json:"webhook_id"`
+		Event      Event  `json:"event"`
+	}
+	if err := json.Unmarshal(first.body, &payload); err != nil {
+		t.Fatalf("invalid payload %s: %v", first.body, err)
+	}
+	if payload.WebhookID != hook.ID || payload.Event.FileID != fileID || payload.Event.FileName != "docs/a.txt" {
+		t.Fatalf("unexpected payload: %s", first.body)
+	}
+	if got := first.header.Get("X-Haystack-Delivery"); got != strconv.FormatUint(payload.DeliveryID, 10) {
+		t.Fatalf("X-Haystack-Delivery = %q, want %d", got, payload.DeliveryID)
+	}
+
+	// 退避后重试，内容不变，时间戳和签名重新计算
+	retry := nextWebhookRequest(t, requests)
+	checkSignature(t, secret, retry)
+	if string(retry.body) != string(first.body) {
+		t.Fatalf("retry body = %s, want %s", retry.body, first.body)
+	}
+
+	delivered := waitForDelivery(t, s, hook.ID, payload.DeliveryID, func(d *WebhookDelivery) bool {
+		return d.Status == DeliverySucceeded
+	})
+	if delivered.Attempts != 2 || delivered.ResponseCode != http.StatusOK {
+		t.Fatalf("delivery attempts = %d, response = %d, want 2 and 200", delivered.Attempts, delivered.ResponseCode)
+	}
+
+	// 重新投递生成新的记录，原记录不变
+	redelivery, err := s.Redeliver(hook.ID, payload.DeliveryID)
+	if err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	if redelivery.ID == payload.DeliveryID {
+		t.Fatalf("redelivery reused delivery %d", redelivery.ID)
+	}
+
+	again := nextWebhookRequest(t, requests)
+	checkSignature(t, secret, again)
+	if got := again.header.Get("X-Haystack-Delivery"); got != strconv.FormatUint(redelivery.ID, 10) {
+		t.Fatalf("X-Haystack-Delivery = %q, want %d", got, redelivery.ID)
+	}
+	waitForDelivery(t, s, hook.ID, redelivery.ID, func(d *WebhookDelivery) bool {
+		return d.Status == DeliverySucceeded && d.Attempts == 1
+	})
+
+	deliveries, err := s.ListDeliveries(hook.ID, "", 100)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("got %d delivery records, want 2", len(deliveries))
+	}
+	for _, d := range deliveries {
+		if d.ID == payload.DeliveryID && (d.Status != DeliverySucceeded || d.Attempts != 2) {
+			t.Fatalf("original delivery changed: status %s, attempts %d", d.Status, d.Attempts)
+		}
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	cfg := WebhookConfig{InitialBackoff: 10, MaxBackoff: 60}
+	want := []int64{10, 20, 40, 60, 60}
+	for i, w := range want {
+		if got := webhookBackoff(cfg, i+1); got != w {
+			t.Errorf("webhookBackoff(%d) = %d, want %d", i+1, got, w)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"haystack-lite/internal/api"
+	"haystack-lite/internal/cluster"
 	"haystack-lite/internal/config"
 	"haystack-lite/internal/storage"
 
@@ -28,6 +29,29 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// 执行子命令
+	if flag.NArg() > 0 {
+		if err := runCommand(cfg, flag.Args()); err != nil {
+			log.Fatalf("%s: %v", flag.Arg(0), err)
+		}
+		return
+	}
+
+	// 目录服务不持有 Volume，只负责 ID 分配和节点管理
+	if cfg.Cluster.Role == config.RoleDirectory {
+		runDirectory(cfg)
+		return
+	}
+
+	// 存储节点先向目录服务注册，取得 Volume ID 区间
+	if cfg.Cluster.Role == config.RoleStore {
+		base, err := cluster.Register(cfg.Cluster)
+		if err != nil {
+			log.Fatalf("Failed to register store node: %v", err)
+		}
+		cfg.Cluster.VolumeBase = base
+	}
+
 	// 创建存储
 	store, err := storage.NewStore(cfg)
 	if err != nil {
@@ -37,6 +61,15 @@ func main() {
 
 	log.Printf("Storage initialized with %s: %s", cfg.Database.Type, cfg.Storage.DataDir)
 
+	// 热点对象缓存
+	if cfg.Cache.Enabled {
+		store.SetCache(storage.NewMemoryCache(storage.CacheConfig{
+			MetadataEntries: cfg.Cache.MetadataEntries,
+			BodyBytes:       cfg.Cache.BodyBytes,
+			MaxObjectSize:   cfg.Cache.MaxObjectSize,
+		}))
+	}
+
 	// 启动后台压缩
 	compactionCfg := storage.CompactionConfig{
 		Enabled:          cfg.Compaction.Enabled,
@@ -46,14 +79,87 @@ func main() {
 	}
 	store.StartCompaction(compactionCfg)
 
+	// 启动后台过期清理
+	store.StartExpiration(storage.ExpirationConfig{
+		Enabled:  cfg.Expiration.Enabled,
+		Interval: cfg.Expiration.Interval,
+	})
+
+	// 启动孤立数据检查
+	store.StartReconciler(storage.ReconcileConfig{
+		Enabled:  cfg.Reconcile.Enabled,
+		Interval: cfg.Reconcile.Interval,
+		Grace:    cfg.Reconcile.Grace,
+		Repair:   cfg.Reconcile.Repair,
+	})
+
+	// 启动全文索引
+	store.StartSearch(storage.SearchConfig{
+		Enabled:     cfg.Search.Enabled,
+		Path:        cfg.Search.Path,
+		MaxFileSize: cfg.Search.MaxFileSize,
+		Interval:    cfg.Search.Interval,
+		BatchSize:   cfg.Search.BatchSize,
+	})
+
+	// 启动 Webhook 投递
+	store.StartWebhooks(storage.WebhookConfig{
+		Enabled:        cfg.Webhook.Enabled,
+		MaxAttempts:    cfg.Webhook.MaxAttempts,
+		InitialBackoff: cfg.Webhook.InitialBackoff,
+		MaxBackoff:     cfg.Webhook.MaxBackoff,
+		Timeout:        cfg.Webhook.Timeout,
+		Workers:        cfg.Webhook.Workers,
+	})
+
+	// 启动复制
+	store.StartReplication()
+
+	// 启动反熵修复
+	store.StartAntiEntropy(storage.AntiEntropyConfig{
+		Enabled:  cfg.AntiEntropy.Enabled,
+		Interval: cfg.AntiEntropy.Interval,
+		Peer:     cfg.AntiEntropy.Peer,
+		Buckets:  cfg.AntiEntropy.Buckets,
+		DryRun:   cfg.AntiEntropy.DryRun,
+	})
+
 	r := gin.Default()
-	api.SetupRoutes(r, store)
+	if cfg.Cluster.Role == config.RoleStore {
+		cluster.StartHeartbeat(store, cfg.Cluster)
+		api.SetupStoreNodeRoutes(r, store)
+	} else {
+		api.SetupRoutes(r, store)
+	}
 
 	srv := startServer(r, cfg.Server.Port)
 
 	waitForShutdown(srv, store)
 }
 
+func runDirectory(cfg *config.Config) {
+	dir, err := cluster.NewDirectory(cfg.Cluster)
+	if err != nil {
+		log.Fatalf("Failed to create directory: %v", err)
+	}
+
+	r := gin.Default()
+	api.SetupDirectoryRoutes(r, dir)
+
+	srv := startServer(r, cfg.Server.Port)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+	log.Println("Directory exited")
+}
+
 func loadConfig(path string) (*config.Config, error) {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		log.Printf("Config file not found: %s, using default config", path)